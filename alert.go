@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarning
+	severityCritical
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityWarning:
+		return "warning"
+	case severityCritical:
+		return "critical"
+	default:
+		return "info"
+	}
+}
+
+func (s severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "info":
+		*s = severityInfo
+	case "warning":
+		*s = severityWarning
+	case "critical":
+		*s = severityCritical
+	default:
+		return fmt.Errorf("unknown severity %s", text)
+	}
+	return nil
+}
+
+// notification is a message for pushover and every configured backend
+type notification struct {
+	title    string
+	message  string
+	severity severity
+	findings []finding // the findings behind message, for backends that can format them
+}
+
+// alert notifies immediately, unless this is a non-critical alert raised during quiet hours, in which case it is queued for the next run outside quiet hours.
+func alert(app notifier, n notification) *pushover.Response {
+	logEvent(n.severity, n.title+": "+n.message, map[string]string{"HEARTBEAT_ALERT": n.title, "HEARTBEAT_SEVERITY": n.severity.String()})
+
+	now := time.Now()
+	if deferred(n.severity, now) {
+		// without the state there's nowhere to hold it, so it goes out now
+		s, err := loadState()
+		if err != nil {
+			log.Println("error opening state file for read: " + err.Error())
+			return notify(app, n)
+		}
+		if queueDeferred(&s, n, now) {
+			saveState(s)
+			log.Printf("quiet hours: deferred %s %q", n.severity, n.title)
+		} else {
+			log.Printf("quiet hours: %s %q is already deferred", n.severity, n.title)
+		}
+		return nil
+	}
+
+	return notify(app, n)
+}
+
+// queueDeferred holds n for the end of quiet hours, unless the same alert is already waiting, so a run every few minutes doesn't fill the morning message with copies of one warning
+func queueDeferred(s *state, n notification, now time.Time) bool {
+	if slices.ContainsFunc(s.Deferred, func(a deferredAlert) bool { return a.Title == n.title && a.Message == n.message }) {
+		return false
+	}
+	s.Deferred = append(s.Deferred, deferredAlert{Queued: now, Title: n.title, Message: n.message})
+	return true
+}
+
+// deferred is true if an alert of severity sev raised at now waits for the end of quiet hours
+func deferred(sev severity, now time.Time) bool {
+	return sev < severityCritical && inQuietHours(now)
+}
+
+func inQuietHours(t time.Time) bool {
+	switch {
+	case quietStart == quietEnd:
+		return false
+	case quietStart < quietEnd:
+		return t.Hour() >= quietStart && t.Hour() < quietEnd
+	default:
+		return t.Hour() >= quietStart || t.Hour() < quietEnd
+	}
+}
+
+// flushDeferred sends everything queued during quiet hours as a single message once quiet hours are over
+func flushDeferred(app notifier, now time.Time) {
+	if inQuietHours(now) {
+		return
+	}
+	s, err := loadState()
+	if err != nil || len(s.Deferred) == 0 {
+		return
+	}
+
+	// kept for the next run if nothing went out, eg muted by an alert or dropped by the rate limit
+	if _, sent := deliver(app, notification{title: "Overnight warnings", message: formatDeferred(s.Deferred), severity: severityWarning}); !sent {
+		return
+	}
+
+	if s, err = loadState(); err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return
+	}
+	s.Deferred = nil
+	saveState(s)
+}
+
+func formatDeferred(alerts []deferredAlert) string {
+	lines := make([]string, 0, len(alerts))
+	for _, a := range alerts {
+		lines = append(lines, fmt.Sprintf("%s %s: %s", a.Queued.Format("15:04"), a.Title, a.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// finding is a single problem discovered during a run
+type finding struct {
+	check    string
+	severity severity
+	message  string
+	detail   string   // raw command output behind the finding
+	errored  bool     // the check could not run, rather than finding a problem
+	disk     string   // the disk a SMART failure is about, as in smartDisks
+	merged   []string // other checks whose findings correlate merged into this one
+}
+
+// checks is every check behind f
+func (f finding) checks() []string {
+	return append([]string{f.check}, f.merged...)
+}
+
+// label names the check behind f for backends that format findings individually
+func (f finding) label() string {
+	if f.errored {
+		return f.check + " could not run"
+	}
+	return f.check
+}
+
+// digest collects every finding from a run so they can be sent as a single notification
+type digest struct {
+	findings []finding
+}
+
+func (d *digest) add(check string, sev severity, msg, detail string) {
+	d.findings = append(d.findings, finding{check: check, severity: sev, message: msg, detail: detail})
+}
+
+// addError adds a finding for each error joined in err, marking the ones that mean the check itself could not run
+func (d *digest) addError(check string, sev severity, err error, detail string) {
+	for _, e := range unjoin(err) {
+		f := finding{check: check, severity: sev, message: e.Error(), detail: detail, errored: errors.As(e, new(checkError))}
+		var se severityError
+		if errors.As(e, &se) {
+			f.severity = se.severity
+		}
+		var smart smartError
+		if errors.As(e, &smart) {
+			f.disk = smart.disk
+		}
+		d.findings = append(d.findings, f)
+		detail = "" // the output covers every error from this check
+	}
+}
+
+func (d *digest) severity() severity {
+	sev := severityInfo
+	for _, f := range d.findings {
+		if f.severity > sev {
+			sev = f.severity
+		}
+	}
+	return sev
+}
+
+// exitCode reports the most severe problem found, or exitError if the only findings are checks that couldn't run
+func (d *digest) exitCode() int {
+	var sev severity
+	var problems, errored bool
+	for _, f := range d.findings {
+		if f.errored {
+			errored = true
+		} else if !problems || f.severity > sev {
+			problems = true
+			sev = f.severity
+		}
+	}
+
+	switch {
+	case problems && sev == severityCritical:
+		return exitCritical
+	case problems:
+		return exitWarning
+	case errored:
+		return exitError
+	default:
+		return exitHealthy
+	}
+}
+
+// String lists findings from most to least severe
+func (d *digest) String() string {
+	var r alertReport
+	for sev := severityCritical; sev >= severityInfo; sev-- {
+		for _, f := range d.findings {
+			if f.severity == sev {
+				r.Findings = append(r.Findings, findingReport{Check: f.check, Severity: f.severity.String(), Message: f.message, Errored: f.errored})
+			}
+		}
+	}
+	return r.String()
+}
+
+func (d *digest) send(app notifier) *pushover.Response {
+	if len(d.findings) == 0 {
+		return nil
+	}
+
+	sev := d.severity()
+	title := "Health check warnings"
+	if sev == severityCritical {
+		title = "Health check failed!"
+	}
+	if !slices.ContainsFunc(d.findings, func(f finding) bool { return !f.errored }) {
+		title = "Health check could not run"
+	}
+	msg := d.String()
+	// a deferred alert is only queued if it isn't already, so it doesn't get a new paste every run, which would also make every copy look new
+	if !deferred(sev, time.Now()) {
+		if link := d.paste(); link != "" {
+			msg += "\nDetails: " + link
+		}
+	}
+	return alert(app, notification{title: title, message: msg, severity: sev, findings: d.findings})
+}
+
+// severityError overrides the severity of the check that returned it
+type severityError struct {
+	severity severity
+	err      error
+}
+
+func (e severityError) Error() string {
+	return e.err.Error()
+}
+
+func (e severityError) Unwrap() error {
+	return e.err
+}
+
+// unjoin splits an error created by errors.Join back into its parts
+func unjoin(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// paste uploads the raw output behind each finding, returning a link to it
+func (d *digest) paste() string {
+	if pasteURL == "" {
+		return ""
+	}
+
+	var sections []string
+	for _, f := range d.findings {
+		if f.detail != "" {
+			sections = append(sections, fmt.Sprintf("== [%s] %s\n%s", f.severity, f.message, f.detail))
+		}
+	}
+	if len(sections) == 0 {
+		return ""
+	}
+
+	link, err := paste(strings.Join(sections, "\n\n"))
+	if err != nil {
+		log.Println("unable to paste diagnostic output: " + err.Error())
+		return ""
+	}
+	return link
+}
+
+func paste(text string) (string, error) {
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(pasteURL, "text/plain; charset=utf-8", strings.NewReader(text))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_inQuietHours(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		hour  int
+		quiet bool
+	}{
+		{22, false},
+		{23, true},
+		{0, true},
+		{6, true},
+		{7, false},
+		{12, false},
+	}
+
+	for _, tt := range tests {
+		now := time.Date(2024, time.March, 31, tt.hour, 30, 0, 0, time.Local)
+		assert.Equal(t, tt.quiet, inQuietHours(now), "hour %d", tt.hour)
+	}
+}
+
+func Test_deferred(t *testing.T) {
+	t.Parallel()
+
+	night := time.Date(2024, time.March, 31, 23, 30, 0, 0, time.Local)
+	assert.True(t, deferred(severityWarning, night))
+	assert.False(t, deferred(severityCritical, night), "critical alerts always go out")
+	assert.False(t, deferred(severityWarning, night.Add(13*time.Hour)))
+}
+
+func Test_formatDeferred(t *testing.T) {
+	t.Parallel()
+
+	alerts := []deferredAlert{
+		{Queued: time.Date(2024, time.March, 31, 23, 5, 0, 0, time.Local), Title: "Internal Error", Message: "zfs list failed"},
+		{Queued: time.Date(2024, time.April, 1, 2, 15, 0, 0, time.Local), Title: "Health check failed!", Message: "Check logs"},
+	}
+	assert.Equal(t, "23:05 Internal Error: zfs list failed\n02:15 Health check failed!: Check logs", formatDeferred(alerts))
+}
+
+func Test_queueDeferred(t *testing.T) {
+	t.Parallel()
+
+	var s state
+	start := time.Date(2024, time.March, 31, 23, 0, 0, 0, time.Local)
+	n := notification{title: "Health check warnings", message: "[warning] pool scratch is 91% full", severity: severityWarning}
+	for i := 0; i < 48; i++ {
+		queueDeferred(&s, n, start.Add(time.Duration(i)*10*time.Minute))
+	}
+	assert.True(t, queueDeferred(&s, notification{title: n.title, message: "[warning] pool scratch is 92% full"}, start.Add(8*time.Hour)))
+	assert.Equal(t, []deferredAlert{
+		{Queued: start, Title: n.title, Message: n.message},
+		{Queued: start.Add(8 * time.Hour), Title: n.title, Message: "[warning] pool scratch is 92% full"},
+	}, s.Deferred)
+}
+
+func Test_rateLimited(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.Local)
+	assert.False(t, rateLimited(state{}, now, severityWarning))
+
+	warned := state{LastUpdated: now.Add(-time.Hour), LastSeverity: severityWarning}
+	assert.True(t, rateLimited(warned, now, severityWarning))
+	assert.True(t, rateLimited(warned, now, severityInfo))
+	assert.False(t, rateLimited(warned, now, severityCritical), "a critical alert isn't muted by a warning")
+
+	paged := state{LastUpdated: now.Add(-time.Hour), LastSeverity: severityCritical}
+	assert.True(t, rateLimited(paged, now, severityCritical))
+	assert.False(t, rateLimited(paged, now.Add(23*time.Hour), severityCritical))
+}
+
+func Test_digest(t *testing.T) {
+	t.Parallel()
+
+	var d digest
+	assert.Equal(t, severityInfo, d.severity())
+
+	d.add("smart selftest", severityWarning, "smart error: disk sdb: Completed: read failure", "")
+	d.add("pool status", severityCritical, "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors", "")
+	d.add("disk usage", severityWarning, "zfs list failed", "")
+
+	assert.Equal(t, severityCritical, d.severity())
+	assert.Equal(t, "[critical] pool primarySafe - DEGRADED (0|0|0): errors: No known data errors\n[warning] smart error: disk sdb: Completed: read failure\n[warning] zfs list failed", d.String())
+}
+
+func Test_digestAddError(t *testing.T) {
+	t.Parallel()
+
+	var d digest
+	d.addError("smart selftest", severityWarning, errors.Join(
+		errors.New("smart error: disk sdb: Completed: read failure"),
+		checkError{errors.New("disk sdc: exit status 2")},
+	), "$ /sbin/smartctl")
+
+	require.Len(t, d.findings, 2)
+	assert.False(t, d.findings[0].errored)
+	assert.Equal(t, "$ /sbin/smartctl", d.findings[0].detail)
+	assert.True(t, d.findings[1].errored)
+	assert.Empty(t, d.findings[1].detail)
+	assert.Equal(t, "[warning] smart error: disk sdb: Completed: read failure\n[warning] smart selftest could not run: disk sdc: exit status 2", d.String())
+}
+
+func Test_digestExitCode(t *testing.T) {
+	t.Parallel()
+
+	var d digest
+	assert.Equal(t, exitHealthy, d.exitCode())
+
+	d.addError("disk usage", severityWarning, checkError{errors.New("exit status 1")}, "")
+	assert.Equal(t, exitError, d.exitCode())
+
+	d.add("smart selftest", severityWarning, "smart error: disk sdb: Completed: read failure", "")
+	assert.Equal(t, exitWarning, d.exitCode())
+
+	d.add("pool status", severityCritical, "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors", "")
+	assert.Equal(t, exitCritical, d.exitCode())
+}
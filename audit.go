@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errReadOnly is returned for a command readOnly mode refused to run
+var errReadOnly = errors.New("refused in read only mode")
+
+// readOnlyCommands are the commands other than the sudo helper's that readOnly mode allows, which only probe the network
+var readOnlyCommands = []string{"ping", "rpcinfo"}
+
+// readOnlyAllowed is true if cmd with args can't change anything: one of the sudo helper's read only commands (so not zpool clear, smartctl -t, or badblocks), or a network probe
+func readOnlyAllowed(cmd string, args []string) bool {
+	for _, allowed := range readOnlyCommands {
+		if cmd == allowed {
+			return true
+		}
+	}
+	if cmd == "/sbin/zpool" && len(args) > 0 && args[0] == "clear" {
+		return false
+	}
+	return helperAllowed(cmd, args)
+}
+
+// checkReadOnly refuses cmd if readOnly is set and it could change something, recording the refusal in the audit log
+func checkReadOnly(cmd string, args []string) error {
+	if !readOnly || readOnlyAllowed(cmd, args) {
+		return nil
+	}
+	err := fmt.Errorf("%s %s: %w", cmd, strings.Join(args, " "), errReadOnly)
+	audit(cmd, args, time.Now(), err)
+	return err
+}
+
+// auditEntry is a line of the audit log
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	Command  string    `json:"command"`
+	Args     []string  `json:"args"`
+	Duration float64   `json:"duration_seconds"`
+	ExitCode int       `json:"exit_code"`          // -1 if it didn't run or was killed
+	Error    string    `json:"error,omitempty"`    // why it failed, eg refused in read only mode
+	User     int       `json:"uid"`                // the user it ran as, before any sudo
+	Instance string    `json:"instance,omitempty"` // see useInstance
+}
+
+var auditMu sync.Mutex
+
+// audit appends a command that ran (or was refused) at start to auditLogPath, as a line of JSON. The command is as run, after any sudo or ssh rewriting.
+func audit(cmd string, args []string, start time.Time, err error) {
+	if auditLogPath == "" {
+		return
+	}
+
+	entry := auditEntry{Time: start, Command: cmd, Args: args, Duration: time.Since(start).Seconds(), User: os.Geteuid(), Instance: instanceName}
+	var ce *commandError
+	switch {
+	case errors.As(err, &ce):
+		entry.ExitCode = ce.exitCode
+		entry.Error = strings.TrimSpace(ce.stderr)
+	case err != nil:
+		entry.ExitCode = -1
+		entry.Error = err.Error()
+	}
+	data, _ := json.Marshal(entry)
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	f, err := os.OpenFile(auditLogPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		log.Println("error opening audit log: " + err.Error())
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Println("error writing audit log: " + err.Error())
+	}
+}
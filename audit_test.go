@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readOnlyAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cmd  string
+		args []string
+		want bool
+	}{
+		{"/sbin/zpool", []string{"status", "-t"}, true},
+		{"/sbin/zpool", []string{"status", "-c", "upath"}, false},
+		{"/sbin/zpool", []string{"clear", "tank"}, false},
+		{"/sbin/zpool", []string{"clear", "tank", "sdb"}, false},
+		{"/sbin/zpool", []string{"scrub", "tank"}, false},
+		{"zfs", []string{"list", "-H", "-o", "name"}, true},
+		{"zfs", []string{"destroy", "tank/data"}, false},
+		{"/sbin/smartctl", []string{"-a", "/dev/sda"}, true},
+		{"/sbin/smartctl", []string{"-t", "long", "/dev/sda"}, false},
+		{"badblocks", []string{"-wsv", "/dev/sda"}, false},
+		{"ping", []string{"-c", "3", "nas"}, true},
+		{"rpcinfo", []string{"-t", "nas", "nfs"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cmd+" "+strings.Join(tt.args, " "), func(t *testing.T) {
+			assert.Equal(t, tt.want, readOnlyAllowed(tt.cmd, tt.args))
+		})
+	}
+}
+
+func Test_audit(t *testing.T) {
+	auditLogPath = filepath.Join(t.TempDir(), "audit.log")
+	defer func() { auditLogPath = "" }()
+
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	audit("/sbin/zpool", []string{"status"}, start, nil)
+	audit("smartctl", []string{"-a", "/dev/sda"}, start, &commandError{cmd: "smartctl", stderr: "open failed\n", exitCode: 2})
+
+	data, err := os.ReadFile(auditLogPath)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var entries [2]auditEntry
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &entries[i]))
+	}
+	assert.Equal(t, "/sbin/zpool", entries[0].Command)
+	assert.Equal(t, []string{"status"}, entries[0].Args)
+	assert.True(t, start.Equal(entries[0].Time))
+	assert.Zero(t, entries[0].ExitCode)
+	assert.Empty(t, entries[0].Error)
+	assert.Equal(t, 2, entries[1].ExitCode)
+	assert.Equal(t, "open failed", entries[1].Error)
+}
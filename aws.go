@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const imdsEndpoint = "http://169.254.169.254"
+
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// loadAWSCredentials follows the standard credential chain: environment, shared credentials file, then the EC2 instance role
+func loadAWSCredentials() (awsCredentials, error) {
+	if c := (awsCredentials{os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}); c.accessKey != "" && c.secretKey != "" {
+		return c, nil
+	}
+
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	if f, err := os.Open(path); err == nil {
+		c, err := parseAWSCredentialsFile(f, profile)
+		f.Close()
+		if err == nil {
+			return c, nil
+		}
+	}
+
+	return instanceRoleCredentials()
+}
+
+func parseAWSCredentialsFile(r io.Reader, profile string) (awsCredentials, error) {
+	var c awsCredentials
+	var section string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			c.accessKey = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			c.secretKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			c.sessionToken = strings.TrimSpace(value)
+		}
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return c, fmt.Errorf("no credentials for profile %s", profile)
+	}
+	return c, nil
+}
+
+// instanceRoleCredentials fetches temporary credentials from the instance metadata service (IMDSv2)
+func instanceRoleCredentials() (awsCredentials, error) {
+	client := http.Client{Timeout: 2 * time.Second}
+	req, _ := http.NewRequest(http.MethodPut, imdsEndpoint+"/latest/api/token", nil)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, errors.New("no aws credentials found in the environment, shared credentials file, or instance metadata")
+	}
+	token, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	get := func(path string) ([]byte, error) {
+		req, _ := http.NewRequest(http.MethodGet, imdsEndpoint+path, nil)
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("instance metadata %s: %s", path, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+
+	role, err := get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	data, err := get("/latest/meta-data/iam/security-credentials/" + strings.TrimSpace(strings.Split(string(role), "\n")[0]))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	var creds struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+	}
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return awsCredentials{}, err
+	}
+	return awsCredentials{creds.AccessKeyID, creds.SecretAccessKey, creds.Token}, nil
+}
+
+// signAWS adds a signature version 4 Authorization header to req
+func signAWS(req *http.Request, body []byte, c awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+	if req.Header.Get("Host") == "" {
+		req.Header.Set("Host", req.URL.Host)
+	}
+
+	headers := make([]string, 0, len(req.Header))
+	for k := range req.Header {
+		headers = append(headers, strings.ToLower(k))
+	}
+	sort.Strings(headers)
+	var canonicalHeaders strings.Builder
+	for _, h := range headers {
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(req.Header.Get(h)) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{req.Method, path, strings.Join(params, "&"), canonicalHeaders.String(), signedHeaders, sha256Hex(body)}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.accessKey, scope, signedHeaders, signature))
+	req.Header.Del("Host") // net/http sets this from req.Host
+}
+
+// awsQuery calls an AWS query API (eg SNS Publish) with form encoded params
+func awsQuery(region, service string, params url.Values) error {
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return err
+	}
+
+	host := fmt.Sprintf("%s.%s.amazonaws.com", service, region)
+	if service == "ses" {
+		host = fmt.Sprintf("email.%s.amazonaws.com", region)
+	}
+	body := []byte(params.Encode())
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", strings.NewReader(string(body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWS(req, body, creds, region, service, time.Now())
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("%s %s: %s: %s", service, params.Get("Action"), resp.Status, data)
+	}
+	return nil
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sns publishes notifications to a topic
+type sns struct {
+	topicARN string
+}
+
+func (s sns) name() string {
+	return "sns"
+}
+
+func (s sns) send(n notification) error {
+	// arn:aws:sns:<region>:<account>:<topic>
+	parts := strings.Split(s.topicARN, ":")
+	if len(parts) != 6 {
+		return fmt.Errorf("invalid topic arn %s", s.topicARN)
+	}
+	return awsQuery(parts[3], "sns", url.Values{
+		"Action":   {"Publish"},
+		"Version":  {"2010-03-31"},
+		"TopicArn": {s.topicARN},
+		"Subject":  {truncate(fmt.Sprintf("[%s] %s", n.severity, n.title), 100)},
+		"Message":  {n.message},
+	})
+}
+
+// ses emails notifications
+type ses struct {
+	region string
+	from   string
+	to     []string
+}
+
+func (s ses) name() string {
+	return "ses"
+}
+
+func (s ses) send(n notification) error {
+	params := url.Values{
+		"Action":                 {"SendEmail"},
+		"Version":                {"2010-12-01"},
+		"Source":                 {s.from},
+		"Message.Subject.Data":   {fmt.Sprintf("[%s] %s", n.severity, n.title)},
+		"Message.Body.Text.Data": {n.message},
+	}
+	for i, to := range s.to {
+		params.Set(fmt.Sprintf("Destination.ToAddresses.member.%d", i+1), to)
+	}
+	return awsQuery(s.region, "ses", params)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_signAWS(t *testing.T) {
+	t.Parallel()
+
+	// the worked example from the AWS signature version 4 documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := awsCredentials{accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWS(req, nil, creds, "us-east-1", "iam", time.Date(2015, time.August, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+}
+
+func Test_parseAWSCredentialsFile(t *testing.T) {
+	t.Parallel()
+
+	file := `[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = secret1
+
+[nas]
+aws_access_key_id=AKIDNAS
+aws_secret_access_key=secret2
+aws_session_token=token2
+`
+	c, err := parseAWSCredentialsFile(strings.NewReader(file), "nas")
+	require.NoError(t, err)
+	assert.Equal(t, awsCredentials{"AKIDNAS", "secret2", "token2"}, c)
+
+	_, err = parseAWSCredentialsFile(strings.NewReader(file), "missing")
+	assert.Error(t, err)
+}
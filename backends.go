@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+// backend is a notification service messages are sent to alongside pushover
+type backend interface {
+	name() string
+	send(n notification) error
+}
+
+func enabledBackends() []backend {
+	var backends []backend
+	if discordWebhook != "" {
+		backends = append(backends, discord{webhook: discordWebhook})
+	}
+	if slackWebhook != "" || slackToken != "" {
+		backends = append(backends, slack{webhook: slackWebhook, token: slackToken, channel: slackChannel})
+	}
+	if matrixHomeserver != "" {
+		backends = append(backends, matrix{homeserver: matrixHomeserver, token: matrixToken, room: matrixRoom})
+	}
+	if snsTopicARN != "" {
+		backends = append(backends, sns{topicARN: snsTopicARN})
+	}
+	if sesFrom != "" {
+		backends = append(backends, ses{region: sesRegion, from: sesFrom, to: sesTo})
+	}
+	backends = append(backends, parseNotifyURLs(notifyURLs)...)
+	groups := make([]string, 0, len(notifyGroups))
+	for group := range notifyGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	for _, group := range groups {
+		for _, b := range parseNotifyURLs(notifyGroups[group]) {
+			backends = append(backends, groupBackend{group: group, backend: b})
+		}
+	}
+	return backends
+}
+
+// parseNotifyURLs turns each notification URL into a backend, skipping invalid ones
+func parseNotifyURLs(urls []string) []backend {
+	var backends []backend
+	for _, raw := range urls {
+		b, err := parseNotifyURL(raw)
+		if err != nil {
+			log.Println("invalid notify url: " + err.Error())
+			continue
+		}
+		backends = append(backends, b)
+	}
+	return backends
+}
+
+// groupBackend sends a recipient group's version of each notification, see notifyGroups
+type groupBackend struct {
+	group string
+	backend
+}
+
+func (g groupBackend) name() string {
+	return g.group + " " + g.backend.name()
+}
+
+func (g groupBackend) send(n notification) error {
+	msg := newGroupReport(n).render(g.group)
+	if msg == "" {
+		return nil // nothing this group needs to hear about
+	}
+	return g.backend.send(notification{title: n.title, message: msg, severity: n.severity})
+}
+
+// pushoverBackend sends to pushover accounts other than the primary one configured by token and user
+type pushoverBackend struct {
+	token string
+	user  string
+}
+
+func (p pushoverBackend) name() string {
+	return "pushover"
+}
+
+func (p pushoverBackend) send(n notification) error {
+	text, _ := fitMessage(n.message, pushover.MessageMaxLength)
+	message := pushoverMessage(text, pushoverFormat)
+	message.Title = n.title
+	_, err := pushover.New(p.token).SendMessage(message, pushover.NewRecipient(p.user))
+	return err
+}
+
+// backendNotification is a notification on its way to a backend
+type backendNotification struct {
+	backend backend
+	n       notification
+}
+
+// sendBackends sends each notification, returning how many went out
+func sendBackends(outgoing []backendNotification) int {
+	var sent int
+	for _, o := range outgoing {
+		if err := o.backend.send(o.n); err != nil {
+			log.Printf("error sending to %s: %s", o.backend.name(), err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+// postJSON posts v to url, returning an error for any non-2xx response
+func postJSON(url string, v any, headers map[string]string) ([]byte, error) {
+	return requestJSON(http.MethodPost, url, v, headers)
+}
+
+func requestJSON(method, url string, v any, headers map[string]string) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return body, fmt.Errorf("%s: %s", resp.Status, body)
+	}
+	return body, nil
+}
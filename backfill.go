@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// importMaxSize skips files too big to be a saved smartctl or zpool status, eg a tarball in the same directory
+const importMaxSize = 16 << 20
+
+var smartctlTimeRe = regexp.MustCompile(`(?m)^Local Time is:\s+(.+?)\s*$`)
+
+// backfill counts what import found
+type backfill struct {
+	smart, scrubs, skipped int
+	disks                  map[string]bool
+}
+
+// smartctlTime reads when smartctl -i ran from its output. The time zone abbreviation is only trusted if it's this machine's, which is close enough for daily samples.
+func smartctlTime(out string) (time.Time, bool) {
+	m := smartctlTimeRe.FindStringSubmatch(out)
+	if m == nil {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006 MST", m[1], time.Local)
+	return t, err == nil
+}
+
+// addHealthSample puts sample in history in time order, replacing any other sample from the same day
+func addHealthSample(history []healthSample, sample healthSample) []healthSample {
+	day := func(t time.Time) string { return t.Format(time.DateOnly) }
+	i := slices.IndexFunc(history, func(h healthSample) bool { return day(h.At) == day(sample.At) })
+	if i >= 0 {
+		history[i] = sample
+	} else {
+		history = append(history, sample)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].At.Before(history[j].At) })
+	return history
+}
+
+// importSmart records a saved smartctl -i -A output from at in s: when the drive was first seen, and its health score if it's recent enough to be part of the trend
+func importSmart(s *state, out string, at, now time.Time) (serial string, err error) {
+	d := parseDrive(out)
+	if d.Serial == "" {
+		return "", errors.New("no serial number")
+	}
+	if t, ok := smartctlTime(out); ok {
+		at = t
+	}
+
+	if s.Drives == nil {
+		s.Drives = make(map[string]driveRecord)
+	}
+	r, ok := s.Drives[d.Serial]
+	if !ok || at.Before(r.FirstSeen) {
+		r.FirstSeen = at
+	}
+	if !ok || at.After(r.LastSeen) {
+		r.Model, r.PowerOnHours, r.LastSeen = d.Model, d.PowerOnHours, at
+	}
+	s.Drives[d.Serial] = r
+
+	if now.Sub(at) <= healthWindow {
+		score := scoreDrive(out, float64(max(d.Temperature, 0)))
+		if s.Health == nil {
+			s.Health = make(map[string][]healthSample)
+		}
+		s.Health[d.Serial] = addHealthSample(s.Health[d.Serial], healthSample{At: at, Score: score.Total, Temperature: d.Temperature})
+	}
+	return d.Serial, nil
+}
+
+// importScrubs records the completed scrubs in a saved zpool status in s, returning how many were new.
+// Scrub speed needs the pool's used space at the time, which zpool status doesn't show, so used (by pool) is today's instead.
+func importScrubs(s *state, out string, used map[string]uint64) (int, error) {
+	pools, err := parsePools(out)
+	if err != nil {
+		return 0, err
+	}
+	if s.Scrubs == nil {
+		s.Scrubs = make(map[string][]scrubRecord)
+	}
+
+	var added int
+	for _, p := range pools {
+		at, ok := p.LastScrub()
+		took, tookOK := p.ScrubDuration()
+		bytes, usedOK := used[p.name]
+		if !ok || !tookOK || !usedOK || took < time.Minute {
+			continue
+		}
+		history := s.Scrubs[p.name]
+		if slices.ContainsFunc(history, func(r scrubRecord) bool { return r.At.Equal(at) }) {
+			continue
+		}
+		history = append(history, scrubRecord{At: at, Rate: float64(bytes) / took.Seconds()})
+		sort.Slice(history, func(i, j int) bool { return history[i].At.Before(history[j].At) })
+		if len(history) > scrubHistory {
+			history = history[len(history)-scrubHistory:]
+		}
+		s.Scrubs[p.name] = history
+		added++
+	}
+	return added, nil
+}
+
+// importOutput records a saved smartctl or zpool status output from at (when the file was written) in s
+func importOutput(s *state, b *backfill, out string, at time.Time, used map[string]uint64, now time.Time) error {
+	switch {
+	case strings.Contains(out, "=== START OF INFORMATION SECTION ==="):
+		serial, err := importSmart(s, out, at, now)
+		if err != nil {
+			return err
+		}
+		b.smart++
+		b.disks[serial] = true
+	case strings.Contains(out, "  pool: ") && strings.Contains(out, " state: "):
+		added, err := importScrubs(s, out, used)
+		if err != nil {
+			return err
+		}
+		b.scrubs += added
+	default:
+		b.skipped++
+	}
+	return nil
+}
+
+// importHistory is the import command: it reads every saved smartctl -i -A and zpool status output under dir into the state, so the health score and scrub speed checks start with a baseline.
+// usage is the zfs list of used space, for the scrub speeds.
+func importHistory(w io.Writer, s *state, dir string, usage func() (map[string]space, error), now time.Time) error {
+	used := make(map[string]uint64)
+	if all, err := usage(); err != nil {
+		log.Println("error reading pool usage, scrubs won't be imported: " + err.Error())
+	} else {
+		for name, sp := range all {
+			if !strings.Contains(name, "/") {
+				used[name] = sp.used
+			}
+		}
+	}
+
+	b := backfill{disks: make(map[string]bool)}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > importMaxSize {
+			b.skipped++
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := importOutput(s, &b, string(data), info.ModTime(), used, now); err != nil {
+			log.Printf("skipping %s: %s", path, err)
+			b.skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "imported %d smartctl outputs for %d disks and %d scrubs, skipped %d files\n", b.smart, len(b.disks), b.scrubs, b.skipped)
+	return nil
+}
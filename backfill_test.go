@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_smartctlTime(t *testing.T) {
+	t.Parallel()
+
+	info, err := os.ReadFile("testFiles/smartInfo.txt")
+	require.NoError(t, err)
+	at, ok := smartctlTime(string(info))
+	require.True(t, ok)
+	assert.Equal(t, "2024-03-31 18:40:12", at.Format(time.DateTime))
+
+	_, ok = smartctlTime("smartctl 7.3 2022-02-28 r5338")
+	assert.False(t, ok)
+}
+
+func Test_importHistory(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	copyFixture := func(fixture, name string, modified time.Time) {
+		data, err := os.ReadFile(filepath.Join("testFiles", fixture))
+		require.NoError(t, err)
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+		require.NoError(t, os.Chtimes(path, modified, modified))
+	}
+	copyFixture("smartInfo.txt", "2024-03-31/sda.txt", time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC))
+	copyFixture("zpoolSample.txt", "2018-03-26/zpool.txt", time.Date(2018, 3, 26, 12, 0, 0, 0, time.UTC))
+	copyFixture("zfsList.txt", "2018-03-26/zfs.txt", time.Date(2018, 3, 26, 12, 0, 0, 0, time.UTC))
+
+	now := time.Date(2024, 4, 15, 12, 0, 0, 0, time.UTC)
+	s := state{
+		Drives: map[string]driveRecord{"WD-WX31D87HJ4KL": {Model: "WDC WD60EFRX-68L0BN1", Device: "sda", PowerOnHours: 30000, FirstSeen: now.AddDate(0, 0, -1), LastSeen: now}},
+		Scrubs: map[string][]scrubRecord{"primarySafe": {{At: time.Date(2018, 3, 26, 11, 12, 9, 0, time.UTC), Rate: 1}}},
+	}
+	usage := func() (map[string]space, error) {
+		return map[string]space{"primarySafe": {used: 40347975680}, "primarySafe/home": {used: 1}, "freenas-boot": {used: 1 << 30}}, nil
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, importHistory(&out, &s, dir, usage, now))
+	assert.Equal(t, "imported 1 smartctl outputs for 1 disks and 1 scrubs, skipped 1 files\n", out.String())
+
+	r := s.Drives["WD-WX31D87HJ4KL"]
+	assert.Equal(t, time.Date(2024, 3, 31, 18, 40, 12, 0, time.UTC), r.FirstSeen.UTC())
+	assert.Equal(t, 30000, r.PowerOnHours, "an older output doesn't replace what the last run saw")
+	require.Len(t, s.Health["WD-WX31D87HJ4KL"], 1)
+	assert.Equal(t, 36, s.Health["WD-WX31D87HJ4KL"][0].Temperature)
+
+	// primarySafe's scrub was already recorded, so only freenas-boot's is new
+	assert.Len(t, s.Scrubs["primarySafe"], 1)
+	require.Len(t, s.Scrubs["freenas-boot"], 1)
+	assert.InDelta(t, float64(1<<30)/407, s.Scrubs["freenas-boot"][0].Rate, 1)
+}
+
+func Test_addHealthSample(t *testing.T) {
+	t.Parallel()
+
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, time.UTC) }
+	history := []healthSample{{At: day(1, 12), Score: 1}, {At: day(3, 12), Score: 3}}
+	history = addHealthSample(history, healthSample{At: day(2, 12), Score: 2})
+	history = addHealthSample(history, healthSample{At: day(3, 18), Score: 4})
+	assert.Equal(t, []healthSample{{At: day(1, 12), Score: 1}, {At: day(2, 12), Score: 2}, {At: day(3, 18), Score: 4}}, history)
+}
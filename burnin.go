@@ -0,0 +1,240 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// the stages of a burn-in, in order
+var burnInStages = []string{"short self-test", "badblocks", "long self-test"}
+
+// burnIn is a new disk being tested before it's trusted with pool data. Finished stages are recorded so a burn-in interrupted by a reboot picks up where it left off.
+type burnIn struct {
+	Device   string
+	Serial   string
+	Started  time.Time
+	Write    bool     // badblocks writes test patterns, destroying any data on the disk
+	Before   float64  // health score before the burn-in
+	Done     []string // finished stages
+	Result   string   // pass/fail summary, once finished
+	Finished time.Time
+}
+
+// wholeDisk is the disk a device path is on, with any partition removed, eg /dev/sdb1 is on /dev/sdb
+func wholeDisk(path string) string {
+	return filepath.Join(filepath.Dir(path), diskDevice(path))
+}
+
+// resolveDevice follows a by-id, by-partuuid, or gptid link to the device it names
+func resolveDevice(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// burnInUse refuses to burn in a device that's part of a pool or mounted. Pools are read with zpool status -L -P, so members named by a partition or a by-id, by-partuuid, or gptid link are matched by the disk they're on.
+func burnInUse(e executer, device string) error {
+	disk := wholeDisk(resolveDevice(device))
+
+	pools, err := readDevicePools(e)
+	if err != nil {
+		return err
+	}
+	for _, p := range pools {
+		var member bool
+		p.Walk(func(v vdev, d vdevDisk) bool {
+			member = wholeDisk(d.name) == disk
+			return !member
+		})
+		if member {
+			return fmt.Errorf("%s is in pool %s", device, p.name)
+		}
+	}
+
+	mounts, _ := os.ReadFile("/proc/mounts")
+	for _, m := range parseMounts(string(mounts)) {
+		if strings.HasPrefix(m.source, "/dev/") && wholeDisk(resolveDevice(m.source)) == disk {
+			return fmt.Errorf("%s is mounted at %s", device, m.point)
+		}
+	}
+	return nil
+}
+
+// sameDisk refuses to resume b on a device that's now a different disk, eg after a reboot renamed them
+func (b burnIn) sameDisk(e executer) error {
+	if b.Serial == "" {
+		return nil
+	}
+	out, err := e("/sbin/smartctl", "-i", b.Device)
+	if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+		return err
+	}
+	if serial := parseDrive(out).Serial; serial != b.Serial {
+		return fmt.Errorf("%s is now the disk with serial %q, not %s where this burn-in started; find that disk's new device and resume it there", b.Device, serial, b.Serial)
+	}
+	return nil
+}
+
+// selfTest runs a SMART self-test on device and waits for it to finish, returning its status
+func selfTest(e executer, device, kind string, sleep func(time.Duration)) (string, error) {
+	if _, err := e("/sbin/smartctl", "-t", kind, device); err != nil {
+		return "", err
+	}
+	for {
+		out, err := e("/sbin/smartctl", "-c", device)
+		if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+			return "", err
+		}
+		if !strings.Contains(out, "Self-test routine in progress") {
+			break
+		}
+		sleep(time.Minute)
+	}
+
+	out, err := e("/sbin/smartctl", "-l", "selftest", device)
+	if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+		return "", err
+	}
+	entries := readSelfTestLog(out)
+	if len(entries) == 0 {
+		return "", errors.New("no self-test in the log")
+	}
+	return entries[0].status, nil
+}
+
+// runStage runs one stage of b, returning why the disk failed it, if it did
+func (b *burnIn) runStage(e executer, stage string, sleep func(time.Duration)) (string, error) {
+	switch stage {
+	case "short self-test", "long self-test":
+		kind, _, _ := strings.Cut(stage, " ")
+		status, err := selfTest(e, b.Device, kind, sleep)
+		if err != nil {
+			return "", err
+		}
+		if status != "Completed without error" {
+			return status, nil
+		}
+	case "badblocks":
+		args := []string{"-s", "-v", "-b", "4096", b.Device}
+		if b.Write {
+			args = append([]string{"-w"}, args...)
+		}
+		// bad blocks are listed on stdout, one per line
+		out, err := e("badblocks", args...)
+		if err != nil {
+			return "", err
+		}
+		if bad := len(strings.Fields(out)); bad > 0 {
+			return fmt.Sprintf("%d bad blocks", bad), nil
+		}
+	}
+	return "", nil
+}
+
+// run works through the stages of b that haven't finished, calling save after each, and records the result
+func (b *burnIn) run(w io.Writer, e executer, save func(), sleep func(time.Duration), now func() time.Time) error {
+	if b.Serial == "" {
+		out, err := e("/sbin/smartctl", "-i", "-A", "-l", "error", "-l", "selftest", b.Device)
+		if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+			return err
+		}
+		b.Serial = parseDrive(out).Serial
+		b.Before = scoreDrive(out, 0).Total
+		save()
+	}
+
+	for _, stage := range burnInStages {
+		if slices.Contains(b.Done, stage) {
+			continue
+		}
+		fmt.Fprintf(w, "%s: %s\n", b.Device, stage)
+		failure, err := b.runStage(e, stage, sleep)
+		if err != nil {
+			return fmt.Errorf("%s: %w", stage, err)
+		}
+		b.Done = append(b.Done, stage)
+		if failure != "" {
+			b.Result = fmt.Sprintf("FAIL: %s: %s", stage, failure)
+			b.Finished = now()
+			save()
+			return nil
+		}
+		save()
+	}
+
+	out, err := e("/sbin/smartctl", "-i", "-A", "-l", "error", "-l", "selftest", b.Device)
+	if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+		return err
+	}
+	after := scoreDrive(out, 0)
+	if after.Total > b.Before {
+		b.Result = fmt.Sprintf("FAIL: health score rose from %.1f to %.1f: %s", b.Before, after.Total, strings.Join(after.Parts, ", "))
+	} else {
+		b.Result = "PASS"
+	}
+	b.Finished = now()
+	save()
+	return nil
+}
+
+func (b burnIn) String() string {
+	switch {
+	case b.Result != "":
+		return fmt.Sprintf("%s (%s): %s after %s", b.Device, b.Serial, b.Result, b.Finished.Sub(b.Started).Round(time.Minute))
+	default:
+		return fmt.Sprintf("%s (%s): started %s, finished %s", b.Device, b.Serial, b.Started.Format(time.DateTime), strings.Join(b.Done, ", "))
+	}
+}
+
+// burnInCommand starts or resumes a burn-in, or lists them all
+func burnInCommand(w io.Writer, e executer, s *state, args []string, save func(), sleep func(time.Duration), now func() time.Time) (*burnIn, error) {
+	flags := flag.NewFlagSet("burnin", flag.ContinueOnError)
+	flags.SetOutput(w)
+	write := flags.Bool("write", false, "run badblocks in destructive write mode, erasing the disk")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() == 0 {
+		for _, b := range s.BurnIns {
+			fmt.Fprintln(w, b)
+		}
+		return nil, nil
+	}
+	if flags.NArg() != 1 {
+		return nil, errors.New("usage: heartbeat burnin [-write] <device>")
+	}
+	device := flags.Arg(0)
+
+	i := slices.IndexFunc(s.BurnIns, func(b burnIn) bool { return b.Device == device && b.Result == "" })
+	if i < 0 {
+		if err := burnInUse(e, device); err != nil {
+			return nil, err
+		}
+		s.BurnIns = append(s.BurnIns, burnIn{Device: device, Started: now(), Write: *write})
+		i = len(s.BurnIns) - 1
+	} else {
+		if err := burnInUse(e, device); err != nil {
+			return nil, err
+		}
+		if err := s.BurnIns[i].sameDisk(e); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(w, "resuming %s\n", s.BurnIns[i])
+	}
+
+	b := &s.BurnIns[i]
+	if err := b.run(w, e, save, sleep, now); err != nil {
+		return b, err
+	}
+	fmt.Fprintln(w, b)
+	return b, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type burnInDisk struct {
+	info      string
+	polls     int
+	badblocks error
+	selftest  string
+	ran       []string
+}
+
+func (d *burnInDisk) execute(cmd string, args ...string) (string, error) {
+	d.ran = append(d.ran, cmd+" "+strings.Join(args, " "))
+	switch {
+	case cmd == "/sbin/zpool":
+		return "  pool: primarySafe\n state: ONLINE\nconfig:\n\n\tNAME           STATE     READ WRITE CKSUM\n\tprimarySafe    ONLINE       0     0     0\n\t  mirror-0     ONLINE       0     0     0\n\t    /dev/sda1  ONLINE       0     0     0\n\t    /dev/sdb1  ONLINE       0     0     0\n\nerrors: No known data errors\n", nil
+	case cmd == "badblocks":
+		return "", d.badblocks
+	case args[0] == "-i":
+		return d.info, nil
+	case args[0] == "-c":
+		d.polls++
+		if d.polls%2 == 1 {
+			return "Self-test execution status:      ( 249)\tSelf-test routine in progress...\n", nil
+		}
+		return "Self-test execution status:      (   0)\tThe previous self-test routine completed\n", nil
+	case args[0] == "-l":
+		return "Num  Test_Description    Status                  Remaining  LifeTime(hours)  LBA_of_first_error\n# 1  Short offline       " + d.selftest + "       00%     80110         -\n", nil
+	}
+	return "", nil
+}
+
+func Test_burnInCommand(t *testing.T) {
+	t.Parallel()
+
+	info, err := os.ReadFile("testFiles/smartInfo.txt")
+	require.NoError(t, err)
+	now := func() time.Time { return time.Date(2024, time.March, 31, 12, 0, 0, 0, time.Local) }
+	var sleeps int
+	sleep := func(time.Duration) { sleeps++ }
+	var saves int
+	save := func() { saves++ }
+
+	disk := &burnInDisk{info: string(info), badblocks: errors.New("signal: killed"), selftest: "Completed without error"}
+	var s state
+	var buf bytes.Buffer
+
+	_, err = burnInCommand(&buf, disk.execute, &s, []string{"/dev/sda"}, save, sleep, now)
+	assert.EqualError(t, err, "/dev/sda is in pool primarySafe")
+	assert.Contains(t, disk.ran, "/sbin/zpool status -L -P")
+
+	// interrupted during badblocks
+	_, err = burnInCommand(&buf, disk.execute, &s, []string{"-write", "/dev/sdk"}, save, sleep, now)
+	assert.EqualError(t, err, "badblocks: signal: killed")
+	require.Len(t, s.BurnIns, 1)
+	assert.Equal(t, []string{"short self-test"}, s.BurnIns[0].Done)
+	assert.Equal(t, "WD-WX31D87HJ4KL", s.BurnIns[0].Serial)
+	assert.Equal(t, 1, sleeps)
+	assert.Contains(t, disk.ran, "badblocks -w -s -v -b 4096 /dev/sdk")
+
+	// and resumed after a reboot
+	disk.badblocks = nil
+	disk.ran = nil
+	b, err := burnInCommand(&buf, disk.execute, &s, []string{"/dev/sdk"}, save, sleep, now)
+	require.NoError(t, err)
+	assert.Equal(t, "PASS", b.Result)
+	assert.NotContains(t, disk.ran, "/sbin/smartctl -t short /dev/sdk")
+	assert.Contains(t, buf.String(), "resuming /dev/sdk (WD-WX31D87HJ4KL): started 2024-03-31 12:00:00, finished short self-test\n")
+	assert.Equal(t, 5, saves)
+
+	// a resumed burn-in whose device is now a different disk is refused
+	s.BurnIns = append(s.BurnIns, burnIn{Device: "/dev/sdm", Serial: "WD-OTHERDISK", Write: true, Done: []string{"short self-test"}})
+	disk.ran = nil
+	_, err = burnInCommand(&buf, disk.execute, &s, []string{"/dev/sdm"}, save, sleep, now)
+	assert.EqualError(t, err, `/dev/sdm is now the disk with serial "WD-WX31D87HJ4KL", not WD-OTHERDISK where this burn-in started; find that disk's new device and resume it there`)
+	assert.NotContains(t, strings.Join(disk.ran, "\n"), "badblocks")
+	s.BurnIns = s.BurnIns[:len(s.BurnIns)-1]
+
+	// a failed self-test fails the burn-in
+	failing := &burnInDisk{info: string(info), selftest: "Completed: read failure"}
+	b, err = burnInCommand(&buf, failing.execute, &s, []string{"/dev/sdl"}, save, sleep, now)
+	require.NoError(t, err)
+	assert.Equal(t, "FAIL: short self-test: Completed: read failure", b.Result)
+
+	buf.Reset()
+	_, err = burnInCommand(&buf, disk.execute, &s, nil, save, sleep, now)
+	require.NoError(t, err)
+	assert.Equal(t, "/dev/sdk (WD-WX31D87HJ4KL): PASS after 0s\n/dev/sdl (WD-WX31D87HJ4KL): FAIL: short self-test: Completed: read failure after 0s\n", buf.String())
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"sync"
+)
+
+// commandCache runs each read only command once per run, so checks that need the same output (eg zpool version, or zfs list for disk usage and compression) share it
+type commandCache struct {
+	e       executer
+	mu      sync.Mutex
+	results map[string]*cachedResult
+}
+
+type cachedResult struct {
+	once sync.Once
+	out  string
+	err  error
+}
+
+func newCommandCache(e executer) *commandCache {
+	return &commandCache{e: e, results: make(map[string]*cachedResult)}
+}
+
+// execute returns the output of the first run of cmd with args this run, running it if there wasn't one
+func (c *commandCache) execute(cmd string, args ...string) (string, error) {
+	if !cacheable(cmd, args) {
+		return c.e(cmd, args...)
+	}
+
+	key := strings.Join(append([]string{cmd}, args...), "\x00")
+	c.mu.Lock()
+	r, ok := c.results[key]
+	if !ok {
+		r = &cachedResult{}
+		c.results[key] = r
+	}
+	c.mu.Unlock()
+
+	r.once.Do(func() {
+		r.out, r.err = c.e(cmd, args...)
+	})
+	return r.out, r.err
+}
+
+// cacheable is true for commands that only read state, whose output won't change within a run. zpool clear, scrubs, and SMART self-tests always run.
+func cacheable(cmd string, args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	switch cmd {
+	case "/sbin/zpool":
+		return args[0] == "status" || args[0] == "get" || args[0] == "list" || args[0] == "version" || args[0] == "history" || args[0] == "upgrade" && len(args) == 1
+	case "zfs":
+		return args[0] == "list" || args[0] == "get" || args[0] == "version"
+	}
+	return false
+}
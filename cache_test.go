@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_commandCache(t *testing.T) {
+	t.Parallel()
+
+	runs := make(map[string]int)
+	c := newCommandCache(func(cmd string, args ...string) (string, error) {
+		key := strings.TrimSpace(cmd + " " + strings.Join(args, " "))
+		runs[key]++
+		return key, nil
+	})
+
+	for range 3 {
+		out, err := c.execute("/sbin/zpool", "version")
+		require.NoError(t, err)
+		assert.Equal(t, "/sbin/zpool version", out)
+		_, err = c.execute("zfs", zfsSpaceArgs...)
+		require.NoError(t, err)
+		_, err = c.execute("/sbin/zpool", "clear", "tank", "sda")
+		require.NoError(t, err)
+		_, err = c.execute("/sbin/smartctl", "-t", "short", "/dev/sda")
+		require.NoError(t, err)
+	}
+	_, err := c.execute("/sbin/zpool", "status", "-D")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{
+		"/sbin/zpool version":                    1,
+		"zfs " + strings.Join(zfsSpaceArgs, " "): 1,
+		"/sbin/zpool clear tank sda":             3,
+		"/sbin/smartctl -t short /dev/sda":       3,
+		"/sbin/zpool status -D":                  1,
+	}, runs)
+}
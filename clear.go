@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// transientErrors lists the disks in p with a few read, write, or checksum errors (at most limit) if that's the only thing wrong with the pool
+func transientErrors(p pool, limit int) []vdevDisk {
+	if p.state != stateOnline || p.read != 0 || p.write != 0 || p.checksum != 0 || p.errors != noDataErrors {
+		return nil
+	}
+
+	var disks []vdevDisk
+	for _, v := range p.vdevs {
+		if v.typev == vdevTypeSpare {
+			if !v.Healthy() {
+				return nil
+			}
+			continue
+		}
+		if v.state != stateOnline || v.read+v.write+v.checksum > limit {
+			return nil
+		}
+		for _, d := range v.disks {
+			if d.Healthy() {
+				continue
+			}
+			if d.state != stateOnline || d.message != "" || d.read+d.write+d.checksum > limit {
+				return nil
+			}
+			disks = append(disks, d)
+		}
+	}
+	return disks
+}
+
+// checkTransient clears the errors on acknowledged disks with transient errors, and alerts critically when errors come back on a disk within watch of it being cleared
+func checkTransient(s *state, e executer, pools []pool, limit int, watch time.Duration, now time.Time) error {
+	for key, at := range s.Cleared {
+		if now.Sub(at) > watch {
+			delete(s.Cleared, key)
+		}
+	}
+
+	var errs []error
+	for _, p := range pools {
+		for _, d := range transientErrors(p, limit) {
+			key := p.name + "/" + d.name
+			if cleared, ok := s.Cleared[key]; ok {
+				errs = append(errs, severityError{severityCritical, fmt.Errorf("errors on disk %s in pool %s came back %s after zpool clear (%d|%d|%d)", d.name, p.name, now.Sub(cleared).Round(time.Hour), d.read, d.write, d.checksum)})
+				continue
+			}
+			if _, ok := s.Acked[key]; !ok {
+				continue
+			}
+			if _, err := e("/sbin/zpool", "clear", p.name, d.name); err != nil {
+				errs = append(errs, checkError{err})
+				continue
+			}
+			log.Printf("cleared disk %s in pool %s after it was acknowledged", d.name, p.name)
+			if s.Cleared == nil {
+				s.Cleared = make(map[string]time.Time)
+			}
+			s.Cleared[key] = now
+			delete(s.Acked, key)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// trackTransient runs checkTransient against the state file
+func trackTransient(e executer, pools []pool) error {
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkTransient(&s, e, pools, transientErrorLimit, clearWatch, time.Now())
+	saveState(s)
+	return err
+}
+
+// ack acknowledges the errors on a disk, so autoClear will clear them on the next run
+func ack(s *state, args []string, now time.Time) error {
+	if len(args) != 2 {
+		return errors.New("usage: heartbeat ack <pool> <disk>")
+	}
+	if s.Acked == nil {
+		s.Acked = make(map[string]time.Time)
+	}
+	s.Acked[args[0]+"/"+args[1]] = now
+	return nil
+}
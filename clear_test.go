@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func transientPool(checksum int, state deviceState) pool {
+	p := pool{name: "primarySafe", state: "ONLINE", errors: "errors: No known data errors"}
+	p.vdevs = []vdev{{name: "raidz2-0", state: "ONLINE", typev: vdevTypeRaidz}}
+	p.vdevs[0].disks = []vdevDisk{
+		{vdev: &p.vdevs[0], name: "sda", state: "ONLINE"},
+		{vdev: &p.vdevs[0], name: "sdb", state: state, checksum: checksum},
+	}
+	return p
+}
+
+func Test_transientErrors(t *testing.T) {
+	t.Parallel()
+
+	disks := transientErrors(transientPool(1, "ONLINE"), 3)
+	require.Len(t, disks, 1)
+	assert.Equal(t, "sdb", disks[0].name)
+
+	assert.Empty(t, transientErrors(transientPool(0, "ONLINE"), 3))
+	assert.Empty(t, transientErrors(transientPool(4, "ONLINE"), 3))
+	assert.Empty(t, transientErrors(transientPool(1, "FAULTED"), 3))
+}
+
+func Test_checkTransient(t *testing.T) {
+	t.Parallel()
+
+	var cleared []string
+	e := func(cmd string, args ...string) (string, error) {
+		if args[2] == "sdz" {
+			return "", errors.New("exit status 1")
+		}
+		cleared = append(cleared, args[1]+" "+args[2])
+		return "", nil
+	}
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.Local)
+	pools := []pool{transientPool(1, "ONLINE")}
+
+	// nothing happens until the errors are acknowledged
+	var s state
+	require.NoError(t, checkTransient(&s, e, pools, 3, 14*24*time.Hour, now))
+	assert.Empty(t, cleared)
+
+	require.NoError(t, ack(&s, []string{"primarySafe", "sdb"}, now))
+	require.NoError(t, checkTransient(&s, e, pools, 3, 14*24*time.Hour, now.Add(time.Hour)))
+	assert.Equal(t, []string{"primarySafe sdb"}, cleared)
+	assert.Empty(t, s.Acked)
+
+	// coming back within the watch is critical
+	err := checkTransient(&s, e, pools, 3, 14*24*time.Hour, now.Add(73*time.Hour))
+	require.Error(t, err)
+	var se severityError
+	require.ErrorAs(t, err, &se)
+	assert.Equal(t, severityCritical, se.severity)
+	assert.EqualError(t, err, "errors on disk sdb in pool primarySafe came back 72h0m0s after zpool clear (0|0|1)")
+
+	// but not once the watch is over
+	require.NoError(t, checkTransient(&s, e, []pool{transientPool(0, "ONLINE")}, 3, 14*24*time.Hour, now.Add(15*24*time.Hour)))
+	assert.Empty(t, s.Cleared)
+
+	assert.Error(t, ack(&s, []string{"primarySafe"}, now))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compressionBaselineAge is how long a dataset's compression ratio is kept as the baseline before it's refreshed
+const compressionBaselineAge = 7 * 24 * time.Hour
+
+// datasetSpace is the space a dataset uses before and after compression
+type datasetSpace struct {
+	name    string
+	used    uint64 // bytes on disk
+	logical uint64 // bytes before compression
+	ratio   float64
+}
+
+// readCompression lists the space used by every filesystem and volume
+func readCompression(e executer) ([]datasetSpace, error) {
+	out, err := e("zfs", zfsSpaceArgs...)
+	if err != nil {
+		return nil, checkError{err}
+	}
+
+	var datasets []datasetSpace
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 5 {
+			return nil, checkError{fmt.Errorf("unexpected zfs list output: %q", line)}
+		}
+		d := datasetSpace{name: fields[0]}
+		if d.used, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return nil, checkError{err}
+		}
+		if d.logical, err = strconv.ParseUint(fields[3], 10, 64); err != nil {
+			return nil, checkError{err}
+		}
+		if d.ratio, err = strconv.ParseFloat(strings.TrimSuffix(fields[4], "x"), 64); err != nil {
+			return nil, checkError{err}
+		}
+		datasets = append(datasets, d)
+	}
+	return datasets, nil
+}
+
+// compressionBaseline is a dataset's compression ratio as of Since
+type compressionBaseline struct {
+	Ratio float64
+	Since time.Time
+}
+
+// checkCompression warns when a dataset's compression ratio has fallen by more than drop since its baseline, recording baselines in s
+func checkCompression(s *state, datasets []datasetSpace, drop float64, now time.Time) error {
+	baselines := make(map[string]compressionBaseline)
+	var errs []error
+	for _, d := range datasets {
+		b, ok := s.Compression[d.name]
+		if drop > 0 && ok && d.ratio < b.Ratio*(1-drop) {
+			errs = append(errs, fmt.Errorf("compression ratio of %s fell from %.2fx to %.2fx since %s", d.name, b.Ratio, d.ratio, b.Since.Format("Jan 2")))
+		}
+		if !ok || now.Sub(b.Since) > compressionBaselineAge {
+			b = compressionBaseline{Ratio: d.ratio, Since: now}
+		}
+		baselines[d.name] = b
+	}
+	s.Compression = baselines
+
+	return errors.Join(errs...)
+}
+
+// trackCompression runs checkCompression against the state file
+func trackCompression(datasets []datasetSpace) error {
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkCompression(&s, datasets, compressionDrop, time.Now())
+	saveState(s)
+	return err
+}
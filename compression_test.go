@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readCompression(t *testing.T) {
+	t.Parallel()
+
+	e := func(cmd string, args ...string) (string, error) {
+		return "boot-pool\t5275648000\t17179869184\t9663676416\t1.83\nprimarySafe\t2473901162496\t17716740096\t2748779069440\t1.11\nprimarySafe/media\t1099511627776\t17716740096\t1099511627776\t1.00\n", nil
+	}
+	datasets, err := readCompression(e)
+	require.NoError(t, err)
+	assert.Equal(t, []datasetSpace{
+		{name: "boot-pool", used: 5275648000, logical: 9663676416, ratio: 1.83},
+		{name: "primarySafe", used: 2473901162496, logical: 2748779069440, ratio: 1.11},
+		{name: "primarySafe/media", used: 1099511627776, logical: 1099511627776, ratio: 1.00},
+	}, datasets)
+
+	r := newHeartbeatReport(nil, map[string]space{"boot-pool": {avail: 17179869184}, "primarySafe": {avail: 17716740096}}, 0, 0, nil, datasets)
+	assert.Equal(t, "boot-pool: 16.00 GiB free\n  1.83x compression, 9.00 GiB stored in 4.91 GiB\nprimarySafe: 16.50 GiB free\n  1.11x compression, 2.50 TiB stored in 2.25 TiB\n", r.String())
+}
+
+func Test_checkCompression(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.April, 6, 8, 0, 0, 0, time.UTC)
+	var s state
+	require.NoError(t, checkCompression(&s, []datasetSpace{{name: "primarySafe/vms", ratio: 2.0}}, 0.25, now))
+	require.NoError(t, checkCompression(&s, []datasetSpace{{name: "primarySafe/vms", ratio: 1.5}}, 0.25, now.Add(time.Hour)))
+	assert.EqualError(t, checkCompression(&s, []datasetSpace{{name: "primarySafe/vms", ratio: 1.0}}, 0.25, now.Add(2*time.Hour)), "compression ratio of primarySafe/vms fell from 2.00x to 1.00x since Apr 6")
+	assert.Equal(t, now, s.Compression["primarySafe/vms"].Since, "the baseline is kept for a week")
+	assert.NoError(t, checkCompression(&s, []datasetSpace{{name: "primarySafe/vms", ratio: 1.0}}, 0, now.Add(2*time.Hour)), "0 disables the check")
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hostModes are the ways hostMode can reach the host from inside a container
+var hostModes = []string{"nsenter", "chroot"}
+
+// hostCommand rewrites a command to run on the host from inside a container, as hostMode says
+func hostCommand(mode, root, cmd string, args []string) (string, []string) {
+	switch mode {
+	case "nsenter":
+		// pid 1 is the host's init when the container shares its pid namespace
+		return "nsenter", append([]string{"--target", "1", "--mount", "--uts", "--ipc", "--net", "--", cmd}, args...)
+	case "chroot":
+		return "chroot", append([]string{root, cmd}, args...)
+	}
+	return cmd, args
+}
+
+// hostPath is where a path on the host is from inside the container, eg /etc/hostname is /host/etc/hostname with hostRoot mounted at /host
+func hostPath(path string) string {
+	switch hostMode {
+	case "nsenter":
+		return filepath.Join("/proc/1/root", path)
+	case "chroot":
+		return filepath.Join(hostRoot, path)
+	}
+	return path
+}
+
+// hostHostname is the host's name from inside a container, whose own hostname is usually a container ID
+func hostHostname() (string, error) {
+	name, err := os.ReadFile(hostPath("/etc/hostname"))
+	return strings.TrimSpace(string(name)), err
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_hostCommand(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		mode     string
+		wantCmd  string
+		wantArgs []string
+	}{
+		{"", "/sbin/zpool", []string{"status", "-p"}},
+		{"nsenter", "nsenter", []string{"--target", "1", "--mount", "--uts", "--ipc", "--net", "--", "/sbin/zpool", "status", "-p"}},
+		{"chroot", "chroot", []string{"/host", "/sbin/zpool", "status", "-p"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cmd, args := hostCommand(tt.mode, "/host", "/sbin/zpool", []string{"status", "-p"})
+			assert.Equal(t, tt.wantCmd, cmd)
+			assert.Equal(t, tt.wantArgs, args)
+		})
+	}
+}
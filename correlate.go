@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// poolDevices is the device each disk of p is on, in Walk order, from devicePools (zpool status -L -P). Without them, disks are assumed to be named by their device.
+func poolDevices(p pool, devicePools []pool) []string {
+	var devices []string
+	if i := slices.IndexFunc(devicePools, func(dp pool) bool { return dp.name == p.name }); i >= 0 {
+		devicePools[i].Walk(func(v vdev, d vdevDisk) bool {
+			devices = append(devices, diskDevice(d.name))
+			return true
+		})
+	}
+
+	var count int
+	p.Walk(func(v vdev, d vdevDisk) bool {
+		count++
+		return true
+	})
+	if len(devices) == count {
+		return devices
+	}
+	devices = devices[:0]
+	p.Walk(func(v vdev, d vdevDisk) bool {
+		devices = append(devices, diskDevice(d.name))
+		return true
+	})
+	return devices
+}
+
+// correlate merges each SMART failure with the ZFS errors on the same disk into one finding, eg
+// "sdd (serial X, member of primarySafe/raidz2-0) is failing: SMART overall health check failed + 12 checksum errors",
+// taking the disk out of its pool's finding. pools are from the pool status check, devicePools and drives are from the disk age and drive inventory checks.
+func correlate(findings []finding, pools, devicePools []pool, drives []drive) []finding {
+	serials := make(map[string]string)
+	for _, d := range drives {
+		device, _, _ := strings.Cut(d.Device, ":")
+		serials[device] = d.Serial
+	}
+
+	removed := make(map[int]bool)
+	merged := make(map[int][]finding) // by the index of the pool finding they were taken from
+	for _, p := range pools {
+		ev := p.Evaluate()
+		heading := fmt.Sprintf("pool %s is %s", p.name, p.state)
+		pf := slices.IndexFunc(findings, func(f finding) bool { return f.check == "pool status" && f.message == ev.err(heading).Error() })
+		if pf < 0 {
+			continue
+		}
+
+		devices := poolDevices(p, devicePools)
+		var moved []reason
+		var k int
+		p.Walk(func(v vdev, d vdevDisk) bool {
+			device := devices[k]
+			k++
+			de := d.Evaluate()
+			if de.Healthy() || v.typev == vdevTypeSpare {
+				return true
+			}
+
+			c := finding{check: "pool status", severity: de.Severity}
+			var problems []string
+			for i, f := range findings {
+				if disk, _, _ := strings.Cut(f.disk, ":"); f.disk == "" || disk != device || removed[i] {
+					continue
+				}
+				removed[i] = true
+				if !slices.Contains(c.merged, f.check) {
+					c.merged = append(c.merged, f.check)
+				}
+				problems = append(problems, strings.TrimPrefix(f.message, "smart error: disk "+f.disk+": "))
+				c.severity = max(c.severity, f.severity)
+				if c.detail == "" {
+					c.detail = f.detail
+				}
+			}
+			if len(problems) == 0 {
+				return true
+			}
+			for _, r := range de.Reasons {
+				problems = append(problems, strings.TrimPrefix(strings.TrimPrefix(r.Problem, "has "), "is "))
+			}
+			moved = append(moved, de.Reasons...)
+
+			member := p.name
+			if v.typev != vdevTypeDisk {
+				member += "/" + v.name
+			}
+			if serial := serials[device]; serial != "" {
+				member = fmt.Sprintf("serial %s, member of %s", serial, member)
+			} else {
+				member = "member of " + member
+			}
+			c.message = fmt.Sprintf("%s (%s) is failing: %s", device, member, strings.Join(problems, " + "))
+			merged[pf] = append(merged[pf], c)
+			return true
+		})
+		if len(moved) == 0 {
+			continue
+		}
+
+		var rest evaluation
+		for _, r := range ev.Reasons {
+			if !slices.Contains(moved, r) {
+				rest.add(r)
+			}
+		}
+		if rest.Healthy() {
+			removed[pf] = true
+			// the zpool status output goes with the first disk instead
+			first := &merged[pf][0]
+			first.detail = strings.TrimSpace(first.detail + "\n\n" + findings[pf].detail)
+		} else {
+			findings[pf].message = rest.err(heading).Error()
+			findings[pf].severity = rest.Severity
+		}
+	}
+	if len(merged) == 0 {
+		return findings
+	}
+
+	correlated := make([]finding, 0, len(findings))
+	for i, f := range findings {
+		correlated = append(correlated, merged[i]...)
+		if !removed[i] {
+			correlated = append(correlated, f)
+		}
+	}
+	return correlated
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_correlate(t *testing.T) {
+	t.Parallel()
+
+	pools, err := parsePools(`  pool: primarySafe
+ state: ONLINE
+config:
+
+	NAME                                      STATE     READ WRITE CKSUM
+	primarySafe                               ONLINE       0     0     0
+	  raidz2-0                                ONLINE       0     0     0
+	    60ef726b-e8ec-11e3-aabf-d43d7ef79ff0  ONLINE       0     0     0
+	    4167d912-9102-11e2-a05e-b8975a0e7ea3  ONLINE       0     0    12
+	    e43d41b6-adcc-11e5-b06a-d43d7ef79ff0  ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: scratch
+ state: ONLINE
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	scratch     ONLINE       0     0     0
+	  sdf       ONLINE       2     0     0
+
+errors: No known data errors
+`)
+	require.NoError(t, err)
+	devicePools, err := parsePools(`  pool: primarySafe
+ state: ONLINE
+config:
+
+	NAME           STATE     READ WRITE CKSUM
+	primarySafe    ONLINE       0     0     0
+	  raidz2-0     ONLINE       0     0     0
+	    /dev/sdc1  ONLINE       0     0     0
+	    /dev/sdd1  ONLINE       0     0    12
+	    /dev/sde1  ONLINE       0     0     0
+
+errors: No known data errors
+`)
+	require.NoError(t, err)
+	drives := []drive{{Device: "sdd", Serial: "WD-WCC4E1234567"}, {Device: "sdf:sat", Serial: "ZA1B2C3D"}}
+
+	var d digest
+	var found []error
+	for _, p := range pools {
+		found = append(found, p.Evaluate().err("pool "+p.name+" is ONLINE"))
+	}
+	d.addError("pool status", severityCritical, errors.Join(found...), "zpool status output")
+	d.addError("smart selftest", severityWarning, errors.Join(
+		smartError{"sdd", "Completed: read failure"},
+		severityError{severityCritical, smartError{"sdd", "SMART overall health check failed"}},
+		smartError{"sdf:sat", "prefailure attributes at or below threshold"},
+		smartError{"sdg", "Completed: read failure"},
+	), "smartctl output")
+	d.add("disk usage", severityWarning, "pool scratch is 91% full", "")
+
+	correlated := correlate(d.findings, pools, devicePools, drives)
+	assert.Equal(t, []finding{
+		{check: "pool status", severity: severityCritical, message: "sdd (serial WD-WCC4E1234567, member of primarySafe/raidz2-0) is failing: Completed: read failure + SMART overall health check failed + 12 checksum errors", detail: "smartctl output\n\nzpool status output", merged: []string{"smart selftest"}},
+		{check: "pool status", severity: severityWarning, message: "sdf (serial ZA1B2C3D, member of scratch) is failing: prefailure attributes at or below threshold + 2 read errors", merged: []string{"smart selftest"}},
+		{check: "smart selftest", severity: severityWarning, message: "smart error: disk sdg: Completed: read failure", disk: "sdg"},
+		{check: "disk usage", severity: severityWarning, message: "pool scratch is 91% full"},
+	}, correlated)
+
+	// nothing to correlate without a SMART failure on a disk with ZFS errors
+	assert.Equal(t, d.findings[:1], correlate(d.findings[:1], pools, devicePools, drives))
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const arcstatsPath = "/proc/spl/kstat/zfs/arcstats"
+const meminfoPath = "/proc/meminfo"
+
+var ddtRe = regexp.MustCompile(`dedup: DDT entries (\d+), size (\S+) on disk, (\S+) in core`)
+
+// parseDDT reads the in-memory size of each pool's dedup table from zpool status -D
+func parseDDT(out string) (map[string]uint64, error) {
+	tables := make(map[string]uint64)
+	var poolName string
+	for _, line := range strings.Split(out, "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(trimmedLine, "pool: "); ok {
+			poolName = name
+			continue
+		}
+
+		matches := ddtRe.FindStringSubmatch(trimmedLine)
+		if matches == nil {
+			continue
+		}
+		entries, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := parseSize(matches[3])
+		if err != nil {
+			return nil, err
+		}
+		tables[poolName] = entries * size
+	}
+	return tables, nil
+}
+
+// memoryLimit is the most memory the dedup tables can use: the ARC's maximum size, or all of RAM if that isn't available
+func memoryLimit() (uint64, string, error) {
+	if data, err := os.ReadFile(arcstatsPath); err == nil {
+		if cmax, ok := kstat(string(data), "c_max"); ok {
+			return cmax, "ARC", nil
+		}
+	}
+
+	data, err := os.ReadFile(meminfoPath)
+	if err != nil {
+		return 0, "", err
+	}
+	kb, ok := kstat(string(data), "MemTotal:")
+	if !ok {
+		return 0, "", errors.New("MemTotal missing from " + meminfoPath)
+	}
+	return kb * 1024, "RAM", nil
+}
+
+// kstat finds a value in the name/value tables linux exposes under /proc, eg arcstats (name type value) or meminfo (name value kB)
+func kstat(data, name string) (uint64, bool) {
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != name {
+			continue
+		}
+		value := fields[len(fields)-1]
+		if value == "kB" {
+			value = fields[len(fields)-2]
+		}
+		n, err := strconv.ParseUint(value, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// checkDedup warns when the dedup tables no longer comfortably fit in memory
+func checkDedup(e executer) error {
+	out, err := e("/sbin/zpool", "status", "-D")
+	if err != nil {
+		return checkError{err}
+	}
+	tables, err := parseDDT(out)
+	if err != nil {
+		return checkError{err}
+	}
+
+	var total uint64
+	for _, size := range tables {
+		total += size
+	}
+	if total == 0 {
+		return nil
+	}
+
+	limit, limitName, err := memoryLimit()
+	if err != nil {
+		return checkError{err}
+	}
+	if float64(total) > ddtMaxFraction*float64(limit) {
+		return fmt.Errorf("dedup tables use %s of memory, %.0f%% of the %s (%s)", formatDDT(tables), 100*float64(total)/float64(limit), limitName, formatBytes(limit))
+	}
+	return nil
+}
+
+func formatDDT(tables map[string]uint64) string {
+	var parts []string
+	for name, size := range tables {
+		if size > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", name, formatBytes(size)))
+		}
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, ", ")
+}
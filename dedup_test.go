@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseDDT(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolDedup.txt")
+	require.NoError(t, err)
+
+	tables, err := parseDDT(string(data))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"primarySafe": 24000000 * 185}, tables)
+	assert.Equal(t, "primarySafe 4.14 GiB", formatDDT(tables))
+}
+
+func Test_kstat(t *testing.T) {
+	t.Parallel()
+
+	arcstats := "13 1 0x01 147 39984 5289939316 3011876567590\nname                            type data\nhits                            4    2011367\nc_max                           4    8341467136\n"
+	meminfo := "MemTotal:       16290108 kB\nMemFree:         1184096 kB\n"
+
+	cmax, ok := kstat(arcstats, "c_max")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(8341467136), cmax)
+
+	total, ok := kstat(meminfo, "MemTotal:")
+	assert.True(t, ok)
+	assert.Equal(t, uint64(16290108), total)
+
+	_, ok = kstat(meminfo, "c_max")
+	assert.False(t, ok)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// previousStatusPath is where the status file is moved to when a run replaces it, eg status.previous.json, for heartbeat diff
+func previousStatusPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".previous" + ext
+}
+
+// keepPreviousStatus moves the last run's status file aside before it's replaced
+func keepPreviousStatus(path string) error {
+	if err := os.Rename(path, previousStatusPath(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// errorDelta describes how a device's read, write, and checksum error counts changed, eg "+3 read, +12 checksum errors". zpool clear can make them go down.
+func errorDelta(read, write, checksum int) string {
+	var parts []string
+	for _, c := range []struct {
+		name  string
+		delta int
+	}{{"read", read}, {"write", write}, {"checksum", checksum}} {
+		if c.delta != 0 {
+			parts = append(parts, fmt.Sprintf("%+d %s", c.delta, c.name))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, ", ") + " errors"
+}
+
+// signedBytes formats a change in size, eg +100 GiB
+func signedBytes(from, to uint64) string {
+	if to >= from {
+		return "+" + formatBytes(to-from)
+	}
+	return "-" + formatBytes(from-to)
+}
+
+// diffStatus describes what changed between two runs: pool, vdev, and disk states, error counts, space used, and check results
+func diffStatus(old, cur runStatus) []string {
+	var changes []string
+	add := func(format string, args ...any) {
+		changes = append(changes, fmt.Sprintf(format, args...))
+	}
+
+	oldPools := make(map[string]poolStatus)
+	for _, p := range old.Pools {
+		oldPools[p.Name] = p
+	}
+	for _, p := range cur.Pools {
+		o, ok := oldPools[p.Name]
+		delete(oldPools, p.Name)
+		if !ok {
+			add("pool %s appeared, %s", p.Name, p.State)
+			continue
+		}
+		if o.State != p.State {
+			add("pool %s: %s -> %s", p.Name, o.State, p.State)
+		}
+		if o.Used != p.Used && o.Used+p.Used > 0 {
+			add("pool %s: used %s -> %s (%s), %.0f%% -> %.0f%% full", p.Name, formatBytes(o.Used), formatBytes(p.Used), signedBytes(o.Used, p.Used), o.Full, p.Full)
+		}
+		if o.Scan != p.Scan && p.Scan != "" {
+			scan, _, _ := strings.Cut(p.Scan, "\n")
+			add("pool %s: %s", p.Name, scan)
+		}
+		changes = append(changes, diffVdevs(p.Name, o.Vdevs, p.Vdevs)...)
+	}
+	for _, p := range old.Pools {
+		if _, ok := oldPools[p.Name]; ok {
+			add("pool %s is gone, it was %s", p.Name, p.State)
+		}
+	}
+
+	oldChecks := make(map[string]checkStatus)
+	for _, c := range old.Checks {
+		oldChecks[c.Name] = c
+	}
+	for _, c := range cur.Checks {
+		o, ok := oldChecks[c.Name]
+		switch {
+		case !ok || o.Result == c.Result && o.Message == c.Message:
+		case c.Message != "":
+			add("check %s: %s -> %s: %s", c.Name, o.Result, c.Result, strings.ReplaceAll(c.Message, "\n", " / "))
+		default:
+			add("check %s: %s -> %s", c.Name, o.Result, c.Result)
+		}
+	}
+
+	oldDrives := make(map[string]driveStatus)
+	for _, d := range old.Drives {
+		oldDrives[d.Device] = d
+	}
+	for _, d := range cur.Drives {
+		if o, ok := oldDrives[d.Device]; ok && o.Serial != d.Serial {
+			add("drive %s: serial %s -> %s", d.Device, o.Serial, d.Serial)
+		}
+	}
+	return changes
+}
+
+// diffVdevs describes how the vdevs and disks of a pool changed
+func diffVdevs(pool string, old, cur []vdevStatus) []string {
+	var changes []string
+	oldVdevs := make(map[string]vdevStatus)
+	for _, v := range old {
+		oldVdevs[v.Name] = v
+	}
+	for _, v := range cur {
+		o, ok := oldVdevs[v.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("pool %s: vdev %s appeared", pool, v.Name))
+			continue
+		}
+		if o.State != v.State {
+			changes = append(changes, fmt.Sprintf("pool %s: vdev %s: %s -> %s", pool, v.Name, o.State, v.State))
+		}
+		if delta := errorDelta(v.Read-o.Read, v.Write-o.Write, v.Checksum-o.Checksum); delta != "" {
+			changes = append(changes, fmt.Sprintf("pool %s: vdev %s: %s", pool, v.Name, delta))
+		}
+
+		oldDisks := make(map[string]diskStatus)
+		for _, d := range o.Disks {
+			oldDisks[d.Name] = d
+		}
+		for _, d := range v.Disks {
+			od, ok := oldDisks[d.Name]
+			delete(oldDisks, d.Name)
+			if !ok {
+				changes = append(changes, fmt.Sprintf("pool %s: disk %s joined %s, %s", pool, d.Name, v.Name, d.State))
+				continue
+			}
+			if od.State != d.State {
+				changes = append(changes, fmt.Sprintf("pool %s: disk %s: %s -> %s", pool, d.Name, od.State, d.State))
+			}
+			if delta := errorDelta(d.Read-od.Read, d.Write-od.Write, d.Checksum-od.Checksum); delta != "" {
+				changes = append(changes, fmt.Sprintf("pool %s: disk %s: %s", pool, d.Name, delta))
+			}
+		}
+		for _, d := range o.Disks {
+			if _, ok := oldDisks[d.Name]; ok {
+				changes = append(changes, fmt.Sprintf("pool %s: disk %s left %s", pool, d.Name, v.Name))
+			}
+		}
+		delete(oldVdevs, v.Name)
+	}
+	for _, v := range old {
+		if _, ok := oldVdevs[v.Name]; ok {
+			changes = append(changes, fmt.Sprintf("pool %s: vdev %s is gone", pool, v.Name))
+		}
+	}
+	return changes
+}
+
+// diffCommand is the diff command: it prints what changed between the last two runs, or between two status files
+func diffCommand(w io.Writer, args []string) error {
+	oldPath, curPath := previousStatusPath(statusPath), statusPath
+	switch len(args) {
+	case 0:
+	case 2:
+		oldPath, curPath = args[0], args[1]
+	default:
+		return errors.New("usage: heartbeat diff [old status file] [new status file]")
+	}
+
+	old, err := readStatus(oldPath)
+	if err != nil {
+		return err
+	}
+	cur, err := readStatus(curPath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "from %s to %s\n", old.Time.Local().Format("2006-01-02 15:04"), cur.Time.Local().Format("2006-01-02 15:04"))
+	changes := diffStatus(old, cur)
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "nothing changed")
+	}
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_previousStatusPath(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "/var/lib/heartbeat/status.previous.json", previousStatusPath("/var/lib/heartbeat/status.json"))
+	assert.Equal(t, "/var/lib/heartbeat/status-offsite.previous.json", previousStatusPath(instancePath("/var/lib/heartbeat/status.json", "offsite")))
+}
+
+func Test_diffStatus(t *testing.T) {
+	t.Parallel()
+
+	old := runStatus{
+		Time: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Pools: []poolStatus{
+			{Name: "primarySafe", State: stateOnline, Healthy: true, Used: 4 << 40, Full: 60, Vdevs: []vdevStatus{
+				{Name: "raidz2-0", Kind: "raidz", State: stateOnline, Healthy: true, Disks: []diskStatus{
+					{Name: "sda", State: stateOnline, Healthy: true},
+					{Name: "sdb", State: stateOnline, Healthy: true, Checksum: 2},
+					{Name: "sdc", State: stateOnline, Healthy: true},
+				}},
+			}},
+			{Name: "scratch", State: stateOnline, Healthy: true},
+		},
+		Checks: []checkStatus{
+			{Name: "pool status", Result: "ok"},
+			{Name: "disk usage", Result: "ok"},
+			{Name: "peers", Result: "failed", Severity: "warning", Message: "peer nas2 is unreachable"},
+		},
+		Drives: []driveStatus{{Device: "sdc", Serial: "WD-OLD"}},
+	}
+	cur := runStatus{
+		Time: time.Date(2024, 3, 1, 12, 10, 0, 0, time.UTC),
+		Pools: []poolStatus{
+			{Name: "primarySafe", State: stateDegraded, Healthy: false, Used: 4<<40 + 100<<30, Full: 61.5, Scan: "resilver in progress since Fri Mar  1 12:05:00 2024\n\t1.2T scanned", Vdevs: []vdevStatus{
+				{Name: "raidz2-0", Kind: "raidz", State: stateDegraded, Disks: []diskStatus{
+					{Name: "sda", State: stateOnline, Healthy: true},
+					{Name: "sdb", State: stateFaulted, Read: 3, Checksum: 14, Message: "too many errors"},
+					{Name: "sdd", State: stateOnline, Healthy: true},
+				}},
+			}},
+		},
+		Checks: []checkStatus{
+			{Name: "pool status", Result: "failed", Severity: "critical", Message: "pool primarySafe is DEGRADED\ndisk sdb is FAULTED"},
+			{Name: "disk usage", Result: "ok"},
+			{Name: "peers", Result: "ok"},
+		},
+		Drives: []driveStatus{{Device: "sdc", Serial: "WD-NEW"}},
+	}
+
+	assert.Equal(t, []string{
+		"pool primarySafe: ONLINE -> DEGRADED",
+		"pool primarySafe: used 4.00 TiB -> 4.10 TiB (+100.00 GiB), 60% -> 62% full",
+		"pool primarySafe: resilver in progress since Fri Mar  1 12:05:00 2024",
+		"pool primarySafe: vdev raidz2-0: ONLINE -> DEGRADED",
+		"pool primarySafe: disk sdb: ONLINE -> FAULTED",
+		"pool primarySafe: disk sdb: +3 read, +12 checksum errors",
+		"pool primarySafe: disk sdd joined raidz2-0, ONLINE",
+		"pool primarySafe: disk sdc left raidz2-0",
+		"pool scratch is gone, it was ONLINE",
+		"check pool status: ok -> failed: pool primarySafe is DEGRADED / disk sdb is FAULTED",
+		"check peers: failed -> ok",
+		"drive sdc: serial WD-OLD -> WD-NEW",
+	}, diffStatus(old, cur))
+
+	assert.Empty(t, diffStatus(cur, cur))
+}
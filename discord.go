@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// discord posts notifications to a webhook as an embed colored by severity, with a field per finding
+type discord struct {
+	webhook string
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+	Timestamp   string         `json:"timestamp"`
+	Footer      struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+// discord's embed limits
+const (
+	discordMaxFields      = 25
+	discordMaxFieldValue  = 1024
+	discordMaxDescription = 4096
+)
+
+func (d discord) name() string {
+	return "discord"
+}
+
+func (d discord) send(n notification) error {
+	_, err := postJSON(d.webhook, map[string]any{
+		"username": "zfsHeartbeat",
+		"embeds":   []discordEmbed{discordEmbedFor(n, time.Now())},
+	}, nil)
+	return err
+}
+
+func discordEmbedFor(n notification, now time.Time) discordEmbed {
+	embed := discordEmbed{
+		Title:     n.title,
+		Color:     severityColor(n.severity),
+		Timestamp: now.UTC().Format(time.RFC3339),
+	}
+	embed.Footer.Text = hostname()
+
+	if len(n.findings) == 0 {
+		embed.Description = truncate(n.message, discordMaxDescription)
+		return embed
+	}
+
+	// one field per pool/vdev/disk line, so each component gets its own row
+	for _, f := range n.findings {
+		for _, line := range strings.Split(f.message, "\n") {
+			if len(embed.Fields) == discordMaxFields {
+				embed.Description = "Too many findings to list, see logs for the rest"
+				return embed
+			}
+			embed.Fields = append(embed.Fields, discordField{
+				Name:  f.label() + " (" + f.severity.String() + ")",
+				Value: truncate(line, discordMaxFieldValue),
+			})
+		}
+	}
+	return embed
+}
+
+func severityColor(sev severity) int {
+	switch sev {
+	case severityCritical:
+		return 0xe74c3c // red
+	case severityWarning:
+		return 0xf39c12 // orange
+	default:
+		return 0x2ecc71 // green
+	}
+}
+
+// truncate shortens s to at most max bytes, marking that it was cut off
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max - 3
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "..."
+}
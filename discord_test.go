@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_discordEmbedFor(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 31, 18, 40, 0, 0, time.UTC)
+	var d digest
+	d.add("pool status", severityCritical, "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors\ndisk 14803813886136010794 - UNAVAIL (0|0|0): was /dev/gptid/4167d912", "")
+	d.add("smart selftest", severityWarning, "smart error: disk sde: Completed: read failure", "")
+
+	embed := discordEmbedFor(notification{title: "Health check failed!", message: d.String(), severity: d.severity(), findings: d.findings}, now)
+	assert.Equal(t, "Health check failed!", embed.Title)
+	assert.Equal(t, 0xe74c3c, embed.Color)
+	assert.Equal(t, "2024-03-31T18:40:00Z", embed.Timestamp)
+	assert.Equal(t, []discordField{
+		{Name: "pool status (critical)", Value: "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors"},
+		{Name: "pool status (critical)", Value: "disk 14803813886136010794 - UNAVAIL (0|0|0): was /dev/gptid/4167d912"},
+		{Name: "smart selftest (warning)", Value: "smart error: disk sde: Completed: read failure"},
+	}, embed.Fields)
+
+	heartbeat := discordEmbedFor(notification{title: "Heartbeat", message: "all good", severity: severityInfo}, now)
+	assert.Equal(t, "all good", heartbeat.Description)
+	assert.Equal(t, 0x2ecc71, heartbeat.Color)
+}
+
+func Test_truncate(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "abcdefg...", truncate("abcdefghijklmnop", 10))
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// partitionRe matches a partition of a disk, eg sda1, nvme0n1p2, or ada0p3 on FreeBSD
+var partitionRe = regexp.MustCompile(`^((?:sd|vd|xvd|hd)[a-z]+)\d+$|^(.*\d)p\d+$`)
+
+// diskDevice is the disk a device path from zpool status -L -P is on, eg /dev/sda1 is on sda
+func diskDevice(device string) string {
+	name := path.Base(device)
+	if m := partitionRe.FindStringSubmatch(name); m != nil {
+		return m[1] + m[2]
+	}
+	return name
+}
+
+// checkDiskAge warns about drives powered on longer than life years, and vdevs with more than perVdev of them, since drives that age together tend to fail together.
+// pools are from zpool status -L -P, so disks are named by their device.
+func checkDiskAge(pools []pool, drives []drive, life float64, perVdev int) error {
+	aged := make(map[string]bool)
+	var errs []error
+	for _, d := range drives {
+		years := float64(d.PowerOnHours) / hoursPerYear
+		if years <= life {
+			continue
+		}
+		device, _, _ := strings.Cut(d.Device, ":")
+		aged[device] = true
+		errs = append(errs, fmt.Errorf("disk %s (%s, serial %s) has been powered on for %.1f years, past its %.0f year service life", device, d.Model, d.Serial, years, life))
+	}
+
+	for _, p := range pools {
+		for _, v := range p.vdevs {
+			if v.typev == vdevTypeSpare {
+				continue
+			}
+			var old []string
+			for _, d := range v.disks {
+				if device := diskDevice(d.name); aged[device] {
+					old = append(old, device)
+				}
+			}
+			if len(old) > perVdev {
+				errs = append(errs, fmt.Errorf("vdev %s in pool %s has %d disks past their service life at once: %s", v.name, p.name, len(old), strings.Join(old, ", ")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// readDevicePools reads zpool status -L -P, which names each disk by its device (eg /dev/sda1) rather than its label
+func readDevicePools(e executer) ([]pool, error) {
+	out, err := e("/sbin/zpool", "status", "-L", "-P")
+	if err != nil {
+		return nil, checkError{err}
+	}
+	pools, err := parsePools(out)
+	if len(pools) == 0 && err != nil {
+		return nil, checkError{err}
+	}
+	return pools, nil
+}
+
+// addDiskAges sets the age range of each pool's disks in r, from pools read by readDevicePools
+func (r *heartbeatReport) addDiskAges(pools []pool, drives []drive) {
+	hours := make(map[string]int)
+	for _, d := range drives {
+		device, _, _ := strings.Cut(d.Device, ":")
+		hours[device] = d.PowerOnHours
+	}
+
+	for i := range r.Pools {
+		pr := &r.Pools[i]
+		for _, p := range pools {
+			if p.name != pr.Name {
+				continue
+			}
+			oldest, youngest := -1, -1
+			p.Walk(func(v vdev, d vdevDisk) bool {
+				if h, ok := hours[diskDevice(d.name)]; ok {
+					oldest = max(oldest, h)
+					if youngest < 0 || h < youngest {
+						youngest = h
+					}
+				}
+				return true
+			})
+			if oldest >= 0 {
+				pr.OldestDisk, pr.YoungestDisk = yearsFromHours(oldest), yearsFromHours(youngest)
+			}
+		}
+	}
+}
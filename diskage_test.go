@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_diskDevice(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"/dev/sda1":      "sda",
+		"/dev/sdab2":     "sdab",
+		"/dev/sdc":       "sdc",
+		"/dev/nvme0n1p1": "nvme0n1",
+		"/dev/nvme0n1":   "nvme0n1",
+		"/dev/ada0p3":    "ada0",
+		"/dev/da1":       "da1",
+	}
+	for device, expected := range tests {
+		assert.Equal(t, expected, diskDevice(device), device)
+	}
+}
+
+func Test_checkDiskAge(t *testing.T) {
+	t.Parallel()
+
+	const year = 8766
+	drives := []drive{
+		{Device: "sda", Model: "WDC WD40EFRX", Serial: "WD-1", PowerOnHours: 6 * year},
+		{Device: "sdb:sat", Model: "WDC WD40EFRX", Serial: "WD-2", PowerOnHours: 5*year + 100},
+		{Device: "sdc", Model: "WDC WD40EFRX", Serial: "WD-3", PowerOnHours: 2 * year},
+		{Device: "sdd", Model: "ST4000VN008", Serial: "ZDH-4", PowerOnHours: 7 * year},
+	}
+	pools := []pool{{name: "tank", vdevs: []vdev{
+		{name: "raidz2-0", typev: vdevTypeRaidz, disks: []vdevDisk{{name: "/dev/sda1"}, {name: "/dev/sdb1"}, {name: "/dev/sdc1"}}},
+		{name: "spares", typev: vdevTypeSpare, disks: []vdevDisk{{name: "/dev/sdd1"}}},
+	}}}
+
+	err := checkDiskAge(pools, drives, 5, 1)
+	assert.EqualError(t, err, "disk sda (WDC WD40EFRX, serial WD-1) has been powered on for 6.0 years, past its 5 year service life\n"+
+		"disk sdb (WDC WD40EFRX, serial WD-2) has been powered on for 5.0 years, past its 5 year service life\n"+
+		"disk sdd (ST4000VN008, serial ZDH-4) has been powered on for 7.0 years, past its 5 year service life\n"+
+		"vdev raidz2-0 in pool tank has 2 disks past their service life at once: sda, sdb")
+
+	assert.NoError(t, checkDiskAge(pools, drives, 8, 1))
+}
+
+func Test_addDiskAges(t *testing.T) {
+	t.Parallel()
+
+	drives := []drive{{Device: "sda", PowerOnHours: 61000}, {Device: "sdb", PowerOnHours: 52000}, {Device: "nvme0n1", PowerOnHours: 9000}}
+	pools := []pool{
+		{name: "boot-pool", vdevs: []vdev{{name: "/dev/nvme0n1p3", typev: vdevTypeDisk, disks: []vdevDisk{{name: "/dev/nvme0n1p3"}}}}},
+		{name: "primarySafe", vdevs: []vdev{{name: "mirror-0", typev: vdevTypeRaidz, disks: []vdevDisk{{name: "/dev/sda1"}, {name: "/dev/sdb1"}}}}},
+	}
+	r := newHeartbeatReport(nil, map[string]space{"boot-pool": {avail: 17179869184}, "primarySafe": {avail: 17716740096}}, 61000, 9000, nil, nil)
+	r.addDiskAges(pools, drives)
+
+	assert.Equal(t, "boot-pool: 16.00 GiB free\n  disk age 1.03-1.03 years\nprimarySafe: 16.50 GiB free\n  disk age 5.93-6.96 years\n", r.String(), "the overall range is left out")
+}
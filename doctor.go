@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+type recipientChecker interface {
+	GetRecipientDetails(recipient *pushover.Recipient) (*pushover.RecipientDetails, error)
+}
+
+// doctor checks everything a run depends on and prints a readiness report, returning false if anything is broken
+func doctor(w io.Writer, e executer, app recipientChecker) bool {
+	ok := true
+	report := func(name, detail string, err error) {
+		if err != nil {
+			ok = false
+			fmt.Fprintf(w, "[FAIL] %s: %s\n", name, err)
+		} else {
+			fmt.Fprintf(w, "[ok]   %s: %s\n", name, detail)
+		}
+	}
+
+	for _, cmd := range [][]string{{"/sbin/zpool", "version"}, {"zfs", "version"}, {"/sbin/smartctl", "--version"}} {
+		out, err := e(cmd[0], cmd[1:]...)
+		report(cmd[0], firstLine(out), err)
+	}
+
+	if uid := os.Geteuid(); sudoHelper && uid != 0 {
+		report("root", "running as uid "+strconv.Itoa(uid)+" with the sudo helper", nil)
+	} else if uid != 0 {
+		report("root", "", fmt.Errorf("running as uid %d, zpool and smartctl need root", uid))
+	} else {
+		report("root", "running as root", nil)
+	}
+
+	report("state file", statePath, checkWritable(filepath.Dir(statePath)))
+	if stateMirrorPath != "" {
+		report("state mirror", stateMirrorPath, withTimeout(stateMirrorTimeout, func() error { return checkWritable(filepath.Dir(stateMirrorPath)) }))
+	}
+
+	if pushoverEnabled {
+		_, err := app.GetRecipientDetails(pushover.NewRecipient(user))
+		report("pushover", "token and user key accepted", err)
+	}
+	for _, b := range enabledBackends() {
+		host := backendHost(b)
+		conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+		if err == nil {
+			conn.Close()
+		}
+		report(b.name(), host+" reachable", err)
+	}
+
+	return ok
+}
+
+func checkWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".doctor")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// backendHost is the host:port a backend delivers to
+func backendHost(b backend) string {
+	hostOf := func(raw string) string {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return raw
+		}
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), "443")
+		}
+		return u.Host
+	}
+
+	switch b := b.(type) {
+	case discord:
+		return hostOf(b.webhook)
+	case slack:
+		if b.webhook != "" {
+			return hostOf(b.webhook)
+		}
+		return hostOf(slackAPI)
+	case matrix:
+		return hostOf(b.homeserver)
+	case email:
+		return b.server
+	case sns:
+		parts := strings.Split(b.topicARN, ":")
+		if len(parts) == 6 {
+			return fmt.Sprintf("sns.%s.amazonaws.com:443", parts[3])
+		}
+		return b.topicARN
+	case ses:
+		return fmt.Sprintf("email.%s.amazonaws.com:443", b.region)
+	case groupBackend:
+		return backendHost(b.backend)
+	default:
+		return "api.pushover.net:443"
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_backendHost(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		b    backend
+		host string
+	}{
+		{discord{webhook: "https://discord.com/api/webhooks/1234/abcd"}, "discord.com:443"},
+		{slack{token: "xoxb-1234"}, "slack.com:443"},
+		{matrix{homeserver: "http://matrix.local:8008"}, "matrix.local:8008"},
+		{email{server: "smtp.example.com:587"}, "smtp.example.com:587"},
+		{sns{topicARN: "arn:aws:sns:us-west-2:123456789012:nas"}, "sns.us-west-2.amazonaws.com:443"},
+		{pushoverBackend{}, "api.pushover.net:443"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.host, backendHost(tt.b))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// checkRunDuration warns when a run took longer than limit, naming the checks that took longest, since a disk that's slow to answer smartctl or zpool is often a dying one
+func checkRunDuration(results []checkResult, elapsed, limit time.Duration) error {
+	if limit <= 0 || elapsed <= limit {
+		return nil
+	}
+
+	slowest := slices.Clone(results)
+	slices.SortStableFunc(slowest, func(a, b checkResult) int {
+		return cmp.Compare(b.duration, a.duration)
+	})
+	var names []string
+	for _, r := range slowest[:min(len(slowest), 3)] {
+		if r.duration > 0 {
+			names = append(names, fmt.Sprintf("%s %s", r.name, r.duration.Round(time.Second)))
+		}
+	}
+
+	msg := fmt.Sprintf("run took %s, longer than %s", elapsed.Round(time.Second), limit)
+	if len(names) > 0 {
+		msg += "; slowest checks: " + strings.Join(names, ", ")
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkRunDuration(t *testing.T) {
+	t.Parallel()
+
+	results := []checkResult{
+		{name: "pool status", duration: 2 * time.Second},
+		{name: "smart selftest", duration: 9*time.Minute + 12*time.Second},
+		{name: "zrepl", skipped: true},
+		{name: "health score", duration: 3*time.Minute + 400*time.Millisecond},
+		{name: "disk usage", duration: time.Second},
+	}
+
+	assert.NoError(t, checkRunDuration(results, 5*time.Minute, 10*time.Minute))
+	assert.NoError(t, checkRunDuration(results, time.Hour, 0), "disabled")
+	assert.EqualError(t, checkRunDuration(results, 12*time.Minute+15*time.Second, 10*time.Minute), "run took 12m15s, longer than 10m0s; slowest checks: smart selftest 9m12s, health score 3m0s, pool status 2s")
+	assert.EqualError(t, checkRunDuration(nil, 12*time.Minute, 10*time.Minute), "run took 12m0s, longer than 10m0s")
+}
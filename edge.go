@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// checkEdges picks out the findings of checks that started failing, got more severe, or found a new problem since the last run, and the checks that recovered,
+// recording the severity and problems of each failing check in s. A finding correlate merged from several checks counts for each of them.
+func checkEdges(s *state, results []checkResult, findings []finding) (changed []finding, recovered []string) {
+	worst := make(map[string]severity)
+	problems := make(map[string][]string)
+	for _, f := range findings {
+		for _, check := range f.checks() {
+			if sev, ok := worst[check]; !ok || f.severity > sev {
+				worst[check] = f.severity
+			}
+			problems[check] = append(problems[check], f.message)
+		}
+	}
+	if s.Severities == nil {
+		s.Severities = make(map[string]severity)
+	}
+	if s.Problems == nil {
+		s.Problems = make(map[string][]string)
+	}
+
+	sent := make(map[int]bool)
+	for _, r := range results {
+		if r.skipped {
+			continue
+		}
+		cur, failing := worst[r.name]
+		prev, wasFailing := s.Severities[r.name]
+		worse := !wasFailing || cur > prev
+		switch {
+		case failing:
+			for i, f := range findings {
+				if sent[i] || !slices.Contains(f.checks(), r.name) {
+					continue
+				}
+				if worse || !slices.Contains(s.Problems[r.name], f.message) {
+					changed = append(changed, f)
+					sent[i] = true
+				}
+			}
+		case wasFailing:
+			recovered = append(recovered, r.name)
+		}
+		if failing {
+			s.Severities[r.name] = cur
+			s.Problems[r.name] = problems[r.name]
+		} else {
+			delete(s.Severities, r.name)
+			delete(s.Problems, r.name)
+		}
+	}
+	return changed, recovered
+}
+
+// notifyEdges alerts on what changed since the last run, for edgeTriggered
+func notifyEdges(app notifier, results []checkResult, d digest) {
+	// without the last run to compare against, everything is news
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		d.send(app)
+		return
+	}
+	changed, recovered := checkEdges(&s, results, d.findings)
+	recordAlerts(&s, changed, time.Now())
+	saveState(s)
+
+	if len(changed) > 0 {
+		changes := digest{findings: changed}
+		changes.send(app)
+	}
+	if len(recovered) > 0 {
+		notify(app, notification{title: "Health check recovered", message: strings.Join(recovered, " recovered\n") + " recovered", severity: severityInfo})
+	}
+}
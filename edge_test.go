@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkEdges(t *testing.T) {
+	t.Parallel()
+
+	run := func(s *state, failing map[string]severity) ([]string, []string) {
+		var results []checkResult
+		var d digest
+		for _, name := range []string{"pool status", "disk usage"} {
+			r := checkResult{name: name}
+			if sev, ok := failing[name]; ok {
+				r.severity, r.err = sev, errors.New(name+" failed")
+				d.addError(name, sev, r.err, "")
+			}
+			results = append(results, r)
+		}
+		results = append(results, checkResult{name: "zrepl", skipped: true})
+
+		changed, recovered := checkEdges(s, results, d.findings)
+		var messages []string
+		for _, f := range changed {
+			messages = append(messages, f.message)
+		}
+		return messages, recovered
+	}
+
+	var s state
+	changed, recovered := run(&s, nil)
+	assert.Empty(t, changed)
+	assert.Empty(t, recovered)
+
+	changed, _ = run(&s, map[string]severity{"disk usage": severityWarning})
+	assert.Equal(t, []string{"disk usage failed"}, changed, "healthy to warning")
+	changed, _ = run(&s, map[string]severity{"disk usage": severityWarning})
+	assert.Empty(t, changed, "still a warning")
+
+	changed, _ = run(&s, map[string]severity{"disk usage": severityCritical, "pool status": severityCritical})
+	assert.Equal(t, []string{"pool status failed", "disk usage failed"}, changed, "warning to critical, and healthy to critical")
+	changed, _ = run(&s, map[string]severity{"disk usage": severityWarning, "pool status": severityCritical})
+	assert.Empty(t, changed, "getting better isn't alerted on")
+
+	changed, recovered = run(&s, map[string]severity{"disk usage": severityWarning})
+	assert.Empty(t, changed)
+	assert.Equal(t, []string{"pool status"}, recovered)
+	assert.Equal(t, map[string]severity{"disk usage": severityWarning}, s.Severities)
+}
+
+func Test_checkEdgesCorrelated(t *testing.T) {
+	t.Parallel()
+
+	results := []checkResult{
+		{name: "pool status", severity: severityCritical, err: errors.New("pool tank is ONLINE\ndisk sdd has 12 checksum errors")},
+		{name: "smart selftest", severity: severityWarning, err: smartError{"sdd", "Completed: read failure"}},
+	}
+	merged := []finding{{check: "pool status", severity: severityCritical, message: "sdd (member of tank/raidz2-0) is failing: Completed: read failure + 12 checksum errors", merged: []string{"smart selftest"}}}
+
+	var s state
+	changed, _ := checkEdges(&s, results, merged)
+	assert.Equal(t, merged, changed, "sent once, though it's for both checks")
+
+	// still failing, so not recovered
+	changed, recovered := checkEdges(&s, results, merged)
+	assert.Empty(t, changed)
+	assert.Empty(t, recovered)
+	assert.Equal(t, map[string]severity{"pool status": severityCritical, "smart selftest": severityCritical}, s.Severities)
+}
+
+func Test_checkEdgesNewProblem(t *testing.T) {
+	t.Parallel()
+
+	run := func(s *state, messages ...string) []finding {
+		var d digest
+		for _, m := range messages {
+			d.add("pool status", severityCritical, m, "")
+		}
+		changed, _ := checkEdges(s, []checkResult{{name: "pool status", severity: severityCritical, err: errors.New("failed")}}, d.findings)
+		return changed
+	}
+
+	var s state
+	assert.Len(t, run(&s, "pool tank is DEGRADED"), 1)
+	assert.Empty(t, run(&s, "pool tank is DEGRADED"))
+	changed := run(&s, "pool tank is DEGRADED", "pool backup is DEGRADED")
+	require.Len(t, changed, 1, "a second pool degrading at the same severity")
+	assert.Equal(t, "pool backup is DEGRADED", changed[0].message)
+	assert.Empty(t, run(&s, "pool backup is DEGRADED"), "one pool getting better isn't alerted on")
+	assert.Len(t, run(&s, "pool tank is DEGRADED", "pool backup is DEGRADED"), 1, "but it coming back is")
+}
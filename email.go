@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// email sends notifications over SMTP, upgrading to TLS when the server supports it
+type email struct {
+	server   string // host:port
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (e email) name() string {
+	return "email"
+}
+
+func (e email) send(n notification) error {
+	var auth smtp.Auth
+	if e.username != "" {
+		host, _, _ := net.SplitHostPort(e.server)
+		auth = smtp.PlainAuth("", e.username, e.password, host)
+	}
+	return smtp.SendMail(e.server, auth, e.from, e.to, e.message(n, time.Now()))
+}
+
+func (e email) message(n notification, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", e.from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&b, "Subject: [%s] %s\r\n", n.severity, n.title)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(n.message, "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// envPrefix starts the environment variables that override settings, for a container or pod whose settings come from its environment or mounted files rather than a rebuild
+const envPrefix = "HEARTBEAT_"
+
+// envSettings are the settings that can come from the environment, by variable name after envPrefix
+var envSettings = map[string]*string{
+	"STATE_PATH":        &statePath,
+	"STATE_MIRROR_PATH": &stateMirrorPath,
+	"STATUS_PATH":       &statusPath,
+	"LOCK_PATH":         &lockPath,
+	"AUDIT_LOG_PATH":    &auditLogPath,
+}
+
+// lookupSetting finds a setting in the environment variable envPrefix+name, or in the file named by envPrefix+name+"_FILE", eg a mounted secret or ConfigMap
+func lookupSetting(getenv func(string) string, readFile func(string) ([]byte, error), name string) (string, bool, error) {
+	if value := getenv(envPrefix + name); value != "" {
+		return value, true, nil
+	}
+	path := getenv(envPrefix + name + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := readFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s%s_FILE: %w", envPrefix, name, err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// applyEnv overrides settings from the environment, returning where logs should go.
+// Besides envSettings, HEARTBEAT_NOTIFY_URLS adds to notifyURLs (separated by commas or whitespace) and HEARTBEAT_DISABLED_CHECKS to disabledChecks (separated by commas, since check names have spaces in them), and HEARTBEAT_LOG_FORMAT=json logs a line of JSON per message.
+func applyEnv(getenv func(string) string, readFile func(string) ([]byte, error), logs io.Writer) (io.Writer, error) {
+	for _, name := range sortedKeys(envSettings) {
+		value, ok, err := lookupSetting(getenv, readFile, name)
+		if err != nil {
+			return logs, err
+		}
+		if ok {
+			*envSettings[name] = value
+		}
+	}
+
+	split := func(s string) []string {
+		return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' || r == '\t' })
+	}
+	urls, _, err := lookupSetting(getenv, readFile, "NOTIFY_URLS")
+	if err != nil {
+		return logs, err
+	}
+	notifyURLs = append(notifyURLs, split(urls)...)
+	checks, _, err := lookupSetting(getenv, readFile, "DISABLED_CHECKS")
+	if err != nil {
+		return logs, err
+	}
+	for _, name := range strings.Split(checks, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			disabledChecks = append(disabledChecks, name)
+		}
+	}
+
+	switch format := getenv(envPrefix + "LOG_FORMAT"); format {
+	case "", "text":
+		return logs, nil
+	case "json":
+		return jsonLog{w: logs}, nil
+	default:
+		return logs, fmt.Errorf("%sLOG_FORMAT: unknown log format %q, expected text or json", envPrefix, format)
+	}
+}
+
+// jsonLog writes each log message as a line of JSON, for log collectors that parse them (eg in kubernetes). It's meant for a logger without flags, since it adds its own timestamp.
+type jsonLog struct {
+	w io.Writer
+}
+
+func (l jsonLog) Write(p []byte) (int, error) {
+	entry := struct {
+		Time     time.Time `json:"time"`
+		Message  string    `json:"msg"`
+		Instance string    `json:"instance,omitempty"`
+	}{time.Now(), strings.TrimSuffix(string(p), "\n"), instanceName}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// useEnv applies the environment to the settings and the logger, exiting if it's unusable
+func useEnv() {
+	logs, err := applyEnv(os.Getenv, os.ReadFile, os.Stderr)
+	if _, ok := logs.(jsonLog); ok {
+		log.SetFlags(0)
+	}
+	log.SetOutput(logs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
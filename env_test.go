@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_applyEnv(t *testing.T) {
+	oldState, oldStatus, oldURLs, oldDisabled := statePath, statusPath, notifyURLs, disabledChecks
+	defer func() {
+		statePath, statusPath, notifyURLs, disabledChecks = oldState, oldStatus, oldURLs, oldDisabled
+	}()
+
+	env := map[string]string{
+		"HEARTBEAT_STATE_PATH":       "/var/lib/heartbeat/state.json",
+		"HEARTBEAT_NOTIFY_URLS_FILE": "/run/secrets/notify",
+		"HEARTBEAT_DISABLED_CHECKS":  "sas links, network",
+		"HEARTBEAT_LOG_FORMAT":       "json",
+	}
+	files := map[string]string{"/run/secrets/notify": "pushover://token@user\ndiscord://id/token\n"}
+	readFile := func(path string) ([]byte, error) {
+		if data, ok := files[path]; ok {
+			return []byte(data), nil
+		}
+		return nil, os.ErrNotExist
+	}
+
+	var buf bytes.Buffer
+	logs, err := applyEnv(func(name string) string { return env[name] }, readFile, &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "/var/lib/heartbeat/state.json", statePath)
+	assert.Equal(t, oldStatus, statusPath)
+	assert.Equal(t, append(append([]string{}, oldURLs...), "pushover://token@user", "discord://id/token"), notifyURLs)
+	assert.Equal(t, append(append([]string{}, oldDisabled...), "sas links", "network"), disabledChecks)
+
+	log.New(logs, "", 0).Println("Running heartbeat job...")
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	assert.Equal(t, "Running heartbeat job...", entry["msg"])
+	assert.Contains(t, entry, "time")
+
+	env = map[string]string{"HEARTBEAT_STATUS_PATH_FILE": "/missing"}
+	_, err = applyEnv(func(name string) string { return env[name] }, readFile, &buf)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	env = map[string]string{"HEARTBEAT_LOG_FORMAT": "logfmt"}
+	_, err = applyEnv(func(name string) string { return env[name] }, readFile, &buf)
+	assert.EqualError(t, err, `HEARTBEAT_LOG_FORMAT: unknown log format "logfmt", expected text or json`)
+}
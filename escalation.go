@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+const twilioAPI = "https://api.twilio.com/2010-04-01"
+
+// escalation tracks an emergency priority pushover alert until it's acknowledged or escalated to SMS
+type escalation struct {
+	Receipt   string
+	Sent      time.Time
+	Title     string
+	Message   string
+	Escalated bool
+}
+
+type receiptChecker interface {
+	GetReceiptDetails(receipt string) (*pushover.ReceiptDetails, error)
+}
+
+func smsEscalationEnabled() bool {
+	return twilioSID != "" && len(smsTo) > 0
+}
+
+// trackEscalation remembers a critical alert so it can be escalated if nobody acknowledges it
+func trackEscalation(n notification, resp *pushover.Response) {
+	if resp == nil || resp.Receipt == "" {
+		return
+	}
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return
+	}
+	s.Escalation = &escalation{Receipt: resp.Receipt, Sent: time.Now(), Title: n.title, Message: n.message}
+	saveState(s)
+}
+
+// checkEscalation texts smsTo if the last critical alert still hasn't been acknowledged after escalateAfter
+func checkEscalation(app receiptChecker, now time.Time) {
+	if !smsEscalationEnabled() {
+		return
+	}
+	s, err := loadState()
+	if err != nil {
+		return
+	}
+	send := func(to, body string) error { return sendSMS(twilioAPI, to, body) }
+	if escalate(app, &s, smsTo, send, now) {
+		saveState(s)
+	}
+}
+
+// escalate texts the escalation in s to each of to with send, once nobody has acknowledged it for escalateAfter, and reports whether s changed.
+// If no text goes out, it's tried again next run.
+func escalate(app receiptChecker, s *state, to []string, send func(to, body string) error, now time.Time) bool {
+	if s.Escalation == nil || s.Escalation.Escalated || now.Sub(s.Escalation.Sent) < escalateAfter {
+		return false
+	}
+
+	receipt, err := app.GetReceiptDetails(s.Escalation.Receipt)
+	if err != nil {
+		log.Println("error checking pushover receipt: " + err.Error())
+		return false
+	}
+	if receipt.Acknowledged {
+		log.Printf("critical alert acknowledged by %s", receipt.AcknowledgedBy)
+		s.Escalation = nil
+		return true
+	}
+
+	body := fmt.Sprintf("UNACKNOWLEDGED for %s: %s\n%s", now.Sub(s.Escalation.Sent).Round(time.Minute), s.Escalation.Title, s.Escalation.Message)
+	for _, number := range to {
+		if err := send(number, body); err != nil {
+			log.Printf("error sending sms to %s: %s", number, err)
+			continue
+		}
+		s.Escalation.Escalated = true
+	}
+	return s.Escalation.Escalated
+}
+
+// sendSMS texts body to a phone number through the twilio API at api
+func sendSMS(api, to, body string) error {
+	form := url.Values{
+		"To":   {to},
+		"From": {twilioFrom},
+		"Body": {truncate(body, 1600)},
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/Accounts/%s/Messages.json", api, twilioSID), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(twilioSID, twilioToken)
+
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("twilio: %s", resp.Status)
+	}
+	return nil
+}
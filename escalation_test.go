@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gregdel/pushover"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReceipts answers receipt lookups with details, or err
+type fakeReceipts struct {
+	details pushover.ReceiptDetails
+	err     error
+	checked []string
+}
+
+func (f *fakeReceipts) GetReceiptDetails(receipt string) (*pushover.ReceiptDetails, error) {
+	f.checked = append(f.checked, receipt)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &f.details, nil
+}
+
+func Test_escalate(t *testing.T) {
+	t.Parallel()
+
+	sent := time.Date(2024, time.April, 6, 3, 0, 0, 0, time.UTC)
+	pending := escalation{Receipt: "r1", Sent: sent, Title: "Pool degraded", Message: "sdb is faulted"}
+	tests := []struct {
+		name       string
+		escalation *escalation
+		receipt    pushover.ReceiptDetails
+		receiptErr error
+		sendErr    error
+		now        time.Time
+		changed    bool
+		want       *escalation
+		texts      []string
+	}{
+		{
+			name:       "acknowledged",
+			escalation: &pending,
+			receipt:    pushover.ReceiptDetails{Acknowledged: true, AcknowledgedBy: "u1"},
+			now:        sent.Add(escalateAfter),
+			changed:    true,
+		},
+		{
+			name:       "unacknowledged past the deadline",
+			escalation: &pending,
+			now:        sent.Add(escalateAfter + 2*time.Minute),
+			changed:    true,
+			want:       &escalation{Receipt: "r1", Sent: sent, Title: "Pool degraded", Message: "sdb is faulted", Escalated: true},
+			texts:      []string{"+15555550100: UNACKNOWLEDGED for 17m0s: Pool degraded\nsdb is faulted", "+15555550101: UNACKNOWLEDGED for 17m0s: Pool degraded\nsdb is faulted"},
+		},
+		{
+			name:       "before the deadline",
+			escalation: &pending,
+			now:        sent.Add(escalateAfter - time.Minute),
+			want:       &pending,
+		},
+		{
+			name:       "already escalated",
+			escalation: &escalation{Receipt: "r1", Sent: sent, Escalated: true},
+			now:        sent.Add(time.Hour),
+			want:       &escalation{Receipt: "r1", Sent: sent, Escalated: true},
+		},
+		{
+			name:       "sms failure",
+			escalation: &pending,
+			sendErr:    errors.New("twilio: 401 Unauthorized"),
+			now:        sent.Add(escalateAfter),
+			want:       &pending,
+		},
+		{
+			name:       "receipt lookup failure",
+			escalation: &pending,
+			receiptErr: errors.New("pushover: 500"),
+			now:        sent.Add(escalateAfter),
+			want:       &pending,
+		},
+		{
+			name: "nothing to escalate",
+			now:  sent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := state{}
+			if tt.escalation != nil {
+				e := *tt.escalation
+				s.Escalation = &e
+			}
+			app := &fakeReceipts{details: tt.receipt, err: tt.receiptErr}
+			var texts []string
+			send := func(to, body string) error {
+				if tt.sendErr != nil {
+					return tt.sendErr
+				}
+				texts = append(texts, to+": "+body)
+				return nil
+			}
+
+			assert.Equal(t, tt.changed, escalate(app, &s, []string{"+15555550100", "+15555550101"}, send, tt.now))
+			assert.Equal(t, tt.want, s.Escalation)
+			assert.Equal(t, tt.texts, texts)
+			if tt.escalation == nil || tt.escalation.Escalated || tt.now.Sub(sent) < escalateAfter {
+				assert.Empty(t, app.checked, "the receipt is only checked once it's due")
+			}
+		})
+	}
+}
+
+func Test_trackEscalation(t *testing.T) {
+	oldState, oldMirror := statePath, stateMirrorPath
+	defer func() { statePath, stateMirrorPath = oldState, oldMirror }()
+	statePath, stateMirrorPath = t.TempDir()+"/heartbeat.json", ""
+
+	n := notification{title: "Pool degraded", message: "sdb is faulted", severity: severityCritical}
+	trackEscalation(n, &pushover.Response{})
+	s, err := loadState()
+	require.NoError(t, err)
+	assert.Nil(t, s.Escalation, "only emergency priority messages have a receipt to track")
+
+	trackEscalation(n, &pushover.Response{Receipt: "r1"})
+	s, err = loadState()
+	require.NoError(t, err)
+	require.NotNil(t, s.Escalation)
+	assert.Equal(t, "r1", s.Escalation.Receipt)
+	assert.Equal(t, "Pool degraded", s.Escalation.Title)
+	assert.Equal(t, "sdb is faulted", s.Escalation.Message)
+	assert.False(t, s.Escalation.Escalated)
+}
+
+func Test_sendSMS(t *testing.T) {
+	t.Parallel()
+
+	var method, path string
+	var form map[string][]string
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method, path = r.Method, r.URL.Path
+		r.ParseForm()
+		form = r.PostForm
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	require.NoError(t, sendSMS(server.URL, "+15555550100", "UNACKNOWLEDGED for 15m0s: Pool degraded"))
+	assert.Equal(t, http.MethodPost, method)
+	assert.Equal(t, "/Accounts/"+twilioSID+"/Messages.json", path)
+	assert.Equal(t, []string{"+15555550100"}, form["To"])
+	assert.Equal(t, []string{"UNACKNOWLEDGED for 15m0s: Pool degraded"}, form["Body"])
+
+	status = http.StatusUnauthorized
+	assert.EqualError(t, sendSMS(server.URL, "+15555550100", "hi"), "twilio: 401 Unauthorized")
+}
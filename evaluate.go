@@ -0,0 +1,267 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// noDataErrors is the errors line of a pool without damaged data
+const noDataErrors = "errors: No known data errors"
+
+// reason is one thing wrong with a pool, vdev, or disk
+type reason struct {
+	Device   string   `json:"device"` // pool, vdev, or disk
+	Name     string   `json:"name"`
+	Kind     string   `json:"kind"`
+	Problem  string   `json:"problem"`
+	Severity severity `json:"severity"`
+}
+
+// kinds of reason
+const (
+	reasonState   = "state"   // not ONLINE, or not AVAIL for a spare
+	reasonErrors  = "errors"  // read, write, or checksum errors
+	reasonMessage = "message" // zpool status has something to say about an ONLINE disk, eg (resilvering)
+	reasonData    = "data"    // damaged data in the pool
+)
+
+func (r reason) String() string {
+	return fmt.Sprintf("%s %s %s", r.Device, r.Name, r.Problem)
+}
+
+// evaluation is everything wrong with a pool, vdev, or disk, and how serious the worst of it is
+type evaluation struct {
+	Severity severity `json:"severity"`
+	Reasons  []reason `json:"reasons,omitempty"`
+}
+
+func (e evaluation) Healthy() bool {
+	return len(e.Reasons) == 0
+}
+
+func (e *evaluation) add(r reason) {
+	e.Reasons = append(e.Reasons, r)
+	e.Severity = max(e.Severity, r.Severity)
+}
+
+// err lists the reasons under heading, one per line, at e's severity
+func (e evaluation) err(heading string) error {
+	lines := []string{heading}
+	for _, r := range e.Reasons {
+		if r.String() != heading {
+			lines = append(lines, r.String())
+		}
+	}
+	return severityError{e.Severity, errors.New(strings.Join(lines, "\n"))}
+}
+
+func (e *evaluation) merge(other evaluation) {
+	for _, r := range other.Reasons {
+		e.add(r)
+	}
+}
+
+// stateSeverity is how serious it is for a pool, vdev, or disk to be in state. A disk someone took offline is only a warning
+func stateSeverity(state deviceState) severity {
+	if state == stateOffline {
+		return severityWarning
+	}
+	return severityCritical
+}
+
+// parity is how many disks v can lose without losing data: the parity of a raidz or draid, one less than the width of a mirror, and none for a disk on its own
+func (v vdev) parity() int {
+	switch v.kind() {
+	case "mirror":
+		return max(v.members()-1, 0)
+	case "raidz", "draid":
+		// eg raidz2-0 or draid2:4d:12c:1s-0, where raidz-0 and draid:... are single parity
+		level := strings.TrimLeft(v.name, "abcdefghijklmnopqrstuvwxyz")
+		if n := strings.IndexAny(level, "-:"); n >= 0 {
+			level = level[:n]
+		}
+		if n, err := strconv.Atoi(level); err == nil {
+			return n
+		}
+		return 1
+	default:
+		return 0
+	}
+}
+
+// members counts v's disks, with a replacing or spare group counted as the one disk it stands for
+func (v vdev) members() int {
+	groups := make(map[string]bool)
+	var n int
+	for _, d := range v.disks {
+		group := d.replacing + d.spare
+		if group == "" || !groups[group] {
+			n++
+		}
+		if group != "" {
+			groups[group] = true
+		}
+	}
+	return n
+}
+
+// lost counts v's disks that aren't ONLINE, where a replacing or spare group is only lost if none of its disks are ONLINE
+func (v vdev) lost() int {
+	online := make(map[string]bool)
+	for _, d := range v.disks {
+		if group := d.replacing + d.spare; group != "" && d.state == stateOnline {
+			online[group] = true
+		}
+	}
+	counted := make(map[string]bool)
+	var n int
+	for _, d := range v.disks {
+		group := d.replacing + d.spare
+		if d.state == stateOnline || group != "" && (online[group] || counted[group]) {
+			continue
+		}
+		counted[group] = true
+		n++
+	}
+	return n
+}
+
+// lossSeverity is how serious it is for v to have lost that many disks: a warning while it has redundancy left, and critical once another failure would lose data
+func (v vdev) lossSeverity(lost int) severity {
+	if lost < v.parity() {
+		return severityWarning
+	}
+	return severityCritical
+}
+
+// redundancyProblem describes how many more disks v can lose, eg "can lose 1 more disk"
+func (v vdev) redundancyProblem(lost int) string {
+	switch left := v.parity() - lost; {
+	case left <= 0:
+		return "has no redundancy left"
+	case left == 1:
+		return "can lose 1 more disk"
+	default:
+		return fmt.Sprintf("can lose %d more disks", left)
+	}
+}
+
+// stateProblem describes being in state, with zpool's message about it if there is one
+func stateProblem(state deviceState, message string) string {
+	if message == "" {
+		return "is " + string(state)
+	}
+	return fmt.Sprintf("is %s: %s", state, message)
+}
+
+// countsSeverity is a warning for a few errors (at most transientErrorLimit), which may be transient, and critical for more
+func countsSeverity(read, write, checksum int) severity {
+	if read+write+checksum > transientErrorLimit {
+		return severityCritical
+	}
+	return severityWarning
+}
+
+// countsProblem describes read, write, and checksum errors, or is empty if there are none
+func countsProblem(read, write, checksum int) string {
+	var counts []string
+	for _, c := range []struct {
+		n    int
+		kind string
+	}{{read, "read"}, {write, "write"}, {checksum, "checksum"}} {
+		if c.n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", c.n, c.kind))
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	return "has " + strings.Join(counts, ", ") + " errors"
+}
+
+// Evaluate reports everything wrong with p and its vdevs and disks
+func (p pool) Evaluate() evaluation {
+	var e evaluation
+	if p.state != stateOnline {
+		e.add(reason{"pool", p.name, reasonState, stateProblem(p.state, ""), p.degradedSeverity()})
+	}
+	if problem := countsProblem(p.read, p.write, p.checksum); problem != "" {
+		e.add(reason{"pool", p.name, reasonErrors, problem, countsSeverity(p.read, p.write, p.checksum)})
+	}
+	switch p.errors {
+	case noDataErrors:
+	case "":
+		e.add(reason{"pool", p.name, reasonData, "has no errors line in zpool status", severityWarning})
+	default:
+		e.add(reason{"pool", p.name, reasonData, "reports " + p.errors, severityCritical})
+	}
+	for _, v := range p.vdevs {
+		e.merge(v.Evaluate())
+	}
+	return e
+}
+
+// degradedSeverity is how serious p's state is. A DEGRADED pool is only as bad as its worst vdev, so a raidz2 missing a disk is a warning, where a mirror missing one is critical
+func (p pool) degradedSeverity() severity {
+	if p.state != stateDegraded {
+		return stateSeverity(p.state)
+	}
+	var sev severity
+	var found bool
+	for _, v := range p.vdevs {
+		if lost := v.lost(); v.typev == vdevTypeRaidz && lost > 0 {
+			sev, found = max(sev, v.lossSeverity(lost)), true
+		}
+	}
+	if !found {
+		return severityCritical
+	}
+	return sev
+}
+
+// Evaluate reports everything wrong with v and its disks. A lone disk vdev is reported as the disk
+func (v vdev) Evaluate() evaluation {
+	var e evaluation
+	if v.typev != vdevTypeSpare && v.typev != vdevTypeDisk {
+		if lost := v.lost(); v.state == stateDegraded && lost > 0 {
+			e.add(reason{"vdev", v.name, reasonState, stateProblem(v.state, v.redundancyProblem(lost)), v.lossSeverity(lost)})
+		} else if v.state != stateOnline {
+			e.add(reason{"vdev", v.name, reasonState, stateProblem(v.state, ""), stateSeverity(v.state)})
+		}
+		if problem := countsProblem(v.read, v.write, v.checksum); problem != "" {
+			e.add(reason{"vdev", v.name, reasonErrors, problem, countsSeverity(v.read, v.write, v.checksum)})
+		}
+	}
+	for _, d := range v.disks {
+		e.merge(d.Evaluate())
+	}
+	return e
+}
+
+// Evaluate reports everything wrong with d. A spare only needs to be available
+func (d vdevDisk) Evaluate() evaluation {
+	var e evaluation
+	if d.vdev != nil && d.vdev.typev == vdevTypeSpare {
+		if d.state != stateAvail {
+			e.add(reason{"spare", d.name, reasonState, stateProblem(d.state, d.message), severityWarning})
+		}
+		return e
+	}
+
+	if d.state != stateOnline {
+		sev := stateSeverity(d.state)
+		if d.vdev != nil && d.vdev.typev == vdevTypeRaidz {
+			// this disk counts as lost even when it's evaluated apart from the rest of its vdev
+			sev = d.vdev.lossSeverity(max(d.vdev.lost(), 1))
+		}
+		e.add(reason{"disk", d.name, reasonState, stateProblem(d.state, d.message), sev})
+	} else if d.message != "" {
+		e.add(reason{"disk", d.name, reasonMessage, d.message, severityWarning})
+	}
+	if problem := countsProblem(d.read, d.write, d.checksum); problem != "" {
+		e.add(reason{"disk", d.name, reasonErrors, problem, countsSeverity(d.read, d.write, d.checksum)})
+	}
+	return e
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_vdevDiskEvaluate(t *testing.T) {
+	t.Parallel()
+
+	raidz := &vdev{name: "raidz2-0", typev: vdevTypeRaidz}
+	spares := &vdev{name: "spares", typev: vdevTypeSpare}
+	tests := []struct {
+		disk     vdevDisk
+		severity severity
+		reasons  []string
+	}{
+		{vdevDisk{vdev: raidz, name: "sda", state: stateOnline}, severityInfo, nil},
+		{vdevDisk{vdev: raidz, name: "sda", state: stateOffline}, severityWarning, []string{"disk sda is OFFLINE"}},
+		{vdevDisk{vdev: raidz, name: "sda", state: stateFaulted, read: 12, message: "too many errors"}, severityCritical, []string{"disk sda is FAULTED: too many errors", "disk sda has 12 read errors"}},
+		{vdevDisk{vdev: raidz, name: "sda", state: stateOnline, checksum: 2}, severityWarning, []string{"disk sda has 2 checksum errors"}},
+		{vdevDisk{vdev: raidz, name: "sda", state: stateOnline, read: 1, write: 1, checksum: 2}, severityCritical, []string{"disk sda has 1 read, 1 write, 2 checksum errors"}},
+		{vdevDisk{vdev: raidz, name: "sda", state: stateOnline, message: "(resilvering)"}, severityWarning, []string{"disk sda (resilvering)"}},
+		{vdevDisk{vdev: spares, name: "sdf", state: stateAvail}, severityInfo, nil},
+		{vdevDisk{vdev: spares, name: "sdf", state: stateInUse, message: "currently in use"}, severityWarning, []string{"spare sdf is INUSE: currently in use"}},
+	}
+
+	for _, tt := range tests {
+		ev := tt.disk.Evaluate()
+		var reasons []string
+		for _, r := range ev.Reasons {
+			reasons = append(reasons, r.String())
+		}
+		assert.Equal(t, tt.reasons, reasons, tt.disk.String())
+		assert.Equal(t, tt.severity, ev.Severity, tt.disk.String())
+		assert.Equal(t, tt.reasons == nil, tt.disk.Healthy(), tt.disk.String())
+	}
+}
+
+func Test_poolEvaluate(t *testing.T) {
+	t.Parallel()
+
+	p := pool{name: "tank", state: stateOnline, errors: "errors: Permanent errors have been detected in the following files:\n/tank/photos/IMG_4412.CR2"}
+	ev := p.Evaluate()
+	assert.Equal(t, severityCritical, ev.Severity)
+	assert.EqualError(t, ev.err("pool tank is ONLINE"), "pool tank is ONLINE\npool tank reports errors: Permanent errors have been detected in the following files:\n/tank/photos/IMG_4412.CR2")
+
+	data, err := json.Marshal(ev.Reasons[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"device":"pool","name":"tank","kind":"data","problem":"reports errors: Permanent errors have been detected in the following files:\n/tank/photos/IMG_4412.CR2","severity":"critical"}`, string(data))
+
+	// the pool's state is the heading, so it isn't repeated
+	p = pool{name: "tank", state: stateDegraded, errors: noDataErrors}
+	assert.EqualError(t, p.Evaluate().err("pool tank is DEGRADED"), "pool tank is DEGRADED")
+}
+
+func Test_poolEvaluateRedundancy(t *testing.T) {
+	t.Parallel()
+
+	degraded := func(vdevName string, states ...deviceState) pool {
+		v := vdev{name: vdevName, state: stateDegraded, typev: vdevTypeRaidz}
+		if !vdevRe.MatchString(vdevName) {
+			v.typev = vdevTypeDisk
+		}
+		for i, s := range states {
+			v.disks = append(v.disks, vdevDisk{name: fmt.Sprintf("sd%c", 'a'+i), state: s})
+		}
+		p := pool{name: "tank", state: stateDegraded, errors: noDataErrors, vdevs: []vdev{v}}
+		p.vdevs[0].relink()
+		return p
+	}
+	on, gone := stateOnline, stateUnavail
+
+	tests := []struct {
+		pool     pool
+		severity severity
+		vdev     string // the vdev's reason
+	}{
+		{degraded("raidz2-0", on, on, gone, on, on, on), severityWarning, "vdev raidz2-0 is DEGRADED: can lose 1 more disk"},
+		{degraded("raidz2-0", on, gone, gone, on, on, on), severityCritical, "vdev raidz2-0 is DEGRADED: has no redundancy left"},
+		{degraded("raidz3-0", on, gone, on, on, on, on), severityWarning, "vdev raidz3-0 is DEGRADED: can lose 2 more disks"},
+		{degraded("raidz1-0", on, gone, on), severityCritical, "vdev raidz1-0 is DEGRADED: has no redundancy left"},
+		{degraded("raidz-0", on, gone, on), severityCritical, "vdev raidz-0 is DEGRADED: has no redundancy left"},
+		{degraded("draid2:4d:12c:1s-0", on, gone, on, on, on, on, on, on, on, on, on, on), severityWarning, "vdev draid2:4d:12c:1s-0 is DEGRADED: can lose 1 more disk"},
+		{degraded("mirror-0", on, gone), severityCritical, "vdev mirror-0 is DEGRADED: has no redundancy left"},
+		{degraded("mirror-0", on, gone, on), severityWarning, "vdev mirror-0 is DEGRADED: can lose 1 more disk"},
+		{degraded("sda", gone), severityCritical, ""},
+	}
+
+	for _, tt := range tests {
+		ev := tt.pool.Evaluate()
+		assert.Equal(t, tt.severity, ev.Severity, tt.pool.vdevs[0].name)
+		var vdevReason string
+		for _, r := range ev.Reasons {
+			if r.Device == "vdev" {
+				vdevReason = r.String()
+			}
+			assert.Equal(t, tt.severity, r.Severity, r.String())
+		}
+		assert.Equal(t, tt.vdev, vdevReason)
+	}
+
+	// a hot spare standing in for a lost disk gives the redundancy back
+	p := degraded("raidz1-0", on, gone, on, on)
+	p.vdevs[0].disks[1].spare = "spare-1"
+	p.vdevs[0].disks[3].spare = "spare-1"
+	assert.Equal(t, 3, p.vdevs[0].members())
+	assert.Equal(t, 0, p.vdevs[0].lost())
+}
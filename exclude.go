@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// smartTargets splits disks into the ones to check and the ones an exclude rule skips, with the rule that skipped each.
+// Rules are serial:<serial number>, model:<glob>, or path:<glob> (eg path:sdf or path:/dev/disk/by-id/usb-*). Serial and model rules need smartctl -i, so disks are only identified when there are any.
+func smartTargets(e executer, disks []string, exclude []string) ([]string, map[string]string) {
+	identify := false
+	for _, rule := range exclude {
+		if !strings.HasPrefix(rule, "path:") {
+			identify = true
+		}
+	}
+
+	var targets []string
+	skipped := make(map[string]string)
+disks:
+	for _, disk := range disks {
+		var d drive
+		if identify {
+			// a disk that can't be identified is checked, so whatever is wrong with it is reported
+			if out, err := e("/sbin/smartctl", smartctlArgs(disk, "-i")...); err == nil {
+				d = parseDrive(out)
+			}
+		}
+
+		for _, rule := range exclude {
+			kind, pattern, _ := strings.Cut(rule, ":")
+			var match bool
+			switch kind {
+			case "serial":
+				match = d.Serial != "" && d.Serial == pattern
+			case "model":
+				match, _ = path.Match(pattern, d.Model)
+				match = match && d.Model != ""
+			case "path":
+				short, _ := path.Match(pattern, disk)
+				full, _ := path.Match(pattern, "/dev/"+disk)
+				match = short || full
+			}
+			if match {
+				skipped[disk] = fmt.Sprintf("excluded by %s", rule)
+				continue disks
+			}
+		}
+		targets = append(targets, disk)
+	}
+	return targets, skipped
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_smartTargets(t *testing.T) {
+	t.Parallel()
+
+	info, err := os.ReadFile("testFiles/smartInfo.txt")
+	require.NoError(t, err)
+	nvme, err := os.ReadFile("testFiles/smartInfoNvme.txt")
+	require.NoError(t, err)
+
+	var identified int
+	e := func(cmd string, args ...string) (string, error) {
+		identified++
+		switch args[1] {
+		case "/dev/sdb":
+			return string(info), nil
+		case "/dev/nvme0":
+			return string(nvme), nil
+		}
+		return "", errors.New("exit status 2")
+	}
+	disks := []string{"sda", "sdb", "nvme0", "sdf"}
+
+	targets, skipped := smartTargets(e, disks, []string{"path:sdf"})
+	assert.Equal(t, []string{"sda", "sdb", "nvme0"}, targets)
+	assert.Equal(t, map[string]string{"sdf": "excluded by path:sdf"}, skipped)
+	assert.Zero(t, identified)
+
+	targets, skipped = smartTargets(e, disks, []string{"serial:WD-WX31D87HJ4KL", "model:Samsung*", "path:/dev/sdz"})
+	assert.Equal(t, []string{"sda", "sdf"}, targets)
+	assert.Equal(t, map[string]string{"sdb": "excluded by serial:WD-WX31D87HJ4KL", "nvme0": "excluded by model:Samsung*"}, skipped)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const hoursPerYear = 24 * 365.25
+
+// driveRecord is the history kept for each physical drive, keyed by serial number
+type driveRecord struct {
+	Model         string
+	Device        string
+	PowerOnHours  int
+	SelfTestHours int // power on hours of the latest self-test, corrected for the self-test log wrapping at 65536
+	FirstSeen     time.Time
+	LastSeen      time.Time
+}
+
+// ReplaceBy projects when the drive reaches driveServiceLife, assuming it stays powered on
+func (r driveRecord) ReplaceBy() time.Time {
+	remaining := driveServiceLife*hoursPerYear - float64(r.PowerOnHours)
+	return r.LastSeen.Add(time.Duration(remaining) * time.Hour)
+}
+
+// recordDrives saves the drive history and inventory, returning any unexpected changes in the inventory
+func recordDrives(drives []drive, selfTests map[string]int, now time.Time) []string {
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return nil
+	}
+	updateDriveRecords(&s, drives, selfTests, now)
+	changes := updateInventory(&s, drives)
+	saveState(s)
+
+	return changes
+}
+
+func updateDriveRecords(s *state, drives []drive, selfTests map[string]int, now time.Time) {
+	if s.Drives == nil {
+		s.Drives = make(map[string]driveRecord)
+	}
+	for _, d := range drives {
+		r, ok := s.Drives[d.Serial]
+		if !ok {
+			r.FirstSeen = now
+		}
+		r.Model = d.Model
+		r.Device = d.Device
+		r.PowerOnHours = d.PowerOnHours
+		if hours, ok := selfTests[d.Device]; ok {
+			r.SelfTestHours = hours
+		}
+		r.LastSeen = now
+		s.Drives[d.Serial] = r
+	}
+}
+
+// fleet prints every drive we've seen, soonest replacement first
+func fleet(w io.Writer, s state) {
+	serials := make([]string, 0, len(s.Drives))
+	for serial := range s.Drives {
+		serials = append(serials, serial)
+	}
+	sort.Slice(serials, func(i, j int) bool {
+		return s.Drives[serials[i]].ReplaceBy().Before(s.Drives[serials[j]].ReplaceBy())
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIAL\tMODEL\tDEVICE\tAGE\tREPLACE BY\tLAST SEEN")
+	for _, serial := range serials {
+		r := s.Drives[serial]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f years\t%s\t%s\n", serial, r.Model, r.Device, yearsFromHours(r.PowerOnHours), r.ReplaceBy().Format("2006-01-02"), r.LastSeen.Format("2006-01-02"))
+	}
+	tw.Flush()
+}
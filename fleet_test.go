@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_fleet(t *testing.T) {
+	t.Parallel()
+
+	var s state
+	first := time.Date(2024, time.January, 1, 8, 0, 0, 0, time.UTC)
+	updateDriveRecords(&s, []drive{
+		{Device: "sda", Model: "WDC WD60EFRX-68L0BN1", Serial: "WD-WX31D87HJ4KL", PowerOnHours: 30000},
+		{Device: "sdb", Model: "WDC WD80EFAX-68KNBN0", Serial: "VGH5ZB2G", PowerOnHours: 1000},
+	}, nil, first)
+	now := first.Add(90 * 24 * time.Hour)
+	updateDriveRecords(&s, []drive{
+		{Device: "sdb", Model: "WDC WD60EFRX-68L0BN1", Serial: "WD-WX31D87HJ4KL", PowerOnHours: 32160},
+	}, map[string]int{"sdb": 32150}, now)
+
+	assert.Equal(t, first, s.Drives["WD-WX31D87HJ4KL"].FirstSeen)
+	assert.Equal(t, now, s.Drives["WD-WX31D87HJ4KL"].LastSeen)
+	assert.Equal(t, "sdb", s.Drives["WD-WX31D87HJ4KL"].Device)
+	assert.Equal(t, 32150, s.Drives["WD-WX31D87HJ4KL"].SelfTestHours)
+
+	var buf bytes.Buffer
+	fleet(&buf, s)
+	assert.Equal(t, `SERIAL           MODEL                 DEVICE  AGE         REPLACE BY  LAST SEEN
+WD-WX31D87HJ4KL  WDC WD60EFRX-68L0BN1  sdb     3.67 years  2025-07-30  2024-03-31
+VGH5ZB2G         WDC WD80EFAX-68KNBN0  sdb     0.11 years  2028-11-19  2024-01-01
+`, buf.String())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// grafanaAnnotation is an event posted to grafana's annotations API. Dashboards show them by querying for the zfs tag.
+type grafanaAnnotation struct {
+	Time    int64    `json:"time"` // unix milliseconds
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Tags    []string `json:"tags"`
+	Text    string   `json:"text"`
+}
+
+// scanAnnotations marks the scrubs and resilvers that started or finished since they were last annotated, recording each pool's last annotated scan in s
+func scanAnnotations(s *state, pools []pool) []grafanaAnnotation {
+	if s.Annotated == nil {
+		s.Annotated = make(map[string]string)
+	}
+
+	var annotations []grafanaAnnotation
+	for _, p := range pools {
+		scan := strings.Split(p.scanStatus, "\n")[0]
+		if scan == "" || scan == s.Annotated[p.name] {
+			continue
+		}
+		s.Annotated[p.name] = scan
+
+		kind := "scrub"
+		if strings.HasPrefix(scan, "resilver") {
+			kind = "resilver"
+		}
+		tags := []string{"zfs", kind, p.name}
+
+		switch {
+		case strings.Contains(scan, " in progress since "):
+			_, since, _ := strings.Cut(scan, " in progress since ")
+			start, err := parseCommandTime(since)
+			if err != nil {
+				continue
+			}
+			annotations = append(annotations, grafanaAnnotation{Time: start.UnixMilli(), Tags: tags, Text: fmt.Sprintf("%s of %s started", kind, p.name)})
+		case strings.Contains(scan, " errors on "):
+			summary, on, _ := strings.Cut(scan, " errors on ")
+			end, err := parseCommandTime(on)
+			took, ok := scanDuration(scan)
+			if err != nil || !ok {
+				continue
+			}
+			annotations = append(annotations, grafanaAnnotation{Time: end.Add(-took).UnixMilli(), TimeEnd: end.UnixMilli(), Tags: tags, Text: fmt.Sprintf("%s: %s errors", p.name, summary)})
+		case strings.Contains(scan, " canceled on "):
+			_, on, _ := strings.Cut(scan, " canceled on ")
+			at, err := parseCommandTime(on)
+			if err != nil {
+				continue
+			}
+			annotations = append(annotations, grafanaAnnotation{Time: at.UnixMilli(), Tags: tags, Text: fmt.Sprintf("%s of %s canceled", kind, p.name)})
+		}
+	}
+	return annotations
+}
+
+// alertAnnotations marks each finding alerted on
+func alertAnnotations(findings []finding, now time.Time) []grafanaAnnotation {
+	var annotations []grafanaAnnotation
+	for _, f := range findings {
+		annotations = append(annotations, grafanaAnnotation{Time: now.UnixMilli(), Tags: []string{"zfs", "alert", f.severity.String(), f.check}, Text: f.label() + ": " + f.message})
+	}
+	return annotations
+}
+
+// annotateGrafana posts scrub, resilver, and alert annotations to grafanaURL
+func annotateGrafana(pools []pool, findings []finding) error {
+	if grafanaURL == "" {
+		return nil
+	}
+
+	s, err := loadState()
+	if err != nil {
+		return fmt.Errorf("error opening state file for read: %w", err)
+	}
+	annotations := append(scanAnnotations(&s, pools), alertAnnotations(findings, time.Now())...)
+	saveState(s)
+
+	headers := map[string]string{"Authorization": "Bearer " + grafanaToken}
+	for _, a := range annotations {
+		if _, err := postJSON(strings.TrimSuffix(grafanaURL, "/")+"/api/annotations", a, headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scanAnnotations(t *testing.T) {
+	t.Parallel()
+
+	var s state
+	annotations := scanAnnotations(&s, []pool{
+		{name: "boot-pool", scanStatus: "scrub in progress since Sun Mar 31 18:37:01 2024\n\t1.02G scanned at 348M/s, 1.02G issued at 348M/s, 2.18G total"},
+		{name: "primarySafe", scanStatus: "scrub repaired 0B in 04:18:03 with 0 errors on Sun Mar 10 05:18:09 2024"},
+		{name: "tank", scanStatus: "resilvered 1.20T in 10:00:00 with 0 errors on Sun Mar 10 05:18:09 2024"},
+	})
+	end := time.Date(2024, time.March, 10, 5, 18, 9, 0, time.UTC)
+	assert.Equal(t, []grafanaAnnotation{
+		{Time: time.Date(2024, time.March, 31, 18, 37, 1, 0, time.UTC).UnixMilli(), Tags: []string{"zfs", "scrub", "boot-pool"}, Text: "scrub of boot-pool started"},
+		{Time: end.Add(-(4*time.Hour + 18*time.Minute + 3*time.Second)).UnixMilli(), TimeEnd: end.UnixMilli(), Tags: []string{"zfs", "scrub", "primarySafe"}, Text: "primarySafe: scrub repaired 0B in 04:18:03 with 0 errors"},
+		{Time: end.Add(-10 * time.Hour).UnixMilli(), TimeEnd: end.UnixMilli(), Tags: []string{"zfs", "resilver", "tank"}, Text: "tank: resilvered 1.20T in 10:00:00 with 0 errors"},
+	}, annotations)
+
+	// nothing new until a scan changes
+	assert.Empty(t, scanAnnotations(&s, []pool{{name: "primarySafe", scanStatus: "scrub repaired 0B in 04:18:03 with 0 errors on Sun Mar 10 05:18:09 2024"}}))
+	assert.Len(t, scanAnnotations(&s, []pool{{name: "boot-pool", scanStatus: "scrub canceled on Sun Mar 31 19:02:11 2024"}}), 1)
+}
+
+func Test_alertAnnotations(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)
+	annotations := alertAnnotations([]finding{
+		{check: "pool status", severity: severityCritical, message: "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors"},
+		{check: "disk usage", severity: severityWarning, message: "exit status 1", errored: true},
+	}, now)
+	assert.Equal(t, []grafanaAnnotation{
+		{Time: now.UnixMilli(), Tags: []string{"zfs", "alert", "critical", "pool status"}, Text: "pool status: pool primarySafe - DEGRADED (0|0|0): errors: No known data errors"},
+		{Time: now.UnixMilli(), Tags: []string{"zfs", "alert", "warning", "disk usage"}, Text: "disk usage could not run: exit status 1"},
+	}, annotations)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// healthWindow is how far back a disk's health score is compared, and its temperature averaged
+const healthWindow = 30 * 24 * time.Hour
+
+// the points each unit of an attribute adds to a disk's health score, by ATA attribute ID or NVMe field
+var healthWeights = map[string]float64{
+	"5":   0.5, // Reallocated_Sector_Ct
+	"187": 2,   // Reported_Uncorrect
+	"188": 0.1, // Command_Timeout
+	"197": 2,   // Current_Pending_Sector
+	"198": 2,   // Offline_Uncorrectable
+	"199": 0.1, // UDMA_CRC_Error_Count, usually a cable
+
+	"Media and Data Integrity Errors": 2,
+	"Percentage Used":                 0.2,
+	"Error Information Log Entries":   0.1,
+}
+
+const (
+	errorLogWeight        = 0.5 // per entry in the ATA error log
+	selftestFailureWeight = 10  // per failed self-test in the log
+	temperatureWeight     = 1   // per degree the disk's average temperature is above healthTempLimit
+	healthTempLimit       = 45
+)
+
+var errorCountRe = regexp.MustCompile(`ATA Error Count: (\d+)`)
+
+// healthScore is a weighted sum of the signs a disk is failing. Higher is worse; a healthy disk scores 0.
+type healthScore struct {
+	Total float64
+	Parts []string // what contributed to the score
+}
+
+func (h *healthScore) add(weight float64, count float64, part string) {
+	if count <= 0 {
+		return
+	}
+	h.Total += weight * count
+	h.Parts = append(h.Parts, part)
+}
+
+// scoreDrive scores the output of smartctl -i -A -l error -l selftest, given the disk's average temperature
+func scoreDrive(out string, avgTemp float64) healthScore {
+	var h healthScore
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 10 {
+			if weight, ok := healthWeights[fields[0]]; ok {
+				raw, _ := strconv.ParseFloat(fields[9], 64)
+				h.add(weight, raw, fmt.Sprintf("%s %s", fields[1], fields[9]))
+			}
+			continue
+		}
+		if key, value, found := strings.Cut(line, ":"); found {
+			if weight, ok := healthWeights[key]; ok {
+				value = strings.TrimSuffix(strings.ReplaceAll(strings.TrimSpace(value), ",", ""), "%")
+				n, _ := strconv.ParseFloat(value, 64)
+				h.add(weight, n, fmt.Sprintf("%s %s", key, strings.TrimSpace(value)))
+			}
+		}
+	}
+
+	if matches := errorCountRe.FindStringSubmatch(out); matches != nil {
+		n, _ := strconv.ParseFloat(matches[1], 64)
+		h.add(errorLogWeight, n, fmt.Sprintf("%s errors logged", matches[1]))
+	}
+
+	failures := 0
+	for _, entry := range readSelfTestLog(out) {
+		switch {
+		case entry.status == "Completed without error", strings.HasPrefix(entry.status, "Aborted"), strings.HasPrefix(entry.status, "Interrupted"), strings.HasPrefix(entry.status, "Self-test routine in progress"):
+		default:
+			failures++
+		}
+	}
+	h.add(selftestFailureWeight, float64(failures), fmt.Sprintf("%d failed self-tests", failures))
+
+	h.add(temperatureWeight, avgTemp-healthTempLimit, fmt.Sprintf("averaging %.0f°C", avgTemp))
+
+	return h
+}
+
+// healthSample is a disk's health score on a given day
+type healthSample struct {
+	At          time.Time
+	Score       float64
+	Temperature int // celsius, -1 if unknown
+}
+
+// checkHealth scores a disk, recording the score in s, and warns when it's over limit or has risen by more than rise within healthWindow
+func checkHealth(s *state, d drive, out string, rise, limit float64, now time.Time) error {
+	var history []healthSample
+	for _, sample := range s.Health[d.Serial] {
+		if now.Sub(sample.At) <= healthWindow {
+			history = append(history, sample)
+		}
+	}
+
+	var sum float64
+	var n int
+	for _, sample := range append(history, healthSample{Temperature: d.Temperature}) {
+		if sample.Temperature >= 0 {
+			sum += float64(sample.Temperature)
+			n++
+		}
+	}
+	var avgTemp float64
+	if n > 0 {
+		avgTemp = sum / float64(n)
+	}
+
+	score := scoreDrive(out, avgTemp)
+	sample := healthSample{At: now, Score: score.Total, Temperature: d.Temperature}
+	// one sample a day is plenty to follow a trend
+	if len(history) > 0 && history[len(history)-1].At.YearDay() == now.YearDay() && history[len(history)-1].At.Year() == now.Year() {
+		history[len(history)-1] = sample
+	} else {
+		history = append(history, sample)
+	}
+	if s.Health == nil {
+		s.Health = make(map[string][]healthSample)
+	}
+	s.Health[d.Serial] = history
+
+	parts := strings.Join(score.Parts, ", ")
+	switch baseline := history[0]; {
+	case score.Total >= limit:
+		return fmt.Errorf("disk %s (%s) health score is %.1f: %s", d.Device, d.Serial, score.Total, parts)
+	case score.Total-baseline.Score >= rise:
+		return fmt.Errorf("disk %s (%s) health score rose from %.1f to %.1f since %s: %s", d.Device, d.Serial, baseline.Score, score.Total, baseline.At.Format("Jan 2"), parts)
+	}
+	return nil
+}
+
+// trackHealth scores every disk in disks against the state file
+func trackHealth(e executer, disks []string) error {
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+
+	var errs []error
+	for _, disk := range disks {
+		out, err := e("/sbin/smartctl", smartctlArgs(disk, "-i", "-A", "-l", "error", "-l", "selftest")...)
+		if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+			errs = append(errs, checkError{fmt.Errorf("disk %s: %w", disk, err)})
+			continue
+		}
+		d := parseDrive(out)
+		d.Device = disk
+		if d.Serial == "" {
+			errs = append(errs, checkError{fmt.Errorf("no serial number reported for disk %s", disk)})
+			continue
+		}
+		errs = append(errs, checkHealth(&s, d, out, healthScoreRise, healthScoreMax, time.Now()))
+	}
+	saveState(s)
+
+	return errors.Join(errs...)
+}
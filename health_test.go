@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_scoreDrive(t *testing.T) {
+	t.Parallel()
+
+	healthy, err := os.ReadFile("testFiles/smartInfo.txt")
+	require.NoError(t, err)
+	assert.Equal(t, healthScore{}, scoreDrive(string(healthy), 36))
+
+	nvme, err := os.ReadFile("testFiles/smartInfoNvme.txt")
+	require.NoError(t, err)
+	assert.Equal(t, healthScore{Total: 0.2, Parts: []string{"Percentage Used 1"}}, scoreDrive(string(nvme), 40))
+
+	failing, err := os.ReadFile("testFiles/smartHealth.txt")
+	require.NoError(t, err)
+	score := scoreDrive(string(failing), 49)
+	assert.InDelta(t, 12+6+3.5+10+4, score.Total, 0.001)
+	assert.Equal(t, []string{"Reallocated_Sector_Ct 24", "Current_Pending_Sector 3", "7 errors logged", "1 failed self-tests", "averaging 49°C"}, score.Parts)
+}
+
+func Test_checkHealth(t *testing.T) {
+	t.Parallel()
+
+	healthy, err := os.ReadFile("testFiles/smartInfo.txt")
+	require.NoError(t, err)
+	failing, err := os.ReadFile("testFiles/smartHealth.txt")
+	require.NoError(t, err)
+
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.Local)
+	d := drive{Device: "sdb", Serial: "WD-WX31D87HJ4KL", Temperature: 36}
+	var s state
+	require.NoError(t, checkHealth(&s, d, string(healthy), 10, 50, start))
+	require.NoError(t, checkHealth(&s, d, string(healthy), 10, 50, start.Add(time.Hour)))
+	assert.Len(t, s.Health["WD-WX31D87HJ4KL"], 1)
+
+	d.Temperature = 49
+	err = checkHealth(&s, d, string(failing), 10, 50, start.Add(10*24*time.Hour))
+	assert.EqualError(t, err, "disk sdb (WD-WX31D87HJ4KL) health score rose from 0.0 to 31.5 since Mar 1: Reallocated_Sector_Ct 24, Current_Pending_Sector 3, 7 errors logged, 1 failed self-tests")
+	assert.Len(t, s.Health["WD-WX31D87HJ4KL"], 2)
+
+	err = checkHealth(&s, d, string(failing), 10, 30, start.Add(11*24*time.Hour))
+	assert.EqualError(t, err, "disk sdb (WD-WX31D87HJ4KL) health score is 31.5: Reallocated_Sector_Ct 24, Current_Pending_Sector 3, 7 errors logged, 1 failed self-tests")
+
+	// once the rise is older than the window, a steady score is quiet
+	assert.NoError(t, checkHealth(&s, d, string(failing), 10, 50, start.Add(45*24*time.Hour)))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+const sudoersPath = "/etc/sudoers.d/zfs-heartbeat"
+
+// helperName matches a pool, vdev, or dataset name, and can't be mistaken for an option
+const helperName = `\w[\w./:-]*`
+
+// helperCommands are the only commands helper mode will run as root, and the arguments each may be run with. Only read only operations are allowed, apart from zpool clear for autoClear.
+// zpool and zfs are limited to the exact arguments heartbeat runs them with, since options like zpool status -c run scripts.
+var helperCommands = map[string]*regexp.Regexp{
+	"/sbin/zpool": regexp.MustCompile(`^(status( -t| -L -P| -D)?|get -H -o name,value autotrim|get -H -p -o name,value guid ` + helperName + ` all-vdevs|history ` + helperName +
+		`|upgrade|version|clear ` + helperName + ` ` + helperName + `)$`),
+	"zfs": regexp.MustCompile(`^(list -H -p -t filesystem,volume -o name,used,avail,logicalused,compressratio|list -H -o name|list -H -p -t filesystem,volume,snapshot -o name,creation` +
+		`|list -H -p -t volume -o name,volsize,refreservation,used,logicalreferenced,avail|list -H -t snapshot -o name -s creation -d 1 ` + helperName +
+		`|get -H -o value mountpoint ` + helperName + `|version)$`),
+	"zrepl":          regexp.MustCompile(`^status --mode raw$`),
+	"journalctl":     regexp.MustCompile(`^-k -q --no-pager --show-cursor (--after-cursor=[\w=;]+|--since=-1h)$`),
+	"/sbin/smartctl": regexp.MustCompile(`^((-[HiAaxj]|-l [\w,]+|-d [\w,]+|--version)( |$))+(/dev/\w+)?$`),
+}
+
+// helperAllowed is true if helper mode may run cmd with args
+func helperAllowed(cmd string, args []string) bool {
+	re, ok := helperCommands[cmd]
+	if !ok {
+		return false
+	}
+	for _, arg := range args {
+		if strings.ContainsAny(arg, " \t\n") {
+			return false // keep the argument boundaries unambiguous
+		}
+	}
+	return re.MatchString(strings.Join(args, " "))
+}
+
+// sudoCommand rewrites a command that needs root to run through helper mode under sudo
+func sudoCommand(cmd string, args []string) (string, []string) {
+	if _, ok := helperCommands[cmd]; !ok || os.Geteuid() == 0 {
+		return cmd, args
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return cmd, args
+	}
+	return "sudo", append([]string{"-n", self, "helper", cmd}, args...)
+}
+
+// helper runs a whitelisted command in place of this process. It's meant to be the only thing the heartbeat user can run as root.
+func helper(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: heartbeat helper <command> [args...]")
+	}
+	if !helperAllowed(args[0], args[1:]) {
+		return fmt.Errorf("helper refused to run %s", strings.Join(args, " "))
+	}
+
+	path, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	return syscall.Exec(path, args, append(os.Environ(), commandEnv...))
+}
+
+// sudoers is a sudoers rule letting username run helper mode as root
+func sudoers(username, self string) string {
+	return fmt.Sprintf("# generated by heartbeat install: lets %[1]s run read only zpool, zfs, smartctl, and zrepl commands as root\n%[1]s ALL=(root) NOPASSWD: %[2]s helper *\n", username, self)
+}
+
+// installCommand is the install command. install sudoers [user] writes the sudoers rule for helper mode, which is also what a bare install [user] does, from before there was anything else to install.
+// install policy generates an AppArmor profile or SELinux module, and install -schedule runs heartbeat from a systemd timer or cron.
+func installCommand(args []string) error {
+	if len(args) > 0 && args[0] == "policy" {
+		return installPolicy(os.Stdout, args[1:])
+	}
+	if len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		return installSchedule(os.Stdout, args)
+	}
+	if len(args) > 0 && args[0] == "sudoers" {
+		args = args[1:]
+	}
+	switch len(args) {
+	case 0:
+		return install("")
+	case 1:
+		return install(args[0])
+	default:
+		return fmt.Errorf("usage: heartbeat install sudoers <user>")
+	}
+}
+
+// install writes the sudoers rule for helper mode, or prints it if we aren't root
+func install(username string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	if username == "" {
+		username = os.Getenv("SUDO_USER") // the user that ran sudo heartbeat install
+	}
+	if username == "" || username == "root" {
+		return fmt.Errorf("usage: heartbeat install sudoers <user>")
+	}
+	rule := sudoers(username, self)
+
+	if os.Geteuid() != 0 {
+		fmt.Fprintf(os.Stderr, "not running as root, add this to %s with visudo:\n", sudoersPath)
+		fmt.Print(rule)
+		return nil
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(sudoersPath), ".zfs-heartbeat")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(rule); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o440); err != nil {
+		return err
+	}
+	if out, err := exec.Command("visudo", "-cf", f.Name()).CombinedOutput(); err != nil {
+		return fmt.Errorf("visudo rejected the rule: %s", out)
+	}
+	if err := os.Rename(f.Name(), sudoersPath); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s. %s must only be writable by root.\n", sudoersPath, self)
+	return nil
+}
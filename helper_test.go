@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_helperAllowed(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cmd     string
+		args    []string
+		allowed bool
+	}{
+		{"/sbin/zpool", []string{"status", "-t"}, true},
+		{"/sbin/zpool", []string{"upgrade"}, true},
+		{"/sbin/zpool", []string{"get", "-H", "-o", "name,value", "autotrim"}, true},
+		{"/sbin/zpool", []string{"upgrade", "-a"}, false},
+		{"/sbin/zpool", []string{"clear", "primarySafe", "4167d912-9102-11e2-a05e-b8975a0e7ea3"}, true},
+		{"/sbin/zpool", []string{"clear", "-F", "primarySafe"}, false},
+		{"/sbin/zpool", []string{"destroy", "primarySafe"}, false},
+		{"/sbin/zpool", []string{"status primarySafe", "&&", "reboot"}, false},
+		{"/sbin/zpool", []string{"status", "-L", "-P"}, true},
+		{"/sbin/zpool", []string{"status", "-D"}, true},
+		{"/sbin/zpool", []string{"status", "-c", "upath"}, false},
+		{"/sbin/zpool", []string{"iostat", "-c", "upath"}, false},
+		{"/sbin/zpool", []string{"get", "-H", "-p", "-o", "name,value", "guid", "primarySafe", "all-vdevs"}, true},
+		{"/sbin/zpool", []string{"get", "-H", "-p", "-o", "name,value", "guid", "-c", "all-vdevs"}, false},
+		{"/sbin/zpool", []string{"history", "primarySafe"}, true},
+		{"/sbin/zpool", []string{"history", "-i", "primarySafe"}, false},
+		{"zfs", zfsSpaceArgs, true},
+		{"zfs", []string{"list", "-H", "-o", "name"}, true},
+		{"zfs", []string{"list", "-H", "-t", "snapshot", "-o", "name", "-s", "creation", "-d", "1", "primarySafe/backup"}, true},
+		{"zfs", []string{"get", "-H", "-o", "value", "mountpoint", "primarySafe/backup"}, true},
+		{"zfs", []string{"version"}, true},
+		{"zfs", []string{"list", "-H", "-p", "-o", "name,used,avail"}, false},
+		{"zfs", []string{"get", "-H", "-o", "value", "mountpoint", "-r", "primarySafe"}, false},
+		{"zfs", []string{"destroy", "-r", "primarySafe"}, false},
+		{"/sbin/smartctl", []string{"-H", "-l", "selftest", "/dev/sda"}, true},
+		{"/sbin/smartctl", []string{"-i", "-A", "/dev/nvme0"}, true},
+		{"/sbin/smartctl", []string{"--version"}, true},
+		{"/sbin/smartctl", []string{"-H", "-l", "selftest", "-d", "megaraid,3", "/dev/sda"}, true},
+		{"/sbin/smartctl", []string{"-t", "long", "/dev/sda"}, false},
+		{"/sbin/smartctl", []string{"-s", "off", "/dev/sda"}, false},
+		{"journalctl", []string{"-k", "-q", "--no-pager", "--show-cursor", "--after-cursor=s=8f3b;i=1a2b3;b=0123"}, true},
+		{"journalctl", []string{"-k", "-q", "--no-pager", "--show-cursor", "--vacuum-time=1s"}, false},
+		{"/bin/sh", []string{"-c", "id"}, false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.allowed, helperAllowed(tt.cmd, tt.args), "%s %v", tt.cmd, tt.args)
+	}
+}
+
+func Test_sudoers(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "# generated by heartbeat install: lets heartbeat run read only zpool, zfs, smartctl, and zrepl commands as root\nheartbeat ALL=(root) NOPASSWD: /usr/local/bin/heartbeat helper *\n", sudoers("heartbeat", "/usr/local/bin/heartbeat"))
+}
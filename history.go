@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// alertHistoryAge is how long past alerts are kept for heartbeat alerts
+const alertHistoryAge = 180 * 24 * time.Hour
+
+// alertRecord is a finding that was alerted on
+type alertRecord struct {
+	Time     time.Time `json:"time"`
+	Check    string    `json:"check"`
+	Severity severity  `json:"severity"`
+	Message  string    `json:"message"`
+	Errored  bool      `json:"errored,omitempty"` // the check could not run, rather than finding a problem
+}
+
+// recordAlerts adds findings to the alert history in s, dropping alerts older than alertHistoryAge
+func recordAlerts(s *state, findings []finding, now time.Time) {
+	var kept []alertRecord
+	for _, r := range s.Alerts {
+		if now.Sub(r.Time) < alertHistoryAge {
+			kept = append(kept, r)
+		}
+	}
+	for _, f := range findings {
+		kept = append(kept, alertRecord{Time: now, Check: f.check, Severity: f.severity, Message: f.message, Errored: f.errored})
+	}
+	s.Alerts = kept
+}
+
+// trackAlerts runs recordAlerts against the state file
+func trackAlerts(findings []finding) {
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return
+	}
+	recordAlerts(&s, findings, time.Now())
+	saveState(s)
+}
+
+// alertFilter picks out alerts for heartbeat alerts
+type alertFilter struct {
+	severity severity // at least this severe
+	pool     string   // mentioning this pool
+	since    time.Time
+	until    time.Time
+}
+
+func (f alertFilter) match(r alertRecord) bool {
+	if r.Severity < f.severity {
+		return false
+	}
+	if f.pool != "" && !strings.Contains(r.Message, f.pool) {
+		return false
+	}
+	if !f.since.IsZero() && r.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !r.Time.Before(f.until) {
+		return false
+	}
+	return true
+}
+
+// parseAlertTime reads a date (2006-01-02, in local time) or an RFC 3339 timestamp
+func parseAlertTime(value string) (time.Time, error) {
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// alerts prints the alert history in s, filtered and formatted as args ask
+func alerts(w io.Writer, s state, args []string) error {
+	flags := flag.NewFlagSet("alerts", flag.ContinueOnError)
+	flags.SetOutput(w)
+	sev := flags.String("severity", "info", "only show alerts at least this severe: info, warning, or critical")
+	pool := flags.String("pool", "", "only show alerts mentioning this pool")
+	since := flags.String("since", "", "only show alerts from this date (2006-01-02) or time (RFC 3339) on")
+	until := flags.String("until", "", "only show alerts before this date or time")
+	format := flags.String("format", "text", "text, csv, or json")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := alertFilter{pool: *pool}
+	if err := filter.severity.UnmarshalText([]byte(*sev)); err != nil {
+		return err
+	}
+	var err error
+	if *since != "" {
+		if filter.since, err = parseAlertTime(*since); err != nil {
+			return err
+		}
+	}
+	if *until != "" {
+		if filter.until, err = parseAlertTime(*until); err != nil {
+			return err
+		}
+	}
+
+	records := []alertRecord{}
+	for _, r := range s.Alerts {
+		if filter.match(r) {
+			records = append(records, r)
+		}
+	}
+
+	switch *format {
+	case "text":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "TIME\tSEVERITY\tCHECK\tMESSAGE")
+		for _, r := range records {
+			check := r.Check
+			if r.Errored {
+				check += " (could not run)"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Time.Format("2006-01-02 15:04"), r.Severity, check, strings.ReplaceAll(r.Message, "\n", " / "))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"time", "severity", "check", "message", "errored"})
+		for _, r := range records {
+			_ = cw.Write([]string{r.Time.Format(time.RFC3339), r.Severity.String(), r.Check, r.Message, strconv.FormatBool(r.Errored)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "\t")
+		return enc.Encode(records)
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+}
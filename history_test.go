@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_recordAlerts(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.Local)
+	s := state{Alerts: []alertRecord{
+		{Time: now.Add(-200 * 24 * time.Hour), Check: "pool status", Severity: severityCritical, Message: "pool primarySafe - DEGRADED"},
+		{Time: now.Add(-24 * time.Hour), Check: "smart selftest", Severity: severityWarning, Message: "smart error: disk sdb: Completed: read failure"},
+	}}
+	recordAlerts(&s, []finding{{check: "disk usage", severity: severityWarning, message: "exit status 1", errored: true}}, now)
+
+	require.Len(t, s.Alerts, 2)
+	assert.Equal(t, "smart selftest", s.Alerts[0].Check)
+	assert.Equal(t, alertRecord{Time: now, Check: "disk usage", Severity: severityWarning, Message: "exit status 1", Errored: true}, s.Alerts[1])
+}
+
+func Test_alerts(t *testing.T) {
+	t.Parallel()
+
+	s := state{Alerts: []alertRecord{
+		{Time: time.Date(2024, time.March, 2, 12, 0, 0, 0, time.Local), Check: "smart selftest", Severity: severityWarning, Message: "smart error: disk sdb: Completed: read failure"},
+		{Time: time.Date(2024, time.March, 5, 12, 0, 0, 0, time.Local), Check: "pool status", Severity: severityCritical, Message: "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors"},
+		{Time: time.Date(2024, time.March, 9, 12, 0, 0, 0, time.Local), Check: "disk usage", Severity: severityWarning, Message: "dataset primarySafe/vms has 10.00 GiB available", Errored: false},
+		{Time: time.Date(2024, time.March, 12, 12, 0, 0, 0, time.Local), Check: "pool status", Severity: severityCritical, Message: "pool boot-pool - DEGRADED (0|0|0): errors: No known data errors"},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, alerts(&buf, s, []string{"-pool", "primarySafe", "-since", "2024-03-03", "-until", "2024-03-12"}))
+	assert.Equal(t, `TIME              SEVERITY  CHECK        MESSAGE
+2024-03-05 12:00  critical  pool status  pool primarySafe - DEGRADED (0|0|0): errors: No known data errors
+2024-03-09 12:00  warning   disk usage   dataset primarySafe/vms has 10.00 GiB available
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, alerts(&buf, s, []string{"-severity", "critical", "-format", "csv"}))
+	assert.Equal(t, `time,severity,check,message,errored
+2024-03-05T12:00:00Z,critical,pool status,pool primarySafe - DEGRADED (0|0|0): errors: No known data errors,false
+2024-03-12T12:00:00Z,critical,pool status,pool boot-pool - DEGRADED (0|0|0): errors: No known data errors,false
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, alerts(&buf, s, []string{"-format", "json", "-since", "2024-03-10T00:00:00Z"}))
+	var records []alertRecord
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &records))
+	assert.Equal(t, s.Alerts[3:], records)
+	assert.Contains(t, buf.String(), `"severity": "critical"`)
+
+	assert.Error(t, alerts(&buf, s, []string{"-severity", "bad"}))
+	assert.Error(t, alerts(&buf, s, []string{"-format", "xml"}))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// version is set at build time, see linuxBuild.sh
+var version = ""
+
+// hostReport describes the software on the box, so an unattended upgrade shows up in the heartbeat
+type hostReport struct {
+	Version    string // of heartbeat
+	Uptime     string
+	Kernel     string
+	ZFS        string // OpenZFS kernel module version
+	PrevKernel string // kernel at the last heartbeat, if it's changed since
+	PrevZFS    string // OpenZFS version at the last heartbeat, if it's changed since
+}
+
+// hostVersions is what was running at the last heartbeat
+type hostVersions struct {
+	Kernel string
+	ZFS    string
+}
+
+// buildVersion is version, or the commit heartbeat was built from if it wasn't set
+func buildVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" && len(s.Value) >= 12 {
+				return s.Value[:12]
+			}
+		}
+	}
+	return "unknown"
+}
+
+// readHost reads the uptime and kernel and OpenZFS versions from the proc and sys filesystems under root
+func readHost(root string) (hostReport, error) {
+	r := hostReport{Version: buildVersion()}
+	read := func(path string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(root, path))
+		return strings.TrimSpace(string(data)), err
+	}
+
+	var err error
+	if r.Kernel, err = read("proc/sys/kernel/osrelease"); err != nil {
+		return r, err
+	}
+	if r.ZFS, err = read("sys/module/zfs/version"); err != nil {
+		return r, err
+	}
+	uptime, err := read("proc/uptime")
+	if err != nil {
+		return r, err
+	}
+	seconds, err := strconv.ParseFloat(strings.Fields(uptime + " ")[0], 64)
+	if err != nil {
+		return r, fmt.Errorf("parsing uptime %q: %w", uptime, err)
+	}
+	r.Uptime = formatUptime(time.Duration(seconds) * time.Second)
+	return r, nil
+}
+
+func formatUptime(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	case d >= 2*time.Hour:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	default:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	}
+}
+
+// compareHost notes the versions that changed since the last heartbeat, and remembers the current ones in s
+func compareHost(s *state, r *hostReport) {
+	if s.Host.Kernel != "" && s.Host.Kernel != r.Kernel {
+		r.PrevKernel = s.Host.Kernel
+	}
+	if s.Host.ZFS != "" && s.Host.ZFS != r.ZFS {
+		r.PrevZFS = s.Host.ZFS
+	}
+	s.Host = hostVersions{Kernel: r.Kernel, ZFS: r.ZFS}
+}
+
+// trackHost reads the host's versions for the heartbeat, comparing them to the last heartbeat's
+func trackHost() *hostReport {
+	r, err := readHost("/")
+	if err != nil {
+		log.Println("error reading host versions: " + err.Error())
+		return nil
+	}
+
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return &r
+	}
+	compareHost(&s, &r)
+	saveState(s)
+	return &r
+}
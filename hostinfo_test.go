@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readHost(t *testing.T) {
+	t.Parallel()
+
+	r, err := readHost("testFiles/host")
+	require.NoError(t, err)
+	assert.Equal(t, "6.1.0-18-amd64", r.Kernel)
+	assert.Equal(t, "2.2.3-1", r.ZFS)
+	assert.Equal(t, "12 days", r.Uptime)
+	assert.NotEmpty(t, r.Version)
+
+	_, err = readHost(t.TempDir())
+	assert.Error(t, err)
+}
+
+func Test_formatUptime(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "12 minutes", formatUptime(12*time.Minute))
+	assert.Equal(t, "119 minutes", formatUptime(119*time.Minute))
+	assert.Equal(t, "47 hours", formatUptime(47*time.Hour+59*time.Minute))
+	assert.Equal(t, "3 days", formatUptime(80*time.Hour))
+}
+
+func Test_compareHost(t *testing.T) {
+	t.Parallel()
+
+	s := state{}
+	r := hostReport{Version: "v1.4.0", Uptime: "3 days", Kernel: "6.1.0-18-amd64", ZFS: "2.2.3-1"}
+	compareHost(&s, &r)
+	assert.Empty(t, r.PrevKernel)
+	assert.Empty(t, r.PrevZFS)
+
+	r = hostReport{Version: "v1.4.0", Uptime: "2 hours", Kernel: "6.1.0-20-amd64", ZFS: "2.2.3-1"}
+	compareHost(&s, &r)
+	assert.Equal(t, "6.1.0-18-amd64", r.PrevKernel)
+	assert.Empty(t, r.PrevZFS)
+	assert.Equal(t, hostVersions{Kernel: "6.1.0-20-amd64", ZFS: "2.2.3-1"}, s.Host)
+
+	assert.Equal(t, "\nheartbeat v1.4.0, up 2 hours, kernel 6.1.0-20-amd64 (was 6.1.0-18-amd64), OpenZFS 2.2.3-1", heartbeatReport{Host: &r}.String())
+}
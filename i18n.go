@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// translations are the built in catalogs for the built in group templates, by locale. A <locale>.json in templateDir, mapping English text to its translation, adds to or overrides these.
+var translations = map[string]map[string]string{
+	"de": {
+		"The NAS needs attention. Please leave it turned on and don't unplug anything until it's fixed.": "Das NAS braucht Aufmerksamkeit. Bitte lass es eingeschaltet und zieh keine Kabel ab, bis es repariert ist.",
+		"The NAS has a minor problem. Nothing needs to be done right now.":                               "Das NAS hat ein kleines Problem. Im Moment muss nichts getan werden.",
+	},
+	"es": {
+		"The NAS needs attention. Please leave it turned on and don't unplug anything until it's fixed.": "El NAS necesita atención. Por favor, déjalo encendido y no desconectes nada hasta que esté arreglado.",
+		"The NAS has a minor problem. Nothing needs to be done right now.":                               "El NAS tiene un problema menor. No hace falta hacer nada por ahora.",
+	},
+	"fr": {
+		"The NAS needs attention. Please leave it turned on and don't unplug anything until it's fixed.": "Le NAS a besoin d'attention. Merci de le laisser allumé et de ne rien débrancher jusqu'à ce qu'il soit réparé.",
+		"The NAS has a minor problem. Nothing needs to be done right now.":                               "Le NAS a un petit problème. Il n'y a rien à faire pour l'instant.",
+	},
+}
+
+// translator returns a function translating English text into locale (eg es, or pt-BR falling back to pt), leaving text it has no translation for as is
+func translator(locale string) func(string) string {
+	if locale == "" {
+		return func(text string) string { return text }
+	}
+
+	var catalogs []map[string]string
+	lang, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+	for _, l := range []string{locale, lang} {
+		if custom, err := readCatalog(filepath.Join(templateDir, l+".json")); err == nil {
+			catalogs = append(catalogs, custom)
+		} else if !os.IsNotExist(err) {
+			log.Printf("error reading translations for %s: %s", l, err)
+		}
+		if builtin, ok := translations[l]; ok {
+			catalogs = append(catalogs, builtin)
+		}
+	}
+
+	return func(text string) string {
+		for _, c := range catalogs {
+			if t, ok := c[text]; ok {
+				return t
+			}
+		}
+		return text
+	}
+}
+
+// readCatalog reads a JSON object mapping English text to its translation
+func readCatalog(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var catalog map[string]string
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
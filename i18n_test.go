@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_translator(t *testing.T) {
+	t.Parallel()
+
+	const text = "The NAS has a minor problem. Nothing needs to be done right now."
+	assert.Equal(t, text, translator("")(text))
+	assert.Equal(t, "El NAS tiene un problema menor. No hace falta hacer nada por ahora.", translator("es")(text))
+	assert.Equal(t, "El NAS tiene un problema menor. No hace falta hacer nada por ahora.", translator("es_MX")(text), "falls back to the language")
+	assert.Equal(t, "pool status", translator("es")("pool status"), "untranslated text is left as is")
+	assert.Equal(t, text, translator("xx")(text))
+
+	r := groupReport{Severity: "critical"}
+	assert.Equal(t, "Das NAS braucht Aufmerksamkeit. Bitte lass es eingeschaltet und zieh keine Kabel ab, bis es repariert ist.", renderLocale("family.tmpl", groupTemplates["family"], "de", r))
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// instance is a machine this binary monitors with its own settings, eg the NAS itself and an offsite backup box over ssh.
+// Each is run by its own cron line, `heartbeat instance <name>`, and keeps its own state, status, and lock files.
+type instance struct {
+	Name       string
+	Host       string   // ssh destination the commands run on, eg root@offsite.example.com. Empty for this machine
+	Pools      []string // replaces diskUsagePools
+	SmartDisks []string // replaces smartDisks
+	NotifyURLs []string // replaces notifyURLs, eg to send the offsite box's alerts to someone else
+	Disabled   []string // checks to skip on top of disabledChecks
+}
+
+// localChecks read this machine's /proc, /sys, or files directly rather than running a command, so they're skipped for an instance on another host
+var localChecks = []string{"dedup table", "restore", "sas links", "network", "snapshot policy"}
+
+// instanceName and remoteHost are set by useInstance for the rest of the process
+var instanceName string
+var remoteHost string
+
+// useInstance switches the settings over to the named instance
+func useInstance(name string) error {
+	i := slices.IndexFunc(instances, func(in instance) bool { return in.Name == name })
+	if i < 0 {
+		return fmt.Errorf("no instance named %s", name)
+	}
+	in := instances[i]
+
+	instanceName = in.Name
+	remoteHost = in.Host
+	statePath = instancePath(statePath, in.Name)
+	stateMirrorPath = instancePath(stateMirrorPath, in.Name)
+	statusPath = instancePath(statusPath, in.Name)
+	lockPath = instancePath(lockPath, in.Name)
+	if in.Pools != nil {
+		diskUsagePools = in.Pools
+	}
+	if in.SmartDisks != nil {
+		smartDisks = in.SmartDisks
+	}
+	if in.NotifyURLs != nil {
+		notifyURLs = in.NotifyURLs
+	}
+	disabledChecks = append(slices.Clone(disabledChecks), in.Disabled...)
+	if in.Host != "" {
+		disabledChecks = append(disabledChecks, localChecks...)
+	}
+	return nil
+}
+
+// instancePath gives an instance its own copy of a file, eg heartbeat.json becomes heartbeat-offsite.json
+func instancePath(path, name string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-" + name + ext
+}
+
+// sshCommand rewrites a command to run on host, with the same locale and time zone it would get here
+func sshCommand(host, cmd string, args []string) (string, []string) {
+	remote := append(append(append([]string{"env"}, commandEnv...), cmd), args...)
+	for i, arg := range remote {
+		remote[i] = shellQuote(arg)
+	}
+	// BatchMode fails instead of prompting for a password nobody is there to type
+	return "ssh", []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", host, "--", strings.Join(remote, " ")}
+}
+
+var shellSafeRe = regexp.MustCompile(`^[\w@%+=:,./-]+$`)
+
+// shellQuote quotes s for the remote shell ssh runs commands with
+func shellQuote(s string) string {
+	if shellSafeRe.MatchString(s) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// hostname is the name of the machine being monitored, for notifiers that say where an alert came from
+func hostname() string {
+	if remoteHost != "" {
+		return instanceName
+	}
+	if hostMode != "" {
+		if host, err := hostHostname(); err == nil && host != "" {
+			return host
+		}
+	}
+	host, _ := os.Hostname()
+	return host
+}
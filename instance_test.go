@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_instancePath(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "/var/lib/heartbeat/heartbeat-offsite.json", instancePath("/var/lib/heartbeat/heartbeat.json", "offsite"))
+	assert.Equal(t, "/var/run/heartbeat-offsite.lock", instancePath("/var/run/heartbeat.lock", "offsite"))
+	assert.Equal(t, "", instancePath("", "offsite"), "a disabled file stays disabled")
+}
+
+func Test_sshCommand(t *testing.T) {
+	t.Parallel()
+
+	cmd, args := sshCommand("root@offsite", "/sbin/zpool", []string{"status", "-P", "tank"})
+	assert.Equal(t, "ssh", cmd)
+	assert.Equal(t, []string{"-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "root@offsite", "--", "env LC_ALL=C LANG=C TZ=UTC /sbin/zpool status -P tank"}, args)
+
+	_, args = sshCommand("offsite", "zfs", []string{"list", "-o", "name", "my pool's data"})
+	assert.Equal(t, `env LC_ALL=C LANG=C TZ=UTC zfs list -o name 'my pool'\''s data'`, args[len(args)-1])
+}
+
+func Test_wrapCommand(t *testing.T) {
+	t.Parallel()
+
+	// the sudo helper is a path on this machine, so remote commands don't go through it
+	cmd, args := wrapCommand("/sbin/zpool", []string{"status", "-P"}, true, "root@offsite")
+	assert.Equal(t, "ssh", cmd)
+	assert.Equal(t, "env LC_ALL=C LANG=C TZ=UTC /sbin/zpool status -P", args[len(args)-1])
+
+	cmd, args = wrapCommand("/sbin/zpool", []string{"status", "-P"}, false, "")
+	assert.Equal(t, "/sbin/zpool", cmd)
+	assert.Equal(t, []string{"status", "-P"}, args)
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// checkIntervalSlack lets a check run a little early, so an hourly check from a job every 5 minutes doesn't slip to every 65 minutes when a run starts a few seconds sooner than the last
+const checkIntervalSlack = time.Minute
+
+// checkDue is true if the check called name should run now: it has no interval, it failed or hasn't run, or interval has passed since it last passed
+func checkDue(s state, name string, interval time.Duration, now time.Time) bool {
+	last, ok := s.CheckRuns[name]
+	return interval <= 0 || !ok || now.Sub(last) >= interval-checkIntervalSlack
+}
+
+// recordCheckRuns records when each check in intervals last passed. A check that failed isn't recorded, so it runs every time until it passes.
+func recordCheckRuns(s *state, results []checkResult, intervals map[string]time.Duration, now time.Time) {
+	if s.CheckRuns == nil {
+		s.CheckRuns = make(map[string]time.Time)
+	}
+	for name := range s.CheckRuns {
+		if _, ok := intervals[name]; !ok {
+			delete(s.CheckRuns, name)
+		}
+	}
+	for _, r := range results {
+		if _, ok := intervals[r.name]; !ok || r.skipped {
+			continue
+		}
+		if r.err == nil {
+			s.CheckRuns[r.name] = now
+		} else {
+			delete(s.CheckRuns, r.name)
+		}
+	}
+}
+
+// trackCheckRuns runs recordCheckRuns against the state file
+func trackCheckRuns(results []checkResult, now time.Time) {
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return
+	}
+	recordCheckRuns(&s, results, checkIntervals, now)
+	saveState(s)
+}
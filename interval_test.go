@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_checkDue(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC)
+	s := state{CheckRuns: map[string]time.Time{"smart selftest": now.Add(-59*time.Minute - 58*time.Second), "drive inventory": now.Add(-2 * time.Hour)}}
+
+	assert.True(t, checkDue(s, "pool status", 0, now))
+	assert.True(t, checkDue(s, "smart selftest", time.Hour, now), "a few seconds early is close enough")
+	assert.False(t, checkDue(s, "drive inventory", 24*time.Hour, now))
+	assert.True(t, checkDue(s, "health score", time.Hour, now), "it hasn't run")
+}
+
+func Test_recordCheckRuns(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 1, 13, 0, 0, 0, time.UTC)
+	earlier := now.Add(-time.Hour)
+	s := state{CheckRuns: map[string]time.Time{"smart selftest": earlier, "health score": earlier, "drive inventory": earlier, "kernel log": earlier}}
+	intervals := map[string]time.Duration{"smart selftest": time.Hour, "health score": time.Hour, "drive inventory": 24 * time.Hour}
+	results := []checkResult{
+		{name: "pool status"},
+		{name: "smart selftest"},
+		{name: "health score", err: errors.New("disk sda health score fell to 71")},
+		{name: "drive inventory", skipped: true},
+	}
+
+	recordCheckRuns(&s, results, intervals, now)
+	assert.Equal(t, map[string]time.Time{"smart selftest": now, "drive inventory": earlier}, s.CheckRuns)
+}
@@ -0,0 +1,32 @@
+package main
+
+import "fmt"
+
+// inventoryEntry is the drive last seen at a device path
+type inventoryEntry struct {
+	Serial   string
+	Model    string
+	Firmware string
+}
+
+// updateInventory records which drive is at each device path, returning a description of every unexpected change since the last run
+func updateInventory(s *state, drives []drive) []string {
+	if s.Inventory == nil {
+		s.Inventory = make(map[string]inventoryEntry)
+	}
+
+	var changes []string
+	for _, d := range drives {
+		prev, ok := s.Inventory[d.Device]
+		switch {
+		case !ok:
+		case prev.Serial != d.Serial:
+			changes = append(changes, fmt.Sprintf("%s is now %s serial %s (was %s serial %s)", d.Device, d.Model, d.Serial, prev.Model, prev.Serial))
+		case prev.Firmware != d.Firmware:
+			changes = append(changes, fmt.Sprintf("%s serial %s firmware changed from %s to %s", d.Device, d.Serial, prev.Firmware, d.Firmware))
+		}
+		s.Inventory[d.Device] = inventoryEntry{Serial: d.Serial, Model: d.Model, Firmware: d.Firmware}
+	}
+
+	return changes
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_updateInventory(t *testing.T) {
+	t.Parallel()
+
+	var s state
+	drives := []drive{
+		{Device: "sda", Model: "WDC WD60EFRX-68L0BN1", Serial: "WD-WX31D87HJ4KL", Firmware: "82.00A82"},
+		{Device: "sdb", Model: "WDC WD80EFAX-68KNBN0", Serial: "VGH5ZB2G", Firmware: "81.00A81"},
+	}
+	assert.Empty(t, updateInventory(&s, drives))
+	assert.Empty(t, updateInventory(&s, drives))
+
+	drives = []drive{
+		{Device: "sda", Model: "WDC WD80EFAX-68KNBN0", Serial: "VGH5ZB2G", Firmware: "81.00A81"},
+		{Device: "sdb", Model: "WDC WD80EFAX-68KNBN0", Serial: "VGH5ZB2G", Firmware: "83.00A83"},
+	}
+	assert.Equal(t, []string{
+		"sda is now WDC WD80EFAX-68KNBN0 serial VGH5ZB2G (was WDC WD60EFRX-68L0BN1 serial WD-WX31D87HJ4KL)",
+		"sdb serial VGH5ZB2G firmware changed from 81.00A81 to 83.00A83",
+	}, updateInventory(&s, drives))
+	assert.Empty(t, updateInventory(&s, drives))
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// kernelLogPatterns match the kernel messages that mean trouble below ZFS: link resets, I/O errors, controller faults, and ZFS panics
+var kernelLogPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`ata\d+(\.\d+)?: (exception Emask|hard resetting link|SError|failed command)`),
+	regexp.MustCompile(`I/O error, dev \w+`),
+	regexp.MustCompile(`rejecting I/O to offline device`),
+	regexp.MustCompile(`(mpt[23]sas|megaraid_sas|aacraid).*(fault|reset|log_info)`),
+	regexp.MustCompile(`zio pool=\S+ vdev=\S+ error=\d+`),
+	regexp.MustCompile(`PANIC at |VERIFY3?\(.*\) failed`),
+}
+
+// maxKernelLines is the most kernel messages quoted in one alert
+const maxKernelLines = 10
+
+// parseKernelLog finds the storage errors in journalctl output, and the cursor to resume from next time
+func parseKernelLog(out string) ([]string, string) {
+	var matches []string
+	var cursor string
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if c, ok := strings.CutPrefix(line, "-- cursor: "); ok {
+			cursor = c
+			continue
+		}
+		for _, re := range kernelLogPatterns {
+			if re.MatchString(line) {
+				matches = append(matches, line)
+				break
+			}
+		}
+	}
+	return matches, cursor
+}
+
+// checkKernelLog scans the kernel log for storage errors logged since the last run, keeping its place with a journald cursor in s
+func checkKernelLog(s *state, e executer) error {
+	args := []string{"-k", "-q", "--no-pager", "--show-cursor"}
+	if s.KernelCursor != "" {
+		args = append(args, "--after-cursor="+s.KernelCursor)
+	} else {
+		args = append(args, "--since=-1h")
+	}
+	out, err := e("journalctl", args...)
+	if err != nil {
+		return checkError{err}
+	}
+
+	matches, cursor := parseKernelLog(out)
+	if cursor != "" {
+		s.KernelCursor = cursor
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("kernel logged %d storage errors:\n%s", len(matches), strings.Join(matches[:min(len(matches), maxKernelLines)], "\n"))
+	if len(matches) > maxKernelLines {
+		msg += fmt.Sprintf("\n...and %d more", len(matches)-maxKernelLines)
+	}
+	return errors.New(msg)
+}
+
+// trackKernelLog runs checkKernelLog against the state file
+func trackKernelLog(e executer) error {
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkKernelLog(&s, e)
+	saveState(s)
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkKernelLog(t *testing.T) {
+	t.Parallel()
+
+	out, err := os.ReadFile("testFiles/journalKernel.txt")
+	require.NoError(t, err)
+
+	var calls [][]string
+	e := func(cmd string, args ...string) (string, error) {
+		calls = append(calls, args)
+		if len(calls) == 1 {
+			return string(out), nil
+		}
+		return "", nil
+	}
+
+	var s state
+	err = checkKernelLog(&s, e)
+	assert.EqualError(t, err, `kernel logged 4 storage errors:
+Mar 31 12:01:14 nas kernel: ata3.00: exception Emask 0x10 SAct 0x0 SErr 0x4050002 action 0xe frozen
+Mar 31 12:01:14 nas kernel: ata3: hard resetting link
+Mar 31 12:01:21 nas kernel: I/O error, dev sdc, sector 1953514520 op 0x0:(READ) flags 0x700 phys_seg 1 prio class 0
+Mar 31 12:01:21 nas kernel: zio pool=primarySafe vdev=/dev/disk/by-id/ata-WDC_WD80EFAX-68KNBN0_VAGWJ7KL-part1 error=5 type=1 offset=1000203837440 size=4096 flags=180880`)
+	cursor := "s=8f3b2c1d4e5f6a7b8c9d0e1f2a3b4c5d;i=1a2b3;b=0123456789abcdef0123456789abcdef;m=4a5b6c7d;t=614f2a3b4c5d6;x=9e8d7c6b5a493827"
+	assert.Equal(t, cursor, s.KernelCursor)
+
+	// the next run picks up where this one left off, and keeps the cursor if nothing new was logged
+	assert.NoError(t, checkKernelLog(&s, e))
+	assert.Equal(t, "--since=-1h", calls[0][4])
+	assert.Equal(t, "--after-cursor="+cursor, calls[1][4])
+	assert.Equal(t, cursor, s.KernelCursor)
+	assert.True(t, helperAllowed("journalctl", calls[1]))
+}
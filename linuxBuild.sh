@@ -1 +1,8 @@
-GOOS=linux GOARCH=amd64 go build -ldflags="-s -w" -o heartbeat .
+GOOS=linux GOARCH=amd64 go build -ldflags="-s -w -X main.version=$(git describe --always --dirty)" -o heartbeat .
+
+# assets to attach to a GitHub release for heartbeat self-update. Set HEARTBEAT_SIGNING_KEY to the key file from heartbeat release keygen to sign them.
+cp heartbeat heartbeat-linux-amd64
+sha256sum heartbeat-linux-amd64 > SHA256SUMS
+if [ -n "$HEARTBEAT_SIGNING_KEY" ]; then
+	./heartbeat release sign "$HEARTBEAT_SIGNING_KEY" SHA256SUMS
+fi
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadSample is how long iowait is measured over
+const loadSample = time.Second
+
+// cpuTimes is the cpu line of /proc/stat, in clock ticks
+type cpuTimes struct {
+	iowait, total uint64
+}
+
+// parseCPUTimes reads the time all CPUs have spent waiting on IO, and in total, from /proc/stat
+func parseCPUTimes(data string) (cpuTimes, error) {
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[0] != "cpu" {
+			continue
+		}
+		var t cpuTimes
+		for i, f := range fields[1:] {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return t, fmt.Errorf("reading /proc/stat: %w", err)
+			}
+			// guest time is already counted in user time
+			if i < 8 {
+				t.total += n
+			}
+			if i == 4 {
+				t.iowait = n
+			}
+		}
+		return t, nil
+	}
+	return cpuTimes{}, errors.New("no cpu line in /proc/stat")
+}
+
+// iowaitPercent is how much of the time between two samples was spent waiting on IO
+func iowaitPercent(before, after cpuTimes) float64 {
+	if after.total <= before.total {
+		return 0
+	}
+	return float64(after.iowait-before.iowait) / float64(after.total-before.total) * 100
+}
+
+// parseLoad reads the 1 minute load average from /proc/loadavg
+func parseLoad(data string) (float64, error) {
+	fields := strings.Fields(data)
+	if len(fields) == 0 {
+		return 0, errors.New("empty /proc/loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// busy says why the system is too busy for heavyChecks, or is empty if it isn't: iowait above maxIOWait percent, or a load average per CPU above maxLoad. 0 turns either off.
+func busy(readFile func(string) ([]byte, error), sleep func(time.Duration), cpus int, maxIOWait, maxLoad float64) (string, error) {
+	if maxLoad > 0 {
+		data, err := readFile("/proc/loadavg")
+		if err != nil {
+			return "", err
+		}
+		load, err := parseLoad(string(data))
+		if err != nil {
+			return "", err
+		}
+		if perCPU := load / float64(cpus); perCPU > maxLoad {
+			return fmt.Sprintf("load average %.2f is %.2f per CPU", load, perCPU), nil
+		}
+	}
+	if maxIOWait > 0 {
+		var samples [2]cpuTimes
+		for i := range samples {
+			if i > 0 {
+				sleep(loadSample)
+			}
+			data, err := readFile("/proc/stat")
+			if err != nil {
+				return "", err
+			}
+			if samples[i], err = parseCPUTimes(string(data)); err != nil {
+				return "", err
+			}
+		}
+		if iowait := iowaitPercent(samples[0], samples[1]); iowait > maxIOWait {
+			return fmt.Sprintf("%.0f%% iowait", iowait), nil
+		}
+	}
+	return "", nil
+}
+
+// waitForIdle holds off heavyChecks while the system is busy, checking every busyRecheck for up to busyMaxWait, then lets them run anyway so they can't be put off forever.
+// It returns how long it waited, which isn't counted against runSlowAfter.
+func waitForIdle(readFile func(string) ([]byte, error), sleep func(time.Duration), cpus int) time.Duration {
+	var waited time.Duration
+	for {
+		reason, err := busy(readFile, sleep, cpus, busyIOWait, busyLoad)
+		if err != nil {
+			log.Println("error reading system load, running heavy checks anyway: " + err.Error())
+			return waited
+		}
+		if reason == "" {
+			return waited
+		}
+		if waited >= busyMaxWait {
+			log.Printf("still busy after %s (%s), running heavy checks anyway", waited, reason)
+			return waited
+		}
+		log.Printf("system is busy (%s), holding off heavy checks for %s", reason, busyRecheck)
+		sleep(busyRecheck)
+		waited += busyRecheck
+	}
+}
+
+// jitter sleeps for a random time up to runJitter, so machines started by the same cron line don't all run their checks at once
+func jitter(sleep func(time.Duration)) {
+	if runJitter <= 0 {
+		return
+	}
+	d := rand.N(runJitter)
+	log.Printf("waiting %s before running", d.Round(time.Second))
+	sleep(d)
+}
+
+// guardLoad is waitForIdle against this machine. An instance on another host isn't guarded, since this machine's load says nothing about it.
+func guardLoad() time.Duration {
+	if remoteHost != "" || busyIOWait <= 0 && busyLoad <= 0 {
+		return 0
+	}
+	return waitForIdle(os.ReadFile, time.Sleep, runtime.NumCPU())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseCPUTimes(t *testing.T) {
+	t.Parallel()
+
+	times, err := parseCPUTimes("cpu  133926 0 16690 530414 409 0 16 3997 0 0\ncpu0 133926 0 16690 530414 409 0 16 3997 0 0\nintr 1461668 0 0\n")
+	require.NoError(t, err)
+	assert.Equal(t, cpuTimes{iowait: 409, total: 685452}, times)
+
+	_, err = parseCPUTimes("intr 1461668 0 0\n")
+	assert.Error(t, err)
+
+	assert.InDelta(t, 25.0, iowaitPercent(cpuTimes{iowait: 100, total: 1000}, cpuTimes{iowait: 150, total: 1200}), 0.001)
+	assert.Zero(t, iowaitPercent(cpuTimes{iowait: 100, total: 1000}, cpuTimes{iowait: 100, total: 1000}))
+}
+
+func Test_busy(t *testing.T) {
+	t.Parallel()
+
+	stats := []string{"cpu  1000 0 100 8000 100 0 0 0 0 0\n", "cpu  1100 0 110 8050 240 0 0 0 0 0\n"}
+	files := func(stat int) func(string) ([]byte, error) {
+		return func(path string) ([]byte, error) {
+			switch path {
+			case "/proc/loadavg":
+				return []byte("6.40 3.10 1.20 2/71 9742\n"), nil
+			case "/proc/stat":
+				stat++
+				return []byte(stats[min(stat-1, 1)]), nil
+			}
+			return nil, os.ErrNotExist
+		}
+	}
+	var slept time.Duration
+	sleep := func(d time.Duration) { slept += d }
+
+	reason, err := busy(files(0), sleep, 4, 0, 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, "load average 6.40 is 1.60 per CPU", reason)
+	assert.Zero(t, slept)
+
+	reason, err = busy(files(0), sleep, 8, 0, 1.5)
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+
+	// 140 of 300 ticks waiting on IO
+	reason, err = busy(files(0), sleep, 8, 30, 1.5)
+	require.NoError(t, err)
+	assert.Equal(t, "47% iowait", reason)
+	assert.Equal(t, loadSample, slept)
+
+	reason, err = busy(files(0), sleep, 8, 50, 0)
+	require.NoError(t, err)
+	assert.Empty(t, reason)
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_acquireLock(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "heartbeat.lock")
+	release, err := acquireLock(path)
+	require.NoError(t, err)
+
+	_, err = acquireLock(path)
+	assert.ErrorIs(t, err, errLocked)
+
+	release()
+	release, err = acquireLock(path)
+	require.NoError(t, err)
+	release()
+}
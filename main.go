@@ -1,18 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"math"
 	"os"
 	"os/exec"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gregdel/pushover"
@@ -23,7 +24,230 @@ const user = "uJwFSeRyH5aNFT3TTcp2GeZYrvh185"
 
 var diskUsagePools = []string{"boot-pool", "primarySafe"}
 
-const smartThreshold = 0.05 // x% of smart tests for an individual disk must fail before we fail health check
+// warn when a pool in diskUsagePools is this full (percent of used+available space), and alert as critical at poolUsageCritical. poolUsageLimits overrides both for a pool, eg "boot-pool": {warn: 90, critical: 98}
+const poolUsageWarn = 80.0
+const poolUsageCritical = 95.0
+
+var poolUsageLimits = map[string]usageLimit{}
+
+// warn when any of these datasets has less than this much space available (eg "primarySafe/vms": "200G"). Quotas and reservations mean a dataset can run out well before its pool does.
+var datasetMinFree = map[string]string{}
+
+// checks listed here are skipped: "pool status", "disk replacement", "pool topology", "transient errors", "pool operations", "pool checkpoint", "pool trim", "scrub speed", "dedup table", "compression", "zvols", "snapshot policy", "zrepl", "restore", "services", "peers", "smart selftest", "health score", "sas links", "kernel log", "network", "disk usage", "drive inventory", "disk age", "report share", "run duration", "config"
+var disabledChecks = []string{}
+
+// checks listed here only run once this long has passed since they last passed, eg "smart selftest": time.Hour, "drive inventory": 24 * time.Hour, so cron can run heartbeat every few minutes for pool status without waking every disk for smartctl each time.
+// A check that failed runs every time until it passes, and the weekly update runs everything.
+var checkIntervals = map[string]time.Duration{}
+
+// disks behind a RAID controller or USB bridge need their smartctl device type after a colon, eg "sda:megaraid,0", "sdg:sat", or "sdh:sntasmedia"
+var smartDisks = []string{
+	"sda",
+	"sdb",
+	"sdc",
+	"sdd",
+	"sde",
+	"sdf",
+}
+
+// disks in smartDisks to leave out of the SMART checks, eg USB enclosures that lie about SMART: "serial:WD-WX31D87HJ4KL", "model:ST8000DM004*", or "path:sdf"
+var smartExclude = []string{}
+
+const smartThreshold = 0.05          // x% of smart tests for an individual disk must fail before we fail health check, with older failures counting less (see smartFailureHalfLife)
+const smartFailureHalfLife = 90 * 24 // power on hours after which a failed self-test counts half as much toward smartThreshold
+
+// warnings raised between these hours (local time) are held until quiet hours end. Critical alerts always go out immediately.
+const quietStart = 23
+const quietEnd = 7
+
+// raw command output from failing checks is posted here (eg https://paste.rs) and linked in the alert. The response body must be the paste's URL. Leave empty to disable.
+const pasteURL = ""
+
+// heartbeat.tmpl and alert.tmpl in this directory override the default message templates
+const templateDir = "/mnt/primarySafe/apps/heartbeat"
+
+// heartbeat self-update installs the latest release from this GitHub repository (owner/name). Since the settings are built in, it should be your own fork, with releases built by linuxBuild.sh.
+const updateRepo = ""
+
+// base64 ed25519 public key from `heartbeat release keygen`. When set, self-update only installs releases whose SHA256SUMS is signed with its private key.
+const updateKey = ""
+
+// held for the duration of a run so overlapping runs (eg a hung smartctl) exit instead of double notifying
+var lockPath = "/var/run/heartbeat.lock"
+
+// refuse to run anything that could change a pool or disk (zpool clear, smartctl -t, badblocks), whatever the rest of the settings ask for
+const readOnly = false
+
+// every command run is appended here as a line of JSON with its arguments, start time, duration, and exit code. Leave empty to disable.
+var auditLogPath = ""
+
+// other machines to monitor, each run by its own cron line: `heartbeat instance offsite`. Commands run over ssh as Host (which should log in as root, without a password), and local only checks are skipped.
+// eg {Name: "offsite", Host: "root@offsite.example.com", Pools: []string{"backup"}, SmartDisks: []string{"sda", "sdb"}, NotifyURLs: []string{"pushover://token@user"}}
+var instances = []instance{}
+
+// a simple health page (health.html) and a copy of the status file are written here each run, eg a folder on an SMB share so anyone in the house can open it from Windows or a phone. Leave empty to disable.
+const reportDir = ""
+
+// the share reportDir is mounted from, eg //nas/family. The report share check warns when it isn't mounted there (or can't be written to), rather than the page quietly landing on the local disk. Leave empty to skip the check.
+const reportShare = ""
+
+// run commands on the host when heartbeat is in a container: "nsenter" enters the host's namespaces through its init (run the container with --pid=host and CAP_SYS_ADMIN), and "chroot" runs them from the host's root filesystem mounted at hostRoot (with the host's /dev mounted too). Leave empty to run them directly.
+const hostMode = ""
+const hostRoot = "/host"
+
+// run zpool, zfs, and smartctl through sudo and heartbeat helper, so the job itself doesn't need root. Run `heartbeat install sudoers <user>` as root to add the sudoers rule.
+const sudoHelper = false
+
+// the result of every run is written here as JSON for other tools to poll. `heartbeat status` fails if it is older than statusStaleAfter. Leave empty to disable.
+var statusPath = "/mnt/primarySafe/apps/heartbeat/status.json"
+
+const statusStaleAfter = 2 * time.Hour
+
+const checkpointMaxAge = 3 * 24 * time.Hour // warn when a pool checkpoint is older than this, since it holds on to everything freed since it was taken
+
+const ddtMaxFraction = 0.5 // warn when dedup tables would fill more than this fraction of the maximum ARC size
+
+const compressionDrop = 0.0 // warn when a dataset's compression ratio falls by more than this fraction in a week (eg 0.25), which usually means incompressible data is landing somewhere it shouldn't. 0 disables.
+
+// datasets are checked for the snapshots promised by this sanoid config, if it exists, and by snapshotPolicy, eg "primarySafe/home": {Keep: map[string]int{"hourly": 24, "daily": 30}, Recursive: true}
+const sanoidConf = "/etc/sanoid/sanoid.conf"
+
+var snapshotPolicy = map[string]retention{}
+
+// zrepl jobs are checked for failed replication, or replication running longer than zreplStuckAfter
+const zreplEnabled = false
+const zreplStuckAfter = 6 * time.Hour
+
+// each run, these files (relative to the dataset, with an optional sha256) are read back out of the newest snapshot of restoreDataset to prove backups can be restored. Leave restoreDataset empty to disable.
+const restoreDataset = ""
+
+var restoreSentinels = map[string]string{}
+
+// network interfaces to check for errors and, for bonds, missing links (eg "bond0")
+var netInterfaces = []string{}
+
+// replication partners to check each run: a host is pinged, a host:port is probed over TCP
+var peers = []string{}
+
+const peerGrace = 30 * time.Minute // warn when a peer has been unreachable for this long
+
+// storage services clients depend on, probed each run, eg {Kind: "smb", Address: "localhost"} or {Kind: "nfs", Address: "localhost"}
+var services = []service{}
+
+const scrubSlowdown = 0.5 // warn while a scrub or resilver runs this much slower than the pool's usual speed, an early sign of a dying disk or cable
+
+const trimMaxAge = 35 * 24 * time.Hour // warn when a pool with SSDs hasn't been fully trimmed (zpool trim) in this long
+
+const operationStallAfter = 6 * time.Hour // warn when a device removal or raidz expansion hasn't progressed in this long
+
+const runSlowAfter = 10 * time.Minute // warn when a run takes longer than this, since a disk that's slow to answer smartctl or zpool is often a dying one. 0 disables.
+
+// sleep a random time up to this before each run, so machines started by the same cron line don't all hit a shared backup target or notifier at once. 0 disables.
+const runJitter = 0 * time.Minute
+
+// heavyChecks wait while iowait is above busyIOWait percent, or the 1 minute load average per CPU is above busyLoad, so heartbeat doesn't add to the latency it's measuring.
+// They check again every busyRecheck, and run anyway after busyMaxWait. 0 disables either guard.
+var heavyChecks = []string{"smart selftest", "health score", "drive inventory"}
+
+const busyIOWait = 0.0
+const busyLoad = 0.0
+const busyRecheck = 15 * time.Second
+const busyMaxWait = 2 * time.Minute
+
+const poolParallelism = 4 // pools checked at once, for hosts with many pools (eg a pool per VM)
+
+const driveServiceLife = 5.0 // years of power on time before a drive should be replaced, and warned about
+const driveAgedPerVdev = 1   // warn when more than this many disks in one vdev are past driveServiceLife, since drives that age together tend to fail together
+
+// warn when a disk's health score (see health.go) reaches healthScoreMax, or rises by healthScoreRise within 30 days
+const healthScoreRise = 10
+const healthScoreMax = 50
+
+// each run is exported as an OpenTelemetry trace to this OTLP/HTTP collector (eg http://localhost:4318). Leave empty to disable.
+const otlpEndpoint = ""
+
+// check results and alerts are written to syslog (with structured fields when journald is available)
+const syslogEnabled = false
+
+// health changes are sent as SNMPv2c traps to this host:port (eg nms.local:162). Leave empty to disable. See mibs/ZFS-HEARTBEAT-MIB.txt.
+const snmpTarget = ""
+const snmpCommunity = "public"
+const snmpBaseOID = "1.3.6.1.4.1.8072.9999.9999.1" // netSnmpPlaypen.1
+
+// check results are pushed to this zabbix server/proxy trapper port (eg zabbix.local:10051). Leave empty to disable. See zabbix.go for item keys.
+const zabbixServer = ""
+const zabbixHost = "" // host name in zabbix, defaults to this machine's hostname
+
+// scrubs, resilvers, and alerts are posted as annotations to this grafana (eg http://grafana.local:3000). Leave empty to disable.
+const grafanaURL = ""
+const grafanaToken = "" // service account token with the annotations:write permission
+
+// alerts are also posted to this discord webhook (https://discord.com/api/webhooks/...). Leave empty to disable.
+const discordWebhook = ""
+
+// alerts are also posted to slack, via either an incoming webhook or a bot token (chat:write) and channel. Leave empty to disable.
+const slackWebhook = ""
+const slackToken = ""
+const slackChannel = ""
+
+// alerts are also sent to this matrix room, eg https://matrix.org, a bot account's access token, and !roomid:matrix.org. Leave empty to disable.
+const matrixHomeserver = ""
+const matrixToken = ""
+const matrixRoom = ""
+
+// alerts are also published to this SNS topic and/or emailed via SES. Credentials come from the usual AWS environment variables, ~/.aws/credentials, or the instance role.
+const snsTopicARN = ""
+const sesRegion = "us-east-1"
+const sesFrom = ""
+
+var sesTo = []string{}
+
+// alerts are also sent to each of these services. See parseNotifyURL for the supported formats, eg "discord://webhook_id/webhook_token".
+var notifyURLs = []string{}
+
+// recipient groups get their own version of every notification, rendered with <group>.tmpl from templateDir (see groupReport), eg "family": {"pushover://token@user"}.
+// The built in family template only says whether the NAS needs attention; other groups without a template get the full message.
+var notifyGroups = map[string][]string{}
+
+// language of each recipient group's messages, eg "family": "es". Templates translate text with {{T "..."}} using <locale>.json from templateDir, falling back to the built in translations in i18n.go.
+var notifyLocales = map[string]string{}
+
+// failing checks open an opsgenie alert (routed to opsgenieTeam, if set) that is closed when the check recovers. Leave the key empty to disable.
+const opsgenieKey = ""
+const opsgenieTeam = ""
+const opsgenieAPI = "https://api.opsgenie.com" // https://api.eu.opsgenie.com for EU accounts
+
+// critical alerts are sent with pushover's emergency priority, and texted to smsTo via twilio if nobody acknowledges them within escalateAfter. Leave twilioSID empty to disable.
+const twilioSID = ""
+const twilioToken = ""
+const twilioFrom = "" // twilio phone number, eg +15555550100
+const escalateAfter = 15 * time.Minute
+
+var smsTo = []string{}
+
+// after heartbeat ack, zpool clear disks with no more than transientErrorLimit read, write, and checksum errors, alerting critically if they come back within clearWatch.
+// Until then, such disks are only a warning.
+const autoClear = false
+const transientErrorLimit = 3
+const clearWatch = 14 * 24 * time.Hour
+
+// set to false to only send alerts to syslog (see syslogEnabled) or the other backends instead of pushover
+const pushoverEnabled = true
+
+// each notifier may send notifyBurst notifications at once, refilled at notifyPerHour, and no more than notifyMaxPerHour go out across all of them,
+// so a flapping disk can't burn through a month of pushover messages overnight
+const notifyBurst = 5
+const notifyPerHour = 2.0
+const notifyMaxPerHour = 10
+
+// only notify when something changes: a check starts failing, gets more severe (eg warning to critical), finds a new problem (eg a second pool degrading), or recovers. Otherwise a problem is alerted on again every 23 hours until it's fixed.
+const edgeTriggered = false
+
+// pushover messages are limited to 1024 characters, so long alerts keep their most important lines and count the rest. Set to send the rest as follow up messages instead.
+const pushoverContinuation = false
+
+// "html" sends pushover messages with the severity of each finding in bold and color and the paste link clickable, and "monospace" lines up zpool status excerpts in a fixed width font. Other backends always get plain text.
+const pushoverFormat = ""
 
 type notifier interface {
 	SendMessage(message *pushover.Message, recipient *pushover.Recipient) (*pushover.Response, error)
@@ -31,39 +255,484 @@ type notifier interface {
 
 type executer func(cmd string, args ...string) (string, error)
 
+// exit codes of the heartbeat job, for wrapper scripts and cron monitors
+const (
+	exitHealthy  = 0
+	exitWarning  = 1 // a check found a warning
+	exitCritical = 2 // a check found a critical problem
+	exitError    = 3 // a check couldn't run, and nothing else was found
+)
+
 func main() {
-	log.SetOutput(os.Stderr)
+	useEnv()
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
+	os.Exit(heartbeat())
+}
+
+// heartbeat runs every check and sends the results, returning the process exit code
+func heartbeat() (code int) {
+	jitter(time.Sleep)
+	release, err := acquireLock(lockPath)
+	if errors.Is(err, errLocked) {
+		log.Println(err)
+		return exitHealthy
+	} else if err != nil {
+		log.Println("error acquiring lock, running anyway: " + err.Error())
+	} else {
+		defer release()
+	}
+
 	log.Println("Running heartbeat job...")
 	app := pushover.New(token)
+	// checks recover from their own panics, so this catches the rest of the run, eg building the report
+	defer func() {
+		if r := recover(); r != nil {
+			err := recovered("heartbeat", r)
+			notify(app, notification{title: "Heartbeat internal error", message: err.Error(), severity: severityWarning})
+			code = exitError
+		}
+	}()
+	flushDeferred(app, time.Now())
+	checkEscalation(app, time.Now())
 
-	err := checkPoolStatus(execute)
-	var oldestDisk int
-	var youngestDisk int
+	tr := newTracer()
+	defer func() {
+		if err := tr.export(); err != nil {
+			log.Println("error exporting traces: " + err.Error())
+		}
+	}()
+
+	started := time.Now()
+	runs, err := loadState()
 	if err != nil {
-		notify(app, "Health check failed!", err.Error())
-		return
+		log.Println("error opening state file for read: " + err.Error())
 	}
-	err, oldestDisk, youngestDisk = checkSmartStatus(execute)
-	if err != nil {
-		notify(app, "Health check failed!", "Check logs")
-		log.Println(err.Error())
-		return
+	cache := newCommandCache(execute)
+	var d digest
+	var results []checkResult
+	var waited time.Duration // holding off heavyChecks, see guardLoad
+	guarded := false
+	checkStream := func(name string, sev severity, fn func(span *span, e executer, stream streamer) error) {
+		if !checkEnabled(name) {
+			log.Printf("%s: skipped", name)
+			logEvent(severityInfo, name+": skipped", map[string]string{"HEARTBEAT_CHECK": name, "HEARTBEAT_RESULT": "skipped"})
+			results = append(results, checkResult{name: name, skipped: true})
+			return
+		}
+		if !shouldNotify(started) && !checkDue(runs, name, checkIntervals[name], started) {
+			log.Printf("%s: not due, last passed %s", name, runs.CheckRuns[name].Local().Format(time.Kitchen))
+			logEvent(severityInfo, name+": not due", map[string]string{"HEARTBEAT_CHECK": name, "HEARTBEAT_RESULT": "skipped"})
+			results = append(results, checkResult{name: name, skipped: true})
+			return
+		}
+		if !guarded && slices.Contains(heavyChecks, name) {
+			guarded = true
+			waited = guardLoad()
+		}
+		span := tr.start(name)
+		rec := &recorder{e: span.execute(cache.execute), s: span.stream(executeStream)}
+		start := time.Now()
+		err := safely(name, func() error { return fn(span, rec.execute, rec.stream) })
+		took := time.Since(start)
+		if err != nil {
+			d.addError(name, sev, err, rec.String())
+		}
+		span.finish(err)
+		logResult(name, sev, err, took)
+		results = append(results, checkResult{name: name, severity: sev, err: err, duration: took})
+	}
+	check := func(name string, sev severity, fn func(span *span, e executer) error) {
+		checkStream(name, sev, func(span *span, e executer, _ streamer) error { return fn(span, e) })
 	}
 
-	diskUsage, err := diskUsage(app, execute)
-	if err != nil {
-		notify(app, "Health check failed!", "Check logs")
-		log.Println(err.Error())
-		return
+	check("config", severityWarning, func(span *span, e executer) error {
+		return configError(validateConfig(e, os.Stat))
+	})
+	var pools []pool
+	checkStream("pool status", severityCritical, func(span *span, e executer, stream streamer) (err error) {
+		s, loadErr := loadState()
+		if loadErr != nil {
+			log.Println("error opening state file for read: " + loadErr.Error())
+		}
+		pools, err = checkPoolStatus(e, stream, s.Replacements)
+		problems := make([]string, len(pools))
+		eachPool(pools, func(i int, p pool) error {
+			if !p.Health() {
+				problems[i] = p.HealthSummary()
+			}
+			return nil
+		})
+		for i, p := range pools {
+			ps := span.child("pool " + p.name)
+			ps.attrs["pool"] = p.name
+			if problems[i] == "" {
+				ps.finish(nil)
+			} else {
+				ps.finish(errors.New(problems[i]))
+			}
+		}
+		return err
+	})
+	var replaced []string
+	check("disk replacement", severityWarning, func(span *span, e executer) (err error) {
+		replaced, err = trackReplacements(pools)
+		return err
+	})
+	if autoClear {
+		check("transient errors", severityWarning, func(span *span, e executer) error {
+			return trackTransient(e, pools)
+		})
+	}
+	check("pool topology", severityWarning, func(span *span, e executer) error {
+		if len(pools) == 0 {
+			return nil
+		}
+		return trackTopology(e, pools)
+	})
+	check("pool operations", severityWarning, func(span *span, e executer) error {
+		return trackOperations(pools)
+	})
+	check("pool checkpoint", severityWarning, func(span *span, e executer) error {
+		return checkCheckpoints(pools, time.Now())
+	})
+	check("pool trim", severityWarning, func(span *span, e executer) error {
+		if err := readAutotrim(e, pools); err != nil {
+			return err
+		}
+		return checkTrim(pools, time.Now())
+	})
+	check("dedup table", severityWarning, func(span *span, e executer) error {
+		return checkDedup(e)
+	})
+	// the first check that needs the disks identifies them with its executer, so nothing runs when those checks are disabled or not due
+	var disks []string
+	var skippedDisks map[string]string
+	targetsResolved := false
+	targets := func(e executer) []string {
+		if !targetsResolved {
+			targetsResolved = true
+			disks, skippedDisks = smartTargets(e, smartDisks, smartExclude)
+			for disk, reason := range skippedDisks {
+				log.Printf("skipping SMART checks on %s: %s", disk, reason)
+			}
+		}
+		return disks
+	}
+	var selfTests map[string]int
+	check("smart selftest", severityWarning, func(span *span, e executer) (err error) {
+		err, selfTests = checkSmartStatus(e, targets(e))
+		return err
+	})
+	check("health score", severityWarning, func(span *span, e executer) error {
+		return trackHealth(e, targets(e))
+	})
+	check("sas links", severityWarning, func(span *span, e executer) error {
+		return trackLinkErrors()
+	})
+	check("kernel log", severityWarning, func(span *span, e executer) error {
+		return trackKernelLog(e)
+	})
+	var usage map[string]space
+	check("disk usage", severityWarning, func(span *span, e executer) (err error) {
+		usage, err = diskUsage(e)
+		recordUsage(span, usage)
+		return err
+	})
+	check("scrub speed", severityWarning, func(span *span, e executer) error {
+		return trackScrubSpeed(pools, usage)
+	})
+	var datasets []datasetSpace
+	check("compression", severityWarning, func(span *span, e executer) (err error) {
+		datasets, err = readCompression(e)
+		if err != nil {
+			return err
+		}
+		return trackCompression(datasets)
+	})
+	var zvols []zvol
+	check("zvols", severityWarning, func(span *span, e executer) (err error) {
+		zvols, err = readZvols(e)
+		if err != nil {
+			return err
+		}
+		return checkZvols(zvols)
+	})
+	check("snapshot policy", severityWarning, func(span *span, e executer) error {
+		return checkSnapshots(e)
+	})
+	if zreplEnabled {
+		check("zrepl", severityWarning, func(span *span, e executer) error {
+			return checkZrepl(e)
+		})
+	}
+	if len(services) > 0 {
+		check("services", severityCritical, func(span *span, e executer) error {
+			return checkServices(e, services)
+		})
+	}
+	if len(netInterfaces) > 0 {
+		check("network", severityWarning, func(span *span, e executer) error {
+			return trackNetwork()
+		})
+	}
+	if len(peers) > 0 {
+		check("peers", severityWarning, func(span *span, e executer) error {
+			return trackPeers(e)
+		})
+	}
+	var restored string
+	if restoreDataset != "" {
+		check("restore", severityWarning, func(span *span, e executer) (err error) {
+			restored, err = verifyRestore(e)
+			return err
+		})
+	}
+	var drives []drive
+	check("drive inventory", severityWarning, func(span *span, e executer) (err error) {
+		drives, err = readDrives(e, targets(e))
+		if err != nil {
+			return err
+		}
+		if changes := recordDrives(drives, selfTests, time.Now()); len(changes) > 0 {
+			return errors.New("drive changed: " + strings.Join(changes, "\ndrive changed: "))
+		}
+		return nil
+	})
+	var devicePools []pool
+	check("disk age", severityWarning, func(span *span, e executer) (err error) {
+		if len(drives) == 0 {
+			return nil
+		}
+		if devicePools, err = readDevicePools(e); err != nil {
+			return err
+		}
+		return checkDiskAge(devicePools, drives, driveServiceLife, driveAgedPerVdev)
+	})
+	if reportDir != "" && reportShare != "" {
+		check("report share", severityWarning, func(span *span, e executer) error {
+			return trackReportShare()
+		})
+	}
+	// runs last, so it covers every other check
+	check("run duration", severityWarning, func(span *span, e executer) error {
+		return checkRunDuration(results, time.Since(started)-waited, runSlowAfter)
+	})
+	elapsed := time.Since(started)
+	if len(checkIntervals) > 0 || len(runs.CheckRuns) > 0 {
+		trackCheckRuns(results, time.Now())
+	}
+	d.findings = correlate(d.findings, pools, devicePools, drives)
+
+	reportTransitions(results, pools)
+	if statusPath != "" || reportDir != "" {
+		st := newRunStatus(time.Now(), elapsed, results, pools, usage, skippedDisks)
+		st.addDrives(drives)
+		if statusPath != "" {
+			if err := keepPreviousStatus(statusPath); err != nil {
+				log.Println("error keeping the previous status file: " + err.Error())
+			}
+			if err := writeStatus(statusPath, st); err != nil {
+				log.Println("error writing status file: " + err.Error())
+			}
+		}
+		if reportDir != "" {
+			if err := writeReport(reportDir, st); err != nil {
+				log.Println("error writing health page: " + err.Error())
+			}
+		}
+	}
+	if err := sendZabbix(results, pools, usage, elapsed); err != nil {
+		log.Println("error sending results to zabbix: " + err.Error())
+	}
+	if err := annotateGrafana(pools, d.findings); err != nil {
+		log.Println("error sending annotations to grafana: " + err.Error())
 	}
 
-	msg := fmt.Sprintf("Disk age: %.2f-%.2f years\nFree Space: %s", yearsFromHours(youngestDisk), yearsFromHours(oldestDisk), diskUsage)
+	// good news doesn't start the 23 hour mute, so it can't hold back this run's alerts
+	for _, msg := range replaced {
+		log.Println(msg)
+		notify(app, notification{title: "Disk replaced", message: msg, severity: severityInfo})
+	}
+
+	if edgeTriggered {
+		notifyEdges(app, results, d)
+	}
+	if len(d.findings) > 0 {
+		log.Println(d.String())
+		if !edgeTriggered {
+			trackAlerts(d.findings)
+			d.send(app)
+		}
+		return d.exitCode()
+	}
+
+	oldestDisk, youngestDisk := ageRange(selfTests)
+	report := newHeartbeatReport(pools, usage, oldestDisk, youngestDisk, drives, datasets)
+	report.Restore = restored
+	report.Zvols = zvolReports(zvols)
+	report.addDiskAges(devicePools, drives)
+	weekly := shouldNotify(time.Now())
+	if weekly && remoteHost == "" {
+		report.Host = trackHost()
+	}
+	msg := report.String()
 	log.Println(msg)
-	if err != nil {
-		log.Println(err.Error())
-		notify(app, "Health check failed!", err.Error())
-	} else if shouldNotify(time.Now()) {
-		notify(app, "Heartbeat", msg)
+	if weekly {
+		notify(app, notification{title: "Heartbeat", message: msg, severity: severityInfo})
+	}
+	return exitHealthy
+}
+
+func checkEnabled(name string) bool {
+	return !slices.Contains(disabledChecks, name)
+}
+
+// rateLimited is true while a problem alerted on in the last 23 hours mutes notifications of sev. A critical alert is only muted by an earlier critical one, so it still pages straight after a warning.
+func rateLimited(s state, now time.Time, sev severity) bool {
+	if sev == severityCritical && s.LastSeverity != severityCritical {
+		return false
+	}
+	return !edgeTriggered && s.LastUpdated.Add(time.Hour*23).After(now)
+}
+
+// runCommand runs a subcommand instead of the heartbeat job
+func runCommand(args []string) {
+	switch args[0] {
+	case "fleet":
+		s, err := loadState()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fleet(os.Stdout, s)
+	case "status":
+		st, err := readStatus(statusPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		data, _ := json.MarshalIndent(st, "", "\t")
+		fmt.Println(string(data))
+		if st.stale(time.Now()) {
+			log.Fatalf("last run was at %s", st.Time.Format(time.RFC3339))
+		}
+	case "diff":
+		if err := diffCommand(os.Stdout, args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	case "alerts":
+		s, err := loadState()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := alerts(os.Stdout, s, args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	case "replace-disk":
+		s, err := loadState()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := replaceDisk(os.Stdout, &s, args[1:], time.Now()); err != nil {
+			log.Fatalln(err)
+		}
+		saveState(s)
+	case "ack":
+		s, err := loadState()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := ack(&s, args[1:], time.Now()); err != nil {
+			log.Fatalln(err)
+		}
+		saveState(s)
+	case "import":
+		if len(args) != 2 {
+			log.Fatalln("usage: heartbeat import <dir>")
+		}
+		s, err := loadState()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		usage := func() (map[string]space, error) {
+			out, err := execute("zfs", zfsSpaceArgs...)
+			if err != nil {
+				return nil, err
+			}
+			return parseSpace(out)
+		}
+		if err := importHistory(os.Stdout, &s, args[1], usage, time.Now()); err != nil {
+			log.Fatalln(err)
+		}
+		saveState(s)
+	case "burnin":
+		s, err := loadState()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		// a burn-in takes days, so only its own progress is written back over whatever the heartbeat job has saved since
+		save := func() {
+			latest, err := loadState()
+			if err != nil {
+				log.Println("error opening state file for read, burn-in progress not saved: " + err.Error())
+				return
+			}
+			latest.BurnIns = s.BurnIns
+			saveState(latest)
+		}
+		b, err := burnInCommand(os.Stdout, execute, &s, args[1:], save, time.Sleep, time.Now)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if b != nil && b.Result != "" {
+			notify(pushover.New(token), notification{title: "Burn-in finished", message: b.String(), severity: severityInfo})
+		}
+	case "doctor":
+		if !doctor(os.Stdout, execute, pushover.New(token)) {
+			os.Exit(1)
+		}
+	case "instance":
+		if len(args) < 2 {
+			log.Fatalln("usage: heartbeat instance <name> [command]")
+		}
+		if err := useInstance(args[1]); err != nil {
+			log.Fatalln(err)
+		}
+		if len(args) > 2 {
+			runCommand(args[2:])
+			return
+		}
+		os.Exit(heartbeat())
+	case "tui":
+		if err := tui(os.Stdout, args[1:], func() (runStatus, error) { return readStatus(statusPath) }, loadState, time.Sleep); err != nil {
+			log.Fatalln(err)
+		}
+	case "validate":
+		if !validate(os.Stdout, execute, pushover.New(token)) {
+			os.Exit(1)
+		}
+	case "helper":
+		if err := helper(args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	case "--version", "version":
+		printVersion(os.Stdout)
+	case "self-update":
+		if err := selfUpdate(os.Stdout, args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	case "release":
+		if err := releaseCommand(os.Stdout, args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	case "install":
+		if err := installCommand(args[1:]); err != nil {
+			log.Fatalln(err)
+		}
+	default:
+		log.Fatalf("unknown command %s", args[0])
 	}
 }
 
@@ -75,189 +744,446 @@ func shouldNotify(t time.Time) bool {
 	return t.Weekday() == time.Saturday && t.Hour() == 8 && t.Minute() <= 29
 }
 
-func diskUsage(app notifier, e executer) (map[string]string, error) {
-	diskUsage, err := e("zfs", "list")
+// checkError means a check could not run, as opposed to running and finding a problem
+type checkError struct {
+	err error
+}
+
+func (e checkError) Error() string {
+	return e.err.Error()
+}
+
+func (e checkError) Unwrap() error {
+	return e.err
+}
+
+// space is the space used by and available to a dataset, in bytes
+type space struct {
+	used  uint64
+	avail uint64
+}
+
+func diskUsage(e executer) (map[string]space, error) {
+	out, err := e("zfs", zfsSpaceArgs...)
 	if err != nil {
-		log.Println(err)
-		notify(app, "Internal Error", err.Error())
-		return nil, err
+		return nil, checkError{err}
+	}
+	all, err := parseSpace(out)
+	if err != nil {
+		return nil, checkError{err}
 	}
 
-	usage := make(map[string]string)
+	usage := make(map[string]space)
+	var errs []error
 	for _, poolName := range diskUsagePools {
-		re := regexp.MustCompile(fmt.Sprintf(`%s\s+\S+\s+(\S+)\s+`, poolName))
-		matches := re.FindStringSubmatch(diskUsage)
-		usage[poolName] = matches[1]
+		s, ok := all[poolName]
+		if !ok {
+			errs = append(errs, checkError{fmt.Errorf("pool %s not found in zfs list", poolName)})
+			continue
+		}
+		usage[poolName] = s
+		if err := checkPoolUsage(poolName, s); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return usage, nil
+
+	datasets := make([]string, 0, len(datasetMinFree))
+	for name := range datasetMinFree {
+		datasets = append(datasets, name)
+	}
+	slices.Sort(datasets)
+	for _, name := range datasets {
+		s, ok := all[name]
+		if !ok {
+			errs = append(errs, checkError{fmt.Errorf("dataset %s not found in zfs list", name)})
+			continue
+		}
+		usage[name] = s
+		if err := checkMinFree(name, s.avail, datasetMinFree[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return usage, errors.Join(errs...)
 }
 
-func checkPoolStatus(e executer) error {
-	zStatus, err := e("/sbin/zpool", "status")
+// zfsSpaceArgs lists the space used by every filesystem and volume, with the columns both diskUsage and readCompression need so the run's command cache only runs it once
+var zfsSpaceArgs = []string{"list", "-H", "-p", "-t", "filesystem,volume", "-o", "name,used,avail,logicalused,compressratio"}
+
+// parseSpace reads the output of zfs list -H -p -o name,used,avail, ignoring any columns after those
+func parseSpace(out string) (map[string]space, error) {
+	all := make(map[string]space)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("unexpected zfs list output: %q", line)
+		}
+		var s space
+		var err error
+		if s.used, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return nil, err
+		}
+		if s.avail, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+			return nil, err
+		}
+		all[fields[0]] = s
+	}
+	return all, nil
+}
+
+// checkMinFree returns an error if avail is less than minFree
+func checkMinFree(name string, avail uint64, minFree string) error {
+	threshold, err := parseSize(minFree)
 	if err != nil {
-		return err
+		return checkError{fmt.Errorf("datasetMinFree for %s: %w", name, err)}
 	}
+	if avail < threshold {
+		return fmt.Errorf("dataset %s has %s available, less than %s", name, formatBytes(avail), formatBytes(threshold))
+	}
+	return nil
+}
 
-	pools, err := parsePools(zStatus)
+func checkPoolStatus(e executer, stream streamer, replacements []replacement) ([]pool, error) {
+	version := detectZFSVersion(e)
+	zStatus, err := stream("/sbin/zpool", version.statusArgs()...)
 	if err != nil {
-		return err
+		return nil, checkError{err}
 	}
 
-	var errs []string
-	for _, p := range pools {
-		if !p.Health() {
-			errs = append(errs, p.String())
-			for _, v := range p.vdevs {
-				if !v.Healthy() {
-					errs = append(errs, v.String())
-				}
-
-				for _, disk := range v.disks {
-					if !disk.Healthy() {
-						errs = append(errs, disk.String())
-					}
-				}
+	// a line the parser doesn't understand shouldn't hide problems with the rest of the pools
+	pools, parseErr := parsePoolsReader(zStatus)
+	if err := zStatus.Close(); err != nil {
+		return nil, checkError{err}
+	}
+	if len(pools) == 0 && parseErr != nil {
+		return nil, checkError{parseErr}
+	}
+
+	if slices.ContainsFunc(pools, pool.Upgradable) {
+		// only informational, so a failure here doesn't fail the check
+		if out, err := e("/sbin/zpool", "upgrade"); err != nil {
+			log.Println("error listing pool features: " + err.Error())
+		} else {
+			features := parseUpgradable(out)
+			for i := range pools {
+				pools[i].features = features[pools[i].name]
 			}
 		}
+	}
+
+	var found []error
+	for _, p := range pools {
+		ev := p.Evaluate()
+		if i := slices.IndexFunc(replacements, func(r replacement) bool { return r.expected(p) }); i >= 0 && !ev.Healthy() {
+			log.Printf("pool %s is %s while %s is replaced", p.name, p.state, replacements[i])
+		} else if !ev.Healthy() {
+			// a few errors on an otherwise healthy disk are only a warning: heartbeat ack and autoClear deal with them, and a recurrence is critical
+			found = append(found, ev.err(fmt.Sprintf("pool %s is %s", p.name, p.state)))
+		}
 		if strings.Contains(p.scanStatus, "scrub repaired") && !strings.Contains(p.scanStatus, "with 0 errors") {
-			errs = append(errs, "scrub of %s encountered errors: %s", p.name, p.scanStatus)
+			found = append(found, fmt.Errorf("scrub of %s encountered errors: %s", p.name, p.scanStatus))
 		}
 	}
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "\n"))
+	if parseErr != nil {
+		found = append(found, checkError{parseErr})
 	}
-
-	return nil
+	return pools, errors.Join(found...)
 }
 
-func checkSmartStatus(e executer) (err error, oldest int, youngest int) {
-	youngest = math.MaxInt32
-
-	smartRe := regexp.MustCompile(`#\s*\d+\s*.+?\s{2,}(.+?)\s*\w*00%\s*(\d+)`)
-	disks := []string{
-		"sda",
-		"sdb",
-		"sdc",
-		"sdd",
-		"sde",
-		"sdf",
-	}
+// checkSmartStatus checks the health and self-test log of each disk, returning the power on hours of each disk's latest self-test
+func checkSmartStatus(e executer, disks []string) (err error, selfTests map[string]int) {
+	selfTests = make(map[string]int)
+	var errs []error
 	for _, disk := range disks {
-		var status string
-		status, err = e("/sbin/smartctl", "-l", "selftest", "/dev/"+disk)
-		if err != nil {
-			return
+		// the extended self-test log holds far more than the 21 entries of the standard one, and selftest falls back to the standard log where it isn't supported
+		status, err := e("/sbin/smartctl", smartctlArgs(disk, "-H", "-l", "xselftest,selftest", "-A")...)
+		bits, exited := smartctlExit(err)
+		if err != nil && (!exited || bits&smartctlUnreadable != 0) {
+			errs = append(errs, checkError{fmt.Errorf("disk %s: %w", disk, err)})
+			continue
+		}
+		if bits&smartctlDiskFailing != 0 {
+			errs = append(errs, severityError{severityCritical, smartError{disk, "SMART overall health check failed"}})
+		}
+		if bits&smartctlPrefailThreshold != 0 {
+			errs = append(errs, smartError{disk, "prefailure attributes at or below threshold"})
 		}
 
-		matches := smartRe.FindAllStringSubmatch(status, -1)
-		fails := 0
+		powerOn := parseDrive(status).PowerOnHours
+		var tests []selfTestEntry
 		var latestFail string
-		for j := 0; j < len(matches); j++ {
-			match := matches[j]
-			if match[1] != "Completed without error" {
-				latestFail = match[1]
-				fails++
+		for _, entry := range readSelfTestLog(status) {
+			// a test still running or cut short hasn't passed or failed
+			if !strings.HasSuffix(entry.remaining, "00%") {
+				continue
 			}
-			var age int
-			age, err = strconv.Atoi(match[2])
-			if err != nil {
-				return
+			t := selfTestEntry{passed: entry.status == "Completed without error", hours: unwrapHours(entry.hours, powerOn)}
+			if !t.passed && latestFail == "" {
+				latestFail = entry.status
 			}
+			tests = append(tests, t)
+		}
+		if len(tests) > 0 {
+			selfTests[disk] = tests[0].hours
+		}
 
-			if j == 0 && age > oldest {
-				oldest = age
-			}
-			if j == 0 && age < youngest {
-				youngest = age
-			}
+		if failureScore(tests, powerOn) >= smartThreshold {
+			errs = append(errs, smartError{disk, latestFail})
 		}
+	}
 
-		if float32(fails)/float32(len(matches)) >= smartThreshold {
-			err = fmt.Errorf("smart error: disk %s: %s", disk, latestFail)
-			return
+	return errors.Join(errs...), selfTests
+}
+
+// selfTestEntry is an entry in the SMART self-test log
+type selfTestEntry struct {
+	passed bool
+	hours  int // power on hours when it ran
+}
+
+// failureScore is the fraction of tests that failed, with a failure counting half as much every smartFailureHalfLife power on hours,
+// so a drive that failed a couple of tests years ago and has been clean since doesn't look like one failing now. tests are newest first.
+// Only failures are discounted, so a score is never higher than the plain fraction.
+func failureScore(tests []selfTestEntry, powerOn int) float64 {
+	if len(tests) == 0 {
+		return 0
+	}
+	now := max(powerOn, tests[0].hours)
+	var failed float64
+	for _, t := range tests {
+		if !t.passed {
+			failed += math.Pow(0.5, float64(max(now-t.hours, 0))/smartFailureHalfLife)
 		}
 	}
+	return failed / float64(len(tests))
+}
 
-	return nil, oldest, youngest
+// smartHourWrap is where the 16 bit lifetime hours in the SMART self-test log wrap around, after about 7.5 years
+const smartHourWrap = 1 << 16
+
+// unwrapHours reconstructs the power on hours a self-test ran at from the wrapped value in the log, using the drive's current power on hours (attribute 9)
+func unwrapHours(logged, powerOn int) int {
+	if powerOn < logged {
+		return logged
+	}
+	return logged + (powerOn-logged)/smartHourWrap*smartHourWrap
 }
 
-func execute(cmd string, args ...string) (string, error) {
-	c := exec.Command(cmd, args...)
-	stderr, err := c.StderrPipe()
+// ageRange is the power on hours of the oldest and youngest disks
+func ageRange(hours map[string]int) (oldest, youngest int) {
+	first := true
+	for _, h := range hours {
+		if first || h > oldest {
+			oldest = h
+		}
+		if first || h < youngest {
+			youngest = h
+		}
+		first = false
+	}
+	return oldest, youngest
+}
+
+// recorder wraps an executer and streamer, keeping the output of every command it runs
+type recorder struct {
+	e      executer
+	s      streamer
+	mu     sync.Mutex // commands may run concurrently, see eachPool
+	output []string
+}
+
+func (r *recorder) execute(cmd string, args ...string) (string, error) {
+	out, err := r.e(cmd, args...)
+	r.record(cmd, args, out, err)
+	return out, err
+}
+
+// stream keeps the first recordLimit bytes of the command's output
+func (r *recorder) stream(cmd string, args ...string) (io.ReadCloser, error) {
+	rc, err := r.s(cmd, args...)
 	if err != nil {
-		return "", err
+		r.record(cmd, args, "", err)
+		return nil, err
 	}
-	stdout, err := c.StdoutPipe()
+	head := &limitedBuffer{limit: recordLimit}
+	return streamHook{io.TeeReader(rc, head), rc, func(err error) {
+		out := head.String()
+		if head.truncated {
+			out += "\n[output truncated]\n"
+		}
+		r.record(cmd, args, out, err)
+	}}, nil
+}
+
+func (r *recorder) record(cmd string, args []string, out string, err error) {
 	if err != nil {
-		return "", err
+		out += err.Error()
 	}
-	if err := c.Start(); err != nil {
-		return "", err
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.output = append(r.output, fmt.Sprintf("$ %s %s\n%s", cmd, strings.Join(args, " "), out))
+}
+
+func (r *recorder) String() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return strings.Join(r.output, "\n")
+}
+
+// commandEnv pins the locale and time zone of every command we run, so output is always in English with timestamps in UTC
+var commandEnv = []string{"LC_ALL=C", "LANG=C", "TZ=UTC"}
+
+// parseCommandTime reads a ctime style timestamp (eg Sun Mar 31 18:36:05 2024) from command output, returning it in local time
+func parseCommandTime(s string) (time.Time, error) {
+	t, err := time.ParseInLocation("Mon Jan _2 15:04:05 2006", s, time.UTC)
+	return t.Local(), err
+}
+
+// commandError is returned by execute when a command exits with a non-zero status. Checks can inspect it to decide what the exit status and stderr mean for that tool.
+type commandError struct {
+	cmd      string
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+func (e *commandError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("%s exited with status %d", e.cmd, e.exitCode)
 	}
+	return fmt.Sprintf("%s exited with status %d: %s", e.cmd, e.exitCode, strings.TrimSpace(e.stderr))
+}
 
-	errMsg, err := ioutil.ReadAll(stderr)
-	if err != nil {
-		log.Println("Unable to read command error output: ", err)
-		return "", err
+func (e *commandError) ExitCode() int {
+	return e.exitCode
+}
+
+// wrapCommand rewrites a command to run where the checks are aimed: on remote over ssh, or on the container's host with hostMode.
+// The sudo helper is this machine's, so with helper set it's only used for local commands, and remote ones run as the ssh user.
+func wrapCommand(cmd string, args []string, helper bool, remote string) (string, []string) {
+	if remote != "" {
+		return sshCommand(remote, cmd, args)
 	}
-	if len(errMsg) > 0 {
-		return "", errors.New(fmt.Sprintf("Command %s wrote the following to stderr: %s\n", cmd, string(errMsg)))
+	if helper {
+		cmd, args = sudoCommand(cmd, args)
 	}
+	if hostMode != "" {
+		cmd, args = hostCommand(hostMode, hostRoot, cmd, args)
+	}
+	return cmd, args
+}
 
-	out, err := ioutil.ReadAll(stdout)
-	if err != nil {
-		log.Println("Unable to read command output: ", err)
+// execute runs a command, returning its stdout. stdout is returned even if the command fails, since some tools (eg smartctl) report through their exit status.
+func execute(cmd string, args ...string) (string, error) {
+	if err := checkReadOnly(cmd, args); err != nil {
 		return "", err
 	}
+	cmd, args = wrapCommand(cmd, args, sudoHelper, remoteHost)
+	c := exec.Command(cmd, args...)
+	c.Env = append(os.Environ(), commandEnv...)
+	var stdout, stderr bytes.Buffer
+	c.Stdout = &stdout
+	c.Stderr = &stderr
 
-	if err := c.Wait(); err != nil {
+	start := time.Now()
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = &commandError{cmd: cmd, stdout: stdout.String(), stderr: stderr.String(), exitCode: exitErr.ExitCode()}
+		audit(cmd, args, start, err)
+		return stdout.String(), err
+	}
+	audit(cmd, args, start, err)
+	if err != nil {
 		return "", err
 	}
 
-	return string(out), nil
+	// plenty of healthy tools write warnings to stderr
+	if stderr.Len() > 0 {
+		log.Printf("%s %s wrote to stderr: %s", cmd, strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
 }
 
-func notify(app notifier, title, msg string) *pushover.Response {
-	var cfg struct {
-		LastUpdated time.Time
+func notify(app notifier, n notification) *pushover.Response {
+	resp, _ := deliver(app, n)
+	return resp
+}
+
+// deliver is notify, also reporting whether n went out to any notifier. Only an alert about a run's findings starts the 23 hour mute.
+func deliver(app notifier, n notification) (resp *pushover.Response, sent bool) {
+	if instanceName != "" {
+		n.title = instanceName + ": " + n.title
+	}
+	// without the state, send anyway, but don't save over it with an empty one
+	s, err := loadState()
+	loaded := err == nil
+	if !loaded {
+		log.Println("error opening state file for read: " + err.Error())
+	} else if rateLimited(s, time.Now(), n.severity) {
+		return nil, false
 	}
 
-	filepath := "/mnt/primarySafe/apps/heartbeat/heartbeat.json"
-	f, err := os.OpenFile(filepath, os.O_RDONLY|os.O_CREATE, 0o777)
-	data, err := io.ReadAll(f)
-	f.Close()
-	if err != nil {
-		log.Println("error opening config file for read: " + err.Error())
-	} else if data != nil {
-		_ = json.Unmarshal(data, &cfg)
-		// limit error messages to every 23 hours at most
-		if cfg.LastUpdated.Add(time.Hour * 23).After(time.Now()) {
-			return nil
+	now := time.Now()
+	if len(n.findings) > 0 {
+		s.LastUpdated, s.LastSeverity = now, n.severity
+	}
+	global := globalBucket(&s, now)
+	withinGlobal := global.Tokens >= 1
+	var outgoing []backendNotification
+	var keys []string
+	for _, b := range enabledBackends() {
+		keys = append(keys, limitKey(b))
+		if limited, ok := limitNotification(&s, b, withinGlobal, n, now); ok {
+			outgoing = append(outgoing, backendNotification{b, limited})
 		}
 	}
-
-	cfg.LastUpdated = time.Now()
-	data, _ = json.Marshal(cfg)
-	f, err = os.OpenFile(filepath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0o777)
-	if err != nil {
-		log.Println("error opening config file for write: " + err.Error())
+	var send bool
+	if pushoverEnabled {
+		primary := pushoverBackend{token: token, user: user}
+		keys = append(keys, limitKey(primary))
+		n, send = limitNotification(&s, primary, withinGlobal, n, now)
 	}
-	if _, err := f.Write(data); err != nil {
-		log.Println("error writing to file: " + err.Error())
+	if len(outgoing) > 0 || send {
+		global.Tokens--
 	}
-	if err := f.Close(); err != nil {
-		log.Println("error closing write file: " + err.Error())
+	pruneLimits(&s, keys)
+	if loaded {
+		saveState(s)
+	}
+
+	sent = sendBackends(outgoing) > 0
+	if !send {
+		return nil, sent
 	}
 
 	recipient := pushover.NewRecipient(user)
 
-	message := pushover.NewMessage(msg)
-	message.Title = title
-	resp, err := app.SendMessage(message, recipient)
+	text, dropped := fitMessage(n.message, pushover.MessageMaxLength)
+	message := pushoverMessage(text, pushoverFormat)
+	message.Title = n.title
+	if n.severity == severityCritical && smsEscalationEnabled() {
+		// emergency priority repeats until acknowledged, and gives us a receipt to check for acknowledgement
+		message.Priority = pushover.PriorityEmergency
+		message.Retry = 5 * time.Minute
+		message.Expire = 3 * time.Hour
+	}
+	resp, err = app.SendMessage(message, recipient)
 	if err != nil {
 		log.Println(err)
-		return nil
+		return nil, sent
 	}
+	trackEscalation(n, resp)
 
-	return resp
+	if pushoverContinuation {
+		chunks := chunkLines(dropped, pushover.MessageMaxLength)
+		for i, chunk := range chunks {
+			continued := pushoverMessage(chunk, pushoverFormat)
+			continued.Title = fmt.Sprintf("%s (%d/%d)", n.title, i+2, len(chunks)+1)
+			if _, err := app.SendMessage(continued, recipient); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	return resp, true
 }
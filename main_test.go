@@ -4,14 +4,23 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/gregdel/pushover"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// command timestamps are parsed as UTC and shown in local time, so pin local time for the expected dates in messages
+func TestMain(m *testing.M) {
+	time.Local = time.UTC
+	os.Exit(m.Run())
+}
+
 var output = make(map[string][]string)
 var counters = make(map[string]int)
 var mutex sync.Mutex
@@ -49,10 +58,10 @@ func Test_checkPoolStatus(t *testing.T) {
 		err  string
 	}{
 		{"testFiles/zpoolSample.txt", ""},
-		{"testFiles/zpoolSample2.txt", "pool primarySafe - ONLINE (0|0|0): errors: No known data errors\nvdev raidz2-0 - ONLINE (0|0|0)\ndisk e43d41b6-adcc-11e5-b06a-d43d7ef79ff0 - OFFLINE (0|0|0): "},
-		{"testFiles/zpoolSample3.txt", "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors\nvdev raidz2-0 - DEGRADED (0|0|0)\ndisk 14803813886136010794 - UNAVAIL (0|0|0): was /dev/gptid/4167d912-9102-11e2-a05e-b8975a0e7ea3"}, // actual output from a disconnected disk
+		{"testFiles/zpoolSample2.txt", "pool primarySafe is ONLINE\ndisk e43d41b6-adcc-11e5-b06a-d43d7ef79ff0 is OFFLINE"},
+		{"testFiles/zpoolSample3.txt", "pool primarySafe is DEGRADED\nvdev raidz2-0 is DEGRADED: can lose 1 more disk\ndisk 14803813886136010794 is UNAVAIL: was /dev/gptid/4167d912-9102-11e2-a05e-b8975a0e7ea3"}, // actual output from a disconnected disk
 		{"testFiles/zpoolSample4.txt", ""},
-		{"testFiles/zpoolSample5.txt", "pool primarySafe - ONLINE (0|0|0): errors: No known data errors\nvdev spares -  (0|0|0)\ndisk f9aeb0c4-a208-4118-a5e3-0d01bfb36743 - UNAVAIL: "},
+		{"testFiles/zpoolSample5.txt", "pool primarySafe is ONLINE\nspare f9aeb0c4-a208-4118-a5e3-0d01bfb36743 is UNAVAIL"},
 		{"testFiles/scrubSample.txt", ""},
 	}
 
@@ -60,10 +69,10 @@ func Test_checkPoolStatus(t *testing.T) {
 		t.Run(tt.file, func(t *testing.T) {
 			data, err := ioutil.ReadFile(tt.file)
 			require.NoError(t, err)
-			output["/sbin/zpool"] = []string{string(data)}
+			output["/sbin/zpool"] = []string{"zfs-2.2.3-1\nzfs-kmod-2.2.3-1\n", string(data)}
 			counters["/sbin/zpool"] = 0
 
-			err = checkPoolStatus(MockExecuter)
+			_, err = checkPoolStatus(MockExecuter, bufferedStream(MockExecuter), nil)
 			if tt.err == "" {
 				assert.NoError(t, err, "Test %d:", i)
 			} else {
@@ -73,6 +82,31 @@ func Test_checkPoolStatus(t *testing.T) {
 	}
 }
 
+func Test_checkPoolStatusUpgradable(t *testing.T) {
+	t.Parallel()
+
+	status, err := ioutil.ReadFile("testFiles/zpoolUpgradable.txt")
+	require.NoError(t, err)
+	upgrade, err := ioutil.ReadFile("testFiles/zpoolUpgrade.txt")
+	require.NoError(t, err)
+	e := func(cmd string, args ...string) (string, error) {
+		if args[0] == "upgrade" {
+			return string(upgrade), nil
+		}
+		return string(status), nil
+	}
+
+	pools, err := checkPoolStatus(e, bufferedStream(e), nil)
+	require.NoError(t, err)
+	assert.True(t, pools[0].Upgradable())
+	assert.Equal(t, []string{"zilsaxattr", "head_errlog", "blake3"}, pools[0].features)
+	assert.False(t, pools[1].Upgradable())
+	assert.Empty(t, pools[1].features)
+
+	r := newHeartbeatReport(pools, map[string]space{"boot-pool": {avail: 17179869184}, "primarySafe": {avail: 17716740096}}, 0, 0, nil, nil)
+	assert.Equal(t, "boot-pool: 16.00 GiB free, last scrub Mar 31\n  new features available: zilsaxattr, head_errlog, blake3 (zpool upgrade)\nprimarySafe: 16.50 GiB free, last scrub Mar 10\n", r.String())
+}
+
 func Test_checkSmartStatus(t *testing.T) {
 	t.Parallel()
 
@@ -81,20 +115,22 @@ func Test_checkSmartStatus(t *testing.T) {
 		err  string
 	}{
 		{"testFiles/smartSample.txt", ""},
-		{"testFiles/smartSample2.txt", ""},
-		{"testFiles/smartSample3.txt", "smart error: disk sde: foobarted without error"},
+		{"testFiles/smartSample2.txt", ""},                                               // 1 in 21 tests
+		{"testFiles/smartSample3.txt", "smart error: disk sda: foobarted without error"}, // 2 in 21 tests, recent enough to still count for most of that
+		{"testFiles/smartOldFailures.txt", ""},                                           // 2 in 21 tests, but 15000 hours before the rest
 	}
 
 	for i, tt := range tests {
 		data, err := ioutil.ReadFile(tt.file)
 		require.NoError(t, err)
-		for range 8 {
-			output["/sbin/smartctl"] = append(output["/sbin/smartctl"], string(data))
+		e := func(cmd string, args ...string) (string, error) {
+			return string(data), nil
 		}
 
-		err, oldest, youngest := checkSmartStatus(MockExecuter)
+		err, selfTests := checkSmartStatus(e, []string{"sda"})
 		if tt.err == "" {
 			assert.NoError(t, err, "Test %d:", i)
+			oldest, youngest := ageRange(selfTests)
 			assert.NotZero(t, oldest)
 			assert.NotZero(t, youngest)
 		} else {
@@ -103,14 +139,94 @@ func Test_checkSmartStatus(t *testing.T) {
 	}
 }
 
+// exitStatus is a command exiting with a non-zero status
+type exitStatus int
+
+func (e exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func (e exitStatus) ExitCode() int {
+	return int(e)
+}
+
+func Test_checkSmartStatusExitStatus(t *testing.T) {
+	t.Parallel()
+
+	data, err := ioutil.ReadFile("testFiles/smartSample.txt")
+	require.NoError(t, err)
+	bits := map[string]int{"/dev/sdb": smartctlDiskFailing, "/dev/sdc": smartctlPrefailThreshold, "/dev/sdd": smartctlErrorLog, "/dev/sde": smartctlOpenFailed}
+	e := func(cmd string, args ...string) (string, error) {
+		if b, ok := bits[args[len(args)-1]]; ok {
+			return string(data), exitStatus(b)
+		}
+		return string(data), nil
+	}
+
+	err, _ = checkSmartStatus(e, smartDisks)
+	var d digest
+	d.addError("smart selftest", severityWarning, err, "")
+	assert.Equal(t, "[critical] smart error: disk sdb: SMART overall health check failed\n[warning] smart error: disk sdc: prefailure attributes at or below threshold\n[warning] smart selftest could not run: disk sde: exit status 2", d.String())
+}
+
+func Test_checkSmartStatusExtendedLog(t *testing.T) {
+	t.Parallel()
+
+	data, err := ioutil.ReadFile("testFiles/smartXselftest.txt")
+	require.NoError(t, err)
+	var args []string
+	e := func(cmd string, a ...string) (string, error) {
+		args = a
+		return string(data), nil
+	}
+
+	// test 27 is past the 21 entries of the standard log, and 1 failure in 30 tests is under smartThreshold
+	err, selfTests := checkSmartStatus(e, []string{"sda"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"sda": 40120}, selfTests)
+	assert.Equal(t, []string{"-H", "-l", "xselftest,selftest", "-A", "/dev/sda"}, args)
+}
+
+func Test_checkSmartStatusWrappedHours(t *testing.T) {
+	t.Parallel()
+
+	data, err := ioutil.ReadFile("testFiles/smartSample.txt")
+	require.NoError(t, err)
+	// a drive 9.7 years old, whose self-test log has wrapped around to 19398 hours
+	attrs := "\nID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE\n  9 Power_On_Hours          0x0032   001   001   000    Old_age   Always       -       85034\n"
+	e := func(cmd string, args ...string) (string, error) {
+		if args[len(args)-1] == "/dev/sda" {
+			return string(data) + attrs, nil
+		}
+		return string(data), nil
+	}
+
+	err, selfTests := checkSmartStatus(e, []string{"sda", "sdb"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"sda": 84934, "sdb": 19398}, selfTests)
+	oldest, youngest := ageRange(selfTests)
+	assert.Equal(t, 84934, oldest)
+	assert.Equal(t, 19398, youngest)
+}
+
+func Test_unwrapHours(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 19398, unwrapHours(19398, 0), "no power on hours to go by")
+	assert.Equal(t, 19398, unwrapHours(19398, 19500))
+	assert.Equal(t, 84934, unwrapHours(19398, 85034))
+	assert.Equal(t, 65530, unwrapHours(65530, 65540), "the test ran just before the log wrapped")
+	assert.Equal(t, 150470, unwrapHours(19398, 150500))
+}
+
 func Test_diskUsage(t *testing.T) {
 	t.Parallel()
 
 	tests := []struct {
 		file     string
-		expected map[string]string
+		expected map[string]space
 	}{
-		{"testFiles/zfsList.txt", map[string]string{"boot-pool": "16.0G", "primarySafe": "16.5G"}},
+		{"testFiles/zfsList.txt", map[string]space{"boot-pool": {used: 487424, avail: 17179869184}, "primarySafe": {used: 487424, avail: 17716740096}}},
 	}
 
 	for _, tt := range tests {
@@ -118,8 +234,136 @@ func Test_diskUsage(t *testing.T) {
 		require.NoError(t, err)
 		output["zfs"] = []string{string(data)}
 
-		freeSpace, err := diskUsage(&MockNotify{}, MockExecuter)
+		freeSpace, err := diskUsage(MockExecuter)
 		require.NoError(t, err)
 		assert.Equal(t, tt.expected, freeSpace)
 	}
 }
+
+func Test_diskUsageMissingPool(t *testing.T) {
+	t.Parallel()
+
+	data, err := ioutil.ReadFile("testFiles/zfsList.txt")
+	require.NoError(t, err)
+	e := func(cmd string, args ...string) (string, error) {
+		return strings.ReplaceAll(string(data), "boot-pool", "other-pool"), nil
+	}
+
+	freeSpace, err := diskUsage(e)
+	assert.Equal(t, map[string]space{"primarySafe": {used: 487424, avail: 17716740096}}, freeSpace)
+	assert.EqualError(t, err, "pool boot-pool not found in zfs list")
+	assert.ErrorAs(t, err, new(checkError))
+}
+
+func Test_execute(t *testing.T) {
+	t.Parallel()
+
+	out, err := execute("sh", "-c", "echo out; echo warning >&2")
+	require.NoError(t, err, "stderr alone isn't a failure")
+	assert.Equal(t, "out\n", out)
+
+	out, err = execute("sh", "-c", "echo out; echo broken >&2; exit 3")
+	assert.Equal(t, "out\n", out)
+	var ce *commandError
+	require.ErrorAs(t, err, &ce)
+	assert.Equal(t, 3, ce.exitCode)
+	assert.Equal(t, "broken\n", ce.stderr)
+	assert.EqualError(t, err, "sh exited with status 3: broken")
+
+	bits, exited := smartctlExit(err)
+	assert.True(t, exited)
+	assert.Equal(t, 3, bits)
+
+	out, err = execute("sh", "-c", "echo $LC_ALL $TZ")
+	require.NoError(t, err)
+	assert.Equal(t, "C UTC\n", out)
+}
+
+func Test_recorder(t *testing.T) {
+	t.Parallel()
+
+	rec := &recorder{e: func(cmd string, args ...string) (string, error) {
+		if cmd == "false" {
+			return "", errors.New("exit status 1")
+		}
+		return "ok\n", nil
+	}}
+	_, err := rec.execute("/sbin/zpool", "status")
+	require.NoError(t, err)
+	_, err = rec.execute("false")
+	require.Error(t, err)
+
+	assert.Equal(t, "$ /sbin/zpool status\nok\n\n$ false \nexit status 1", rec.String())
+}
+
+func Test_checkMinFree(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, checkMinFree("primarySafe/home", 17716740096, "10G"))
+	assert.EqualError(t, checkMinFree("primarySafe/home", 17716740096, "1T"), "dataset primarySafe/home has 16.50 GiB available, less than 1.00 TiB")
+	assert.ErrorAs(t, checkMinFree("primarySafe/home", 17716740096, "lots"), new(checkError))
+}
+
+func BenchmarkCheckSmartStatus(b *testing.B) {
+	data, err := ioutil.ReadFile("testFiles/smartXselftest.txt")
+	require.NoError(b, err)
+	e := func(cmd string, args ...string) (string, error) {
+		return string(data), nil
+	}
+	disks := make([]string, 24)
+	for i := range disks {
+		disks[i] = fmt.Sprintf("sd%c", 'a'+i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		checkSmartStatus(e, disks)
+	}
+}
+
+func Test_deliverMute(t *testing.T) {
+	oldState, oldMirror := statePath, stateMirrorPath
+	defer func() { statePath, stateMirrorPath = oldState, oldMirror }()
+	statePath, stateMirrorPath = t.TempDir()+"/heartbeat.json", ""
+	app := &MockNotify{}
+
+	_, sent := deliver(app, notification{title: "Disk replaced", message: "sdb in primarySafe was replaced by sdg", severity: severityInfo})
+	assert.True(t, sent)
+	s, err := loadState()
+	require.NoError(t, err)
+	assert.True(t, s.LastUpdated.IsZero(), "a notice doesn't mute the run's alerts")
+
+	alerted := notification{title: "Health check warnings", message: "[warning] pool scratch is 91% full", severity: severityWarning, findings: []finding{{check: "disk usage", severity: severityWarning, message: "pool scratch is 91% full"}}}
+	_, sent = deliver(app, alerted)
+	assert.True(t, sent)
+	_, sent = deliver(app, alerted)
+	assert.False(t, sent, "muted for 23 hours")
+
+	alerted.severity = severityCritical
+	_, sent = deliver(app, alerted)
+	assert.True(t, sent, "a critical alert isn't muted by a warning")
+}
+
+func Test_deliverState(t *testing.T) {
+	oldState, oldMirror := statePath, stateMirrorPath
+	defer func() { statePath, stateMirrorPath = oldState, oldMirror }()
+	statePath, stateMirrorPath = t.TempDir()+"/heartbeat.json", ""
+	app := &MockNotify{}
+	n := notification{title: "Health check warnings", message: "[warning] pool scratch is 91% full", severity: severityWarning}
+
+	// one notification spends one global token
+	_, sent := deliver(app, n)
+	require.True(t, sent)
+	s, err := loadState()
+	require.NoError(t, err)
+	assert.InDelta(t, notifyMaxPerHour-1, s.Limits[""].Tokens, 0.01)
+
+	// an unreadable state file still gets the alert out, but isn't saved over
+	require.NoError(t, os.WriteFile(statePath, []byte("{not json"), 0o600))
+	_, sent = deliver(app, n)
+	assert.True(t, sent)
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "{not json", string(data))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// matrix sends notifications to a room using the client-server API
+type matrix struct {
+	homeserver string
+	token      string
+	room       string
+}
+
+func (m matrix) name() string {
+	return "matrix"
+}
+
+func (m matrix) send(n notification) error {
+	txn := fmt.Sprintf("zfsheartbeat-%d", time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s", strings.TrimSuffix(m.homeserver, "/"), url.PathEscape(m.room), txn)
+	_, err := requestJSON(http.MethodPut, endpoint, map[string]string{
+		"msgtype":        "m.text",
+		"body":           n.title + "\n" + n.message,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": matrixHTML(n),
+	}, map[string]string{"Authorization": "Bearer " + m.token})
+	return err
+}
+
+func matrixHTML(n notification) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<h4>%s</h4>", html.EscapeString(n.title))
+	if len(n.findings) == 0 {
+		fmt.Fprintf(&b, "<pre><code>%s</code></pre>", html.EscapeString(n.message))
+	}
+	for _, f := range n.findings {
+		fmt.Fprintf(&b, "<p><b>%s</b> (%s)</p><pre><code>%s</code></pre>", html.EscapeString(f.label()), f.severity, html.EscapeString(f.message))
+	}
+	return b.String()
+}
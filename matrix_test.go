@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_matrixHTML(t *testing.T) {
+	t.Parallel()
+
+	var d digest
+	d.add("pool status", severityCritical, "pool primarySafe - DEGRADED (0|0|0): errors: <1 known data error>", "")
+	assert.Equal(t, "<h4>Health check failed!</h4><p><b>pool status</b> (critical)</p><pre><code>pool primarySafe - DEGRADED (0|0|0): errors: &lt;1 known data error&gt;</code></pre>",
+		matrixHTML(notification{title: "Health check failed!", message: d.String(), severity: d.severity(), findings: d.findings}))
+
+	assert.Equal(t, "<h4>Heartbeat</h4><pre><code>Disk age: 1.03-6.96 years</code></pre>", matrixHTML(notification{title: "Heartbeat", message: "Disk age: 1.03-6.96 years"}))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// deviceState is the state zpool status reports for a pool, vdev, or disk
+type deviceState string
+
+const (
+	stateOnline    deviceState = "ONLINE"
+	stateDegraded  deviceState = "DEGRADED"
+	stateFaulted   deviceState = "FAULTED"
+	stateOffline   deviceState = "OFFLINE"
+	stateUnavail   deviceState = "UNAVAIL"
+	stateRemoved   deviceState = "REMOVED"
+	stateSuspended deviceState = "SUSPENDED"
+	stateAvail     deviceState = "AVAIL" // a spare ready for use
+	stateInUse     deviceState = "INUSE" // a spare standing in for a disk
+)
+
+// kind is what sort of vdev v is: mirror, raidz, draid, spares, or disk
+func (v vdev) kind() string {
+	switch {
+	case v.typev == vdevTypeSpare:
+		return "spares"
+	case v.typev == vdevTypeDisk:
+		return "disk"
+	case strings.HasPrefix(v.name, "mirror"):
+		return "mirror"
+	case strings.HasPrefix(v.name, "draid"):
+		return "draid"
+	default:
+		return "raidz"
+	}
+}
+
+// Walk calls fn for every disk in p, stopping early if fn returns false
+func (p pool) Walk(fn func(v vdev, d vdevDisk) bool) {
+	for _, v := range p.vdevs {
+		for _, d := range v.disks {
+			if !fn(v, d) {
+				return
+			}
+		}
+	}
+}
+
+// FindDisk returns the disk in p named name
+func (p pool) FindDisk(name string) (disk vdevDisk, found bool) {
+	p.Walk(func(v vdev, d vdevDisk) bool {
+		if d.name == name {
+			disk, found = d, true
+		}
+		return !found
+	})
+	return disk, found
+}
+
+// HealthSummary describes p's health in a line, eg "DEGRADED: disk sdb is FAULTED: too many errors". The pool and vdev states that follow from a disk's are left out
+func (p pool) HealthSummary() string {
+	ev := p.Evaluate()
+	if ev.Healthy() {
+		var disks int
+		p.Walk(func(vdev, vdevDisk) bool {
+			disks++
+			return true
+		})
+		return fmt.Sprintf("%s, %d disks healthy", p.state, disks)
+	}
+
+	var problems []string
+	for _, r := range ev.Reasons {
+		if r.Kind != reasonState || r.Device != "pool" && r.Device != "vdev" {
+			problems = append(problems, r.String())
+		}
+	}
+	if len(problems) == 0 {
+		problems = []string{ev.Reasons[0].String()}
+	}
+	return fmt.Sprintf("%s: %s", p.state, strings.Join(problems, ", "))
+}
+
+// eachPool calls fn for every pool, up to poolParallelism at once, joining their errors in the order of pools.
+// A panic in fn is returned as an error, since it can't be recovered outside the goroutine it happened in.
+func eachPool(pools []pool, fn func(i int, p pool) error) error {
+	errs := make([]error, len(pools))
+	limit := make(chan struct{}, max(poolParallelism, 1))
+	var wg sync.WaitGroup
+	for i, p := range pools {
+		wg.Add(1)
+		limit <- struct{}{}
+		go func() {
+			defer wg.Done()
+			errs[i] = safely("pool "+p.name, func() error { return fn(i, p) })
+			<-limit
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_poolModel(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolMirrorDegraded.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+	p := pools[0]
+
+	var names []string
+	p.Walk(func(v vdev, d vdevDisk) bool {
+		names = append(names, v.name+"/"+d.name)
+		return d.name != "sdc"
+	})
+	assert.Equal(t, []string{"mirror-0/sda", "mirror-0/sdb", "mirror-1/sdc"}, names)
+
+	d, ok := p.FindDisk("sdb")
+	require.True(t, ok)
+	assert.Equal(t, stateFaulted, d.state)
+	d, ok = p.FindDisk("sdz")
+	assert.False(t, ok)
+	assert.Equal(t, vdevDisk{}, d)
+
+	assert.Equal(t, "DEGRADED: disk sdb is FAULTED: too many errors, disk sdb has 12 read, 1228 write errors", p.HealthSummary())
+
+	data, err = os.ReadFile("testFiles/zpoolSample4.txt")
+	require.NoError(t, err)
+	healthy, err := parsePools(string(data))
+	require.NoError(t, err)
+	assert.Equal(t, "ONLINE, 8 disks healthy", healthy[1].HealthSummary())
+
+	st := newRunStatus(time.Now(), 0, nil, pools, nil, nil)
+	out, err := json.Marshal(st.Pools[0].Vdevs[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"mirror-0","kind":"mirror","state":"DEGRADED","healthy":false,"read_errors":0,"write_errors":0,"checksum_errors":0,"disks":[
+		{"name":"sda","state":"ONLINE","healthy":true,"read_errors":0,"write_errors":0,"checksum_errors":0},
+		{"name":"sdb","state":"FAULTED","healthy":false,"read_errors":12,"write_errors":1228,"checksum_errors":0,"message":"too many errors"}]}`, string(out))
+}
+
+func Test_eachPool(t *testing.T) {
+	t.Parallel()
+
+	pools := make([]pool, 12)
+	for i := range pools {
+		pools[i].name = fmt.Sprintf("vm-%d", i)
+	}
+
+	var running, most atomic.Int32
+	err := eachPool(pools, func(i int, p pool) error {
+		n := running.Add(1)
+		for {
+			m := most.Load()
+			if n <= m || most.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Duration(len(pools)-i) * time.Millisecond)
+		running.Add(-1)
+		if i%5 == 0 {
+			return fmt.Errorf("pool %s failed", p.name)
+		}
+		return nil
+	})
+
+	assert.EqualError(t, err, "pool vm-0 failed\npool vm-5 failed\npool vm-10 failed", "errors are in pool order, however long each took")
+	assert.LessOrEqual(t, most.Load(), int32(poolParallelism))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const netClassPath = "/sys/class/net"
+const bondingPath = "/proc/net/bonding"
+
+// the interface statistics that count errors rather than traffic
+var netCounters = []string{"rx_errors", "tx_errors", "rx_crc_errors"}
+
+// readInterface checks that an interface under root is up and reads its error counters, keyed by interface/counter
+func readInterface(root, name string) (map[string]uint64, error) {
+	operstate, err := os.ReadFile(filepath.Join(root, name, "operstate"))
+	if err != nil {
+		return nil, checkError{err}
+	}
+	if state := strings.TrimSpace(string(operstate)); state != "up" {
+		return nil, fmt.Errorf("interface %s is %s", name, state)
+	}
+
+	counts := make(map[string]uint64)
+	for _, counter := range netCounters {
+		data, err := os.ReadFile(filepath.Join(root, name, "statistics", counter))
+		if err != nil {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil {
+			return nil, checkError{fmt.Errorf("%s %s: %w", name, counter, err)}
+		}
+		counts[name+"/"+counter] = n
+	}
+	return counts, nil
+}
+
+// checkBond finds the links of a bond, as described by /proc/net/bonding, that are down or left out of the active LACP aggregator
+func checkBond(name, status string) error {
+	var errs []error
+	var lacp, inActiveAggregator, slaveDown bool
+	var activeAggregator, slave string
+	for _, line := range strings.Split(status, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), ": ")
+		switch {
+		case key == "Bonding Mode":
+			lacp = strings.Contains(value, "802.3ad")
+		case key == "Active Aggregator Info:":
+			inActiveAggregator = true
+		case key == "Aggregator ID" && inActiveAggregator:
+			activeAggregator = value
+		case key == "Slave Interface":
+			inActiveAggregator = false
+			slave, slaveDown = value, false
+		case key == "MII Status" && slave == "":
+			if value != "up" {
+				return fmt.Errorf("bond %s is %s", name, value)
+			}
+		case key == "MII Status" && value != "up":
+			errs = append(errs, fmt.Errorf("bond %s: link %s is %s", name, slave, value))
+			slaveDown = true
+		case key == "Aggregator ID" && lacp && !slaveDown && value != activeAggregator:
+			errs = append(errs, fmt.Errorf("bond %s: link %s is up but not in the active LACP aggregator", name, slave))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkNetErrors warns about every interface error counter that has grown since the last run, recording the counts in s
+func checkNetErrors(s *state, counts map[string]uint64) error {
+	var errs []error
+	for _, key := range grownCounters(s.NetErrors, counts) {
+		iface, counter, _ := strings.Cut(key, "/")
+		errs = append(errs, fmt.Errorf("interface %s: %s rose from %d to %d", iface, counter, s.NetErrors[key], counts[key]))
+	}
+	s.NetErrors = counts
+
+	return errors.Join(errs...)
+}
+
+// trackNetwork checks every interface in netInterfaces, running checkNetErrors against the state file
+func trackNetwork() error {
+	var errs []error
+	counts := make(map[string]uint64)
+	for _, name := range netInterfaces {
+		c, err := readInterface(netClassPath, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for key, n := range c {
+			counts[key] = n
+		}
+
+		status, err := os.ReadFile(filepath.Join(bondingPath, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			errs = append(errs, checkError{err})
+			continue
+		}
+		errs = append(errs, checkBond(name, string(status)))
+	}
+
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	errs = append(errs, checkNetErrors(&s, counts))
+	saveState(s)
+	return errors.Join(errs...)
+}
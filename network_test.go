@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readInterface(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	for name, state := range map[string]string{"enp1s0f0": "up", "enp2s0": "down"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, name, "statistics"), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name, "operstate"), []byte(state+"\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name, "statistics", "rx_errors"), []byte("12\n"), 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, name, "statistics", "tx_errors"), []byte("0\n"), 0o644))
+	}
+
+	counts, err := readInterface(root, "enp1s0f0")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"enp1s0f0/rx_errors": 12, "enp1s0f0/tx_errors": 0}, counts)
+
+	_, err = readInterface(root, "enp2s0")
+	assert.EqualError(t, err, "interface enp2s0 is down")
+
+	_, err = readInterface(root, "eth9")
+	assert.ErrorAs(t, err, new(checkError))
+}
+
+func Test_checkBond(t *testing.T) {
+	t.Parallel()
+
+	status, err := os.ReadFile("testFiles/bond0.txt")
+	require.NoError(t, err)
+
+	err = checkBond("bond0", string(status))
+	require.Error(t, err)
+	errs := unjoin(err)
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "bond bond0: link enp1s0f1 is up but not in the active LACP aggregator")
+	assert.EqualError(t, errs[1], "bond bond0: link enp2s0 is down")
+
+	healthy := "Bonding Mode: fault-tolerance (active-backup)\nMII Status: up\n\nSlave Interface: eth0\nMII Status: up\n\nSlave Interface: eth1\nMII Status: up\n"
+	assert.NoError(t, checkBond("bond1", healthy))
+	assert.EqualError(t, checkBond("bond1", "Bonding Mode: fault-tolerance (active-backup)\nMII Status: down\n"), "bond bond1 is down")
+}
+
+func Test_checkNetErrors(t *testing.T) {
+	t.Parallel()
+
+	var s state
+	require.NoError(t, checkNetErrors(&s, map[string]uint64{"bond0/rx_errors": 12}))
+	assert.EqualError(t, checkNetErrors(&s, map[string]uint64{"bond0/rx_errors": 40}), "interface bond0: rx_errors rose from 12 to 40")
+	assert.NoError(t, checkNetErrors(&s, map[string]uint64{"bond0/rx_errors": 40}))
+}
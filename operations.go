@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operation is a long running change to a pool's layout: a device removal or a raidz expansion
+type operation struct {
+	pool     string
+	kind     string // "removal" or "expansion"
+	target   string // device or vdev being removed or expanded
+	running  bool
+	canceled bool
+	progress float64 // percent done
+	status   string  // first line of the status, eg "Evacuation of mirror-1 in progress since ..."
+	eta      string  // time remaining, if zfs reports it
+}
+
+func (o operation) String() string {
+	switch {
+	case o.running && o.eta != "":
+		return fmt.Sprintf("%s of %s %.2f%% done, %s to go", o.kind, o.target, o.progress, o.eta)
+	case o.running:
+		return fmt.Sprintf("%s of %s %.2f%% done", o.kind, o.target, o.progress)
+	default:
+		return o.status
+	}
+}
+
+var progressRe = regexp.MustCompile(`([\d.]+)% done(?:, (\S+) to go)?`)
+var removalTargetRe = regexp.MustCompile(`^(?:Evacuation|Removal) of (\S+)`)
+var expansionTargetRe = regexp.MustCompile(`^(?:expansion of|expanded) (\S+)`)
+
+// Operations lists the removal and expansion reported for p, if any
+func (p pool) Operations() []operation {
+	var ops []operation
+	if p.removal != "" {
+		ops = append(ops, parseOperation(p.name, "removal", p.removal, removalTargetRe))
+	}
+	if p.expansion != "" {
+		ops = append(ops, parseOperation(p.name, "expansion", p.expansion, expansionTargetRe))
+	}
+	return ops
+}
+
+func parseOperation(poolName, kind, text string, targetRe *regexp.Regexp) operation {
+	o := operation{pool: poolName, kind: kind}
+	o.status, _, _ = strings.Cut(text, "\n")
+	o.running = strings.Contains(o.status, "in progress")
+	o.canceled = strings.Contains(o.status, "canceled")
+	if matches := targetRe.FindStringSubmatch(o.status); matches != nil {
+		o.target = matches[1]
+	}
+	if matches := progressRe.FindStringSubmatch(text); matches != nil {
+		o.progress, _ = strconv.ParseFloat(matches[1], 64)
+		o.eta = matches[2]
+	}
+	return o
+}
+
+// checkCheckpoints warns about checkpoints older than checkpointMaxAge
+func checkCheckpoints(pools []pool, now time.Time) error {
+	var errs []error
+	for _, p := range pools {
+		created, size, ok := p.Checkpoint()
+		if ok && now.Sub(created) > checkpointMaxAge {
+			errs = append(errs, fmt.Errorf("pool %s has had a checkpoint since %s (%d days), consuming %s", p.name, created.Format("Jan 2"), int(now.Sub(created).Hours()/24), formatBytes(size)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// operationProgress is the last change in progress seen for an operation
+type operationProgress struct {
+	Progress float64
+	Since    time.Time
+	Canceled bool
+}
+
+// checkOperations warns when a removal or expansion stops making progress or is canceled, recording progress in s
+func checkOperations(s *state, pools []pool, now time.Time) error {
+	seen := make(map[string]operationProgress)
+	var errs []error
+	for _, p := range pools {
+		for _, o := range p.Operations() {
+			key := p.name + "/" + o.kind + "/" + o.target
+			prev, ok := s.Operations[key]
+			switch {
+			case o.canceled:
+				if !prev.Canceled {
+					errs = append(errs, fmt.Errorf("%s of %s on pool %s was canceled", o.kind, o.target, p.name))
+				}
+				prev.Canceled = true
+			case !o.running:
+			case !ok || o.progress > prev.Progress:
+				prev = operationProgress{Progress: o.progress, Since: now}
+			case now.Sub(prev.Since) > operationStallAfter:
+				errs = append(errs, fmt.Errorf("%s of %s on pool %s is stalled at %.2f%% since %s", o.kind, o.target, p.name, o.progress, prev.Since.Format(time.DateTime)))
+			}
+			seen[key] = prev
+		}
+	}
+	s.Operations = seen
+
+	return errors.Join(errs...)
+}
+
+// trackOperations runs checkOperations against the state file
+func trackOperations(pools []pool) error {
+	if pools == nil {
+		return nil // zpool status failed, keep the progress from the last run
+	}
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkOperations(&s, pools, time.Now())
+	saveState(s)
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_operations(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolOperations.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+	require.Len(t, pools, 2)
+
+	assert.True(t, pools[0].Health())
+	assert.Equal(t, "scrub repaired 0B in 00:10:03 with 0 errors on Sun Mar 31 18:36:05 2024", pools[0].scanStatus)
+	ops := pools[0].Operations()
+	require.Len(t, ops, 1)
+	assert.Equal(t, "removal of mirror-1 12.30% done, 0h12m to go", ops[0].String())
+
+	ops = pools[1].Operations()
+	require.Len(t, ops, 1)
+	assert.Equal(t, "expansion of raidz2-0 38.96% done, 00:33:25 to go", ops[0].String())
+
+	done := pool{name: "tank", removal: "Removal of vdev 1 copied 10.0G in 0h15m, completed on Tue Apr  2 10:15:00 2024\n1.50M memory used for removed device mappings"}
+	ops = done.Operations()
+	require.Len(t, ops, 1)
+	assert.False(t, ops[0].running)
+	assert.Equal(t, "Removal of vdev 1 copied 10.0G in 0h15m, completed on Tue Apr  2 10:15:00 2024", ops[0].String())
+}
+
+func Test_checkOperations(t *testing.T) {
+	t.Parallel()
+
+	running := pool{name: "tank", removal: "Evacuation of mirror-1 in progress since Tue Apr  2 10:00:01 2024\n1.23G copied out of 10.0G at 12.3M/s, 12.30% done, 0h12m to go"}
+	canceled := pool{name: "tank", removal: "Removal of mirror-1 canceled on Tue Apr  2 11:00:00 2024"}
+	now := time.Date(2024, time.April, 2, 10, 0, 0, 0, time.UTC)
+
+	var s state
+	require.NoError(t, checkOperations(&s, []pool{running}, now))
+	require.NoError(t, checkOperations(&s, []pool{running}, now.Add(operationStallAfter)))
+	assert.EqualError(t, checkOperations(&s, []pool{running}, now.Add(operationStallAfter+time.Hour)), "removal of mirror-1 on pool tank is stalled at 12.30% since 2024-04-02 10:00:00")
+
+	assert.EqualError(t, checkOperations(&s, []pool{canceled}, now), "removal of mirror-1 on pool tank was canceled")
+	assert.NoError(t, checkOperations(&s, []pool{canceled}, now), "a cancellation is only reported once")
+	assert.NoError(t, checkOperations(&s, nil, now))
+	assert.Empty(t, s.Operations)
+}
+
+func Test_checkCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolOperations.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+
+	created, size, ok := pools[0].Checkpoint()
+	require.True(t, ok)
+	assert.Equal(t, "2024-04-01 09:30:00", created.UTC().Format(time.DateTime))
+	assert.Equal(t, uint64(1288490188), size)
+	_, _, ok = pools[1].Checkpoint()
+	assert.False(t, ok)
+
+	assert.NoError(t, checkCheckpoints(pools, created.Add(checkpointMaxAge)))
+	assert.EqualError(t, checkCheckpoints(pools, created.Add(checkpointMaxAge+24*time.Hour)), "pool tank has had a checkpoint since Apr 1 (4 days), consuming 1.20 GiB")
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// opsgenie opens an alert for each failing check and closes it once the check recovers
+type opsgenie struct {
+	api  string
+	key  string
+	team string
+}
+
+type opsgenieResponder struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type opsgenieAlert struct {
+	Message     string              `json:"message"`
+	Alias       string              `json:"alias"`
+	Description string              `json:"description"`
+	Responders  []opsgenieResponder `json:"responders,omitempty"`
+	Priority    string              `json:"priority"`
+	Source      string              `json:"source"`
+	Tags        []string            `json:"tags"`
+}
+
+// opsgenie's field limits
+const (
+	opsgenieMaxMessage     = 130
+	opsgenieMaxDescription = 15000
+)
+
+// updateOpsgenie opens (or re-opens, opsgenie dedupes by alias) an alert for every failing check and closes alerts for checks that recovered
+func updateOpsgenie(results []checkResult, changes []transition) {
+	if opsgenieKey == "" {
+		return
+	}
+
+	o := opsgenie{api: opsgenieAPI, key: opsgenieKey, team: opsgenieTeam}
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		if err := o.create(o.alert(r)); err != nil {
+			log.Println("error creating opsgenie alert: " + err.Error())
+		}
+	}
+	for _, t := range changes {
+		if t.severity == severityInfo && t.pool == "" {
+			if err := o.close(opsgenieAlias(t.check), t.message); err != nil {
+				log.Println("error closing opsgenie alert: " + err.Error())
+			}
+		}
+	}
+}
+
+func (o opsgenie) alert(r checkResult) opsgenieAlert {
+	a := opsgenieAlert{
+		Message:     truncate(fmt.Sprintf("%s: %s failed", hostname(), r.name), opsgenieMaxMessage),
+		Alias:       opsgenieAlias(r.name),
+		Description: truncate(r.err.Error(), opsgenieMaxDescription),
+		Priority:    opsgeniePriority(r.severity),
+		Source:      "zfsHeartbeat",
+		Tags:        []string{"zfs", r.severity.String()},
+	}
+	if o.team != "" {
+		a.Responders = []opsgenieResponder{{Name: o.team, Type: "team"}}
+	}
+	return a
+}
+
+func (o opsgenie) create(a opsgenieAlert) error {
+	_, err := postJSON(strings.TrimSuffix(o.api, "/")+"/v2/alerts", a, o.headers())
+	return err
+}
+
+func (o opsgenie) close(alias, note string) error {
+	endpoint := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias", strings.TrimSuffix(o.api, "/"), url.PathEscape(alias))
+	_, err := postJSON(endpoint, map[string]string{"source": "zfsHeartbeat", "note": note}, o.headers())
+	return err
+}
+
+func (o opsgenie) headers() map[string]string {
+	return map[string]string{"Authorization": "GenieKey " + o.key}
+}
+
+// opsgenieAlias identifies the alert for a check on this host, so repeat failures update one alert
+func opsgenieAlias(check string) string {
+	return "zfsheartbeat-" + hostname() + "-" + strings.ReplaceAll(check, " ", "-")
+}
+
+func opsgeniePriority(sev severity) string {
+	switch sev {
+	case severityCritical:
+		return "P1"
+	case severityWarning:
+		return "P3"
+	default:
+		return "P5"
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_opsgenieAlert(t *testing.T) {
+	t.Parallel()
+
+	hostname, _ := os.Hostname()
+	o := opsgenie{team: "storage"}
+	a := o.alert(checkResult{name: "pool status", severity: severityCritical, err: errors.New("pool primarySafe - DEGRADED (0|0|0): errors: No known data errors")})
+
+	assert.Equal(t, opsgenieAlert{
+		Message:     hostname + ": pool status failed",
+		Alias:       "zfsheartbeat-" + hostname + "-pool-status",
+		Description: "pool primarySafe - DEGRADED (0|0|0): errors: No known data errors",
+		Responders:  []opsgenieResponder{{Name: "storage", Type: "team"}},
+		Priority:    "P1",
+		Source:      "zfsHeartbeat",
+		Tags:        []string{"zfs", "critical"},
+	}, a)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// recovered turns a recovered panic into an error, logging the stack trace it came from since the error alone won't say where it happened
+func recovered(where string, r any) error {
+	log.Printf("panic in %s: %v\n%s", where, r, debug.Stack())
+	return fmt.Errorf("internal error: %v", r)
+}
+
+// safely calls fn, turning a panic into a checkError, so a bug in one parser is reported like any other check that couldn't run
+// instead of crashing the job and taking every other check and notification with it
+func safely(where string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = checkError{recovered(where, r)}
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_safely(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, safely("disk usage", func() error { return nil }))
+	assert.EqualError(t, safely("disk usage", func() error { return errors.New("pool boot-pool not found in zfs list") }), "pool boot-pool not found in zfs list")
+
+	err := safely("disk usage", func() error {
+		var fields []string
+		_ = fields[2]
+		return nil
+	})
+	assert.EqualError(t, err, "internal error: runtime error: index out of range [2] with length 0")
+	assert.ErrorAs(t, err, new(checkError), "reported as the check not running rather than a problem it found")
+
+	err = eachPool([]pool{{name: "tank"}, {name: "boot-pool"}}, func(i int, p pool) error {
+		if p.name == "boot-pool" {
+			panic("unexpected vdev")
+		}
+		return nil
+	})
+	assert.EqualError(t, err, "internal error: unexpected vdev")
+}
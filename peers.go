@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+)
+
+// probePeer pings a host, or probes a host:port over TCP
+func probePeer(e executer, peer string) error {
+	if _, _, err := net.SplitHostPort(peer); err == nil {
+		return probeTCP(peer)
+	}
+	_, err := e("ping", "-c", "3", "-W", "5", peer)
+	return err
+}
+
+// checkPeers warns about peers that have been unreachable for longer than grace, recording when each went down in s
+func checkPeers(s *state, results map[string]error, grace time.Duration, now time.Time) error {
+	var names []string
+	for peer := range results {
+		names = append(names, peer)
+	}
+	sort.Strings(names)
+
+	down := make(map[string]time.Time)
+	var errs []error
+	for _, peer := range names {
+		err := results[peer]
+		if err == nil {
+			continue
+		}
+		since, ok := s.Peers[peer]
+		if !ok {
+			since = now
+		}
+		down[peer] = since
+		if now.Sub(since) >= grace {
+			errs = append(errs, fmt.Errorf("peer %s has been unreachable since %s: %w", peer, since.Format("Jan 2 15:04"), err))
+		}
+	}
+	s.Peers = down
+
+	return errors.Join(errs...)
+}
+
+// trackPeers probes every peer and runs checkPeers against the state file
+func trackPeers(e executer) error {
+	results := make(map[string]error, len(peers))
+	for _, peer := range peers {
+		results[peer] = probePeer(e, peer)
+	}
+
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkPeers(&s, results, peerGrace, time.Now())
+	saveState(s)
+	return err
+}
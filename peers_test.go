@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkPeers(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2024, time.March, 31, 12, 0, 0, 0, time.Local)
+	down := errors.New("ping exited with status 1")
+	var s state
+
+	// a peer going down is tolerated for the grace period
+	require.NoError(t, checkPeers(&s, map[string]error{"offsite": down, "nas2:22": nil}, 30*time.Minute, start))
+	assert.Equal(t, map[string]time.Time{"offsite": start}, s.Peers)
+	require.NoError(t, checkPeers(&s, map[string]error{"offsite": down, "nas2:22": nil}, 30*time.Minute, start.Add(20*time.Minute)))
+
+	err := checkPeers(&s, map[string]error{"offsite": down, "nas2:22": down}, 30*time.Minute, start.Add(40*time.Minute))
+	assert.EqualError(t, err, "peer offsite has been unreachable since Mar 31 12:00: ping exited with status 1")
+	assert.Equal(t, map[string]time.Time{"offsite": start, "nas2:22": start.Add(40 * time.Minute)}, s.Peers)
+
+	// and forgotten once it comes back
+	require.NoError(t, checkPeers(&s, map[string]error{"offsite": nil, "nas2:22": down}, 30*time.Minute, start.Add(50*time.Minute)))
+	assert.Equal(t, map[string]time.Time{"nas2:22": start.Add(40 * time.Minute)}, s.Peers)
+}
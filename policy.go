@@ -0,0 +1,296 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// systemDirs are shared with everything else on the machine, so a policy only grants heartbeat's own files in them rather than the whole directory
+var systemDirs = []string{"/", "/etc", "/run", "/var/run", "/var/lib", "/var/log", "/tmp", "/var/tmp"}
+
+// policyNeeds is everything the configured checks and notifiers touch, for an AppArmor profile or SELinux module confining heartbeat to just that
+type policyNeeds struct {
+	self      string   // this binary
+	commands  []string // commands run, by absolute path
+	missing   []string // commands the settings need that aren't installed here
+	devices   []string // device nodes, with * for disks that are found rather than listed
+	dirs      []string // heartbeat's own directories, where it replaces its files by renaming over them
+	files     []string // files heartbeat writes in system directories, with * for the temporary files it renames over them
+	reads     []string // files and trees read
+	endpoints []string // host:port that notifications go to
+	ping      bool     // the peers check pings, which needs a raw socket
+}
+
+// configuredNeeds works out what the settings need. lookPath is exec.LookPath, to find where commands are installed.
+func configuredNeeds(self string, lookPath func(string) (string, error)) policyNeeds {
+	n := policyNeeds{self: self}
+	command := func(name string) {
+		path, err := lookPath(name)
+		if err != nil && filepath.IsAbs(name) {
+			path = name // it's run by this path whether or not it's installed yet
+		} else if err != nil {
+			n.missing = append(n.missing, name)
+			return
+		}
+		if !slices.Contains(n.commands, path) {
+			n.commands = append(n.commands, path)
+		}
+	}
+	for _, name := range []string{"/sbin/zpool", "zfs", "/sbin/smartctl"} {
+		command(name)
+	}
+	if checkEnabled("kernel log") {
+		command("journalctl")
+	}
+	if zreplEnabled && checkEnabled("zrepl") {
+		command("zrepl")
+	}
+	for _, s := range services {
+		if s.Kind == "nfs" && checkEnabled("services") {
+			command("rpcinfo")
+			break
+		}
+	}
+	if len(peers) > 0 && checkEnabled("peers") {
+		command("ping")
+		n.ping = true
+	}
+	if sudoHelper {
+		command("sudo")
+	}
+	if len(instances) > 0 {
+		command("ssh")
+	}
+	if hostMode != "" {
+		command(hostMode)
+	}
+
+	n.devices = []string{"/dev/zfs"}
+	if len(smartDisks) == 0 {
+		n.devices = append(n.devices, "/dev/sd*", "/dev/nvme*")
+	}
+	for _, disk := range smartDisks {
+		device, _, _ := strings.Cut(disk, ":")
+		n.devices = append(n.devices, "/dev/"+device)
+	}
+
+	writable := func(path, temp string) {
+		if path == "" {
+			return
+		}
+		dir := filepath.Dir(path)
+		if !slices.Contains(systemDirs, dir) {
+			if !slices.Contains(n.dirs, dir) {
+				n.dirs = append(n.dirs, dir)
+			}
+			return
+		}
+		n.files = append(n.files, path)
+		if temp != "" {
+			n.files = append(n.files, filepath.Join(dir, temp+"*"))
+		}
+	}
+	names := []string{""}
+	for _, in := range instances {
+		names = append(names, in.Name)
+	}
+	for _, name := range names {
+		rename := func(path string) string { return path }
+		if name != "" {
+			rename = func(path string) string { return instancePath(path, name) }
+		}
+		writable(rename(statePath), ".heartbeat")
+		writable(rename(stateMirrorPath), ".heartbeat")
+		writable(rename(statusPath), ".status")
+		if statusPath != "" {
+			writable(previousStatusPath(rename(statusPath)), "")
+		}
+		writable(rename(lockPath), "")
+	}
+	writable(auditLogPath, "")
+	if reportDir != "" {
+		writable(filepath.Join(reportDir, "health.html"), ".heartbeat")
+		writable(filepath.Join(reportDir, "status.json"), ".status")
+	}
+
+	n.reads = []string{"/proc/**", "/sys/**", templateDir + "/**"}
+	if sanoidConf != "" {
+		n.reads = append(n.reads, sanoidConf)
+	}
+	if restoreDataset != "" && checkEnabled("restore") {
+		n.reads = append(n.reads, "/**/.zfs/snapshot/**")
+	}
+
+	if pushoverEnabled {
+		n.endpoints = append(n.endpoints, "api.pushover.net:443")
+	}
+	for _, b := range enabledBackends() {
+		if host := backendHost(b); !slices.Contains(n.endpoints, host) {
+			n.endpoints = append(n.endpoints, host)
+		}
+	}
+	return n
+}
+
+// apparmorProfile confines heartbeat to n. The commands it runs stay in the same profile, so they're held to it too.
+func apparmorProfile(n policyNeeds) string {
+	var b strings.Builder
+	b.WriteString("# generated by heartbeat install policy, for the settings heartbeat was built with. Load it with apparmor_parser -r.\n")
+	for _, name := range n.missing {
+		fmt.Fprintf(&b, "# %s isn't installed, so it isn't allowed\n", name)
+	}
+	b.WriteString("abi <abi/3.0>,\ninclude <tunables/global>\n\n")
+	fmt.Fprintf(&b, "profile zfs-heartbeat %s {\n", n.self)
+	b.WriteString("  include <abstractions/base>\n  include <abstractions/nameservice>\n  include <abstractions/ssl_certs>\n\n")
+	b.WriteString("  # zpool and smartctl ioctls\n  capability sys_admin,\n  capability sys_rawio,\n")
+	if n.ping {
+		b.WriteString("  capability net_raw,\n  network inet raw,\n  network inet6 raw,\n")
+	}
+	b.WriteString("\n")
+	if len(n.endpoints) > 0 {
+		b.WriteString("  # notifications go to " + strings.Join(n.endpoints, ", ") + "\n")
+	}
+	b.WriteString("  network inet stream,\n  network inet6 stream,\n  network inet dgram,\n  network inet6 dgram,\n\n")
+
+	fmt.Fprintf(&b, "  %s mr,\n", n.self)
+	for _, cmd := range n.commands {
+		fmt.Fprintf(&b, "  %s mrix,\n", cmd)
+	}
+	b.WriteString("  /{usr/,}lib{,32,64}/** mr,\n\n")
+
+	for _, device := range n.devices {
+		fmt.Fprintf(&b, "  %s rw,\n", device)
+	}
+	b.WriteString("\n")
+	for _, dir := range n.dirs {
+		fmt.Fprintf(&b, "  %s/ r,\n  %s/** rwk,\n", dir, dir)
+	}
+	for _, file := range n.files {
+		fmt.Fprintf(&b, "  %s rwk,\n", file)
+	}
+	for _, read := range n.reads {
+		fmt.Fprintf(&b, "  %s r,\n", read)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// selinuxModule confines heartbeat to n in its own zfs_heartbeat_t domain, entered when cron runs it, returning the module's type enforcement (.te) and file contexts (.fc).
+// SELinux can't tell one disk or host from another without labeling them, so it's coarser than the AppArmor profile.
+func selinuxModule(n policyNeeds) (te, fc string) {
+	var b strings.Builder
+	b.WriteString("# generated by heartbeat install policy, for the settings heartbeat was built with.\n")
+	b.WriteString("# Build it with make -f /usr/share/selinux/devel/Makefile zfs_heartbeat.pp, load it with semodule -i zfs_heartbeat.pp, then restorecon the paths in zfs_heartbeat.fc.\n")
+	for _, name := range n.missing {
+		fmt.Fprintf(&b, "# %s isn't installed, so it isn't allowed\n", name)
+	}
+	b.WriteString("policy_module(zfs_heartbeat, 1.0.0)\n\n")
+	b.WriteString("type zfs_heartbeat_t;\ntype zfs_heartbeat_exec_t;\ncron_system_entry(zfs_heartbeat_t, zfs_heartbeat_exec_t)\n\n")
+	b.WriteString("type zfs_heartbeat_var_t;\nfiles_type(zfs_heartbeat_var_t)\n")
+	b.WriteString("manage_dirs_pattern(zfs_heartbeat_t, zfs_heartbeat_var_t, zfs_heartbeat_var_t)\nmanage_files_pattern(zfs_heartbeat_t, zfs_heartbeat_var_t, zfs_heartbeat_var_t)\n")
+	for _, file := range n.files {
+		if !strings.Contains(file, "*") {
+			b.WriteString("# " + file + " would be made with its directory's label, so create it once before running restorecon\n")
+		}
+	}
+	b.WriteString("\n")
+
+	b.WriteString("# zpool and smartctl ioctls on /dev/zfs and the disks\n")
+	b.WriteString("allow zfs_heartbeat_t self:capability { sys_admin sys_rawio };\n")
+	b.WriteString("dev_rw_generic_chr_files(zfs_heartbeat_t)\nstorage_raw_read_fixed_disk(zfs_heartbeat_t)\n\n")
+
+	b.WriteString("corecmd_exec_bin(zfs_heartbeat_t)\nfiles_read_etc_files(zfs_heartbeat_t)\nkernel_read_system_state(zfs_heartbeat_t)\nkernel_read_network_state(zfs_heartbeat_t)\ndev_read_sysfs(zfs_heartbeat_t)\n")
+	for _, cmd := range n.commands {
+		switch filepath.Base(cmd) {
+		case "journalctl":
+			b.WriteString("logging_read_generic_logs(zfs_heartbeat_t)\n")
+		case "ping":
+			b.WriteString("netutils_domtrans_ping(zfs_heartbeat_t)\n")
+		case "ssh":
+			b.WriteString("ssh_exec(zfs_heartbeat_t)\n")
+		case "sudo":
+			b.WriteString("# sudoHelper: sudo needs more than this module grants, so run heartbeat as root under SELinux instead\n")
+		}
+	}
+	b.WriteString("\n")
+
+	if len(n.endpoints) > 0 {
+		b.WriteString("# notifications go to " + strings.Join(n.endpoints, ", ") + "\n")
+		b.WriteString("sysnet_dns_name_resolve(zfs_heartbeat_t)\nmiscfiles_read_generic_certs(zfs_heartbeat_t)\n")
+		ports := map[string]bool{}
+		for _, endpoint := range n.endpoints {
+			_, port, _ := strings.Cut(endpoint, ":")
+			switch port {
+			case "443", "80":
+				ports["corenet_tcp_connect_http_port"] = true
+			case "25", "465", "587":
+				ports["corenet_tcp_connect_smtp_port"] = true
+			default:
+				ports["corenet_tcp_connect_all_ports"] = true
+			}
+		}
+		for _, macro := range sortedKeys(ports) {
+			fmt.Fprintf(&b, "%s(zfs_heartbeat_t)\n", macro)
+		}
+	}
+	te = b.String()
+
+	b.Reset()
+	fmt.Fprintf(&b, "%s\t--\tgen_context(system_u:object_r:zfs_heartbeat_exec_t,s0)\n", regexp.QuoteMeta(n.self))
+	for _, dir := range n.dirs {
+		fmt.Fprintf(&b, "%s(/.*)?\t\tgen_context(system_u:object_r:zfs_heartbeat_var_t,s0)\n", regexp.QuoteMeta(dir))
+	}
+	for _, file := range n.files {
+		// temporary files are labeled by the directory they're made in, and keep it when renamed
+		if !strings.Contains(file, "*") {
+			fmt.Fprintf(&b, "%s\t--\tgen_context(system_u:object_r:zfs_heartbeat_var_t,s0)\n", regexp.QuoteMeta(file))
+		}
+	}
+	return te, b.String()
+}
+
+// installPolicy is the install policy command: it writes an AppArmor profile (or SELinux module with -selinux) for the settings heartbeat was built with to -o, or prints it
+func installPolicy(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("install policy", flag.ContinueOnError)
+	flags.SetOutput(w)
+	selinux := flags.Bool("selinux", false, "generate an SELinux module instead of an AppArmor profile")
+	dir := flags.String("o", "", "write the profile or module to this directory rather than printing it, eg /etc/apparmor.d")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	n := configuredNeeds(self, exec.LookPath)
+
+	files := [][2]string{{"zfs-heartbeat", apparmorProfile(n)}}
+	if *selinux {
+		te, fc := selinuxModule(n)
+		files = [][2]string{{"zfs_heartbeat.te", te}, {"zfs_heartbeat.fc", fc}}
+	}
+	for _, f := range files {
+		if *dir == "" {
+			fmt.Fprintf(w, "# %s\n%s\n", f[0], f[1])
+			continue
+		}
+		path := filepath.Join(*dir, f[0])
+		if err := os.WriteFile(path, []byte(f[1]), 0o644); err != nil {
+			return err
+		}
+		log.Println("wrote " + path)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_configuredNeeds(t *testing.T) {
+	t.Parallel()
+
+	installed := map[string]string{"zfs": "/usr/sbin/zfs", "journalctl": "/usr/bin/journalctl"}
+	lookPath := func(name string) (string, error) {
+		if path, ok := installed[name]; ok {
+			return path, nil
+		}
+		return "", errors.New("not found")
+	}
+
+	n := configuredNeeds("/usr/local/bin/heartbeat", lookPath)
+	assert.Equal(t, []string{"/sbin/zpool", "/usr/sbin/zfs", "/sbin/smartctl", "/usr/bin/journalctl"}, n.commands)
+	assert.Empty(t, n.missing)
+	assert.Equal(t, []string{"/dev/zfs", "/dev/sda", "/dev/sdb", "/dev/sdc", "/dev/sdd", "/dev/sde", "/dev/sdf"}, n.devices)
+	assert.Equal(t, []string{"/var/lib/heartbeat", "/mnt/primarySafe/apps/heartbeat"}, n.dirs)
+	assert.Equal(t, []string{"/var/run/heartbeat.lock"}, n.files)
+	assert.Equal(t, []string{"api.pushover.net:443"}, n.endpoints)
+}
+
+func Test_apparmorProfile(t *testing.T) {
+	t.Parallel()
+
+	n := policyNeeds{
+		self:      "/usr/local/bin/heartbeat",
+		commands:  []string{"/sbin/zpool", "/bin/ping"},
+		missing:   []string{"zfs"},
+		devices:   []string{"/dev/zfs", "/dev/sda"},
+		dirs:      []string{"/var/lib/heartbeat"},
+		files:     []string{"/var/run/heartbeat.lock"},
+		reads:     []string{"/proc/**"},
+		endpoints: []string{"api.pushover.net:443"},
+		ping:      true,
+	}
+	got := apparmorProfile(n)
+	for _, line := range []string{
+		"# zfs isn't installed, so it isn't allowed\n",
+		"profile zfs-heartbeat /usr/local/bin/heartbeat {\n",
+		"  capability net_raw,\n",
+		"  /sbin/zpool mrix,\n",
+		"  /dev/sda rw,\n",
+		"  /var/lib/heartbeat/** rwk,\n",
+		"  /var/run/heartbeat.lock rwk,\n",
+		"  /proc/** r,\n",
+		"  # notifications go to api.pushover.net:443\n",
+	} {
+		assert.Contains(t, got, line)
+	}
+	n.ping = false
+	assert.NotContains(t, apparmorProfile(n), "net_raw")
+}
+
+func Test_selinuxModule(t *testing.T) {
+	t.Parallel()
+
+	n := policyNeeds{
+		self:      "/usr/local/bin/heartbeat",
+		commands:  []string{"/sbin/zpool", "/usr/bin/journalctl"},
+		dirs:      []string{"/var/lib/heartbeat"},
+		files:     []string{"/var/run/heartbeat.lock", "/var/run/.status*"},
+		endpoints: []string{"api.pushover.net:443", "smtp.example.com:587", "nms.local:10051"},
+	}
+	te, fc := selinuxModule(n)
+	for _, line := range []string{
+		"policy_module(zfs_heartbeat, 1.0.0)\n",
+		"logging_read_generic_logs(zfs_heartbeat_t)\n",
+		"corenet_tcp_connect_all_ports(zfs_heartbeat_t)\ncorenet_tcp_connect_http_port(zfs_heartbeat_t)\ncorenet_tcp_connect_smtp_port(zfs_heartbeat_t)\n",
+	} {
+		assert.Contains(t, te, line)
+	}
+	assert.Equal(t, "/usr/local/bin/heartbeat\t--\tgen_context(system_u:object_r:zfs_heartbeat_exec_t,s0)\n"+
+		"/var/lib/heartbeat(/.*)?\t\tgen_context(system_u:object_r:zfs_heartbeat_var_t,s0)\n"+
+		"/var/run/heartbeat\\.lock\t--\tgen_context(system_u:object_r:zfs_heartbeat_var_t,s0)\n", fc)
+}
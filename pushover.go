@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gregdel/pushover"
+)
+
+// pushoverFormats are the values of pushoverFormat
+var pushoverFormats = []string{"", "html", "monospace"}
+
+// severityColors color each severity tag in html messages, matching the health page
+var severityColors = map[string]string{"[critical]": "#cf222e", "[warning]": "#9a6700"}
+
+// linePriority ranks a line of an alert for fitMessage. The paste link and critical findings are kept first.
+func linePriority(line string) int {
+	switch {
+	case strings.HasPrefix(line, "Details: "):
+		return 4
+	case strings.HasPrefix(line, "[critical]"), containsAny(line, "FAULTED", "UNAVAIL", "DEGRADED", "REMOVED", "OFFLINE"):
+		return 3
+	case strings.HasPrefix(line, "[warning]"):
+		return 2
+	default:
+		return 1
+	}
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// fitMessage shortens msg to at most limit characters for services like pushover with a hard limit.
+// The most important lines are kept in their original order, the rest are counted at the end, and the lines left out are returned.
+func fitMessage(msg string, limit int) (string, []string) {
+	if utf8.RuneCountInString(msg) <= limit {
+		return msg, nil
+	}
+
+	lines := strings.Split(msg, "\n")
+	footer := func(n int) string {
+		return fmt.Sprintf("...and %d more lines", n)
+	}
+	budget := limit - utf8.RuneCountInString(footer(len(lines))) - 1
+
+	keep := make([]bool, len(lines))
+	for priority := 4; priority > 0; priority-- {
+		for i, line := range lines {
+			if linePriority(line) != priority {
+				continue
+			}
+			if n := utf8.RuneCountInString(line) + 1; n <= budget {
+				keep[i] = true
+				budget -= n
+			}
+		}
+	}
+
+	var kept, dropped []string
+	for i, line := range lines {
+		if keep[i] {
+			kept = append(kept, line)
+		} else {
+			dropped = append(dropped, line)
+		}
+	}
+	if len(kept) == 0 {
+		// a single line too long to fit on its own
+		return truncate(lines[0], limit), lines
+	}
+	return strings.Join(append(kept, footer(len(dropped))), "\n"), dropped
+}
+
+// chunkLines packs lines into as few messages of at most limit characters as it can
+func chunkLines(lines []string, limit int) []string {
+	var chunks []string
+	var chunk []string
+	size := 0
+	for _, line := range lines {
+		line = truncate(line, limit)
+		n := utf8.RuneCountInString(line) + 1
+		if len(chunk) > 0 && size+n > limit+1 {
+			chunks = append(chunks, strings.Join(chunk, "\n"))
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, line)
+		size += n
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, strings.Join(chunk, "\n"))
+	}
+	return chunks
+}
+
+// pushoverHTML formats a plain text alert for pushover's html option: severity tags in bold and color, the paste link clickable, and everything else escaped
+func pushoverHTML(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if link, ok := strings.CutPrefix(line, "Details: "); ok && !strings.ContainsAny(link, " \"") {
+			lines[i] = fmt.Sprintf(`Details: <a href="%s">%s</a>`, html.EscapeString(link), html.EscapeString(link))
+			continue
+		}
+		tag, rest, found := strings.Cut(line, " ")
+		color, ok := severityColors[tag]
+		if !found || !ok {
+			lines[i] = html.EscapeString(line)
+			continue
+		}
+		lines[i] = fmt.Sprintf(`<font color="%s"><b>%s</b></font> %s`, color, html.EscapeString(tag), html.EscapeString(rest))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pushoverMessage is text, already fit to pushover's limit, in pushoverFormat.
+// An html message that no longer fits once it's marked up is sent as plain text instead.
+func pushoverMessage(text, format string) *pushover.Message {
+	switch format {
+	case "html":
+		if marked := pushoverHTML(text); utf8.RuneCountInString(marked) <= pushover.MessageMaxLength {
+			message := pushover.NewMessage(marked)
+			message.HTML = true
+			return message
+		}
+	case "monospace":
+		message := pushover.NewMessage(text)
+		message.Monospace = true
+		return message
+	}
+	return pushover.NewMessage(text)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_fitMessage(t *testing.T) {
+	t.Parallel()
+
+	short := "[warning] smart error: disk sdb: Completed: read failure"
+	text, dropped := fitMessage(short, 1024)
+	assert.Equal(t, short, text)
+	assert.Empty(t, dropped)
+
+	var lines []string
+	for i := 0; i < 20; i++ {
+		lines = append(lines, fmt.Sprintf("[warning] smart error: disk sd%c: Completed: read failure", 'a'+i))
+	}
+	lines = append(lines, "[critical] pool primarySafe - DEGRADED (0|0|0): errors: No known data errors", "Details: https://paste.rs/Xy1")
+	msg := strings.Join(lines, "\n")
+
+	text, dropped = fitMessage(msg, 300)
+	assert.LessOrEqual(t, utf8.RuneCountInString(text), 300)
+	assert.Equal(t, `[warning] smart error: disk sda: Completed: read failure
+[warning] smart error: disk sdb: Completed: read failure
+[warning] smart error: disk sdc: Completed: read failure
+[critical] pool primarySafe - DEGRADED (0|0|0): errors: No known data errors
+Details: https://paste.rs/Xy1
+...and 17 more lines`, text)
+	assert.Equal(t, lines[3:20], dropped)
+
+	chunks := chunkLines(dropped, 300)
+	assert.Len(t, chunks, 4)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, utf8.RuneCountInString(chunk), 300)
+	}
+	assert.Equal(t, strings.Join(dropped, "\n"), strings.Join(chunks, "\n"))
+}
+
+func Test_pushoverHTML(t *testing.T) {
+	t.Parallel()
+
+	text := "[critical] pool primarySafe is DEGRADED\nvdev raidz2-0 is DEGRADED: has no redundancy left\ndisk sdb is FAULTED: <too many errors>\n[warning] dataset primarySafe/R&D has 10.00 GiB free\nDetails: https://paste.rs/Xy1"
+	assert.Equal(t, `<font color="#cf222e"><b>[critical]</b></font> pool primarySafe is DEGRADED
+vdev raidz2-0 is DEGRADED: has no redundancy left
+disk sdb is FAULTED: &lt;too many errors&gt;
+<font color="#9a6700"><b>[warning]</b></font> dataset primarySafe/R&amp;D has 10.00 GiB free
+Details: <a href="https://paste.rs/Xy1">https://paste.rs/Xy1</a>`, pushoverHTML(text))
+
+	m := pushoverMessage(text, "html")
+	assert.True(t, m.HTML)
+	assert.Equal(t, pushoverHTML(text), m.Message)
+
+	// markup pushing a message over the limit falls back to plain text
+	long := strings.Repeat("[warning] a & b\n", 60)
+	require.LessOrEqual(t, utf8.RuneCountInString(long), 1024)
+	m = pushoverMessage(long, "html")
+	assert.False(t, m.HTML)
+	assert.Equal(t, long, m.Message)
+
+	m = pushoverMessage(text, "monospace")
+	assert.True(t, m.Monospace)
+	assert.Equal(t, text, m.Message)
+
+	m = pushoverMessage(text, "")
+	assert.False(t, m.HTML || m.Monospace)
+}
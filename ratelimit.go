@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"time"
+)
+
+// tokenBucket limits how often notifications are sent. It holds up to burst tokens, refilled continuously at perHour, and each notification spends one.
+type tokenBucket struct {
+	Tokens  float64
+	Updated time.Time
+	Dropped int       // notifications dropped since the last one sent
+	Since   time.Time // when the first of them was dropped
+}
+
+// refill adds the tokens earned since b was last updated
+func (b *tokenBucket) refill(burst int, perHour float64, now time.Time) {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(burst)
+	} else {
+		b.Tokens = math.Min(float64(burst), b.Tokens+now.Sub(b.Updated).Hours()*perHour)
+	}
+	b.Updated = now
+}
+
+// limitKey names b's bucket in state.Limits, so backends of the same kind that send to different places are limited separately
+func limitKey(b backend) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%#v", b)))
+	return fmt.Sprintf("%s %x", b.name(), sum[:4])
+}
+
+// globalBucket is the bucket in s that limits notifications across every backend. A notification spends one token from it, however many backends it goes out through.
+func globalBucket(s *state, now time.Time) *tokenBucket {
+	if s.Limits == nil {
+		s.Limits = make(map[string]*tokenBucket)
+	}
+	if s.Limits[""] == nil {
+		s.Limits[""] = &tokenBucket{}
+	}
+	global := s.Limits[""]
+	global.refill(notifyMaxPerHour, notifyMaxPerHour, now)
+	return global
+}
+
+// limitNotification decides whether n may go out through b, spending a token from b's bucket in s. withinGlobal is whether the global bucket has a token for n.
+// The first notification b's own limit drops is replaced with a warning that the limit was reached, and the next one sent says how many were dropped.
+// Past the global limit nothing goes out, not even that warning.
+func limitNotification(s *state, b backend, withinGlobal bool, n notification, now time.Time) (notification, bool) {
+	if s.Limits == nil {
+		s.Limits = make(map[string]*tokenBucket)
+	}
+	key := limitKey(b)
+	if s.Limits[key] == nil {
+		s.Limits[key] = &tokenBucket{}
+	}
+	own := s.Limits[key]
+	own.refill(notifyBurst, notifyPerHour, now)
+
+	if !withinGlobal || own.Tokens < 1 {
+		own.Dropped++
+		if own.Dropped == 1 {
+			own.Since = now
+		}
+		if !withinGlobal || own.Dropped > 1 {
+			log.Printf("rate limit: dropped %s %q to %s", n.severity, n.title, b.name())
+			return n, false
+		}
+		// a warning, so a dropped critical alert doesn't page anyone about the rate limit
+		return notification{
+			title:    "Notification limit reached",
+			message:  fmt.Sprintf("Too many notifications, so %s is dropping them for a while. Dropped: %s", b.name(), n.title),
+			severity: severityWarning,
+		}, true
+	}
+
+	own.Tokens--
+	if own.Dropped > 0 {
+		n.message += fmt.Sprintf("\n(%d notifications dropped by the rate limit since %s)", own.Dropped, own.Since.Format("Jan 2 15:04"))
+		own.Dropped = 0
+	}
+	return n, true
+}
+
+// pruneLimits drops the buckets in s that aren't the global one or in keys, eg a backend's old bucket after its token or URL changed
+func pruneLimits(s *state, keys []string) {
+	for key := range s.Limits {
+		if key != "" && !slices.Contains(keys, key) {
+			delete(s.Limits, key)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_limitNotification(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.April, 6, 8, 15, 0, 0, time.UTC)
+	s := state{}
+	n := notification{title: "Pool degraded", message: "sdb is faulted", severity: severityCritical}
+	ops := discord{webhook: "https://discord.com/api/webhooks/1/ops"}
+
+	for i := 0; i < notifyBurst; i++ {
+		sent, ok := limitNotification(&s, ops, true, n, now)
+		assert.True(t, ok, i)
+		assert.Equal(t, n, sent)
+	}
+
+	notice, ok := limitNotification(&s, ops, true, n, now)
+	assert.True(t, ok)
+	assert.Equal(t, "Notification limit reached", notice.title)
+	assert.Equal(t, severityWarning, notice.severity, "dropping a critical alert doesn't page anyone")
+	assert.Contains(t, notice.message, "discord is dropping")
+	assert.Contains(t, notice.message, "Pool degraded")
+
+	_, ok = limitNotification(&s, ops, true, n, now.Add(time.Minute))
+	assert.False(t, ok)
+
+	// other notifiers, and other destinations of the same kind, have their own buckets
+	_, ok = limitNotification(&s, slack{webhook: "https://hooks.slack.com/services/T/B/ops"}, true, n, now)
+	assert.True(t, ok)
+	_, ok = limitNotification(&s, discord{webhook: "https://discord.com/api/webhooks/2/family"}, true, n, now)
+	assert.True(t, ok)
+	_, ok = limitNotification(&s, pushoverBackend{token: "app", user: "family"}, true, n, now)
+	assert.True(t, ok)
+
+	sent, ok := limitNotification(&s, ops, true, n, now.Add(30*time.Minute))
+	assert.True(t, ok)
+	assert.Equal(t, "sdb is faulted\n(2 notifications dropped by the rate limit since Apr 6 08:15)", sent.message)
+	assert.Zero(t, s.Limits[limitKey(ops)].Dropped)
+}
+
+func Test_limitKey(t *testing.T) {
+	t.Parallel()
+
+	primary := pushoverBackend{token: "app", user: "me"}
+	assert.Equal(t, limitKey(primary), limitKey(pushoverBackend{token: "app", user: "me"}))
+	assert.NotEqual(t, limitKey(primary), limitKey(pushoverBackend{token: "app", user: "family"}))
+	assert.NotEqual(t, limitKey(discord{webhook: "https://discord.com/api/webhooks/1/ops"}), limitKey(discord{webhook: "https://discord.com/api/webhooks/2/family"}))
+	assert.NotContains(t, limitKey(primary), "app", "keys don't leak credentials into the state file")
+}
+
+func Test_limitNotificationGlobal(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.April, 6, 8, 15, 0, 0, time.UTC)
+	s := state{}
+	n := notification{title: "Pool degraded", severity: severityCritical}
+	backends := []backend{discord{webhook: "d"}, slack{webhook: "s"}, matrix{room: "m"}, pushoverBackend{user: "p"}}
+
+	// past the global limit nothing goes out, not even the notice that notifications are being dropped
+	global := globalBucket(&s, now)
+	global.Tokens = 0.5
+	for _, b := range backends {
+		_, ok := limitNotification(&s, b, global.Tokens >= 1, n, now)
+		assert.False(t, ok)
+	}
+
+	sent, ok := limitNotification(&s, backends[0], true, n, now.Add(time.Hour))
+	assert.True(t, ok)
+	assert.Equal(t, n.title, sent.title)
+	assert.Contains(t, sent.message, "(1 notifications dropped by the rate limit since Apr 6 08:15)")
+}
+
+func Test_pruneLimits(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.April, 6, 8, 15, 0, 0, time.UTC)
+	s := state{}
+	n := notification{title: "Pool degraded", severity: severityWarning}
+	old, current := discord{webhook: "https://discord.com/api/webhooks/1/old"}, discord{webhook: "https://discord.com/api/webhooks/1/new"}
+	globalBucket(&s, now)
+	limitNotification(&s, old, true, n, now)
+	limitNotification(&s, current, true, n, now)
+
+	pruneLimits(&s, []string{limitKey(current)})
+	assert.Len(t, s.Limits, 2)
+	assert.Contains(t, s.Limits, "")
+	assert.Contains(t, s.Limits, limitKey(current))
+}
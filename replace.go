@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replacementMaxAge is how long a disk can be marked as being replaced before the heartbeat asks whether it's been forgotten
+const replacementMaxAge = 7 * 24 * time.Hour
+
+// replacement is a disk an operator is replacing. Its pool being degraded and resilvering is expected until it's done.
+type replacement struct {
+	Pool       string
+	Disk       string
+	Since      time.Time
+	Progress   float64   // percent done of the resilver when last seen
+	ProgressAt time.Time // when Progress last moved
+}
+
+func (r replacement) String() string {
+	return fmt.Sprintf("disk %s in pool %s", r.Disk, r.Pool)
+}
+
+// matches is true if d is the disk being replaced: by name, or shown by GUID as "was /dev/sdb1", or "was /dev/sdb1/old" once zpool replace puts a new disk in its place
+func (r replacement) matches(d vdevDisk) bool {
+	if d.name == r.Disk {
+		return true
+	}
+	was, ok := strings.CutPrefix(d.message, "was ")
+	if !ok || strings.TrimSpace(was) == "" {
+		return false
+	}
+	was = strings.TrimSuffix(strings.Fields(was)[0], "/old")
+	return was == r.Disk || path.Base(was) == r.Disk || diskDevice(was) == diskDevice(r.Disk)
+}
+
+// expected is true if the only problems in p are the disk being replaced and its replacement
+func (r replacement) expected(p pool) bool {
+	if p.name != r.Pool || p.read != 0 || p.write != 0 || p.checksum != 0 || p.errors != noDataErrors {
+		return false
+	}
+
+	var group string
+	p.Walk(func(_ vdev, d vdevDisk) bool {
+		if r.matches(d) {
+			group = d.replacing
+		}
+		return group == ""
+	})
+	expected := true
+	p.Walk(func(_ vdev, d vdevDisk) bool {
+		expected = d.Healthy() || r.matches(d) || group != "" && d.replacing == group
+		return expected
+	})
+	return expected
+}
+
+// checkReplacements follows the resilver of every disk being replaced, returning a summary of each replacement that finished and dropping it from s
+func checkReplacements(s *state, pools []pool, now time.Time) ([]string, error) {
+	var done []string
+	var errs []error
+	var open []replacement
+	for _, r := range s.Replacements {
+		i := slices.IndexFunc(pools, func(p pool) bool { return p.name == r.Pool })
+		if i < 0 {
+			open = append(open, r)
+			continue
+		}
+		p := pools[i]
+
+		resilvering := strings.HasPrefix(p.scanStatus, "resilver in progress")
+		// the old disk has left the pool, or after an in-place zpool replace, the new one of the same name is all that's left
+		finished := true
+		p.Walk(func(_ vdev, d vdevDisk) bool {
+			if r.matches(d) {
+				finished = d.name == r.Disk && d.replacing == "" && d.Healthy()
+			}
+			return finished
+		})
+		if finished && !resilvering && p.Health() {
+			scan, _, _ := strings.Cut(p.scanStatus, "\n")
+			done = append(done, fmt.Sprintf("%s was replaced in %s: %s", r, now.Sub(r.Since).Round(time.Minute), scan))
+			continue
+		}
+
+		switch {
+		case resilvering:
+			var progress float64
+			if matches := progressRe.FindStringSubmatch(p.scanStatus); matches != nil {
+				progress, _ = strconv.ParseFloat(matches[1], 64)
+			}
+			if r.ProgressAt.IsZero() || progress > r.Progress {
+				r.Progress, r.ProgressAt = progress, now
+			} else if now.Sub(r.ProgressAt) > operationStallAfter {
+				errs = append(errs, fmt.Errorf("resilver replacing %s is stalled at %.2f%% since %s", r, r.Progress, r.ProgressAt.Format(time.DateTime)))
+			}
+		case now.Sub(r.Since) > replacementMaxAge:
+			errs = append(errs, fmt.Errorf("%s has been marked as being replaced since %s, run heartbeat replace-disk -cancel %s %s if that's no longer true", r, r.Since.Format("Jan 2"), r.Pool, r.Disk))
+		}
+		open = append(open, r)
+	}
+	s.Replacements = open
+
+	return done, errors.Join(errs...)
+}
+
+// trackReplacements runs checkReplacements against the state file
+func trackReplacements(pools []pool) ([]string, error) {
+	s, err := loadState()
+	if err != nil {
+		return nil, stateUnreadable(err)
+	}
+	if len(s.Replacements) == 0 {
+		return nil, nil
+	}
+	done, err := checkReplacements(&s, pools, time.Now())
+	saveState(s)
+	return done, err
+}
+
+// replaceDisk records that a disk is being replaced, cancels that, or lists the disks being replaced
+func replaceDisk(w io.Writer, s *state, args []string, now time.Time) error {
+	flags := flag.NewFlagSet("replace-disk", flag.ContinueOnError)
+	flags.SetOutput(w)
+	cancel := flags.Bool("cancel", false, "stop treating the disk as being replaced")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		for _, r := range s.Replacements {
+			fmt.Fprintf(w, "%s since %s\n", r, r.Since.Format(time.DateTime))
+		}
+		return nil
+	}
+	if flags.NArg() != 2 {
+		return errors.New("usage: heartbeat replace-disk [-cancel] <pool> <disk>")
+	}
+	r := replacement{Pool: flags.Arg(0), Disk: flags.Arg(1), Since: now}
+
+	i := slices.IndexFunc(s.Replacements, func(o replacement) bool { return o.Pool == r.Pool && o.Disk == r.Disk })
+	switch {
+	case *cancel && i < 0:
+		return fmt.Errorf("%s isn't being replaced", r)
+	case *cancel:
+		s.Replacements = slices.Delete(s.Replacements, i, i+1)
+		fmt.Fprintf(w, "%s is no longer being replaced\n", r)
+	case i >= 0:
+		return fmt.Errorf("%s is already being replaced", r)
+	default:
+		s.Replacements = append(s.Replacements, r)
+		fmt.Fprintf(w, "%s is being replaced. Alerts about it and its resilver are held until the replacement finishes.\n", r)
+	}
+	return nil
+}
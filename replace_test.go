@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const replacedDisk = "4167d912-9102-11e2-a05e-b8975a0e7ea3"
+
+func Test_checkPoolStatusReplacing(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolReplacing.txt")
+	require.NoError(t, err)
+	e := func(cmd string, args ...string) (string, error) {
+		return string(data), nil
+	}
+
+	pools, err := checkPoolStatus(e, bufferedStream(e), nil)
+	require.Error(t, err)
+	require.Len(t, pools, 1)
+	assert.Equal(t, "replacing-1", pools[0].vdevs[0].disks[1].replacing)
+	assert.Equal(t, "replacing-1", pools[0].vdevs[0].disks[2].replacing)
+	assert.Empty(t, pools[0].vdevs[0].disks[3].replacing)
+
+	_, err = checkPoolStatus(e, bufferedStream(e), []replacement{{Pool: "primarySafe", Disk: replacedDisk}})
+	assert.NoError(t, err)
+
+	// replacing one disk doesn't excuse another
+	_, err = checkPoolStatus(e, bufferedStream(e), []replacement{{Pool: "primarySafe", Disk: "e43d41b6-adcc-11e5-b06a-d43d7ef79ff0"}})
+	assert.Error(t, err)
+}
+
+func Test_checkReplacements(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolReplacing.txt")
+	require.NoError(t, err)
+	resilvering, err := parsePools(string(data))
+	require.NoError(t, err)
+
+	start := time.Date(2024, time.March, 31, 10, 0, 0, 0, time.Local)
+	s := state{Replacements: []replacement{{Pool: "primarySafe", Disk: replacedDisk, Since: start}}}
+
+	done, err := checkReplacements(&s, resilvering, start.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, done)
+	assert.Equal(t, 20.37, s.Replacements[0].Progress)
+
+	_, err = checkReplacements(&s, resilvering, start.Add(8*time.Hour))
+	assert.EqualError(t, err, "resilver replacing disk "+replacedDisk+" in pool primarySafe is stalled at 20.37% since 2024-03-31 11:00:00")
+
+	finished := []pool{{
+		name:       "primarySafe",
+		state:      "ONLINE",
+		errors:     "errors: No known data errors",
+		scanStatus: "resilvered 1.20T in 10:00:00 with 0 errors on Sun Mar 31 20:02:11 2024",
+		vdevs:      []vdev{{name: "raidz2-0", state: "ONLINE", typev: vdevTypeRaidz}},
+	}}
+	done, err = checkReplacements(&s, finished, start.Add(10*time.Hour+5*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"disk " + replacedDisk + " in pool primarySafe was replaced in 10h5m0s: resilvered 1.20T in 10:00:00 with 0 errors on Sun Mar 31 20:02:11 2024"}, done)
+	assert.Empty(t, s.Replacements)
+}
+
+func Test_checkReplacementsInPlace(t *testing.T) {
+	t.Parallel()
+
+	// zpool replace tank sdb with a new disk in the same slot: the old one shows by GUID, and the new one keeps its name
+	data, err := os.ReadFile("testFiles/zpoolReplacingInPlace.txt")
+	require.NoError(t, err)
+	e := func(cmd string, args ...string) (string, error) {
+		return string(data), nil
+	}
+	r := replacement{Pool: "tank", Disk: "sdb", Since: time.Date(2024, time.March, 31, 10, 0, 0, 0, time.Local)}
+	resilvering, err := checkPoolStatus(e, bufferedStream(e), []replacement{r})
+	require.NoError(t, err)
+	_, err = checkPoolStatus(e, bufferedStream(e), []replacement{{Pool: "tank", Disk: "sdc"}})
+	assert.Error(t, err, "replacing one disk doesn't excuse another")
+
+	s := state{Replacements: []replacement{r}}
+	done, err := checkReplacements(&s, resilvering, r.Since.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, done)
+
+	finished := []pool{{
+		name:       "tank",
+		state:      "ONLINE",
+		errors:     "errors: No known data errors",
+		scanStatus: "resilvered 1.20T in 04:00:00 with 0 errors on Sun Mar 31 14:02:11 2024",
+		vdevs: []vdev{{name: "raidz1-0", state: "ONLINE", typev: vdevTypeRaidz, disks: []vdevDisk{
+			{name: "sda", state: "ONLINE"}, {name: "sdb", state: "ONLINE"}, {name: "sdc", state: "ONLINE"},
+		}}},
+	}}
+	done, err = checkReplacements(&s, finished, r.Since.Add(8*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"disk sdb in pool tank was replaced in 192h0m0s: resilvered 1.20T in 04:00:00 with 0 errors on Sun Mar 31 14:02:11 2024"}, done)
+	assert.Empty(t, s.Replacements)
+}
+
+func Test_replacementMatches(t *testing.T) {
+	t.Parallel()
+
+	r := replacement{Pool: "tank", Disk: "sdb"}
+	assert.True(t, r.matches(vdevDisk{name: "sdb"}))
+	assert.True(t, r.matches(vdevDisk{name: "14803813886136010794", message: "was /dev/sdb"}))
+	assert.True(t, r.matches(vdevDisk{name: "14803813886136010794", message: "was /dev/sdb1/old"}))
+	assert.False(t, r.matches(vdevDisk{name: "14803813886136010794", message: "was /dev/sdc1"}))
+	assert.False(t, r.matches(vdevDisk{name: "sdc", message: "too many errors"}))
+
+	byID := replacement{Pool: "primarySafe", Disk: replacedDisk}
+	assert.True(t, byID.matches(vdevDisk{name: "14803813886136010794", message: "was /dev/gptid/" + replacedDisk}))
+}
+
+func Test_replaceDisk(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 31, 10, 0, 0, 0, time.Local)
+	var s state
+	var buf bytes.Buffer
+
+	require.NoError(t, replaceDisk(&buf, &s, []string{"primarySafe", "sdb"}, now))
+	assert.Equal(t, []replacement{{Pool: "primarySafe", Disk: "sdb", Since: now}}, s.Replacements)
+	assert.Error(t, replaceDisk(&buf, &s, []string{"primarySafe", "sdb"}, now))
+	assert.Error(t, replaceDisk(&buf, &s, []string{"primarySafe"}, now))
+
+	buf.Reset()
+	require.NoError(t, replaceDisk(&buf, &s, nil, now))
+	assert.Equal(t, "disk sdb in pool primarySafe since 2024-03-31 10:00:00\n", buf.String())
+
+	require.NoError(t, replaceDisk(&buf, &s, []string{"-cancel", "primarySafe", "sdb"}, now))
+	assert.Empty(t, s.Replacements)
+	assert.Error(t, replaceDisk(&buf, &s, []string{"-cancel", "primarySafe", "sdb"}, now))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shareFilesystems are the filesystem types an SMB share is mounted as
+var shareFilesystems = []string{"cifs", "smb3", "smbfs"}
+
+// mount is a line of /proc/mounts
+type mount struct {
+	source, point, fstype string
+}
+
+// parseMounts reads /proc/mounts, which escapes spaces and other awkward characters in octal, eg \040
+func parseMounts(data string) []mount {
+	unescape := func(s string) string {
+		if !strings.Contains(s, `\`) {
+			return s
+		}
+		var b strings.Builder
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+4 <= len(s) {
+				if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 3
+					continue
+				}
+			}
+			b.WriteByte(s[i])
+		}
+		return b.String()
+	}
+
+	var mounts []mount
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mounts = append(mounts, mount{source: unescape(fields[0]), point: unescape(fields[1]), fstype: fields[2]})
+	}
+	return mounts
+}
+
+// mountOf finds the filesystem path is on, the last mounted of the deepest mount points containing it
+func mountOf(mounts []mount, path string) (found mount, ok bool) {
+	path = filepath.Clean(path)
+	for _, m := range mounts {
+		if m.point != "/" && path != m.point && !strings.HasPrefix(path, m.point+"/") {
+			continue
+		}
+		if !ok || len(m.point) >= len(found.point) {
+			found, ok = m, true
+		}
+	}
+	return found, ok
+}
+
+// checkReportShare makes sure dir is on share, rather than the page quietly landing on the local disk underneath an unmounted share
+func checkReportShare(mounts []mount, dir, share string) error {
+	m, ok := mountOf(mounts, dir)
+	if !ok || !slices.Contains(shareFilesystems, m.fstype) {
+		return fmt.Errorf("report share %s isn't mounted at %s", share, dir)
+	}
+	// mount.cifs records the share with forward slashes however it was written in fstab
+	if !strings.EqualFold(strings.ReplaceAll(m.source, `\`, "/"), strings.ReplaceAll(share, `\`, "/")) {
+		return fmt.Errorf("%s is on %s, not the report share %s", dir, m.source, share)
+	}
+	return nil
+}
+
+// trackReportShare runs checkReportShare against this machine's mounts, and makes sure the share can be written to
+func trackReportShare() error {
+	data, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return checkError{err}
+	}
+	if err := checkReportShare(parseMounts(string(data)), reportDir, reportShare); err != nil {
+		return err
+	}
+	// a share whose server went away hangs rather than failing
+	if err := withTimeout(stateMirrorTimeout, func() error { return checkWritable(reportDir) }); err != nil {
+		return fmt.Errorf("report share %s can't be written to: %w", reportShare, err)
+	}
+	return nil
+}
+
+var healthPageTemplate = template.Must(template.New("health").Funcs(template.FuncMap{
+	"when": func(t time.Time) string { return t.Local().Format("Monday Jan 2, 3:04 PM") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Host}} health</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 50em; }
+.ok { color: #1a7f37; } .warning { color: #9a6700; } .critical { color: #cf222e; }
+table { border-collapse: collapse; } td, th { padding: 0.2em 1em 0.2em 0; text-align: left; }
+</style>
+</head>
+<body>
+<h1 class="{{.Overall}}">{{.Host}}: {{if eq .Overall "ok"}}everything is fine{{else if eq .Overall "warning"}}a minor problem, nothing needs to be done right now{{else}}needs attention, please leave it on and don't unplug anything{{end}}</h1>
+<p>Checked {{when .Status.Time}}. <span id="stale" class="critical" hidden>That was a while ago, the checks may have stopped running.</span></p>
+<script>if (Date.now() - {{.Status.Time.UnixMilli}} > {{.StaleAfter}}) document.getElementById("stale").hidden = false</script>
+<h2>Pools</h2>
+<table>
+{{range .Status.Pools}}<tr><td>{{.Name}}</td><td class="{{if .Healthy}}ok{{else}}critical{{end}}">{{.Summary}}</td><td>{{if .Full}}{{printf "%.0f" .Full}}% full{{end}}</td></tr>
+{{end}}</table>
+{{with .Problems}}<h2>Problems</h2>
+<ul>
+{{range .}}<li class="{{.Severity}}">{{.Name}}: {{.Message}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+// healthPage renders st as a page simple enough to open from a share on any computer or phone
+func healthPage(st runStatus, host string) (string, error) {
+	page := struct {
+		Host       string
+		Status     runStatus
+		StaleAfter int64  // milliseconds, since the page is only rewritten when a run finishes
+		Overall    string // ok, warning, or critical
+		Problems   []checkStatus
+	}{Host: host, Status: st, StaleAfter: statusStaleAfter.Milliseconds(), Overall: "ok"}
+
+	for _, c := range st.Checks {
+		if c.Result != "failed" && c.Result != "errored" {
+			continue
+		}
+		page.Problems = append(page.Problems, c)
+		if page.Overall != "critical" {
+			page.Overall = c.Severity
+		}
+	}
+	for _, p := range st.Pools {
+		if !p.Healthy {
+			page.Overall = "critical"
+		}
+	}
+
+	var b bytes.Buffer
+	err := healthPageTemplate.Execute(&b, page)
+	return b.String(), err
+}
+
+// writeReport writes the health page and a copy of the status file to reportDir
+func writeReport(dir string, st runStatus) error {
+	page, err := healthPage(st, hostname())
+	if err != nil {
+		return err
+	}
+	return withTimeout(stateMirrorTimeout, func() error {
+		path := filepath.Join(dir, "health.html")
+		if err := writeStateFile(path, []byte(page)); err != nil {
+			return err
+		}
+		if err := os.Chmod(path, 0o644); err != nil {
+			return err
+		}
+		return writeStatus(filepath.Join(dir, "status.json"), st)
+	})
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const procMounts = `/dev/sda2 / ext4 rw,relatime 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+primarySafe /mnt/primarySafe zfs rw,xattr,noacl 0 0
+//nas/family /mnt/family cifs rw,relatime,vers=3.1.1,username=heartbeat 0 0
+//nas/family\040photos /mnt/family\040photos cifs rw,relatime 0 0
+`
+
+func Test_parseMounts(t *testing.T) {
+	t.Parallel()
+
+	mounts := parseMounts(procMounts)
+	require.Len(t, mounts, 5)
+	assert.Equal(t, mount{source: "//nas/family photos", point: "/mnt/family photos", fstype: "cifs"}, mounts[4])
+}
+
+func Test_checkReportShare(t *testing.T) {
+	t.Parallel()
+
+	mounts := parseMounts(procMounts)
+	tests := []struct {
+		dir, share string
+		want       string
+	}{
+		{"/mnt/family/heartbeat", "//nas/family", ""},
+		{"/mnt/family/heartbeat", `\\NAS\family`, ""},
+		{"/mnt/family photos/heartbeat", "//nas/family photos", ""},
+		{"/mnt/family/heartbeat", "//nas/public", "/mnt/family/heartbeat is on //nas/family, not the report share //nas/public"},
+		{"/mnt/familyReport", "//nas/family", "report share //nas/family isn't mounted at /mnt/familyReport"},
+		{"/mnt/primarySafe/report", "//nas/family", "report share //nas/family isn't mounted at /mnt/primarySafe/report"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dir, func(t *testing.T) {
+			err := checkReportShare(mounts, tt.dir, tt.share)
+			if tt.want == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_healthPage(t *testing.T) {
+	t.Parallel()
+
+	st := runStatus{
+		Time: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Pools: []poolStatus{
+			{Name: "primarySafe", State: stateOnline, Healthy: true, Summary: "ONLINE, 6 disks healthy", Full: 61.5},
+		},
+		Checks: []checkStatus{
+			{Name: "pool status", Result: "ok"},
+			{Name: "disk usage", Result: "failed", Severity: "warning", Message: "primarySafe/<media> has 10G free"},
+		},
+	}
+	page, err := healthPage(st, "nas")
+	require.NoError(t, err)
+	assert.Contains(t, page, `<h1 class="warning">nas: a minor problem, nothing needs to be done right now</h1>`)
+	assert.Contains(t, page, "Checked Friday Mar 1, 12:00 PM.")
+	assert.Contains(t, page, `<tr><td>primarySafe</td><td class="ok">ONLINE, 6 disks healthy</td><td>62% full</td></tr>`)
+	assert.Contains(t, page, `<li class="warning">disk usage: primarySafe/&lt;media&gt; has 10G free</li>`)
+	assert.Contains(t, page, "if (Date.now() -  1709294400000  >  7200000 )")
+
+	st.Pools[0].Healthy = false
+	page, err = healthPage(st, "nas")
+	require.NoError(t, err)
+	assert.Contains(t, page, `<h1 class="critical">nas: needs attention`)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// verifyRestore reads the sentinel files back out of the newest snapshot of restoreDataset, returning a summary for the heartbeat. The snapshot is read through the dataset's .zfs/snapshot directory, which zfs mounts read only on access, so nothing needs to be cloned or cleaned up.
+func verifyRestore(e executer) (string, error) {
+	mountpoint, err := e("zfs", "get", "-H", "-o", "value", "mountpoint", restoreDataset)
+	if err != nil {
+		return "", checkError{err}
+	}
+	mountpoint = strings.TrimSpace(mountpoint)
+	if !filepath.IsAbs(mountpoint) {
+		return "", checkError{fmt.Errorf("%s isn't mounted (mountpoint %s), so its snapshots can't be read", restoreDataset, mountpoint)}
+	}
+
+	out, err := e("zfs", "list", "-H", "-t", "snapshot", "-o", "name", "-s", "creation", "-d", "1", restoreDataset)
+	if err != nil {
+		return "", checkError{err}
+	}
+	snapshots := strings.Fields(out)
+	if len(snapshots) == 0 {
+		return "", fmt.Errorf("%s has no snapshots to restore from", restoreDataset)
+	}
+	latest := snapshots[len(snapshots)-1]
+	_, snapName, _ := strings.Cut(latest, "@")
+
+	if err := verifySentinels(filepath.Join(mountpoint, ".zfs", "snapshot", snapName), restoreSentinels); err != nil {
+		return "", fmt.Errorf("restore from %s failed: %w", latest, err)
+	}
+	return fmt.Sprintf("%s: %d files verified", latest, len(restoreSentinels)), nil
+}
+
+// verifySentinels checks each file exists under dir, and matches its sha256 if one is given
+func verifySentinels(dir string, sentinels map[string]string) error {
+	paths := make([]string, 0, len(sentinels))
+	for path := range sentinels {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	var errs []error
+	for _, path := range paths {
+		sum, err := sha256File(filepath.Join(dir, path))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if want := sentinels[path]; want != "" && !strings.EqualFold(sum, want) {
+			errs = append(errs, fmt.Errorf("%s has sha256 %s, expected %s", path, sum, want))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
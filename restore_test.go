@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifySentinels(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "docs", "sentinel.txt"), []byte("hello\n"), 0o644))
+
+	const helloSum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	assert.NoError(t, verifySentinels(dir, map[string]string{"docs/sentinel.txt": helloSum}))
+	assert.NoError(t, verifySentinels(dir, map[string]string{"docs/sentinel.txt": ""}), "no checksum only checks the file exists")
+	assert.EqualError(t, verifySentinels(dir, map[string]string{"docs/sentinel.txt": "00"}), "docs/sentinel.txt has sha256 "+helloSum+", expected 00")
+	assert.ErrorIs(t, verifySentinels(dir, map[string]string{"missing.txt": ""}), os.ErrNotExist)
+}
+
+func Test_verifyRestore(t *testing.T) {
+	t.Parallel()
+
+	mountpoint := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(mountpoint, ".zfs", "snapshot", "autosnap_2024-04-06_12:00:01_hourly"), 0o755))
+	e := func(cmd string, args ...string) (string, error) {
+		if args[0] == "get" {
+			return mountpoint + "\n", nil
+		}
+		return "backup/home@autosnap_2024-04-06_11:00:01_hourly\nbackup/home@autosnap_2024-04-06_12:00:01_hourly\n", nil
+	}
+
+	summary, err := verifyRestore(e)
+	require.NoError(t, err)
+	assert.Equal(t, "backup/home@autosnap_2024-04-06_12:00:01_hourly: 0 files verified", summary)
+
+	e = func(cmd string, args ...string) (string, error) {
+		return "none\n", nil
+	}
+	_, err = verifyRestore(e)
+	assert.ErrorAs(t, err, new(checkError))
+}
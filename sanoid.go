@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snapshotPeriods are the snapshot frequencies sanoid understands, and how often each is taken
+var snapshotPeriods = map[string]time.Duration{
+	"frequently": 15 * time.Minute,
+	"hourly":     time.Hour,
+	"daily":      24 * time.Hour,
+	"weekly":     7 * 24 * time.Hour,
+	"monthly":    31 * 24 * time.Hour,
+	"yearly":     366 * 24 * time.Hour,
+}
+
+// sanoidDefaults are the retention values sanoid uses when neither the dataset nor its template set them
+var sanoidDefaults = map[string]int{"frequently": 0, "hourly": 48, "daily": 90, "weekly": 0, "monthly": 6, "yearly": 0}
+
+// retention is how many snapshots of each period a dataset promises to keep
+type retention struct {
+	Keep      map[string]int // by period, eg "daily"
+	Recursive bool           // the policy also covers every child dataset
+}
+
+// parseSanoid reads the retention policy of each dataset in a sanoid.conf
+func parseSanoid(r io.Reader) (map[string]retention, error) {
+	sections := make(map[string]map[string]string)
+	var section map[string]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = make(map[string]string)
+			sections[line[1:len(line)-1]] = section
+		case section == nil:
+			return nil, fmt.Errorf("sanoid.conf: setting outside a section: %q", line)
+		default:
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("sanoid.conf: can't parse %q", line)
+			}
+			section[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]retention)
+	for name, settings := range sections {
+		if strings.HasPrefix(name, "template_") {
+			continue
+		}
+		// later sources win: sanoid's defaults, then each template in order, then the dataset itself
+		merged := make(map[string]string)
+		for period, keep := range sanoidDefaults {
+			merged[period] = strconv.Itoa(keep)
+		}
+		for _, template := range strings.Split(settings["use_template"], ",") {
+			if template = strings.TrimSpace(template); template != "" {
+				for k, v := range sections["template_"+template] {
+					merged[k] = v
+				}
+			}
+		}
+		for k, v := range settings {
+			merged[k] = v
+		}
+
+		r := retention{Keep: make(map[string]int), Recursive: merged["recursive"] == "yes" || merged["recursive"] == "zfs"}
+		for period := range snapshotPeriods {
+			keep, err := strconv.Atoi(merged[period])
+			if err != nil {
+				return nil, fmt.Errorf("sanoid.conf: [%s] %s: %w", name, period, err)
+			}
+			r.Keep[period] = keep
+		}
+		policies[name] = r
+	}
+	return policies, nil
+}
+
+var sanoidSnapshotRe = regexp.MustCompile(`@autosnap_.*_(frequently|hourly|daily|weekly|monthly|yearly)$`)
+
+// parseSnapshots reads the newest sanoid snapshot of each period for every dataset from zfs list -H -p -t filesystem,volume,snapshot -o name,creation
+func parseSnapshots(out string) (datasets []string, newest map[string]map[string]time.Time, err error) {
+	newest = make(map[string]map[string]time.Time)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		name, creation, ok := strings.Cut(line, "\t")
+		if !ok {
+			return nil, nil, fmt.Errorf("unexpected zfs list output: %q", line)
+		}
+		dataset, _, isSnapshot := strings.Cut(name, "@")
+		if !isSnapshot {
+			datasets = append(datasets, dataset)
+			continue
+		}
+
+		matches := sanoidSnapshotRe.FindStringSubmatch(name)
+		if matches == nil {
+			continue // not one of sanoid's, eg a syncoid or manual snapshot
+		}
+		seconds, err := strconv.ParseInt(creation, 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		created := time.Unix(seconds, 0)
+		if newest[dataset] == nil {
+			newest[dataset] = make(map[string]time.Time)
+		}
+		if created.After(newest[dataset][matches[1]]) {
+			newest[dataset][matches[1]] = created
+		}
+	}
+	return datasets, newest, nil
+}
+
+// checkSnapshotPolicy finds datasets missing the snapshots their policy promises. A snapshot is missing if the newest one of a period is more than two periods old.
+func checkSnapshotPolicy(policies map[string]retention, datasets []string, newest map[string]map[string]time.Time, now time.Time) error {
+	var errs []error
+	for _, dataset := range datasets {
+		policy, ok := policyFor(policies, dataset)
+		if !ok {
+			continue
+		}
+
+		periods := make([]string, 0, len(policy.Keep))
+		for period := range policy.Keep {
+			periods = append(periods, period)
+		}
+		slices.SortFunc(periods, func(a, b string) int { return cmp.Compare(snapshotPeriods[a], snapshotPeriods[b]) })
+
+		for _, period := range periods {
+			if policy.Keep[period] == 0 {
+				continue
+			}
+			last, ok := newest[dataset][period]
+			switch {
+			case !ok:
+				errs = append(errs, fmt.Errorf("%s has no %s snapshots", dataset, period))
+			case now.Sub(last) > 2*snapshotPeriods[period]:
+				errs = append(errs, fmt.Errorf("%s hasn't had a %s snapshot since %s", dataset, period, last.Format("Jan 2 15:04")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// policyFor finds the policy covering dataset, either its own or a recursive policy on a parent
+func policyFor(policies map[string]retention, dataset string) (retention, bool) {
+	if r, ok := policies[dataset]; ok {
+		return r, true
+	}
+	for parent := dataset; strings.Contains(parent, "/"); {
+		parent = parent[:strings.LastIndex(parent, "/")]
+		if r, ok := policies[parent]; ok {
+			return r, r.Recursive
+		}
+	}
+	return retention{}, false
+}
+
+// loadSnapshotPolicy combines sanoidConf, if it exists, with snapshotPolicy
+func loadSnapshotPolicy() (map[string]retention, error) {
+	policies := make(map[string]retention)
+	if f, err := os.Open(sanoidConf); err == nil {
+		policies, err = parseSanoid(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	for dataset, r := range snapshotPolicy {
+		policies[dataset] = r
+	}
+	return policies, nil
+}
+
+// checkSnapshots verifies every dataset with a snapshot policy has the snapshots it promises
+func checkSnapshots(e executer) error {
+	policies, err := loadSnapshotPolicy()
+	if err != nil {
+		return checkError{err}
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	out, err := e("zfs", "list", "-H", "-p", "-t", "filesystem,volume,snapshot", "-o", "name,creation")
+	if err != nil {
+		return checkError{err}
+	}
+	datasets, newest, err := parseSnapshots(out)
+	if err != nil {
+		return checkError{err}
+	}
+	return checkSnapshotPolicy(policies, datasets, newest, time.Now())
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSanoid(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("testFiles/sanoid.conf")
+	require.NoError(t, err)
+	defer f.Close()
+
+	policies, err := parseSanoid(f)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]retention{
+		"primarySafe/home":  {Keep: map[string]int{"frequently": 0, "hourly": 36, "daily": 30, "weekly": 0, "monthly": 3, "yearly": 0}, Recursive: true},
+		"primarySafe/media": {Keep: map[string]int{"frequently": 0, "hourly": 0, "daily": 30, "weekly": 0, "monthly": 3, "yearly": 0}},
+		"backup/home":       {Keep: map[string]int{"frequently": 0, "hourly": 0, "daily": 90, "weekly": 0, "monthly": 12, "yearly": 0}},
+	}, policies)
+}
+
+func Test_checkSnapshotPolicy(t *testing.T) {
+	t.Parallel()
+
+	f, err := os.Open("testFiles/sanoid.conf")
+	require.NoError(t, err)
+	defer f.Close()
+	policies, err := parseSanoid(f)
+	require.NoError(t, err)
+
+	now := time.Date(2024, time.April, 6, 12, 30, 0, 0, time.UTC)
+	snapshot := func(name string, age time.Duration) string {
+		return fmt.Sprintf("%s\t%d", name, now.Add(-age).Unix())
+	}
+	out := strings.Join([]string{
+		"primarySafe\t1600000000",
+		"primarySafe/home\t1600000000",
+		snapshot("primarySafe/home@autosnap_2024-04-06_12:00:01_hourly", 30*time.Minute),
+		snapshot("primarySafe/home@autosnap_2024-04-06_00:00:01_daily", 12*time.Hour),
+		snapshot("primarySafe/home@autosnap_2024-04-01_00:00:01_monthly", 5*24*time.Hour),
+		"primarySafe/home/marks\t1600000000",
+		snapshot("primarySafe/home/marks@autosnap_2024-04-06_12:00:01_hourly", 30*time.Minute),
+		snapshot("primarySafe/home/marks@autosnap_2024-03-15_00:00:01_daily", 22*24*time.Hour),
+		snapshot("primarySafe/home/marks@autosnap_2024-03-01_00:00:01_monthly", 36*24*time.Hour),
+		snapshot("primarySafe/home/marks@syncoid_nas_2024-04-06:12:00:00", 30*time.Minute),
+		"primarySafe/media\t1600000000",
+		snapshot("primarySafe/media@autosnap_2024-04-06_00:00:01_daily", 12*time.Hour),
+		"primarySafe/scratch\t1600000000",
+	}, "\n")
+
+	datasets, newest, err := parseSnapshots(out)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"primarySafe", "primarySafe/home", "primarySafe/home/marks", "primarySafe/media", "primarySafe/scratch"}, datasets)
+
+	err = checkSnapshotPolicy(policies, datasets, newest, now)
+	assert.EqualError(t, err, "primarySafe/home/marks hasn't had a daily snapshot since Mar 15 12:30\nprimarySafe/media has no monthly snapshots")
+}
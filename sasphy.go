@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const sasPhyPath = "/sys/class/sas_phy"
+
+// the link error counters each SAS phy exposes. Bad cables and backplane slots show up here hours before ZFS sees checksum errors.
+var sasPhyCounters = []string{"invalid_dword_count", "running_disparity_error_count", "loss_of_dword_sync_count", "phy_reset_problem_count"}
+
+// readLinkErrors reads the error counters of every SAS phy under root, keyed by phy/counter. A system without SAS phys has none.
+func readLinkErrors(root string) (map[string]uint64, error) {
+	phys, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, checkError{err}
+	}
+
+	counts := make(map[string]uint64)
+	for _, phy := range phys {
+		for _, counter := range sasPhyCounters {
+			data, err := os.ReadFile(filepath.Join(root, phy.Name(), counter))
+			if err != nil {
+				// not every driver implements every counter
+				continue
+			}
+			n, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				return nil, checkError{fmt.Errorf("%s %s: %w", phy.Name(), counter, err)}
+			}
+			counts[phy.Name()+"/"+counter] = n
+		}
+	}
+	return counts, nil
+}
+
+// checkLinkErrors warns about every counter that has grown since the last run, recording the counts in s
+func checkLinkErrors(s *state, counts map[string]uint64) error {
+	var errs []error
+	for _, key := range grownCounters(s.LinkErrors, counts) {
+		phy, counter, _ := strings.Cut(key, "/")
+		errs = append(errs, fmt.Errorf("SAS link errors on %s: %s rose from %d to %d", phy, counter, s.LinkErrors[key], counts[key]))
+	}
+	s.LinkErrors = counts
+
+	return errors.Join(errs...)
+}
+
+// grownCounters lists the keys, in order, whose count is higher than last time.
+// Counters start over when the host reboots, so a lower count just becomes the new baseline.
+func grownCounters(last, counts map[string]uint64) []string {
+	var grown []string
+	for key, n := range counts {
+		if prev, ok := last[key]; ok && n > prev {
+			grown = append(grown, key)
+		}
+	}
+	sort.Strings(grown)
+	return grown
+}
+
+// trackLinkErrors runs checkLinkErrors against the state file
+func trackLinkErrors() error {
+	counts, err := readLinkErrors(sasPhyPath)
+	if err != nil {
+		return err
+	}
+
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkLinkErrors(&s, counts)
+	saveState(s)
+	return err
+}
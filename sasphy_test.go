@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readLinkErrors(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "phy-0:0"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "phy-0:0", "invalid_dword_count"), []byte("17\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "phy-0:0", "loss_of_dword_sync_count"), []byte("2\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "phy-0:0", "sas_address"), []byte("0x500605b0000272b8\n"), 0o644))
+
+	counts, err := readLinkErrors(root)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]uint64{"phy-0:0/invalid_dword_count": 17, "phy-0:0/loss_of_dword_sync_count": 2}, counts)
+
+	counts, err = readLinkErrors(filepath.Join(root, "missing"))
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func Test_checkLinkErrors(t *testing.T) {
+	t.Parallel()
+
+	var s state
+	require.NoError(t, checkLinkErrors(&s, map[string]uint64{"phy-0:0/invalid_dword_count": 3, "phy-0:1/invalid_dword_count": 0}))
+	require.NoError(t, checkLinkErrors(&s, map[string]uint64{"phy-0:0/invalid_dword_count": 3, "phy-0:1/invalid_dword_count": 0}))
+
+	err := checkLinkErrors(&s, map[string]uint64{"phy-0:0/invalid_dword_count": 17, "phy-0:1/invalid_dword_count": 0})
+	assert.EqualError(t, err, "SAS link errors on phy-0:0: invalid_dword_count rose from 3 to 17")
+
+	// a reboot resets the counters
+	require.NoError(t, checkLinkErrors(&s, map[string]uint64{"phy-0:0/invalid_dword_count": 0, "phy-0:1/invalid_dword_count": 0}))
+	assert.Equal(t, uint64(0), s.LinkErrors["phy-0:0/invalid_dword_count"])
+}
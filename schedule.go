@@ -0,0 +1,331 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	osuser "os/user"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const systemdUnitDir = "/etc/systemd/system"
+const cronDir = "/etc/cron.d"
+
+// scheduleEnvDir holds the HEARTBEAT_ settings of scheduled jobs, readable only by their owner since they include notifier tokens
+const scheduleEnvDir = "/etc/zfs-heartbeat"
+
+// scheduleEnv is the environment the scheduled job runs with. zfs and smartctl are in sbin, which cron leaves out of PATH.
+const scheduleEnv = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// cronField is one field of a cron expression, with the range its numbers must be in
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+// weekdays are systemd's names for cron's days of the week, where both 0 and 7 are Sunday
+var weekdays = []string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+
+// errCalendarUnsupported is for cron expressions that are fine for cron, but have no systemd equivalent
+var errCalendarUnsupported = errors.New("isn't supported by systemd")
+
+// onCalendar converts a cron expression (minute hour day-of-month month day-of-week, with *, */step, lists, and ranges) to a systemd OnCalendar time
+func onCalendar(expr string) (string, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return "", fmt.Errorf("%q should have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+	// cron runs when either day matches if both are restricted, where systemd needs both to match
+	if fields[2] != "*" && fields[4] != "*" {
+		return "", fmt.Errorf("restricting both the day of the month and the day of the week %w", errCalendarUnsupported)
+	}
+
+	converted := make([]string, len(fields))
+	for i, field := range fields {
+		f := cronFields[i]
+		if field == "*" {
+			converted[i] = "*"
+			continue
+		}
+		var parts []string
+		for _, part := range strings.Split(field, ",") {
+			value, step, hasStep := strings.Cut(part, "/")
+			if hasStep {
+				if n, err := strconv.Atoi(step); err != nil || n < 1 {
+					return "", fmt.Errorf("%s step %q isn't a positive number", f.name, step)
+				}
+			}
+			lo, hi, isRange := strings.Cut(value, "-")
+			numbers := []string{lo}
+			if isRange {
+				numbers = append(numbers, hi)
+			}
+			for _, n := range numbers {
+				if n == "*" && !isRange {
+					continue
+				}
+				if v, err := strconv.Atoi(n); err != nil || v < f.min || v > f.max {
+					return "", fmt.Errorf("%s %q isn't between %d and %d", f.name, n, f.min, f.max)
+				}
+			}
+
+			if f.name == "day of week" {
+				if hasStep {
+					return "", fmt.Errorf("day of week step %q %w, list the days instead", part, errCalendarUnsupported)
+				}
+				lo = weekdays[mustAtoi(lo)]
+				if isRange {
+					hi = weekdays[mustAtoi(hi)]
+				}
+			}
+			switch {
+			case value == "*" && hasStep:
+				part = strconv.Itoa(f.min) + "/" + step
+			case isRange && hasStep:
+				// systemd can't step through a range, so list its values
+				n, _ := strconv.Atoi(step)
+				var values []string
+				for v := mustAtoi(lo); v <= mustAtoi(hi); v += n {
+					values = append(values, strconv.Itoa(v))
+				}
+				part = strings.Join(values, ",")
+			case isRange:
+				part = lo + ".." + hi
+			case hasStep:
+				part = lo + "/" + step
+			default:
+				part = lo
+			}
+			parts = append(parts, part)
+		}
+		converted[i] = strings.Join(parts, ",")
+	}
+
+	calendar := fmt.Sprintf("*-%s-%s %s:%s:00", converted[3], converted[2], converted[1], converted[0])
+	if fields[4] != "*" {
+		calendar = converted[4] + " " + calendar
+	}
+	return calendar, nil
+}
+
+func mustAtoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// unitName is the name of the systemd units or cron file for an instance, or the local machine
+func unitName(instance string) string {
+	if instance == "" {
+		return "zfs-heartbeat"
+	}
+	return "zfs-heartbeat-" + instance
+}
+
+// systemdQuote quotes s for a unit file, where % starts a specifier and $ an environment variable
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if strings.ContainsAny(s, " \t\"\\'") {
+		s = strconv.Quote(s)
+	}
+	return s
+}
+
+// envFile is the file of settings scheduled jobs read their HEARTBEAT_ settings from
+func envFile(name string) string {
+	return filepath.Join(scheduleEnvDir, name+".env")
+}
+
+// envFileContents is settings, one NAME=value per line quoted the way both sh and systemd read it
+func envFileContents(settings []string) string {
+	var b strings.Builder
+	b.WriteString("# generated by heartbeat install -schedule\n")
+	for _, e := range settings {
+		key, value, _ := strings.Cut(e, "=")
+		fmt.Fprintf(&b, "%s=%s\n", key, shellQuote(value))
+	}
+	return b.String()
+}
+
+// systemdUnits writes a oneshot service running command as username, and a timer starting it on calendar. env is an EnvironmentFile to read, if any.
+func systemdUnits(name, description, calendar, username string, command []string, env string) (service, timer string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# generated by heartbeat install -schedule\n[Unit]\nDescription=%s\nWants=network-online.target\nAfter=network-online.target zfs.target\n\n", description)
+	b.WriteString("[Service]\nType=oneshot\n")
+	if username != "" {
+		fmt.Fprintf(&b, "User=%s\n", username)
+	}
+	fmt.Fprintf(&b, "Environment=%s\n", systemdQuote(scheduleEnv))
+	if env != "" {
+		fmt.Fprintf(&b, "EnvironmentFile=%s\n", systemdQuote(env))
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = systemdQuote(arg)
+	}
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	service = b.String()
+
+	timer = fmt.Sprintf("# generated by heartbeat install -schedule\n[Unit]\nDescription=%s on a schedule\n\n[Timer]\nOnCalendar=%s\nPersistent=true\n\n[Install]\nWantedBy=timers.target\n", description, calendar)
+	return service, timer
+}
+
+// crontab is a cron.d file running command as username on schedule. env is a file of settings to read first, if any.
+func crontab(schedule, username string, command []string, env string) string {
+	if username == "" {
+		username = "root"
+	}
+	quoted := make([]string, len(command))
+	for i, arg := range command {
+		quoted[i] = shellQuote(arg)
+	}
+	line := "exec " + strings.Join(quoted, " ")
+	if env != "" {
+		line = fmt.Sprintf("set -a; . %s; set +a; %s", shellQuote(env), line)
+	}
+	var b strings.Builder
+	b.WriteString("# generated by heartbeat install -schedule\n")
+	b.WriteString(scheduleEnv + "\n")
+	// cron turns % into a newline
+	fmt.Fprintf(&b, "%s %s %s\n", strings.Join(strings.Fields(schedule), " "), username, strings.ReplaceAll(line, "%", `\%`))
+	return b.String()
+}
+
+// scheduleSettings are the HEARTBEAT_ settings in environ, so the job runs with the settings it was installed with
+func scheduleSettings(environ []string) []string {
+	var settings []string
+	for _, e := range environ {
+		if strings.HasPrefix(e, envPrefix) {
+			settings = append(settings, e)
+		}
+	}
+	sort.Strings(settings)
+	return settings
+}
+
+// installSchedule is install -schedule: it has systemd (or cron, without systemd) run heartbeat on a cron schedule, printing the files instead if we aren't root
+func installSchedule(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("install", flag.ContinueOnError)
+	flags.SetOutput(w)
+	schedule := flags.String("schedule", "", `when to run, as a cron expression, eg "*/10 * * * *"`)
+	username := flags.String("user", "", "run as this user rather than root, with sudoHelper set (see install sudoers)")
+	target := flags.String("instance", "", "run this instance from instances")
+	useCron := flags.Bool("cron", false, "use cron even if systemd is running")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *schedule == "" || flags.NArg() > 0 {
+		return errors.New(`usage: heartbeat install -schedule "*/10 * * * *" [-user name] [-instance name] [-cron]`)
+	}
+	if *target != "" && !slices.ContainsFunc(instances, func(in instance) bool { return in.Name == *target }) {
+		return fmt.Errorf("no instance named %s", *target)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	command := []string{self}
+	description := "ZFS heartbeat"
+	if *target != "" {
+		command = append(command, "instance", *target)
+		description += " for " + *target
+	}
+	name := unitName(*target)
+
+	files := make(map[string]string)
+	var env string
+	if settings := scheduleSettings(os.Environ()); len(settings) > 0 {
+		env = envFile(name)
+		files[env] = envFileContents(settings)
+	}
+	_, err = os.Stat("/run/systemd/system")
+	systemd := err == nil && !*useCron
+	if systemd {
+		calendar, err := onCalendar(*schedule)
+		if err != nil {
+			return fmt.Errorf("%w, use -cron to schedule it with cron instead", err)
+		}
+		service, timer := systemdUnits(name, description, calendar, *username, command, env)
+		files[filepath.Join(systemdUnitDir, name+".service")] = service
+		files[filepath.Join(systemdUnitDir, name+".timer")] = timer
+	} else {
+		if _, err := onCalendar(*schedule); err != nil && !errors.Is(err, errCalendarUnsupported) {
+			return err
+		}
+		files[filepath.Join(cronDir, name)] = crontab(*schedule, *username, command, env)
+	}
+
+	paths := sortedKeys(files)
+	if os.Geteuid() != 0 {
+		fmt.Fprintln(w, "not running as root, write these files as root:")
+		for _, path := range paths {
+			if path == env {
+				fmt.Fprintf(w, "\n# %s (chmod 600, it has your notifier tokens)\n%s", path, files[path])
+				continue
+			}
+			fmt.Fprintf(w, "\n# %s\n%s", path, files[path])
+		}
+		if systemd {
+			fmt.Fprintf(w, "\nthen run: systemctl daemon-reload && systemctl enable --now %s.timer\n", name)
+		}
+		return nil
+	}
+
+	for _, path := range paths {
+		if err := writeStateFile(path, []byte(files[path])); err != nil {
+			return err
+		}
+		mode := os.FileMode(0o644)
+		if path == env {
+			mode = 0o600
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			return err
+		}
+		// cron reads the settings as the user it runs the job as, where systemd reads them as root
+		if path == env && !systemd && *username != "" {
+			if err := chownUser(path, *username); err != nil {
+				return err
+			}
+		}
+		fmt.Fprintln(w, "wrote "+path)
+	}
+	if systemd {
+		for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", name + ".timer"}} {
+			if out, err := exec.Command("systemctl", args...).CombinedOutput(); err != nil {
+				return fmt.Errorf("systemctl %s: %w: %s", strings.Join(args, " "), err, out)
+			}
+		}
+		fmt.Fprintf(w, "started %s.timer, see systemctl list-timers %s.timer\n", name, name)
+	}
+	return nil
+}
+
+// chownUser gives path to the named user
+func chownUser(path, username string) error {
+	u, err := osuser.Lookup(username)
+	if err != nil {
+		return err
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return err
+	}
+	return os.Chown(path, uid, gid)
+}
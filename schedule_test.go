@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_onCalendar(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		cron    string
+		want    string
+		wantErr string
+	}{
+		{"*/10 * * * *", "*-*-* *:0/10:00", ""},
+		{"0 3 * * *", "*-*-* 3:0:00", ""},
+		{"15 */6 1 * *", "*-*-1 0/6:15:00", ""},
+		{"0 8-18/4 * * 1-5", "Mon..Fri *-*-* 8,12,16:0:00", ""},
+		{"30 2 * * 0,6", "Sun,Sat *-*-* 2:30:00", ""},
+		{"0 0 1,15 1-6 *", "*-1..6-1,15 0:0:00", ""},
+		{"5/20 * * * *", "*-*-* *:5/20:00", ""},
+		{"*/10 * * *", "", `"*/10 * * *" should have 5 fields: minute hour day-of-month month day-of-week`},
+		{"60 * * * *", "", `minute "60" isn't between 0 and 59`},
+		{"*/0 * * * *", "", `minute step "0" isn't a positive number`},
+		{"0 0 1 * 1", "", "restricting both the day of the month and the day of the week isn't supported by systemd"},
+		{"0 0 * * */2", "", `day of week step "*/2" isn't supported by systemd, list the days instead`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cron, func(t *testing.T) {
+			got, err := onCalendar(tt.cron)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := onCalendar("0 0 1 * 1")
+	assert.True(t, errors.Is(err, errCalendarUnsupported))
+}
+
+func Test_systemdUnits(t *testing.T) {
+	t.Parallel()
+
+	service, timer := systemdUnits("zfs-heartbeat-offsite", "ZFS heartbeat for offsite", "*-*-* *:0/10:00", "heartbeat", []string{"/opt/zfs heartbeat/heartbeat", "instance", "offsite"}, envFile("zfs-heartbeat-offsite"))
+	assert.Equal(t, `# generated by heartbeat install -schedule
+[Unit]
+Description=ZFS heartbeat for offsite
+Wants=network-online.target
+After=network-online.target zfs.target
+
+[Service]
+Type=oneshot
+User=heartbeat
+Environment=PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+EnvironmentFile=/etc/zfs-heartbeat/zfs-heartbeat-offsite.env
+ExecStart="/opt/zfs heartbeat/heartbeat" instance offsite
+`, service)
+	assert.Equal(t, `# generated by heartbeat install -schedule
+[Unit]
+Description=ZFS heartbeat for offsite on a schedule
+
+[Timer]
+OnCalendar=*-*-* *:0/10:00
+Persistent=true
+
+[Install]
+WantedBy=timers.target
+`, timer)
+
+	service, _ = systemdUnits("zfs-heartbeat", "ZFS heartbeat", "*-*-* *:0/10:00", "", []string{"/srv/100%/$HOME/heartbeat"}, "")
+	assert.NotContains(t, service, "EnvironmentFile")
+	assert.Contains(t, service, "\nExecStart=/srv/100%%/$$HOME/heartbeat\n")
+}
+
+func Test_envFileContents(t *testing.T) {
+	t.Parallel()
+
+	settings := scheduleSettings([]string{"HOME=/root", "HEARTBEAT_STATE_PATH=/var/lib/heartbeat/state.json", "HEARTBEAT_NOTIFY_URLS=pushover://a@b discord://c/d%20e", "HEARTBEAT_INSTANCE_NAME=bob's nas"})
+	assert.Equal(t, `# generated by heartbeat install -schedule
+HEARTBEAT_INSTANCE_NAME='bob'\''s nas'
+HEARTBEAT_NOTIFY_URLS='pushover://a@b discord://c/d%20e'
+HEARTBEAT_STATE_PATH=/var/lib/heartbeat/state.json
+`, envFileContents(settings))
+}
+
+func Test_crontab(t *testing.T) {
+	t.Parallel()
+
+	got := crontab("*/10  * * * *", "", []string{"/usr/local/bin/heartbeat"}, "")
+	assert.Equal(t, "# generated by heartbeat install -schedule\nPATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin\n*/10 * * * * root exec /usr/local/bin/heartbeat\n", got)
+
+	got = crontab("0 * * * *", "heartbeat", []string{"/opt/100% heartbeat/heartbeat", "instance", "offsite"}, envFile("zfs-heartbeat-offsite"))
+	assert.Equal(t, "# generated by heartbeat install -schedule\nPATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin\n0 * * * * heartbeat set -a; . /etc/zfs-heartbeat/zfs-heartbeat-offsite.env; set +a; exec '/opt/100\\% heartbeat/heartbeat' instance offsite\n", got)
+}
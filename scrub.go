@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// scrubHistory is how many of a pool's past scrubs make up its baseline speed
+const scrubHistory = 5
+
+// scrubRecord is how fast a completed scrub ran
+type scrubRecord struct {
+	At   time.Time
+	Rate float64 // bytes per second
+}
+
+// ScrubDuration returns how long the most recent completed scrub took
+func (p pool) ScrubDuration() (time.Duration, bool) {
+	if !strings.HasPrefix(p.scanStatus, "scrub repaired") {
+		return 0, false
+	}
+	return scanDuration(p.scanStatus)
+}
+
+// scanDuration reads how long a completed scrub or resilver took from its scan status
+func scanDuration(status string) (time.Duration, bool) {
+	_, rest, _ := strings.Cut(status, " in ")
+	took, _, found := strings.Cut(rest, " with ")
+	if !found {
+		return 0, false
+	}
+
+	// older versions of zfs print "0 days 11:12:07", and before 0.8 "11h12m"
+	var days, hours, minutes, seconds int
+	if _, err := fmt.Sscanf(took, "%d days %d:%d:%d", &days, &hours, &minutes, &seconds); err != nil {
+		days = 0
+		if _, err := fmt.Sscanf(took, "%d:%d:%d", &hours, &minutes, &seconds); err != nil {
+			if _, err := fmt.Sscanf(took, "%dh%dm", &hours, &minutes); err != nil {
+				return 0, false
+			}
+		}
+	}
+	return time.Duration(days)*24*time.Hour + time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + time.Duration(seconds)*time.Second, true
+}
+
+// scanWarmup is how long a scrub or resilver runs before its speed is judged, since zfs scans metadata for a while before issuing much
+const scanWarmup = time.Hour
+
+var scanIssuedRe = regexp.MustCompile(`([\d.]+[BKMGTPE]?)(?: / \S+)? (?:issued|scanned out of)`)
+var scanResilveredRe = regexp.MustCompile(`([\d.]+[BKMGTPE]?) resilvered`)
+
+// LastResilver returns when the most recent resilver completed, how long it took, and how much it resilvered
+func (p pool) LastResilver() (at time.Time, took time.Duration, resilvered uint64, ok bool) {
+	first, _, _ := strings.Cut(p.scanStatus, "\n")
+	amount, rest, found := strings.Cut(strings.TrimPrefix(first, "resilvered "), " in ")
+	if !found || !strings.HasPrefix(first, "resilvered ") {
+		return time.Time{}, 0, 0, false
+	}
+	_, on, found := strings.Cut(rest, " errors on ")
+	if !found {
+		return time.Time{}, 0, 0, false
+	}
+	at, err := parseCommandTime(strings.TrimSpace(on))
+	if err != nil {
+		return time.Time{}, 0, 0, false
+	}
+	resilvered, err = parseSize(amount)
+	if err != nil {
+		return time.Time{}, 0, 0, false
+	}
+	took, ok = scanDuration(first)
+	return at, took, resilvered, ok
+}
+
+// scanRate returns which of a scrub or resilver p is running, when it started, and how fast it's going: bytes issued per second for a scrub, or resilvered for a resilver.
+// ok is false if neither is running, or it hasn't been running for scanWarmup.
+func (p pool) scanRate(now time.Time) (kind string, since time.Time, rate float64, ok bool) {
+	first, progress, _ := strings.Cut(p.scanStatus, "\n")
+	kind, started, found := strings.Cut(first, " in progress since ")
+	if !found || (kind != "scrub" && kind != "resilver") {
+		return "", time.Time{}, 0, false
+	}
+	since, err := parseCommandTime(strings.TrimSpace(started))
+	if err != nil || now.Sub(since) < scanWarmup {
+		return "", time.Time{}, 0, false
+	}
+
+	re := scanIssuedRe
+	if kind == "resilver" {
+		re = scanResilveredRe
+	}
+	matches := re.FindStringSubmatch(progress)
+	if matches == nil {
+		return "", time.Time{}, 0, false
+	}
+	done, err := parseSize(matches[1])
+	if err != nil {
+		return "", time.Time{}, 0, false
+	}
+	return kind, since, float64(done) / now.Sub(since).Seconds(), true
+}
+
+// recordScan adds a completed scan to its pool's history in scans, if it isn't there already
+func recordScan(scans map[string][]scrubRecord, pool string, at time.Time, rate float64) {
+	history := scans[pool]
+	if len(history) > 0 && !at.After(history[len(history)-1].At) {
+		return
+	}
+	history = append(history, scrubRecord{At: at, Rate: rate})
+	if len(history) > scrubHistory {
+		history = history[len(history)-scrubHistory:]
+	}
+	scans[pool] = history
+}
+
+// medianRate is the median speed of history
+func medianRate(history []scrubRecord) float64 {
+	rates := make([]float64, 0, len(history))
+	for _, r := range history {
+		rates = append(rates, r.Rate)
+	}
+	slices.Sort(rates)
+	return rates[len(rates)/2]
+}
+
+// checkScrubSpeed warns while a pool's scrub or resilver is running at less than (1 - slowdown) of the median speed of its previous ones, until it finishes or speeds back up.
+// Completed scrubs and resilvers are recorded in s as the baseline. A scrub's speed is the pool's used space over the scrub's duration, and a resilver's is how much it resilvered over its duration,
+// which is close enough to compare one against the next.
+func checkScrubSpeed(s *state, pools []pool, usage map[string]space, slowdown float64, now time.Time) error {
+	if s.Scrubs == nil {
+		s.Scrubs = make(map[string][]scrubRecord)
+	}
+	if s.Resilvers == nil {
+		s.Resilvers = make(map[string][]scrubRecord)
+	}
+
+	var errs []error
+	for _, p := range pools {
+		at, ok := p.LastScrub()
+		took, tookOK := p.ScrubDuration()
+		used, usedOK := usage[p.name]
+		if ok && tookOK && usedOK && took >= time.Minute {
+			recordScan(s.Scrubs, p.name, at, float64(used.used)/took.Seconds())
+		}
+		if at, took, resilvered, ok := p.LastResilver(); ok && took >= time.Minute {
+			recordScan(s.Resilvers, p.name, at, float64(resilvered)/took.Seconds())
+		}
+
+		kind, since, rate, ok := p.scanRate(now)
+		if !ok {
+			continue
+		}
+		history := s.Scrubs[p.name]
+		if kind == "resilver" {
+			history = s.Resilvers[p.name]
+		}
+		if len(history) == 0 {
+			continue
+		}
+		if median := medianRate(history); rate < median*(1-slowdown) {
+			errs = append(errs, fmt.Errorf("%s of %s running since %s is going at %s/s, well below its usual %s/s", kind, p.name, since.Format("Jan 2 15:04"), formatBytes(uint64(rate)), formatBytes(uint64(median))))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// trackScrubSpeed runs checkScrubSpeed against the state file
+func trackScrubSpeed(pools []pool, usage map[string]space) error {
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkScrubSpeed(&s, pools, usage, scrubSlowdown, time.Now())
+	saveState(s)
+	return err
+}
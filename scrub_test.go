@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_poolScrubDuration(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		scan string
+		took time.Duration
+		ok   bool
+	}{
+		{"scrub repaired 0B in 04:18:03 with 0 errors on Sun Mar 10 05:18:09 2024", 4*time.Hour + 18*time.Minute + 3*time.Second, true},
+		{"scrub repaired 0 in 0 days 11:12:07 with 0 errors on Mon Mar 26 11:12:09 2018", 11*time.Hour + 12*time.Minute + 7*time.Second, true},
+		{"scrub repaired 0B in 1 days 02:00:00 with 0 errors on Mon Mar 26 11:12:09 2018", 26 * time.Hour, true},
+		{"scrub repaired 0B in 3h12m with 0 errors on Sun Mar 10 05:18:09 2024", 3*time.Hour + 12*time.Minute, true},
+		{"scrub in progress since Sun Mar 31 18:37:01 2024", 0, false},
+		{"resilvered 1.20T in 10:00:00 with 0 errors on Sun Mar 10 05:18:09 2024", 0, false},
+	}
+
+	for _, tt := range tests {
+		took, ok := pool{scanStatus: tt.scan}.ScrubDuration()
+		assert.Equal(t, tt.ok, ok, tt.scan)
+		assert.Equal(t, tt.took, took, tt.scan)
+	}
+}
+
+func Test_poolLastResilver(t *testing.T) {
+	t.Parallel()
+
+	at, took, resilvered, ok := pool{scanStatus: "resilvered 3.61T in 09:12:44 with 0 errors on Tue Apr  2 19:14:56 2024"}.LastResilver()
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2024, 4, 2, 19, 14, 56, 0, time.Local), at)
+	assert.Equal(t, 9*time.Hour+12*time.Minute+44*time.Second, took)
+	assert.InDelta(t, 3.61*(1<<40), resilvered, 1)
+
+	_, _, _, ok = pool{scanStatus: "scrub repaired 0B in 04:18:03 with 0 errors on Sun Mar 10 05:18:09 2024"}.LastResilver()
+	assert.False(t, ok)
+}
+
+func Test_poolScanRate(t *testing.T) {
+	t.Parallel()
+
+	since := time.Date(2024, 3, 31, 10, 2, 11, 0, time.Local)
+	tests := []struct {
+		name string
+		scan string
+		now  time.Time
+		kind string
+		rate float64
+		ok   bool
+	}{
+		{"scrub", "scrub in progress since Sun Mar 31 10:02:11 2024\n2.31T scanned at 512M/s, 1.10T issued at 243M/s, 5.40T total\n0B repaired, 20.37% done, 05:09:12 to go", since.Add(2 * time.Hour), "scrub", 1.1 * (1 << 40) / 7200, true},
+		{"sequential scrub", "scrub in progress since Sun Mar 31 10:02:11 2024\n2.47G / 6.07T scanned at 843M/s, 0B / 6.07T issued\n0B repaired, 0.00% done, no estimated completion time", since.Add(2 * time.Hour), "scrub", 0, true},
+		{"before 0.8", "scrub in progress since Sun Mar 31 10:02:11 2024\n720G scanned out of 5.40T at 200M/s, 6h50m to go\n0 repaired, 13.02% done", since.Add(time.Hour), "scrub", 720 * (1 << 30) / 3600, true},
+		{"resilver", "resilver in progress since Sun Mar 31 10:02:11 2024\n2.31T scanned at 512M/s, 1.10T issued at 243M/s, 5.40T total\n275G resilvered, 20.37% done, 05:09:12 to go", since.Add(2 * time.Hour), "resilver", 275 * (1 << 30) / 7200, true},
+		{"warming up", "scrub in progress since Sun Mar 31 10:02:11 2024\n2.47G / 6.07T scanned at 843M/s, 0B / 6.07T issued\n0B repaired, 0.00% done, no estimated completion time", since.Add(10 * time.Minute), "", 0, false},
+		{"finished", "scrub repaired 0B in 04:18:03 with 0 errors on Sun Mar 10 05:18:09 2024", since.Add(2 * time.Hour), "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, _, rate, ok := pool{scanStatus: tt.scan}.scanRate(tt.now)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.kind, kind)
+			assert.InDelta(t, tt.rate, rate, 1)
+		})
+	}
+}
+
+func Test_checkScrubSpeed(t *testing.T) {
+	t.Parallel()
+
+	usage := map[string]space{"primarySafe": {used: 4 << 40}}
+	scan := func(status string) []pool {
+		return []pool{{name: "primarySafe", scanStatus: status}}
+	}
+	scrub := func(date, took string) []pool {
+		return scan("scrub repaired 0B in " + took + " with 0 errors on " + date)
+	}
+	running := func(issued string) []pool {
+		return scan("scrub in progress since Sun Apr  7 01:00:00 2024\n3.20T scanned at 500M/s, " + issued + " issued at 100M/s, 4.00T total\n0B repaired, 20.00% done, 10:00:00 to go")
+	}
+	start := time.Date(2024, 4, 7, 1, 0, 0, 0, time.Local)
+
+	var s state
+	require.NoError(t, checkScrubSpeed(&s, scrub("Sun Mar 10 05:18:09 2024", "04:00:00"), usage, 0.5, start))
+	require.NoError(t, checkScrubSpeed(&s, scrub("Sun Mar 10 05:18:09 2024", "04:00:00"), usage, 0.5, start))
+	require.NoError(t, checkScrubSpeed(&s, scrub("Sun Mar 24 05:40:12 2024", "05:00:00"), usage, 0.5, start))
+	assert.Len(t, s.Scrubs["primarySafe"], 2)
+
+	// a slow scrub is warned about for as long as it stays slow
+	require.NoError(t, checkScrubSpeed(&s, running("10G"), usage, 0.5, start.Add(10*time.Minute)), "still warming up")
+	err := checkScrubSpeed(&s, running("360G"), usage, 0.5, start.Add(3*time.Hour))
+	assert.EqualError(t, err, "scrub of primarySafe running since Apr 7 01:00 is going at 34.13 MiB/s, well below its usual 291.27 MiB/s")
+	assert.Error(t, checkScrubSpeed(&s, running("480G"), usage, 0.5, start.Add(4*time.Hour)))
+	require.NoError(t, checkScrubSpeed(&s, running("2.80T"), usage, 0.5, start.Add(5*time.Hour)), "sped back up")
+	require.NoError(t, checkScrubSpeed(&s, scrub("Sun Apr  7 11:00:00 2024", "10:00:00"), usage, 0.5, start.Add(10*time.Hour)), "finished")
+	assert.Len(t, s.Scrubs["primarySafe"], 3)
+
+	// resilvers are compared against the pool's previous resilvers
+	require.NoError(t, checkScrubSpeed(&s, scan("resilvered 1.20T in 10:00:00 with 0 errors on Sun Mar 10 05:18:09 2024"), usage, 0.5, start))
+	assert.Len(t, s.Resilvers["primarySafe"], 1)
+	err = checkScrubSpeed(&s, scan("resilver in progress since Sun Apr  7 01:00:00 2024\n1.00T scanned at 100M/s, 800G issued at 80M/s, 4.00T total\n60G resilvered, 5.00% done, 50:00:00 to go"), usage, 0.5, start.Add(5*time.Hour))
+	assert.EqualError(t, err, "resilver of primarySafe running since Apr 7 01:00 is going at 3.41 MiB/s, well below its usual 34.95 MiB/s")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// service is a storage service clients depend on
+type service struct {
+	Kind    string // nfs, smb, iscsi, or tcp
+	Address string // host for nfs; host or host:port for the rest (smb defaults to 445, iscsi to 3260)
+}
+
+var defaultServicePorts = map[string]string{"smb": "445", "iscsi": "3260"}
+
+// checkServices probes every configured service, so a dead smbd is caught even when the pool behind it is fine
+func checkServices(e executer, services []service) error {
+	var errs []error
+	for _, s := range services {
+		if err := probeService(e, s); err != nil {
+			errs = append(errs, fmt.Errorf("%s on %s is down: %w", s.Kind, s.Address, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func probeService(e executer, s service) error {
+	switch s.Kind {
+	case "nfs":
+		// asks portmap whether nfsd answers a null call, which catches nfsd being down behind a live rpcbind
+		_, err := e("rpcinfo", "-t", s.Address, "nfs")
+		return err
+	case "smb", "iscsi", "tcp":
+		address := s.Address
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			port, ok := defaultServicePorts[s.Kind]
+			if !ok {
+				return checkError{fmt.Errorf("no port in %s", address)}
+			}
+			address = net.JoinHostPort(address, port)
+		}
+		return probeTCP(address)
+	default:
+		return checkError{fmt.Errorf("unknown service kind %s", s.Kind)}
+	}
+}
+
+// probeTCP checks that something is listening at address
+func probeTCP(address string) error {
+	conn, err := net.DialTimeout("tcp", address, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkServices(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	e := func(cmd string, args ...string) (string, error) {
+		if args[1] == "nas" {
+			return "program 100003 version 3 ready and waiting\n", nil
+		}
+		return "", errors.New("rpcinfo exited with status 1: rpcinfo: RPC: Program not registered")
+	}
+
+	assert.NoError(t, checkServices(e, []service{{Kind: "smb", Address: listener.Addr().String()}, {Kind: "nfs", Address: "nas"}}))
+
+	err = checkServices(e, []service{{Kind: "iscsi", Address: closedAddress}, {Kind: "nfs", Address: "backup"}, {Kind: "afp", Address: "nas"}})
+	require.Error(t, err)
+	errs := unjoin(err)
+	require.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Error(), "iscsi on "+closedAddress+" is down: ")
+	assert.EqualError(t, errs[1], "nfs on backup is down: rpcinfo exited with status 1: rpcinfo: RPC: Program not registered")
+	assert.ErrorAs(t, errs[2], new(checkError))
+}
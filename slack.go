@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const slackAPI = "https://slack.com/api/chat.postMessage"
+
+// slack posts notifications using Block Kit via either an incoming webhook or a bot token
+type slack struct {
+	webhook string
+	token   string
+	channel string
+}
+
+// slack's block limits
+const (
+	slackMaxBlocks      = 50
+	slackMaxSectionText = 3000
+)
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+func (s slack) name() string {
+	return "slack"
+}
+
+func (s slack) send(n notification) error {
+	text := n.title + "\n" + n.message
+	err := s.post(map[string]any{"text": text, "blocks": slackBlocks(n, time.Now())})
+	if err != nil {
+		// rendering problems shouldn't cost us the alert
+		if fallbackErr := s.post(map[string]any{"text": text}); fallbackErr != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s slack) post(payload map[string]any) error {
+	if s.webhook != "" {
+		_, err := postJSON(s.webhook, payload, nil)
+		return err
+	}
+
+	payload["channel"] = s.channel
+	body, err := postJSON(slackAPI, payload, map[string]string{"Authorization": "Bearer " + s.token})
+	if err != nil {
+		return err
+	}
+	var resp struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("chat.postMessage: %s", resp.Error)
+	}
+	return nil
+}
+
+func slackBlocks(n notification, now time.Time) []slackBlock {
+	blocks := []slackBlock{{Type: "header", Text: &slackText{Type: "plain_text", Text: severityEmoji(n.severity) + " " + n.title}}}
+
+	if len(n.findings) == 0 {
+		blocks = append(blocks, slackSection(n.message))
+	}
+	for _, f := range n.findings {
+		if len(blocks) == slackMaxBlocks-2 {
+			blocks = append(blocks, slackSection("_Too many findings to list, see logs for the rest_"))
+			break
+		}
+		blocks = append(blocks, slackSection(fmt.Sprintf("%s *%s*\n```%s```", severityEmoji(f.severity), f.label(), f.message)))
+	}
+
+	blocks = append(blocks, slackBlock{Type: "context", Elements: []slackText{
+		{Type: "mrkdwn", Text: fmt.Sprintf("%s | %s", hostname(), now.Format("2006-01-02 15:04:05 MST"))},
+	}})
+	return blocks
+}
+
+func slackSection(text string) slackBlock {
+	text = truncate(text, slackMaxSectionText)
+	if strings.Count(text, "```")%2 == 1 {
+		text = truncate(text, slackMaxSectionText-3) + "```"
+	}
+	return slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}}
+}
+
+func severityEmoji(sev severity) string {
+	switch sev {
+	case severityCritical:
+		return ":rotating_light:"
+	case severityWarning:
+		return ":warning:"
+	default:
+		return ":white_check_mark:"
+	}
+}
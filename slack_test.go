@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_slackBlocks(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 31, 18, 40, 0, 0, time.UTC)
+	var d digest
+	d.add("smart selftest", severityWarning, "smart error: disk sde: Completed: read failure", "")
+
+	blocks := slackBlocks(notification{title: "Health check warnings", message: d.String(), severity: d.severity(), findings: d.findings}, now)
+	require.Len(t, blocks, 3)
+	assert.Equal(t, slackBlock{Type: "header", Text: &slackText{Type: "plain_text", Text: ":warning: Health check warnings"}}, blocks[0])
+	assert.Equal(t, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: ":warning: *smart selftest*\n```smart error: disk sde: Completed: read failure```"}}, blocks[1])
+
+	hostname, _ := os.Hostname()
+	assert.Equal(t, "context", blocks[2].Type)
+	assert.Equal(t, hostname+" | 2024-03-31 18:40:00 UTC", blocks[2].Elements[0].Text)
+}
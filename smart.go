@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// smartctl exit status bits, see EXIT STATUS in smartctl(8)
+const (
+	smartctlCommandLine      = 1 << iota // the command line did not parse
+	smartctlOpenFailed                   // the device could not be opened
+	smartctlCommandFailed                // a SMART command to the disk failed, or a checksum was wrong
+	smartctlDiskFailing                  // SMART status check returned "DISK FAILING"
+	smartctlPrefailThreshold             // prefailure attributes are at or below threshold
+	smartctlPastThreshold                // usage or prefailure attributes were at or below threshold in the past
+	smartctlErrorLog                     // the device error log contains errors
+	smartctlSelftestLog                  // the self-test log contains errors
+
+	smartctlUnreadable = smartctlCommandLine | smartctlOpenFailed | smartctlCommandFailed
+)
+
+// smartctlExit returns the status bits smartctl exited with. exited is false if err isn't from smartctl exiting on its own.
+func smartctlExit(err error) (bits int, exited bool) {
+	if err == nil {
+		return 0, true
+	}
+	var exitErr interface{ ExitCode() int }
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() < 0 {
+		return 0, false
+	}
+	return exitErr.ExitCode(), true
+}
+
+// smartError is a disk failing a SMART check, kept apart from the rest of the message so the finding can be matched with ZFS errors on the same disk
+type smartError struct {
+	disk    string // as in smartDisks, eg sda or sdg:sat
+	problem string
+}
+
+func (e smartError) Error() string {
+	return fmt.Sprintf("smart error: disk %s: %s", e.disk, e.problem)
+}
+
+// smartctlArgs appends the device for a disk in smartDisks to args. A disk behind a RAID controller or USB bridge names its smartctl device type after a colon, eg sda:megaraid,0 or sdg:sat.
+func smartctlArgs(disk string, args ...string) []string {
+	device, kind, found := strings.Cut(disk, ":")
+	if found {
+		args = append(args, "-d", kind)
+	}
+	return append(args, "/dev/"+device)
+}
+
+// drive is the identity and current condition of a physical disk, as reported by smartctl -i -A
+type drive struct {
+	Device       string
+	Model        string
+	Serial       string
+	Firmware     string
+	PowerOnHours int
+	Temperature  int // celsius, -1 if unknown
+}
+
+// readDrives reads the identity and attributes of every disk in disks
+func readDrives(e executer, disks []string) ([]drive, error) {
+	drives := make([]drive, 0, len(disks))
+	var errs []error
+	for _, disk := range disks {
+		out, err := e("/sbin/smartctl", smartctlArgs(disk, "-i", "-A")...)
+		if bits, exited := smartctlExit(err); err != nil && (!exited || bits&smartctlUnreadable != 0) {
+			errs = append(errs, checkError{fmt.Errorf("disk %s: %w", disk, err)})
+			continue
+		}
+
+		d := parseDrive(out)
+		d.Device = disk
+		if d.Serial == "" {
+			errs = append(errs, checkError{fmt.Errorf("no serial number reported for disk %s", disk)})
+			continue
+		}
+		drives = append(drives, d)
+	}
+
+	return drives, errors.Join(errs...)
+}
+
+func parseDrive(out string) drive {
+	d := drive{Temperature: -1}
+	if temp, ok := parseTemperature(out); ok {
+		d.Temperature = temp
+	}
+
+	for rest := out; rest != ""; {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		key, value, found := strings.Cut(line, ":")
+		switch {
+		case found && (key == "Device Model" || key == "Model Number"):
+			d.Model = strings.TrimSpace(value)
+		case found && key == "Serial Number":
+			d.Serial = strings.TrimSpace(value)
+		case found && key == "Firmware Version":
+			d.Firmware = strings.TrimSpace(value)
+		case found && key == "Power On Hours":
+			d.PowerOnHours = leadingInt(strings.ReplaceAll(strings.TrimSpace(value), ",", ""))
+		case strings.HasPrefix(strings.TrimLeft(line, " "), "9 "):
+			// some drives report raw power on time as eg 17520h+23m+12.345s
+			if fields := strings.Fields(line); len(fields) >= 10 {
+				d.PowerOnHours = leadingInt(fields[9])
+			}
+		}
+	}
+
+	return d
+}
+
+// parseTemperature reads the temperature out of smartctl -A output for both ATA and NVMe devices
+func parseTemperature(attrs string) (int, bool) {
+	temp := -1
+	for rest := attrs; rest != ""; {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		// only split the few lines that can hold a temperature into fields
+		trimmed := strings.TrimLeft(line, " ")
+		if !strings.HasPrefix(trimmed, "19") && !strings.HasPrefix(trimmed, "Temperature:") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) >= 10 && fields[0] == "194":
+			// Temperature_Celsius is authoritative when present
+			if t, err := strconv.Atoi(fields[9]); err == nil {
+				return t, true
+			}
+		case len(fields) >= 10 && fields[0] == "190":
+			if t, err := strconv.Atoi(fields[9]); err == nil {
+				temp = t
+			}
+		case len(fields) >= 3 && fields[0] == "Temperature:" && fields[2] == "Celsius":
+			if t, err := strconv.Atoi(fields[1]); err == nil {
+				return t, true
+			}
+		}
+	}
+
+	return temp, temp >= 0
+}
+
+func leadingInt(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	i, _ := strconv.Atoi(s[:end])
+	return i
+}
+
+// selfTestLogLine is an entry in smartctl's self-test log, eg "# 1  Short offline  Completed without error  00%  19398  -"
+type selfTestLogLine struct {
+	status    string
+	remaining string // how much of the test was left, eg 00% once it finished or 90% for one cut short
+	hours     int    // lifetime hours when it ran
+}
+
+// readSelfTestLog reads the self-test log out of smartctl output, newest first.
+// It's read by hand rather than with a regexp, which spent far longer backtracking through every line of the output than smartctl took to print it.
+func readSelfTestLog(out string) []selfTestLogLine {
+	var entries []selfTestLogLine
+	for rest := out; rest != ""; {
+		var line string
+		line, rest, _ = strings.Cut(rest, "\n")
+		num, ok := strings.CutPrefix(line, "#")
+		if !ok {
+			continue
+		}
+		num = strings.TrimLeft(num, " ")
+		if leadingInt(num) == 0 {
+			continue
+		}
+		// the description runs up to the first gap of two or more spaces, then the status up to the remaining percentage
+		_, columns, ok := strings.Cut(strings.TrimLeft(strings.TrimLeft(num, "0123456789"), " "), "  ")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(columns)
+		for i := 1; i+1 < len(fields); i++ {
+			if !strings.HasSuffix(fields[i], "%") {
+				continue
+			}
+			if hours, err := strconv.Atoi(fields[i+1]); err == nil {
+				entries = append(entries, selfTestLogLine{status: strings.Join(fields[:i], " "), remaining: fields[i], hours: hours})
+			}
+			break
+		}
+	}
+	return entries
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseDrive(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		file     string
+		expected drive
+	}{
+		{"testFiles/smartInfo.txt", drive{Model: "WDC WD60EFRX-68L0BN1", Serial: "WD-WX31D87HJ4KL", Firmware: "82.00A82", PowerOnHours: 80120, Temperature: 36}},
+		{"testFiles/smartInfoNvme.txt", drive{Model: "Samsung SSD 970 EVO Plus 500GB", Serial: "S4EVNF0M812345X", Firmware: "2B2QEXM7", PowerOnHours: 9212, Temperature: 41}},
+	}
+
+	for _, tt := range tests {
+		data, err := os.ReadFile(tt.file)
+		require.NoError(t, err)
+
+		assert.Equal(t, tt.expected, parseDrive(string(data)), tt.file)
+	}
+}
+
+func Test_parseTemperature(t *testing.T) {
+	t.Parallel()
+
+	temp, ok := parseTemperature("190 Airflow_Temperature_Cel 0x0022   062   051   045    Old_age   Always       -       38")
+	assert.True(t, ok)
+	assert.Equal(t, 38, temp)
+
+	_, ok = parseTemperature("no attributes here")
+	assert.False(t, ok)
+}
+
+func Test_smartctlArgs(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"-H", "-l", "selftest", "/dev/sdb"}, smartctlArgs("sdb", "-H", "-l", "selftest"))
+	assert.Equal(t, []string{"-i", "-A", "-d", "megaraid,3", "/dev/sda"}, smartctlArgs("sda:megaraid,3", "-i", "-A"))
+	assert.True(t, helperAllowed("/sbin/smartctl", smartctlArgs("sdg:sat", "-H", "-l", "selftest")))
+}
+
+func BenchmarkParseDrive(b *testing.B) {
+	data, err := os.ReadFile("testFiles/smartInfo.txt")
+	require.NoError(b, err)
+	out := string(data)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		parseDrive(out)
+	}
+}
+
+func Test_readSelfTestLog(t *testing.T) {
+	t.Parallel()
+
+	out := `SMART Self-test log structure revision number 1
+Num  Test_Description    Status                  Remaining  LifeTime(hours)  LBA_of_first_error
+# 1  Short offline       Self-test routine in progress 90%     19410         -
+# 2  Extended offline    Completed: read failure       90%     19398         1545737
+# 3  Short offline       Completed without error       00%     19230         -
+#10  Short offline       Aborted by host               00%     17542         -
+ID# ATTRIBUTE_NAME          FLAG     VALUE WORST THRESH TYPE      UPDATED  WHEN_FAILED RAW_VALUE
+`
+	assert.Equal(t, []selfTestLogLine{
+		{"Self-test routine in progress", "90%", 19410},
+		{"Completed: read failure", "90%", 19398},
+		{"Completed without error", "00%", 19230},
+		{"Aborted by host", "00%", 17542},
+	}, readSelfTestLog(out))
+	assert.Empty(t, readSelfTestLog("No self-tests have been logged.  [To run self-tests, use: smartctl -t]"))
+}
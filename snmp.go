@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OIDs defined in mibs/ZFS-HEARTBEAT-MIB.txt, relative to snmpBaseOID
+const (
+	snmpTrapStateChange = ".0.1"
+	snmpObjCheck        = ".1.1"
+	snmpObjPool         = ".1.2"
+	snmpObjVdev         = ".1.3"
+	snmpObjDisk         = ".1.4"
+	snmpObjSeverity     = ".1.5"
+	snmpObjMessage      = ".1.6"
+)
+
+const (
+	oidSysUpTime   = "1.3.6.1.2.1.1.3.0"
+	oidSnmpTrapOID = "1.3.6.1.6.3.1.1.4.1.0"
+)
+
+// BER tags
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berOID         = 0x06
+	berSequence    = 0x30
+	berTimeTicks   = 0x43
+	berTrapV2      = 0xa7
+)
+
+var processStart = time.Now()
+
+// sendTrap emits an SNMPv2c trap describing t to snmpTarget
+func sendTrap(t transition) error {
+	if snmpTarget == "" {
+		return nil
+	}
+
+	packet, err := trapPacket(t, uint32(time.Now().UnixNano()&0x7fffffff))
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("udp", snmpTarget, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
+
+func trapPacket(t transition, requestID uint32) ([]byte, error) {
+	type varbind struct {
+		oid   string
+		value []byte
+	}
+	uptime := uint32(time.Since(processStart) / (10 * time.Millisecond))
+	trapOID, err := berEncodeOID(snmpBaseOID + snmpTrapStateChange)
+	if err != nil {
+		return nil, err
+	}
+	binds := []varbind{
+		{oidSysUpTime, ber(berTimeTicks, berUint(uptime))},
+		{oidSnmpTrapOID, trapOID},
+		{snmpBaseOID + snmpObjCheck, berString(t.check)},
+		{snmpBaseOID + snmpObjPool, berString(t.pool)},
+		{snmpBaseOID + snmpObjVdev, berString(t.vdev)},
+		{snmpBaseOID + snmpObjDisk, berString(t.disk)},
+		{snmpBaseOID + snmpObjSeverity, ber(berInteger, berUint(uint32(t.severity)))},
+		{snmpBaseOID + snmpObjMessage, berString(t.message)},
+	}
+
+	var list bytes.Buffer
+	for _, b := range binds {
+		oid, err := berEncodeOID(b.oid)
+		if err != nil {
+			return nil, err
+		}
+		list.Write(ber(berSequence, append(oid, b.value...)))
+	}
+
+	var pdu bytes.Buffer
+	pdu.Write(ber(berInteger, berUint(requestID)))
+	pdu.Write(ber(berInteger, []byte{0})) // error-status
+	pdu.Write(ber(berInteger, []byte{0})) // error-index
+	pdu.Write(ber(berSequence, list.Bytes()))
+
+	var msg bytes.Buffer
+	msg.Write(ber(berInteger, []byte{1})) // version: SNMPv2c
+	msg.Write(berString(snmpCommunity))
+	msg.Write(ber(berTrapV2, pdu.Bytes()))
+
+	return ber(berSequence, msg.Bytes()), nil
+}
+
+// ber encodes a tag-length-value triple
+func ber(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	if len(value) < 0x80 {
+		out = append(out, byte(len(value)))
+	} else {
+		var length []byte
+		for n := len(value); n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	return append(out, value...)
+}
+
+func berString(s string) []byte {
+	return ber(berOctetString, []byte(s))
+}
+
+// berUint encodes an unsigned value as the minimal two's complement integer content
+func berUint(n uint32) []byte {
+	var out []byte
+	for {
+		out = append([]byte{byte(n)}, out...)
+		n >>= 8
+		if n == 0 {
+			break
+		}
+	}
+	if out[0]&0x80 != 0 {
+		out = append([]byte{0}, out...)
+	}
+	return out
+}
+
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(oid, "."), ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid oid %s", oid)
+	}
+	ids := make([]uint64, len(parts))
+	for i, p := range parts {
+		id, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid oid %s: %w", oid, err)
+		}
+		ids[i] = id
+	}
+
+	content := berBase128(ids[0]*40 + ids[1])
+	for _, id := range ids[2:] {
+		content = append(content, berBase128(id)...)
+	}
+	return ber(berOID, content), nil
+}
+
+func berBase128(n uint64) []byte {
+	out := []byte{byte(n & 0x7f)}
+	for n >>= 7; n > 0; n >>= 7 {
+		out = append([]byte{byte(n&0x7f) | 0x80}, out...)
+	}
+	return out
+}
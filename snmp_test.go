@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_berEncodeOID(t *testing.T) {
+	t.Parallel()
+
+	oid, err := berEncodeOID("1.3.6.1.4.1.8072.9999.9999.1.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x06, 0x0e, 0x2b, 0x06, 0x01, 0x04, 0x01, 0xbf, 0x08, 0xce, 0x0f, 0xce, 0x0f, 0x01, 0x00, 0x01}, oid)
+
+	_, err = berEncodeOID("1")
+	assert.Error(t, err)
+}
+
+func Test_ber(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []byte{0x02, 0x01, 0x00}, ber(berInteger, berUint(0)))
+	assert.Equal(t, []byte{0x02, 0x02, 0x00, 0x80}, ber(berInteger, berUint(128)))
+
+	long := ber(berOctetString, make([]byte, 300))
+	assert.Equal(t, []byte{0x04, 0x82, 0x01, 0x2c}, long[:4])
+	assert.Len(t, long, 304)
+}
+
+func Test_trapPacket(t *testing.T) {
+	t.Parallel()
+
+	packet, err := trapPacket(transition{check: "pool status", pool: "primarySafe", severity: severityCritical, message: "pool primarySafe is DEGRADED (was ONLINE)"}, 1234)
+	require.NoError(t, err)
+
+	// SEQUENCE { INTEGER 1, OCTET STRING "public", Trap-PDU ... }
+	assert.Equal(t, byte(berSequence), packet[0])
+	require.NotZero(t, packet[1]&0x80, "long form length")
+	n := int(packet[1] & 0x7f)
+	length := 0
+	for _, b := range packet[2 : 2+n] {
+		length = length<<8 | int(b)
+	}
+	assert.Equal(t, len(packet)-2-n, length)
+	assert.Equal(t, []byte{0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', berTrapV2}, packet[2+n:2+n+12])
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statePath should be on a local disk rather than a monitored pool, which may be the thing that's broken
+var statePath = "/var/lib/heartbeat/heartbeat.json"
+
+// stateMirrorPath optionally keeps a second copy of the state, eg on a pool so it survives reinstalling the OS. Blank to disable
+var stateMirrorPath = "/mnt/primarySafe/apps/heartbeat/heartbeat.json"
+
+// stateMirrorTimeout bounds reads and writes to the mirror, since I/O to a suspended pool hangs
+const stateMirrorTimeout = 10 * time.Second
+
+// state is persisted between runs
+type state struct {
+	Saved        time.Time // when this copy was written, to pick the newest of the state file and its mirror
+	LastUpdated  time.Time // when a run's problems were last alerted on, which mutes notifications for 23 hours
+	LastSeverity severity  // of that alert
+	Deferred     []deferredAlert
+	Drives       map[string]driveRecord
+	Inventory    map[string]inventoryEntry      // by device
+	Checks       map[string]bool                // whether each check passed last run
+	Pools        map[string]string              // state of each pool last run
+	Escalation   *escalation                    // unacknowledged critical alert
+	Operations   map[string]operationProgress   // by pool/kind/target
+	Compression  map[string]compressionBaseline // by dataset
+	Peers        map[string]time.Time           // when each unreachable peer was first found down
+	LinkErrors   map[string]uint64              // SAS phy error counters, by phy/counter
+	NetErrors    map[string]uint64              // network interface error counters, by interface/counter
+	KernelCursor string                         // journald cursor of the last kernel message scanned
+	Scrubs       map[string][]scrubRecord       // recent scrubs, by pool
+	Resilvers    map[string][]scrubRecord       // recent resilvers, by pool
+	Alerts       []alertRecord                  // every alert sent in the last alertHistoryAge
+	Annotated    map[string]string              // scan status last annotated in grafana, by pool
+	Replacements []replacement                  // disks being replaced, see heartbeat replace-disk
+	Acked        map[string]time.Time           // disks acknowledged with heartbeat ack, by pool/disk
+	Cleared      map[string]time.Time           // when autoClear last cleared each disk, by pool/disk
+	Health       map[string][]healthSample      // daily disk health scores, by serial
+	BurnIns      []burnIn                       // see heartbeat burnin
+	Limits       map[string]*tokenBucket        // notification rate limits, by notifier and destination ("" for all of them)
+	Host         hostVersions                   // kernel and OpenZFS versions at the last heartbeat
+	Topology     map[string]poolLayout          // vdev layout of each pool, by pool
+	Severities   map[string]severity            // severity of each check that failed last run, for edgeTriggered
+	Problems     map[string][]string            // findings of each check that failed last run, for edgeTriggered
+	CheckRuns    map[string]time.Time           // when each check in checkIntervals last passed
+}
+
+// deferredAlert is a warning held back during quiet hours
+type deferredAlert struct {
+	Queued  time.Time
+	Title   string
+	Message string
+}
+
+func loadState() (state, error) {
+	return loadStateFrom(statePath, stateMirrorPath)
+}
+
+// loadStateFrom reads the newest readable copy of the state, so a faulted pool holding the mirror (or a lost local disk) doesn't lose it.
+// If neither copy can be read, it returns an empty state along with the error.
+func loadStateFrom(primary, mirror string) (state, error) {
+	s, err := readStateFile(primary)
+	if mirror == "" {
+		return s, err
+	}
+
+	var m state
+	mirrorErr := withTimeout(stateMirrorTimeout, func() (err error) {
+		m, err = readStateFile(mirror)
+		return err
+	})
+	switch {
+	case err != nil && mirrorErr != nil:
+		return state{}, errors.Join(err, mirrorErr)
+	case err != nil:
+		log.Println("error reading state file, using the mirror: " + err.Error())
+		return m, nil
+	case mirrorErr == nil && m.Saved.After(s.Saved):
+		return m, nil
+	}
+	return s, nil
+}
+
+// stateUnreadable fails a check that compares against the state file when it can't be read, rather than let it save an empty state over the file
+func stateUnreadable(err error) error {
+	return checkError{fmt.Errorf("error opening state file for read: %w", err)}
+}
+
+// readStateFile reads the state from path. A missing file is an empty state
+func readStateFile(path string) (state, error) {
+	var s state
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return state{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return s, nil
+}
+
+func saveState(s state) {
+	saveStateTo(statePath, stateMirrorPath, s, time.Now())
+}
+
+// saveStateTo writes s to primary and, if set, mirror. Errors are logged rather than returned so a missing copy never stops a run.
+func saveStateTo(primary, mirror string, s state, now time.Time) {
+	s.Saved = now
+	data, err := json.Marshal(s)
+	if err != nil {
+		log.Println("error encoding state: " + err.Error())
+		return
+	}
+	if err := writeStateFile(primary, data); err != nil {
+		log.Println("error writing state file: " + err.Error())
+	}
+	if mirror == "" {
+		return
+	}
+	if err := withTimeout(stateMirrorTimeout, func() error { return writeStateFile(mirror, data) }); err != nil {
+		log.Println("error writing state mirror: " + err.Error())
+	}
+}
+
+// writeStateFile replaces the file at path in one step, so a crash mid write can't leave a truncated state behind
+func writeStateFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".heartbeat")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// withTimeout runs fn, giving up after d. I/O to a suspended pool blocks until the pool comes back, so fn may be left running.
+func withTimeout(d time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(d):
+		return fmt.Errorf("timed out after %s", d)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_loadStateFrom(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	primary := filepath.Join(dir, "local", "heartbeat.json")
+	mirror := filepath.Join(dir, "pool", "heartbeat.json")
+	now := time.Date(2024, time.April, 6, 8, 15, 0, 0, time.UTC)
+
+	// nothing saved yet
+	s, err := loadStateFrom(primary, mirror)
+	require.NoError(t, err)
+	assert.Equal(t, state{}, s)
+
+	saveStateTo(primary, mirror, state{KernelCursor: "first"}, now)
+	s, err = loadStateFrom(primary, mirror)
+	require.NoError(t, err)
+	assert.Equal(t, "first", s.KernelCursor)
+
+	// the newer copy wins, eg the mirror after the local disk was replaced
+	saveStateTo(mirror, "", state{KernelCursor: "newer"}, now.Add(time.Hour))
+	s, err = loadStateFrom(primary, mirror)
+	require.NoError(t, err)
+	assert.Equal(t, "newer", s.KernelCursor)
+
+	// a corrupt copy falls back to the other one
+	require.NoError(t, os.WriteFile(primary, []byte("{trunc"), 0o600))
+	s, err = loadStateFrom(primary, mirror)
+	require.NoError(t, err)
+	assert.Equal(t, "newer", s.KernelCursor)
+
+	require.NoError(t, os.WriteFile(mirror, []byte("{trunc"), 0o600))
+	s, err = loadStateFrom(primary, mirror)
+	assert.Error(t, err)
+	assert.Equal(t, state{}, s)
+
+	// an unreachable mirror doesn't stop the state being saved
+	saveStateTo(primary, filepath.Join(primary, "mirror.json"), state{KernelCursor: "local"}, now)
+	s, err = loadStateFrom(primary, "")
+	require.NoError(t, err)
+	assert.Equal(t, "local", s.KernelCursor)
+}
+
+func Test_withTimeout(t *testing.T) {
+	t.Parallel()
+
+	assert.NoError(t, withTimeout(time.Second, func() error { return nil }))
+	assert.EqualError(t, withTimeout(time.Millisecond, func() error { time.Sleep(time.Second); return nil }), "timed out after 1ms")
+}
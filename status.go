@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// runStatus is the result of the most recent run, written to statusPath for other tools to poll
+type runStatus struct {
+	Time     time.Time     `json:"time"`
+	Duration float64       `json:"duration_seconds"` // how long the whole run took
+	Checks   []checkStatus `json:"checks"`
+	Pools    []poolStatus  `json:"pools"`
+
+	SkippedDisks map[string]string `json:"skipped_disks,omitempty"` // disks left out of the SMART checks by smartExclude, and the rule that did it
+	Drives       []driveStatus     `json:"drives,omitempty"`
+}
+
+type checkStatus struct {
+	Name     string  `json:"name"`
+	Result   string  `json:"result"` // ok, failed, errored, or skipped
+	Severity string  `json:"severity,omitempty"`
+	Message  string  `json:"message,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+}
+
+type poolStatus struct {
+	Name    string       `json:"name"`
+	State   deviceState  `json:"state"`
+	Healthy bool         `json:"healthy"`
+	Summary string       `json:"summary"`
+	Used    uint64       `json:"used_bytes,omitempty"`
+	Free    uint64       `json:"free_bytes,omitempty"`
+	Full    float64      `json:"used_percent,omitempty"`
+	Scan    string       `json:"scan,omitempty"` // the last or current scrub or resilver, eg "scrub in progress since ..."
+	Vdevs   []vdevStatus `json:"vdevs,omitempty"`
+	Reasons []reason     `json:"reasons,omitempty"` // why the pool isn't healthy
+}
+
+// vdevStatus is a vdev and its disks, so consumers of the status file don't have to parse zpool status themselves
+type vdevStatus struct {
+	Name     string       `json:"name"`
+	Kind     string       `json:"kind"`            // mirror, raidz, draid, spares, or disk
+	Class    string       `json:"class,omitempty"` // logs, cache, special, or dedup
+	State    deviceState  `json:"state,omitempty"`
+	Healthy  bool         `json:"healthy"`
+	Read     int          `json:"read_errors"`
+	Write    int          `json:"write_errors"`
+	Checksum int          `json:"checksum_errors"`
+	Disks    []diskStatus `json:"disks"`
+}
+
+type diskStatus struct {
+	Name      string      `json:"name"`
+	State     deviceState `json:"state"`
+	Healthy   bool        `json:"healthy"`
+	Read      int         `json:"read_errors"`
+	Write     int         `json:"write_errors"`
+	Checksum  int         `json:"checksum_errors"`
+	Message   string      `json:"message,omitempty"`
+	Replacing string      `json:"replacing,omitempty"` // the replacing-N group, while zpool replace resilvers the disk
+}
+
+// driveStatus is a disk SMART was read from, by device name
+type driveStatus struct {
+	Device      string `json:"device"`
+	Model       string `json:"model,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+	Temperature int    `json:"temperature_celsius,omitempty"`
+}
+
+func newRunStatus(now time.Time, elapsed time.Duration, results []checkResult, pools []pool, free map[string]space, skipped map[string]string) runStatus {
+	st := runStatus{Time: now, Duration: elapsed.Seconds()}
+	if len(skipped) > 0 {
+		st.SkippedDisks = skipped
+	}
+	for _, r := range results {
+		cs := checkStatus{Name: r.name, Result: "ok", Duration: r.duration.Seconds()}
+		switch {
+		case r.skipped:
+			cs.Result = "skipped"
+		case r.err != nil:
+			cs.Result = "errored"
+			for _, err := range unjoin(r.err) {
+				if !errors.As(err, new(checkError)) {
+					cs.Result = "failed"
+				}
+			}
+			cs.Severity = r.severity.String()
+			cs.Message = r.err.Error()
+		}
+		st.Checks = append(st.Checks, cs)
+	}
+	for _, p := range pools {
+		ev := p.Evaluate()
+		ps := poolStatus{Name: p.name, State: p.state, Healthy: ev.Healthy(), Summary: p.HealthSummary(), Scan: p.scanStatus, Reasons: ev.Reasons}
+		if s, ok := free[p.name]; ok {
+			ps.Used = s.used
+			ps.Free = s.avail
+			ps.Full = s.percent()
+		}
+		for _, v := range p.vdevs {
+			vs := vdevStatus{Name: v.name, Kind: v.kind(), Class: v.class, State: v.state, Healthy: v.Healthy(), Read: v.read, Write: v.write, Checksum: v.checksum}
+			for _, d := range v.disks {
+				vs.Disks = append(vs.Disks, diskStatus{Name: d.name, State: d.state, Healthy: d.Healthy(), Read: d.read, Write: d.write, Checksum: d.checksum, Message: d.message, Replacing: d.replacing})
+			}
+			ps.Vdevs = append(ps.Vdevs, vs)
+		}
+		st.Pools = append(st.Pools, ps)
+	}
+	return st
+}
+
+// addDrives lists drives in st, with their temperatures
+func (st *runStatus) addDrives(drives []drive) {
+	for _, d := range drives {
+		ds := driveStatus{Device: d.Device, Model: d.Model, Serial: d.Serial}
+		if d.Temperature >= 0 {
+			ds.Temperature = d.Temperature
+		}
+		st.Drives = append(st.Drives, ds)
+	}
+}
+
+// stale is true if the next run should have finished by now
+func (st runStatus) stale(now time.Time) bool {
+	return now.Sub(st.Time) > statusStaleAfter
+}
+
+// writeStatus replaces the status file in one step so readers never see a partial write
+func writeStatus(path string, st runStatus) error {
+	data, err := json.MarshalIndent(st, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".status")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func readStatus(path string) (runStatus, error) {
+	var st runStatus
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_runStatus(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.April, 6, 8, 15, 0, 0, time.UTC)
+	results := []checkResult{
+		{name: "pool status", severity: severityCritical, duration: 1500 * time.Millisecond},
+		{name: "smart selftest", severity: severityWarning, err: errors.Join(errors.New("smart error: disk sdb: Completed: read failure"), checkError{errors.New("disk sdc: exit status 2")})},
+		{name: "disk usage", severity: severityWarning, err: checkError{errors.New("exit status 1")}},
+		{name: "drive inventory", skipped: true},
+	}
+	pools := []pool{{name: "primarySafe", state: "ONLINE", errors: "errors: No known data errors", scanStatus: "scrub repaired 0B in 11:12:07 with 0 errors on Sun Mar 10 11:12:09 2024"}}
+
+	st := newRunStatus(now, 95*time.Second, results, pools, map[string]space{"primarySafe": {avail: 17716740096}}, map[string]string{"sdf": "excluded by path:sdf"})
+	assert.Equal(t, []checkStatus{
+		{Name: "pool status", Result: "ok", Duration: 1.5},
+		{Name: "smart selftest", Result: "failed", Severity: "warning", Message: "smart error: disk sdb: Completed: read failure\ndisk sdc: exit status 2"},
+		{Name: "disk usage", Result: "errored", Severity: "warning", Message: "exit status 1"},
+		{Name: "drive inventory", Result: "skipped"},
+	}, st.Checks)
+	assert.Equal(t, []poolStatus{{Name: "primarySafe", State: "ONLINE", Healthy: true, Summary: "ONLINE, 0 disks healthy", Free: 17716740096, Scan: "scrub repaired 0B in 11:12:07 with 0 errors on Sun Mar 10 11:12:09 2024"}}, st.Pools)
+
+	st.addDrives([]drive{{Device: "sda", Model: "WDC WD80EFAX", Serial: "VK0ABCD", Temperature: 38}, {Device: "sdb", Serial: "ZA1B2C3", Temperature: -1}})
+	assert.Equal(t, []driveStatus{{Device: "sda", Model: "WDC WD80EFAX", Serial: "VK0ABCD", Temperature: 38}, {Device: "sdb", Serial: "ZA1B2C3"}}, st.Drives)
+
+	assert.False(t, st.stale(now.Add(statusStaleAfter)))
+	assert.True(t, st.stale(now.Add(statusStaleAfter+time.Minute)))
+
+	path := filepath.Join(t.TempDir(), "status.json")
+	require.NoError(t, writeStatus(path, st))
+	read, err := readStatus(path)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(read.Time))
+	assert.Equal(t, 95.0, read.Duration)
+	assert.Equal(t, st.Checks, read.Checks)
+	assert.Equal(t, map[string]string{"sdf": "excluded by path:sdf"}, read.SkippedDisks)
+	assert.Equal(t, st.Drives, read.Drives)
+}
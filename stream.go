@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// streamer runs a command, returning its stdout as it's written rather than all at once, for commands whose output can get large (eg zpool status listing thousands of damaged files).
+// Closing the stream waits for the command, returning a *commandError if it failed.
+type streamer func(cmd string, args ...string) (io.ReadCloser, error)
+
+// executeStream is execute for a streamer
+func executeStream(cmd string, args ...string) (io.ReadCloser, error) {
+	if err := checkReadOnly(cmd, args); err != nil {
+		return nil, err
+	}
+	cmd, args = wrapCommand(cmd, args, sudoHelper, remoteHost)
+	c := exec.Command(cmd, args...)
+	c.Env = append(os.Environ(), commandEnv...)
+	s := &commandStream{c: c, cmd: cmd, args: args, start: time.Now()}
+	c.Stderr = &s.stderr
+	stdout, err := c.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Start(); err != nil {
+		audit(cmd, args, s.start, err)
+		return nil, err
+	}
+	s.stdout = stdout
+	return s, nil
+}
+
+type commandStream struct {
+	c      *exec.Cmd
+	cmd    string
+	args   []string
+	stdout io.ReadCloser
+	stderr bytes.Buffer
+	start  time.Time
+}
+
+func (s *commandStream) Read(p []byte) (int, error) {
+	return s.stdout.Read(p)
+}
+
+// Close discards any output that wasn't read and waits for the command to exit
+func (s *commandStream) Close() error {
+	_, _ = io.Copy(io.Discard, s.stdout)
+	err := s.c.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		err = &commandError{cmd: s.cmd, stderr: s.stderr.String(), exitCode: exitErr.ExitCode()}
+	}
+	audit(s.cmd, s.args, s.start, err)
+	if err != nil {
+		return err
+	}
+
+	if s.stderr.Len() > 0 {
+		log.Printf("%s %s wrote to stderr: %s", s.cmd, strings.Join(s.args, " "), strings.TrimSpace(s.stderr.String()))
+	}
+	return nil
+}
+
+// bufferedStream adapts an executer into a streamer, eg for tests
+func bufferedStream(e executer) streamer {
+	return func(cmd string, args ...string) (io.ReadCloser, error) {
+		out, err := e(cmd, args...)
+		return bufferedOutput{strings.NewReader(out), err}, nil
+	}
+}
+
+type bufferedOutput struct {
+	*strings.Reader
+	err error
+}
+
+func (b bufferedOutput) Close() error {
+	return b.err
+}
+
+// streamHook calls done with the result of a stream when it's closed
+type streamHook struct {
+	io.Reader
+	closer io.Closer
+	done   func(err error)
+}
+
+func (h streamHook) Close() error {
+	err := h.closer.Close()
+	h.done(err)
+	return err
+}
+
+// recordLimit is how much of a streamed command's output a recorder keeps
+const recordLimit = 64 << 10
+
+// limitedBuffer keeps the first limit bytes written to it, noting if there was more
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.truncated = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_executeStream(t *testing.T) {
+	t.Parallel()
+
+	rc, err := executeStream("sh", "-c", "echo out; echo broken >&2; exit 3")
+	require.NoError(t, err)
+	out, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "out\n", string(out))
+	err = rc.Close()
+	var ce *commandError
+	require.ErrorAs(t, err, &ce)
+	assert.EqualError(t, err, "sh exited with status 3: broken")
+
+	// closing early doesn't leave the command blocked writing to us
+	rc, err = executeStream("sh", "-c", "seq 1 200000")
+	require.NoError(t, err)
+	assert.NoError(t, rc.Close())
+
+	_, err = executeStream("/nonexistent/zpool", "status")
+	assert.Error(t, err)
+}
+
+func Test_recorderStream(t *testing.T) {
+	t.Parallel()
+
+	big := strings.Repeat("x", recordLimit+10)
+	rec := &recorder{s: bufferedStream(func(cmd string, args ...string) (string, error) {
+		if cmd == "big" {
+			return big, nil
+		}
+		return "ok\n", nil
+	})}
+	for _, cmd := range []string{"/sbin/zpool", "big"} {
+		rc, err := rec.stream(cmd, "status")
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+	}
+
+	require.Len(t, rec.output, 2)
+	assert.Equal(t, "$ /sbin/zpool status\nok\n", rec.output[0])
+	assert.Equal(t, "$ big status\n"+big[:recordLimit]+"\n[output truncated]\n", rec.output[1])
+}
+
+func Test_parsePoolsReaderErrorFiles(t *testing.T) {
+	t.Parallel()
+
+	// a pool listing thousands of damaged files, streamed rather than built up in memory
+	r, w := io.Pipe()
+	go func() {
+		fmt.Fprint(w, "  pool: tank\n state: ONLINE\nconfig:\n\n\tNAME        STATE     READ WRITE CKSUM\n\ttank        ONLINE       0     0     0\n\t  sda       ONLINE       0     0     0\n\nerrors: Permanent errors have been detected in the following files:\n\n")
+		for i := 0; i < 10000; i++ {
+			fmt.Fprintf(w, "        /tank/data/file%05d\n", i)
+		}
+		w.Close()
+	}()
+
+	pools, err := parsePoolsReader(r)
+	require.NoError(t, err)
+	require.Len(t, pools, 1)
+	lines := strings.Split(pools[0].errors, "\n")
+	assert.Len(t, lines, zpoolErrorFiles+2)
+	assert.Equal(t, "/tank/data/file00000", lines[1])
+	assert.Equal(t, "...and 9950 more files", lines[len(lines)-1])
+}
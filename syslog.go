@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"log/syslog"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// logResult records the outcome of a check, and how long it took, in syslog
+func logResult(check string, sev severity, err error, took time.Duration) {
+	fields := map[string]string{"HEARTBEAT_CHECK": check, "HEARTBEAT_DURATION": strconv.FormatFloat(took.Seconds(), 'f', 3, 64)}
+	if err == nil {
+		fields["HEARTBEAT_RESULT"] = "ok"
+		logEvent(severityInfo, check+": ok", fields)
+		return
+	}
+
+	fields["HEARTBEAT_RESULT"] = "failed"
+	fields["HEARTBEAT_SEVERITY"] = sev.String()
+	logEvent(sev, check+": "+err.Error(), fields)
+}
+
+// logEvent writes msg to journald if it's running, or syslog otherwise. Fields are only recorded by journald.
+func logEvent(sev severity, msg string, fields map[string]string) {
+	if !syslogEnabled {
+		return
+	}
+
+	if _, err := os.Stat(journalSocket); err == nil {
+		err = journal(sev, msg, fields)
+		if err == nil {
+			return
+		}
+		log.Println("error writing to journald: " + err.Error())
+	}
+
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "heartbeat")
+	if err != nil {
+		log.Println("error opening syslog: " + err.Error())
+		return
+	}
+	defer w.Close()
+
+	switch sev {
+	case severityCritical:
+		err = w.Crit(msg)
+	case severityWarning:
+		err = w.Warning(msg)
+	default:
+		err = w.Info(msg)
+	}
+	if err != nil {
+		log.Println("error writing to syslog: " + err.Error())
+	}
+}
+
+func syslogPriority(sev severity) syslog.Priority {
+	switch sev {
+	case severityCritical:
+		return syslog.LOG_CRIT
+	case severityWarning:
+		return syslog.LOG_WARNING
+	default:
+		return syslog.LOG_INFO
+	}
+}
+
+// journal sends an entry using journald's native protocol
+func journal(sev severity, msg string, fields map[string]string) error {
+	conn, err := net.Dial("unixgram", journalSocket)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(journalEntry(sev, msg, fields))
+	return err
+}
+
+func journalEntry(sev severity, msg string, fields map[string]string) []byte {
+	all := map[string]string{
+		"MESSAGE":           msg,
+		"PRIORITY":          fmt.Sprint(int(syslogPriority(sev))),
+		"SYSLOG_IDENTIFIER": "heartbeat",
+	}
+	for k, v := range fields {
+		all[k] = v
+	}
+	keys := make([]string, 0, len(all))
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		v := all[k]
+		if !strings.Contains(v, "\n") {
+			fmt.Fprintf(&buf, "%s=%s\n", k, v)
+			continue
+		}
+		// multi-line values are sent as the key, a little endian length, and the raw value
+		buf.WriteString(k + "\n")
+		_ = binary.Write(&buf, binary.LittleEndian, uint64(len(v)))
+		buf.WriteString(v + "\n")
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_journalEntry(t *testing.T) {
+	t.Parallel()
+
+	entry := journalEntry(severityCritical, "pool status: pool primarySafe - DEGRADED\nvdev raidz2-0 - DEGRADED", map[string]string{"HEARTBEAT_CHECK": "pool status"})
+	assert.Equal(t, "HEARTBEAT_CHECK=pool status\n"+
+		"MESSAGE\n\x41\x00\x00\x00\x00\x00\x00\x00pool status: pool primarySafe - DEGRADED\nvdev raidz2-0 - DEGRADED\n"+
+		"PRIORITY=2\n"+
+		"SYSLOG_IDENTIFIER=heartbeat\n", string(entry))
+}
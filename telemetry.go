@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tracer collects the spans of a single run and exports them via OTLP/HTTP in JSON encoding
+type tracer struct {
+	traceID string
+	root    *span
+	mu      sync.Mutex // spans may start concurrently, see eachPool
+	spans   []*span
+}
+
+type span struct {
+	tracer   *tracer
+	id       string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]string
+	err      error
+}
+
+func newTracer() *tracer {
+	t := &tracer{traceID: randomID(16)}
+	t.root = t.newSpan("heartbeat", "")
+	return t
+}
+
+func (t *tracer) newSpan(name, parentID string) *span {
+	s := &span{tracer: t, id: randomID(8), parentID: parentID, name: name, start: time.Now(), attrs: make(map[string]string)}
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	return s
+}
+
+// start begins a span for a check
+func (t *tracer) start(check string) *span {
+	s := t.newSpan(check, t.root.id)
+	s.attrs["check"] = check
+	return s
+}
+
+// child begins a span nested under s
+func (s *span) child(name string) *span {
+	return s.tracer.newSpan(name, s.id)
+}
+
+func (s *span) finish(err error) {
+	s.end = time.Now()
+	s.err = err
+	if err != nil {
+		s.attrs["result"] = "failed"
+	} else {
+		s.attrs["result"] = "ok"
+	}
+}
+
+// execute wraps an executer so every command it runs is recorded as a child span
+func (s *span) execute(e executer) executer {
+	return func(cmd string, args ...string) (string, error) {
+		c := s.command(cmd, args)
+		out, err := e(cmd, args...)
+		c.finish(err)
+		return out, err
+	}
+}
+
+// stream wraps a streamer so every command it runs is recorded as a child span, ending when the stream is closed
+func (s *span) stream(st streamer) streamer {
+	return func(cmd string, args ...string) (io.ReadCloser, error) {
+		c := s.command(cmd, args)
+		rc, err := st(cmd, args...)
+		if err != nil {
+			c.finish(err)
+			return nil, err
+		}
+		return streamHook{rc, rc, c.finish}, nil
+	}
+}
+
+// command begins a child span for running cmd
+func (s *span) command(cmd string, args []string) *span {
+	c := s.child(cmd)
+	c.attrs["command"] = strings.TrimSpace(cmd + " " + strings.Join(args, " "))
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "/dev/") {
+			c.attrs["disk"] = strings.TrimPrefix(arg, "/dev/")
+		}
+	}
+	return c
+}
+
+// export sends the run to otlpEndpoint, if configured
+func (t *tracer) export() error {
+	if otlpEndpoint == "" {
+		return nil
+	}
+	t.root.finish(nil)
+
+	data, err := json.Marshal(t.otlp())
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(strings.TrimSuffix(otlpEndpoint, "/")+"/v1/traces", "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("otlp export failed: %s: %s", resp.Status, body)
+	}
+
+	return nil
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func (t *tracer) otlp() map[string]any {
+
+	spans := make([]otlpSpan, 0, len(t.spans))
+	for _, s := range t.spans {
+		span := otlpSpan{
+			TraceID:           t.traceID,
+			SpanID:            s.id,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              1, // internal
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.attrs),
+		}
+		span.Status.Code = 1 // ok
+		if s.err != nil {
+			span.Status.Code = 2 // error
+			span.Status.Message = s.err.Error()
+		}
+		spans = append(spans, span)
+	}
+
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": otlpAttributes(map[string]string{"service.name": "zfsHeartbeat", "host.name": hostname()}),
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "zfsHeartbeat"},
+				"spans": spans,
+			}},
+		}},
+	}
+}
+
+func otlpAttributes(attrs map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		var a otlpAttribute
+		a.Key = k
+		a.Value.StringValue = attrs[k]
+		result = append(result, a)
+	}
+	return result
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
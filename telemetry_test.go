@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_tracer(t *testing.T) {
+	t.Parallel()
+
+	tr := newTracer()
+	span := tr.start("smart selftest")
+	e := span.execute(func(cmd string, args ...string) (string, error) {
+		return "", errors.New("exit status 4")
+	})
+	_, err := e("/sbin/smartctl", "-l", "selftest", "/dev/sdb")
+	span.finish(err)
+	tr.root.finish(nil)
+
+	data, err := json.Marshal(tr.otlp())
+	require.NoError(t, err)
+	var export struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(data, &export))
+
+	spans := export.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 3)
+	assert.Equal(t, "heartbeat", spans[0].Name)
+	assert.Equal(t, spans[0].SpanID, spans[1].ParentSpanID)
+	assert.Equal(t, spans[1].SpanID, spans[2].ParentSpanID)
+	assert.Len(t, spans[2].TraceID, 32)
+
+	attrs := make(map[string]string)
+	for _, a := range spans[2].Attributes {
+		attrs[a.Key] = a.Value.StringValue
+	}
+	assert.Equal(t, map[string]string{"command": "/sbin/smartctl -l selftest /dev/sdb", "disk": "sdb", "result": "failed"}, attrs)
+	assert.Equal(t, 2, spans[2].Status.Code)
+	assert.Equal(t, "exit status 4", spans[2].Status.Message)
+}
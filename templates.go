@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultHeartbeatTemplate = `{{range .Pools}}{{.Name}}: {{.Free}} free{{if .Full}} ({{printf "%.0f" .Full}}% full){{end}}{{if not .LastScrub.IsZero}}, last scrub {{.LastScrub.Format "Jan 2"}}{{end}}{{if not .LastTrim.IsZero}}, last trim {{.LastTrim.Format "Jan 2"}}{{end}}
+{{if gt .CompressRatio 1.0}}  {{printf "%.2f" .CompressRatio}}x compression, {{.Logical}} stored in {{.Used}}
+{{end}}{{range .Operations}}  {{.}}
+{{end}}{{if .Upgradable}}  new features available{{with .Features}}: {{.}}{{end}} (zpool upgrade)
+{{end}}{{if not .Checkpoint.IsZero}}  checkpoint from {{.Checkpoint.Format "Jan 2"}} holding {{.CheckpointSize}}
+{{end}}{{if .OldestDisk}}  disk age {{printf "%.2f" .YoungestDisk}}-{{printf "%.2f" .OldestDisk}} years
+{{end}}{{end}}{{range .Zvols}}zvol {{.Name}}: {{.Written}} of {{.Size}} written, {{.Used}} used{{if .Sparse}} (sparse){{end}}
+{{end}}{{if and .OldestDisk (not .PoolDiskAges)}}Disk age: {{printf "%.2f" .YoungestDisk}}-{{printf "%.2f" .OldestDisk}} years{{end}}{{if .HottestDisk}}
+Hottest disk: {{.HottestDisk}} at {{.HottestTemp}}°C{{end}}{{if .Restore}}
+Restore test: {{.Restore}}{{end}}{{with .Host}}
+heartbeat {{.Version}}, up {{.Uptime}}, kernel {{.Kernel}}{{with .PrevKernel}} (was {{.}}){{end}}, OpenZFS {{.ZFS}}{{with .PrevZFS}} (was {{.}}){{end}}{{end}}`
+
+const defaultAlertTemplate = `{{range $i, $f := .Findings}}{{if $i}}
+{{end}}[{{$f.Severity}}] {{if $f.Errored}}{{$f.Check}} could not run: {{end}}{{$f.Message}}{{end}}`
+
+// groupTemplates are the built in templates for recipient groups, by group
+var groupTemplates = map[string]string{
+	"family": `{{if eq .Severity "critical"}}{{T "The NAS needs attention. Please leave it turned on and don't unplug anything until it's fixed."}}{{else if eq .Severity "warning"}}{{T "The NAS has a minor problem. Nothing needs to be done right now."}}{{end}}`,
+}
+
+// heartbeatReport is the data available to heartbeat.tmpl
+type heartbeatReport struct {
+	Pools        []poolReport
+	Zvols        []zvolReport
+	YoungestDisk float64 // years
+	OldestDisk   float64 // years
+	HottestDisk  string
+	HottestTemp  int    // celsius
+	Restore      string // result of the restore test, if restoreDataset is set
+	Host         *hostReport
+}
+
+type poolReport struct {
+	Name           string
+	Free           string
+	Full           float64 // percent of the pool's space used
+	LastScrub      time.Time
+	LastTrim       time.Time // oldest full trim across the pool's SSDs
+	Autotrim       string
+	Operations     []string // removals and raidz expansions
+	Checkpoint     time.Time
+	CheckpointSize string
+	Upgradable     bool   // zpool upgrade would enable more features
+	Features       string // the features it would enable, if known
+	CompressRatio  float64
+	Logical        string  // size of the pool's data before compression
+	Used           string  // size of the pool's data on disk
+	OldestDisk     float64 // years of power on time
+	YoungestDisk   float64 // years of power on time
+}
+
+type zvolReport struct {
+	Name    string
+	Size    string // volsize
+	Written string // data written by the guest, before compression
+	Used    string // space used in the pool, including snapshots and the refreservation
+	Sparse  bool
+}
+
+// groupReport is the data available to <group>.tmpl. An empty message isn't sent, so a group can skip eg the weekly heartbeat.
+type groupReport struct {
+	Title    string
+	Severity string // info, warning, or critical
+	Message  string // the full message admins get
+	Findings []findingReport
+}
+
+func newGroupReport(n notification) groupReport {
+	r := groupReport{Title: n.title, Severity: n.severity.String(), Message: n.message}
+	for _, f := range n.findings {
+		r.Findings = append(r.Findings, findingReport{Check: f.check, Severity: f.severity.String(), Message: f.message, Errored: f.errored})
+	}
+	return r
+}
+
+func (r groupReport) render(group string) string {
+	fallback, ok := groupTemplates[group]
+	if !ok {
+		fallback = "{{.Message}}"
+	}
+	return strings.TrimSpace(renderLocale(group+".tmpl", fallback, notifyLocales[group], r))
+}
+
+// alertReport is the data available to alert.tmpl
+type alertReport struct {
+	Findings []findingReport
+}
+
+type findingReport struct {
+	Check    string
+	Severity string
+	Message  string
+	Errored  bool // the check could not run, rather than finding a problem
+}
+
+func newHeartbeatReport(pools []pool, free map[string]space, oldest, youngest int, drives []drive, datasets []datasetSpace) heartbeatReport {
+	r := heartbeatReport{
+		YoungestDisk: yearsFromHours(youngest),
+		OldestDisk:   yearsFromHours(oldest),
+	}
+
+	for _, name := range diskUsagePools {
+		pr := poolReport{Name: name}
+		if s, ok := free[name]; ok {
+			pr.Free = formatBytes(s.avail)
+			pr.Full = s.percent()
+		}
+		for _, d := range datasets {
+			if d.name == name {
+				pr.CompressRatio = d.ratio
+				pr.Logical = formatBytes(d.logical)
+				pr.Used = formatBytes(d.used)
+			}
+		}
+		for _, p := range pools {
+			if p.name == name {
+				pr.LastScrub, _ = p.LastScrub()
+				pr.LastTrim, _, _ = p.LastTrim()
+				pr.Autotrim = p.autotrim
+				var size uint64
+				pr.Checkpoint, size, _ = p.Checkpoint()
+				pr.CheckpointSize = formatBytes(size)
+				pr.Upgradable = p.Upgradable()
+				pr.Features = strings.Join(p.features, ", ")
+				for _, o := range p.Operations() {
+					pr.Operations = append(pr.Operations, o.String())
+				}
+			}
+		}
+		r.Pools = append(r.Pools, pr)
+	}
+
+	for _, d := range drives {
+		if d.Temperature >= 0 && (r.HottestDisk == "" || d.Temperature > r.HottestTemp) {
+			r.HottestDisk = d.Device
+			r.HottestTemp = d.Temperature
+		}
+	}
+
+	return r
+}
+
+// PoolDiskAges is true if the age of each pool's disks is known, making the overall range redundant
+func (r heartbeatReport) PoolDiskAges() bool {
+	for _, p := range r.Pools {
+		if p.OldestDisk > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r heartbeatReport) String() string {
+	return render("heartbeat.tmpl", defaultHeartbeatTemplate, r)
+}
+
+func (r alertReport) String() string {
+	return render("alert.tmpl", defaultAlertTemplate, r)
+}
+
+// render executes the named template from templateDir, falling back to the built in template if it is missing or broken
+func render(name, fallback string, data any) string {
+	return renderLocale(name, fallback, "", data)
+}
+
+// renderLocale is render with {{T "text"}} translating text into locale
+func renderLocale(name, fallback, locale string, data any) string {
+	funcs := template.FuncMap{"T": translator(locale)}
+	var buf bytes.Buffer
+	if text, err := os.ReadFile(filepath.Join(templateDir, name)); err == nil {
+		t, err := template.New(name).Funcs(funcs).Parse(string(text))
+		if err == nil {
+			err = t.Execute(&buf, data)
+		}
+		if err == nil {
+			return buf.String()
+		}
+		log.Printf("error rendering %s, using the default template: %s", name, err)
+		buf.Reset()
+	}
+
+	t := template.Must(template.New(name).Funcs(funcs).Parse(fallback))
+	if err := t.Execute(&buf, data); err != nil {
+		log.Printf("error rendering default %s: %s", name, err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_heartbeatReport(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/scrubSample.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+
+	free := map[string]space{"boot-pool": {avail: 17179869184}, "primarySafe": {avail: 17716740096}}
+	drives := []drive{{Device: "sda", Temperature: 36}, {Device: "sdb", Temperature: 41}, {Device: "sdc", Temperature: -1}}
+	r := newHeartbeatReport(pools, free, 61000, 9000, drives, nil)
+
+	assert.Equal(t, "boot-pool: 16.00 GiB free, last scrub Mar 31\nprimarySafe: 16.50 GiB free\nDisk age: 1.03-6.96 years\nHottest disk: sdb at 41°C", r.String())
+}
+
+func Test_lastScrub(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolSample4.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+
+	scrubbed, ok := pools[1].LastScrub()
+	require.True(t, ok)
+	assert.Equal(t, "2024-03-10 05:18:09", scrubbed.UTC().Format("2006-01-02 15:04:05"))
+}
+
+// sentBackend records what it was asked to send
+type sentBackend struct {
+	sent *[]notification
+}
+
+func (b sentBackend) name() string {
+	return "sent"
+}
+
+func (b sentBackend) send(n notification) error {
+	*b.sent = append(*b.sent, n)
+	return nil
+}
+
+func Test_groupBackend(t *testing.T) {
+	t.Parallel()
+
+	var d digest
+	d.add("pool status", severityCritical, "pool primarySafe is DEGRADED", "")
+	critical := notification{title: "Health check failed!", message: d.String(), severity: severityCritical, findings: d.findings}
+	heartbeat := notification{title: "Heartbeat", message: "boot-pool: 16.00 GiB free", severity: severityInfo}
+
+	var family, admins []notification
+	require.NoError(t, groupBackend{group: "family", backend: sentBackend{&family}}.send(critical))
+	require.NoError(t, groupBackend{group: "family", backend: sentBackend{&family}}.send(heartbeat))
+	assert.Equal(t, []notification{{title: "Health check failed!", message: "The NAS needs attention. Please leave it turned on and don't unplug anything until it's fixed.", severity: severityCritical}}, family, "family doesn't get the weekly heartbeat")
+
+	require.NoError(t, groupBackend{group: "admins", backend: sentBackend{&admins}}.send(critical))
+	assert.Equal(t, "[critical] pool primarySafe is DEGRADED", admins[0].message, "groups without a template get the full message")
+	assert.Equal(t, "family sent", groupBackend{group: "family", backend: sentBackend{&family}}.name())
+}
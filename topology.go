@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// topologyCommands are the zpool subcommands that change a pool's layout on purpose
+var topologyCommands = []string{"add", "attach", "detach", "replace", "remove", "split"}
+
+// poolLayout is a fingerprint of a pool's vdevs, to notice when they change
+type poolLayout struct {
+	Vdevs  []vdevLayout
+	ByGUID bool      // members are GUIDs rather than device names, which zpool get only reports for vdevs from OpenZFS 2.2 on
+	Seen   time.Time // when this layout was last seen
+}
+
+type vdevLayout struct {
+	Name      string
+	Kind      string
+	Class     string   `json:",omitempty"`
+	Members   []string // disk GUIDs, or device names where GUIDs aren't available
+	Transient []string `json:",omitempty"` // members in a replacing or spare group, which leave when it finishes
+}
+
+// layoutOf fingerprints p, using the GUIDs in guids (by device name) where they're known
+func layoutOf(p pool, guids map[string]string, now time.Time) poolLayout {
+	l := poolLayout{ByGUID: len(guids) > 0, Seen: now}
+	for _, v := range p.vdevs {
+		vl := vdevLayout{Name: v.name, Kind: v.kind(), Class: v.class}
+		for _, d := range v.disks {
+			id := d.name
+			if guid, ok := guids[d.name]; ok {
+				id = guid
+			}
+			vl.Members = append(vl.Members, id)
+			if d.replacing != "" || d.spare != "" {
+				vl.Transient = append(vl.Transient, id)
+			}
+		}
+		l.Vdevs = append(l.Vdevs, vl)
+	}
+	return l
+}
+
+// diff describes how l changed to become next
+func (l poolLayout) diff(next poolLayout) []string {
+	var changes []string
+	old := make(map[string]vdevLayout)
+	for _, v := range l.Vdevs {
+		old[v.Name] = v
+	}
+	for _, v := range next.Vdevs {
+		o, ok := old[v.Name]
+		delete(old, v.Name)
+		if !ok {
+			changes = append(changes, fmt.Sprintf("%s vdev %s with %d disks added", v.Kind, v.Name, len(v.Members)))
+			continue
+		}
+		if o.Kind != v.Kind || o.Class != v.Class {
+			changes = append(changes, fmt.Sprintf("vdev %s changed from %s to %s", v.Name, strings.TrimSpace(o.Class+" "+o.Kind), strings.TrimSpace(v.Class+" "+v.Kind)))
+		}
+		for _, m := range v.Members {
+			if !slices.Contains(o.Members, m) {
+				changes = append(changes, fmt.Sprintf("disk %s joined vdev %s", m, v.Name))
+			}
+		}
+		for _, m := range o.Members {
+			// the old disk leaving a replacing or spare group is the end of a change that was already reported
+			if !slices.Contains(v.Members, m) && !slices.Contains(o.Transient, m) {
+				changes = append(changes, fmt.Sprintf("disk %s left vdev %s", m, v.Name))
+			}
+		}
+	}
+	for _, v := range l.Vdevs {
+		if _, ok := old[v.Name]; ok {
+			changes = append(changes, fmt.Sprintf("vdev %s removed", v.Name))
+		}
+	}
+	return changes
+}
+
+// maintenance lists the commands in zpool history output that changed a pool's layout after since
+func maintenance(history string, since time.Time) []string {
+	var commands []string
+	for _, line := range strings.Split(history, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != "zpool" || !slices.Contains(topologyCommands, fields[2]) {
+			continue
+		}
+		// zpool history prints local time, which is UTC for commands run by heartbeat
+		at, err := time.ParseInLocation("2006-01-02.15:04:05", fields[0], time.UTC)
+		if err == nil && at.After(since) {
+			commands = append(commands, strings.Join(fields[1:], " "))
+		}
+	}
+	return commands
+}
+
+// checkTopology warns when a pool's vdevs have changed since the last run without a zpool command (or heartbeat replace-disk) explaining it, recording layouts in s.
+// history returns a pool's zpool history, and is only called for pools that changed.
+func checkTopology(s *state, pools []pool, guids map[string]map[string]string, history func(pool string) (string, error), now time.Time) error {
+	if s.Topology == nil {
+		s.Topology = make(map[string]poolLayout)
+	}
+
+	var errs []error
+	for _, p := range pools {
+		next := layoutOf(p, guids[p.name], now)
+		prev, ok := s.Topology[p.name]
+		s.Topology[p.name] = next
+		// a pool seen for the first time, or an OpenZFS upgrade switching device names for GUIDs, has nothing to compare against
+		if !ok || prev.ByGUID != next.ByGUID {
+			continue
+		}
+		changes := prev.diff(next)
+		if len(changes) == 0 {
+			continue
+		}
+
+		var commands []string
+		for _, r := range s.Replacements {
+			if r.Pool == p.name {
+				commands = append(commands, "heartbeat replace-disk "+r.Pool+" "+r.Disk)
+			}
+		}
+		out, err := history(p.name)
+		if err != nil {
+			log.Printf("error reading zpool history for %s: %s", p.name, err)
+		}
+		commands = append(commands, maintenance(out, prev.Seen)...)
+		if len(commands) > 0 {
+			log.Printf("pool %s topology changed by %s: %s", p.name, strings.Join(commands, ", "), strings.Join(changes, ", "))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("pool %s topology changed unexpectedly: %s", p.name, strings.Join(changes, ", ")))
+	}
+	return errors.Join(errs...)
+}
+
+// readVdevGUIDs returns the GUID of every device in the named pool, by device name
+func readVdevGUIDs(e executer, name string) (map[string]string, error) {
+	out, err := e("/sbin/zpool", "get", "-H", "-p", "-o", "name,value", "guid", name, "all-vdevs")
+	if err != nil {
+		return nil, err
+	}
+	guids := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if device, guid, ok := strings.Cut(line, "\t"); ok {
+			guids[device] = strings.TrimSpace(guid)
+		}
+	}
+	return guids, nil
+}
+
+// trackTopology runs checkTopology against the state file
+func trackTopology(e executer, pools []pool) error {
+	guids := make(map[string]map[string]string)
+	if detectZFSVersion(e).atLeast(2, 2) {
+		found := make([]map[string]string, len(pools))
+		err := eachPool(pools, func(i int, p pool) (err error) {
+			found[i], err = readVdevGUIDs(e, p.name)
+			return err
+		})
+		if err != nil {
+			return checkError{err}
+		}
+		for i, p := range pools {
+			guids[p.name] = found[i]
+		}
+	}
+	history := func(pool string) (string, error) {
+		return e("/sbin/zpool", "history", pool)
+	}
+
+	s, err := loadState()
+	if err != nil {
+		return stateUnreadable(err)
+	}
+	err = checkTopology(&s, pools, guids, history, time.Now())
+	saveState(s)
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkTopology(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.April, 6, 8, 0, 0, 0, time.UTC)
+	mirror := func(name string, disks ...vdevDisk) vdev {
+		return vdev{name: name, state: stateOnline, typev: vdevTypeRaidz, disks: disks}
+	}
+	spares := vdev{name: "spares", typev: vdevTypeSpare, disks: []vdevDisk{{name: "sdc", state: stateAvail}}}
+	tank := func(vdevs ...vdev) []pool {
+		return []pool{{name: "tank", state: stateOnline, vdevs: vdevs}}
+	}
+	var history string
+	historyOf := func(pool string) (string, error) {
+		return history, nil
+	}
+
+	var s state
+	require.NoError(t, checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sda"}, vdevDisk{name: "sdb"}), spares), nil, historyOf, now), "the first layout is only recorded")
+	assert.Equal(t, poolLayout{Vdevs: []vdevLayout{{Name: "mirror-0", Kind: "mirror", Members: []string{"sda", "sdb"}}, {Name: "spares", Kind: "spares", Members: []string{"sdc"}}}, Seen: now}, s.Topology["tank"])
+
+	now = now.Add(time.Hour)
+	err := checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sda"}, vdevDisk{name: "sdb", spare: "spare-1"}, vdevDisk{name: "sdc", spare: "spare-1"}), spares), nil, historyOf, now)
+	assert.EqualError(t, err, "pool tank topology changed unexpectedly: disk sdc joined vdev mirror-0", "a hot spare kicked in")
+
+	now = now.Add(time.Hour)
+	assert.NoError(t, checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sda"}, vdevDisk{name: "sdc"}), spares), nil, historyOf, now), "the failed disk leaving the spare group was already reported")
+
+	history = "History for 'tank':\n2024-03-01.10:00:00 zpool create tank mirror sda sdb\n2024-04-06.10:30:00 zpool add tank mirror sdd sde\n"
+	now = now.Add(time.Hour)
+	assert.NoError(t, checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sda"}, vdevDisk{name: "sdc"}), mirror("mirror-1", vdevDisk{name: "sdd"}, vdevDisk{name: "sde"}), spares), nil, historyOf, now), "zpool add since the last run")
+
+	now = now.Add(time.Hour)
+	err = checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sda"}, vdevDisk{name: "sdc"}), mirror("mirror-1", vdevDisk{name: "sdd"}, vdevDisk{name: "sde"})), nil, historyOf, now)
+	assert.EqualError(t, err, "pool tank topology changed unexpectedly: vdev spares removed", "the zpool add was before the last run")
+
+	s.Replacements = []replacement{{Pool: "tank", Disk: "sda"}}
+	now = now.Add(time.Hour)
+	assert.NoError(t, checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sdf"}, vdevDisk{name: "sdc"}), mirror("mirror-1", vdevDisk{name: "sdd"}, vdevDisk{name: "sde"})), nil, historyOf, now), "marked with heartbeat replace-disk")
+
+	guids := map[string]map[string]string{"tank": {"sdf": "1111", "sdc": "2222", "sdd": "3333", "sde": "4444"}}
+	now = now.Add(time.Hour)
+	s.Replacements = nil
+	assert.NoError(t, checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sdf"}, vdevDisk{name: "sdc"}), mirror("mirror-1", vdevDisk{name: "sdd"}, vdevDisk{name: "sde"})), guids, historyOf, now), "switching to GUIDs isn't a change")
+	assert.Equal(t, []string{"1111", "2222"}, s.Topology["tank"].Vdevs[0].Members)
+
+	guids["tank"]["sdf"] = "5555"
+	now = now.Add(time.Hour)
+	err = checkTopology(&s, tank(mirror("mirror-0", vdevDisk{name: "sdf"}, vdevDisk{name: "sdc"}), mirror("mirror-1", vdevDisk{name: "sdd"}, vdevDisk{name: "sde"})), guids, historyOf, now)
+	assert.EqualError(t, err, "pool tank topology changed unexpectedly: disk 5555 joined vdev mirror-0, disk 1111 left vdev mirror-0", "a different disk at the same path")
+}
+
+func Test_maintenance(t *testing.T) {
+	t.Parallel()
+
+	history := "History for 'tank':\n2024-03-01.10:00:00 zpool create tank mirror sda sdb\n2024-03-05.12:00:00 zfs snapshot tank@daily\n2024-04-06.09:15:00 zpool replace tank sda sdf\n2024-04-06.09:16:00 zpool scrub tank\n"
+	assert.Equal(t, []string{"zpool replace tank sda sdf"}, maintenance(history, time.Date(2024, time.April, 6, 8, 0, 0, 0, time.UTC)))
+	assert.Empty(t, maintenance(history, time.Date(2024, time.April, 6, 10, 0, 0, 0, time.UTC)))
+}
+
+func Test_readVdevGUIDs(t *testing.T) {
+	t.Parallel()
+
+	e := func(cmd string, args ...string) (string, error) {
+		return "root-0\t9386524880582215536\nmirror-0\t1509276470532395426\nsda\t3617392734858196215\nsdb\t16386574921474052512\n", nil
+	}
+	guids, err := readVdevGUIDs(e, "tank")
+	require.NoError(t, err)
+	assert.Equal(t, "3617392734858196215", guids["sda"])
+	assert.Len(t, guids, 4)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// checkResult is the outcome of one check in a run
+type checkResult struct {
+	name     string
+	severity severity // severity if the check failed
+	err      error
+	skipped  bool          // the check is disabled, or not due yet (see checkIntervals)
+	duration time.Duration // how long the check took
+}
+
+// transition is a change in health since the previous run
+type transition struct {
+	check    string
+	pool     string
+	vdev     string
+	disk     string
+	severity severity // severityInfo for a recovery
+	message  string
+}
+
+// detectTransitions compares this run's results against the previous run, recording the new results in s
+func detectTransitions(s *state, results []checkResult, pools []pool) []transition {
+	if s.Checks == nil {
+		s.Checks = make(map[string]bool)
+	}
+	if s.Pools == nil {
+		s.Pools = make(map[string]string)
+	}
+
+	var changes []transition
+	for _, r := range results {
+		if r.skipped {
+			continue
+		}
+		healthy := r.err == nil
+		if prev, ok := s.Checks[r.name]; ok && prev != healthy {
+			t := transition{check: r.name, severity: severityInfo, message: r.name + " recovered"}
+			if !healthy {
+				t.severity = r.severity
+				t.message = r.err.Error()
+			}
+			changes = append(changes, t)
+		}
+		s.Checks[r.name] = healthy
+	}
+
+	for _, p := range pools {
+		current := string(p.state)
+		if !p.Health() && p.state == stateOnline {
+			current = "ONLINE with errors"
+		}
+		if prev, ok := s.Pools[p.name]; ok && prev != current {
+			t := transition{check: "pool status", pool: p.name, severity: severityInfo, message: fmt.Sprintf("pool %s is %s (was %s)", p.name, current, prev)}
+			if !p.Health() {
+				t.severity = severityCritical
+				t.vdev, t.disk = firstUnhealthy(p)
+			}
+			changes = append(changes, t)
+		}
+		s.Pools[p.name] = current
+	}
+
+	return changes
+}
+
+// firstUnhealthy names the first unhealthy vdev and disk in p, if any
+func firstUnhealthy(p pool) (vdevName, diskName string) {
+	for _, v := range p.vdevs {
+		if v.Healthy() {
+			continue
+		}
+		for _, d := range v.disks {
+			if !d.Healthy() {
+				return v.name, d.name
+			}
+		}
+		return v.name, ""
+	}
+	return "", ""
+}
+
+// reportTransitions records this run's results and forwards any changes since the last run
+func reportTransitions(results []checkResult, pools []pool) {
+	s, err := loadState()
+	if err != nil {
+		log.Println("error opening state file for read: " + err.Error())
+		return
+	}
+	changes := detectTransitions(&s, results, pools)
+	saveState(s)
+
+	for _, t := range changes {
+		if err := sendTrap(t); err != nil {
+			log.Println("error sending snmp trap: " + err.Error())
+		}
+	}
+	updateOpsgenie(results, changes)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_detectTransitions(t *testing.T) {
+	t.Parallel()
+
+	healthy, err := os.ReadFile("testFiles/zpoolSample.txt")
+	require.NoError(t, err)
+	degraded, err := os.ReadFile("testFiles/zpoolSample3.txt")
+	require.NoError(t, err)
+	healthyPools, err := parsePools(string(healthy))
+	require.NoError(t, err)
+	degradedPools, err := parsePools(string(degraded))
+	require.NoError(t, err)
+
+	var s state
+	ok := []checkResult{{name: "smart selftest", severity: severityWarning}}
+	assert.Empty(t, detectTransitions(&s, ok, healthyPools))
+	assert.Empty(t, detectTransitions(&s, ok, healthyPools))
+
+	failed := []checkResult{{name: "smart selftest", severity: severityWarning, err: errors.New("smart error: disk sdb: Completed: read failure")}}
+	assert.Equal(t, []transition{
+		{check: "smart selftest", severity: severityWarning, message: "smart error: disk sdb: Completed: read failure"},
+		{check: "pool status", pool: "primarySafe", vdev: "raidz2-0", disk: "14803813886136010794", severity: severityCritical, message: "pool primarySafe is DEGRADED (was ONLINE)"},
+	}, detectTransitions(&s, failed, degradedPools))
+
+	skipped := []checkResult{{name: "smart selftest", skipped: true}}
+	assert.Equal(t, []transition{
+		{check: "pool status", pool: "primarySafe", severity: severityInfo, message: "pool primarySafe is ONLINE (was DEGRADED)"},
+	}, detectTransitions(&s, skipped, healthyPools))
+	assert.Equal(t, []transition{
+		{check: "smart selftest", severity: severityInfo, message: "smart selftest recovered"},
+	}, detectTransitions(&s, ok, healthyPools))
+}
+
+func Test_detectTransitionsRecovery(t *testing.T) {
+	t.Parallel()
+
+	healthy, err := os.ReadFile("testFiles/zpoolSample.txt")
+	require.NoError(t, err)
+	degraded, err := os.ReadFile("testFiles/zpoolSample3.txt")
+	require.NoError(t, err)
+	healthyPools, err := parsePools(string(healthy))
+	require.NoError(t, err)
+	degradedPools, err := parsePools(string(degraded))
+	require.NoError(t, err)
+
+	var s state
+	ok := []checkResult{{name: "smart selftest", severity: severityWarning}}
+	failed := []checkResult{{name: "smart selftest", severity: severityWarning, err: errors.New("smart error: disk sdb: Completed: read failure")}}
+	detectTransitions(&s, ok, healthyPools)
+	detectTransitions(&s, failed, degradedPools)
+	assert.Equal(t, []transition{
+		{check: "smart selftest", severity: severityInfo, message: "smart selftest recovered"},
+		{check: "pool status", pool: "primarySafe", severity: severityInfo, message: "pool primarySafe is ONLINE (was DEGRADED)"},
+	}, detectTransitions(&s, ok, healthyPools))
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// readAutotrim sets the autotrim property of each pool
+func readAutotrim(e executer, pools []pool) error {
+	out, err := e("/sbin/zpool", "get", "-H", "-o", "name,value", "autotrim")
+	if err != nil {
+		return checkError{err}
+	}
+
+	values := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if name, value, ok := strings.Cut(line, "\t"); ok {
+			values[name] = strings.TrimSpace(value)
+		}
+	}
+	for i := range pools {
+		pools[i].autotrim = values[pools[i].name]
+	}
+	return nil
+}
+
+// checkTrim warns about pools with trim capable disks that haven't been fully trimmed within trimMaxAge
+func checkTrim(pools []pool, now time.Time) error {
+	var errs []error
+	for _, p := range pools {
+		last, running, ssd := p.LastTrim()
+		if !ssd || running || now.Sub(last) <= trimMaxAge {
+			continue
+		}
+		if last.IsZero() {
+			errs = append(errs, fmt.Errorf("pool %s has never been trimmed (autotrim %s)", p.name, p.autotrim))
+		} else {
+			errs = append(errs, fmt.Errorf("pool %s hasn't been trimmed since %s (autotrim %s)", p.name, last.Format("Jan 2"), p.autotrim))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkTrim(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolTrim.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+	assert.True(t, pools[0].Health())
+	assert.True(t, pools[1].Health())
+
+	last, running, ssd := pools[0].LastTrim()
+	assert.Equal(t, "2024-03-02 14:10:09", last.UTC().Format(time.DateTime))
+	assert.False(t, running)
+	assert.True(t, ssd)
+	_, _, ssd = pools[1].LastTrim()
+	assert.False(t, ssd)
+
+	e := func(cmd string, args ...string) (string, error) {
+		return "boot-pool\toff\nprimarySafe\toff\n", nil
+	}
+	require.NoError(t, readAutotrim(e, pools))
+	assert.Equal(t, "off", pools[0].autotrim)
+
+	assert.NoError(t, checkTrim(pools, last.Add(trimMaxAge)))
+	assert.EqualError(t, checkTrim(pools, last.Add(trimMaxAge+time.Hour)), "pool boot-pool hasn't been trimmed since Mar 2 (autotrim off)")
+
+	r := newHeartbeatReport(pools, map[string]space{"boot-pool": {avail: 17179869184}, "primarySafe": {avail: 17716740096}}, 0, 0, nil, nil)
+	assert.Equal(t, "boot-pool: 16.00 GiB free, last scrub Mar 31, last trim Mar 2\nprimarySafe: 16.50 GiB free, last scrub Mar 10\n", r.String())
+}
+
+func Test_parseTrim(t *testing.T) {
+	t.Parallel()
+
+	msg, trim := parseTrim("(untrimmed)")
+	assert.Empty(t, msg)
+	assert.True(t, trim.supported)
+	assert.True(t, trim.at.IsZero())
+
+	msg, trim = parseTrim("was /dev/sdc  (12% trimmed, started at Tue Apr  2 10:00:01 2024)")
+	assert.Equal(t, "was /dev/sdc", msg)
+	assert.True(t, trim.running)
+	assert.Equal(t, 12, trim.percent)
+
+	msg, trim = parseTrim("was /dev/sdc")
+	assert.Equal(t, "was /dev/sdc", msg)
+	assert.Nil(t, trim)
+}
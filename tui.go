@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// tuiRefresh is how often heartbeat tui re-reads the status file, which the job rewrites every run
+const tuiRefresh = 5 * time.Second
+
+// tuiAlerts is how many of the latest alerts the dashboard shows
+const tuiAlerts = 8
+
+// tui is the tui command: a dashboard of the last run's pools, disks, and failing checks and the latest alerts, redrawn as runs finish, for keeping an eye on a resilver over ssh.
+// status reads the status file and load the state file, for the alert history.
+func tui(w io.Writer, args []string, status func() (runStatus, error), load func() (state, error), sleep func(time.Duration)) error {
+	flags := flag.NewFlagSet("tui", flag.ContinueOnError)
+	flags.SetOutput(w)
+	once := flags.Bool("once", false, "draw the dashboard once and exit")
+	color := flags.Bool("color", true, "color pool, vdev, and disk states by health")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	for {
+		st, err := status()
+		if err != nil && *once {
+			return err
+		}
+		s, loadErr := load()
+		if loadErr != nil {
+			log.Println("error opening state file for read: " + loadErr.Error())
+		}
+
+		screen := fmt.Sprintf("error reading the status file: %s\n", err)
+		if err == nil {
+			screen = dashboard(st, s.Alerts, time.Now(), *color)
+		}
+		if *once {
+			_, err := io.WriteString(w, screen)
+			return err
+		}
+		// home the cursor and clear the screen, so each refresh replaces the last instead of scrolling
+		fmt.Fprint(w, "\x1b[H\x1b[2J"+screen)
+		sleep(tuiRefresh)
+	}
+}
+
+// dashboard renders st and the latest of alerts for a terminal
+func dashboard(st runStatus, alerts []alertRecord, now time.Time, color bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "heartbeat: last run %s (%s ago), took %s\n", st.Time.Local().Format("2006-01-02 15:04"), now.Sub(st.Time).Round(time.Second), time.Duration(st.Duration*float64(time.Second)).Round(time.Second))
+	if st.stale(now) {
+		b.WriteString(paint(color, severityCritical, "the last run is stale, is the job still running?") + "\n")
+	}
+
+	b.WriteString("\nPOOLS\n")
+	width := 0
+	for _, p := range st.Pools {
+		width = max(width, len(p.Name))
+		for _, v := range p.Vdevs {
+			width = max(width, len(v.Name)+2)
+			for _, d := range v.Disks {
+				width = max(width, len(d.Name)+4)
+			}
+		}
+	}
+	row := func(name string, state deviceState, healthy bool, detail string) {
+		sev := severityInfo
+		if !healthy {
+			sev = severityWarning
+			if state != stateDegraded {
+				sev = severityCritical
+			}
+		}
+		line := fmt.Sprintf("%-*s  %s", width, name, paint(color, sev, fmt.Sprintf("%-9s", state)))
+		if detail != "" {
+			line += "  " + detail
+		}
+		b.WriteString(strings.TrimRight(line, " ") + "\n")
+	}
+	for _, p := range st.Pools {
+		detail := ""
+		if p.Full > 0 {
+			detail = fmt.Sprintf("%.0f%% full", p.Full)
+		}
+		row(p.Name, p.State, p.Healthy, detail)
+		for _, v := range p.Vdevs {
+			indent := "    "
+			switch v.Kind {
+			case "disk":
+				// a lone disk is its own vdev
+				indent = "  "
+			case "spares":
+				row("  "+v.Name, "", v.Healthy, "")
+			default:
+				row("  "+v.Name, v.State, v.Healthy, v.Class)
+			}
+			for _, d := range v.Disks {
+				detail := ""
+				if d.Read+d.Write+d.Checksum > 0 {
+					detail = fmt.Sprintf("%d read, %d write, %d checksum errors", d.Read, d.Write, d.Checksum)
+				}
+				if d.Message != "" {
+					detail = strings.TrimSpace(detail + " " + d.Message)
+				}
+				row(indent+d.Name, d.State, d.Healthy, detail)
+			}
+		}
+		if p.Scan != "" {
+			scan, _, _ := strings.Cut(p.Scan, "\n")
+			if progress := progressRe.FindString(p.Scan); progress != "" && !strings.Contains(scan, progress) {
+				scan += ", " + progress
+			}
+			fmt.Fprintf(&b, "  %s\n", scan)
+		}
+	}
+
+	if len(st.Drives) > 0 {
+		b.WriteString("\nDISKS\n")
+		for _, d := range st.Drives {
+			temp := "    -"
+			if d.Temperature > 0 {
+				temp = fmt.Sprintf("%3d°C", d.Temperature)
+				if d.Temperature >= healthTempLimit {
+					temp = paint(color, severityWarning, temp)
+				}
+			}
+			fmt.Fprintf(&b, "%-8s %s  %s %s\n", d.Device, temp, d.Model, d.Serial)
+		}
+	}
+
+	b.WriteString("\nCHECKS\n")
+	counts := make(map[string]int)
+	for _, c := range st.Checks {
+		counts[c.Result]++
+		if c.Result == "failed" || c.Result == "errored" {
+			sev := severityWarning
+			_ = sev.UnmarshalText([]byte(c.Severity))
+			fmt.Fprintf(&b, "%s %s: %s\n", paint(color, sev, "["+c.Result+"]"), c.Name, strings.ReplaceAll(c.Message, "\n", " / "))
+		}
+	}
+	fmt.Fprintf(&b, "%d ok, %d failed, %d errored, %d skipped\n", counts["ok"], counts["failed"], counts["errored"], counts["skipped"])
+
+	if len(alerts) > 0 {
+		b.WriteString("\nRECENT ALERTS\n")
+		for _, r := range alerts[max(len(alerts)-tuiAlerts, 0):] {
+			fmt.Fprintf(&b, "%s %s %s: %s\n", r.Time.Local().Format("2006-01-02 15:04"), paint(color, r.Severity, fmt.Sprintf("%-8s", r.Severity)), r.Check, strings.ReplaceAll(r.Message, "\n", " / "))
+		}
+	}
+	return b.String()
+}
+
+// paint colors text by sev with ANSI escapes, green for info, yellow for warning, and red for critical
+func paint(color bool, sev severity, text string) string {
+	if !color {
+		return text
+	}
+	code := "32"
+	switch sev {
+	case severityWarning:
+		code = "33"
+	case severityCritical:
+		code = "31"
+	}
+	return "\x1b[" + code + "m" + text + "\x1b[0m"
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_dashboard(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolSample3.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+	now := time.Date(2024, time.April, 6, 8, 15, 0, 0, time.UTC)
+	results := []checkResult{
+		{name: "pool status", severity: severityCritical, err: errors.New("pool primarySafe is DEGRADED")},
+		{name: "smart selftest", severity: severityWarning, err: checkError{errors.New("disk sde: exit status 2")}},
+		{name: "disk usage"},
+		{name: "zrepl", skipped: true},
+	}
+	st := newRunStatus(now, 95*time.Second, results, pools, map[string]space{"primarySafe": {used: 600, avail: 400}}, nil)
+	st.addDrives([]drive{{Device: "sda", Model: "WDC WD80EFAX", Serial: "VK0ABCD", Temperature: 38}, {Device: "sdb", Model: "ST8000DM004", Serial: "ZA1B2C3", Temperature: -1}})
+	alerts := []alertRecord{{Time: now.Add(-time.Hour), Check: "pool status", Severity: severityCritical, Message: "pool primarySafe is DEGRADED\nvdev raidz2-0 is DEGRADED"}}
+
+	assert.Equal(t, `heartbeat: last run 2024-04-06 08:15 (2m0s ago), took 1m35s
+
+POOLS
+freenas-boot                              ONLINE
+  mirror-0                                ONLINE
+    nvme0p2                               ONLINE
+    nvme1p2                               ONLINE
+  scrub repaired 0 in 0 days 00:03:07 with 0 errors on Fri Apr 24 03:48:07 2020
+primarySafe                               DEGRADED   60% full
+  raidz2-0                                DEGRADED
+    60ef726b-e8ec-11e3-aabf-d43d7ef79ff0  ONLINE
+    14803813886136010794                  UNAVAIL    was /dev/gptid/4167d912-9102-11e2-a05e-b8975a0e7ea3
+    e43d41b6-adcc-11e5-b06a-d43d7ef79ff0  ONLINE
+    d2cf85c0-4737-11e3-920b-b8975a0e7ea3  ONLINE
+    4263a3dc-aa5e-11e8-9954-ac1f6b82895c  ONLINE
+    c9f041eb-5a83-11e5-9cd4-d43d7ef79ff0  ONLINE
+  scrub repaired 0 in 0 days 03:35:38 with 0 errors on Sun Apr  5 03:35:41 2020
+
+DISKS
+sda       38°C  WDC WD80EFAX VK0ABCD
+sdb          -  ST8000DM004 ZA1B2C3
+
+CHECKS
+[failed] pool status: pool primarySafe is DEGRADED
+[errored] smart selftest: disk sde: exit status 2
+1 ok, 1 failed, 1 errored, 1 skipped
+
+RECENT ALERTS
+2024-04-06 07:15 critical pool status: pool primarySafe is DEGRADED / vdev raidz2-0 is DEGRADED
+`, dashboard(st, alerts, now.Add(2*time.Minute), false))
+
+	assert.Contains(t, dashboard(st, nil, now.Add(3*time.Hour), true), "\x1b[31mthe last run is stale, is the job still running?\x1b[0m")
+}
+
+func Test_tui(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	status := func() (runStatus, error) { return runStatus{Time: now}, nil }
+	load := func() (state, error) { return state{}, nil }
+
+	var out bytes.Buffer
+	require.NoError(t, tui(&out, []string{"-once"}, status, load, nil))
+	assert.Contains(t, out.String(), "0 ok, 0 failed, 0 errored, 0 skipped")
+
+	missing := func() (runStatus, error) { return runStatus{}, os.ErrNotExist }
+	assert.ErrorIs(t, tui(&out, []string{"-once"}, missing, load, nil), os.ErrNotExist)
+
+	// without -once it redraws until killed, so stop it from the sleep between refreshes
+	out.Reset()
+	draws := 0
+	func() {
+		defer func() { recover() }()
+		tui(&out, []string{"-color=false"}, status, load, func(d time.Duration) {
+			assert.Equal(t, tuiRefresh, d)
+			if draws++; draws == 2 {
+				panic("stop")
+			}
+		})
+	}()
+	assert.Equal(t, 2, bytes.Count(out.Bytes(), []byte("\x1b[H\x1b[2J")))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseSize reads a size as zfs prints it (eg 573B, 1.20G, or 16.5T) in bytes. zfs sizes are powers of 1024.
+func parseSize(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := uint64(1)
+	unit := s[len(s)-1]
+	if unit < '0' || unit > '9' {
+		i := strings.IndexByte("BKMGTPE", unit)
+		if i < 0 {
+			return 0, fmt.Errorf("unknown unit in size %q", s)
+		}
+		multiplier = 1 << (10 * i)
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(n * float64(multiplier)), nil
+}
+
+// formatBytes renders a byte count in binary units, eg 1.50 GiB
+func formatBytes(n uint64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	value := float64(n) / 1024
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f %ciB", value, units[i])
+}
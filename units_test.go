@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseSize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size  string
+		bytes uint64
+	}{
+		{"573B", 573},
+		{"185", 185},
+		{"1.50K", 1536},
+		{"16.5G", 17716740096},
+		{"2T", 2 << 40},
+	}
+
+	for _, tt := range tests {
+		n, err := parseSize(tt.size)
+		require.NoError(t, err, tt.size)
+		assert.Equal(t, tt.bytes, n, tt.size)
+	}
+
+	_, err := parseSize("12Q")
+	assert.Error(t, err)
+}
+
+func Test_formatBytes(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.50 KiB", formatBytes(1536))
+	assert.Equal(t, "16.50 GiB", formatBytes(17716740096))
+	assert.Equal(t, "2.00 TiB", formatBytes(2<<40))
+}
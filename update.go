@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const githubAPI = "https://api.github.com"
+
+// checksumsAsset lists the sha256 of every other asset in a release, in sha256sum's format. It's signed by checksumsAsset+".sig" when updateKey is set.
+const checksumsAsset = "SHA256SUMS"
+
+// updateAsset is the release asset built for this machine, see linuxBuild.sh
+func updateAsset() string {
+	return "heartbeat-" + runtime.GOOS + "-" + runtime.GOARCH
+}
+
+// release is the part of a GitHub release self-update needs
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset finds the download URL of the named asset
+func (r release) asset(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no %s", r.Tag, name)
+}
+
+// verifyChecksum checks data is the asset called name in sums, a sha256sum listing
+func verifyChecksum(sums []byte, name string, data []byte) error {
+	for _, line := range strings.Split(string(sums), "\n") {
+		sum, file, ok := strings.Cut(strings.TrimSpace(line), " ")
+		// sha256sum marks files it read in binary mode with a *
+		if !ok || strings.TrimPrefix(strings.TrimSpace(file), "*") != name {
+			continue
+		}
+		got := sha256.Sum256(data)
+		if !strings.EqualFold(sum, hex.EncodeToString(got[:])) {
+			return fmt.Errorf("%s doesn't match its checksum, the download may be corrupt or tampered with", name)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+// verifySignature checks sig, base64 encoded, is key's ed25519 signature of data
+func verifySignature(key string, data, sig []byte) error {
+	public, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return errors.New("updateKey isn't a base64 ed25519 public key")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil || !ed25519.Verify(public, data, raw) {
+		return fmt.Errorf("%s isn't signed by updateKey", checksumsAsset)
+	}
+	return nil
+}
+
+// download fetches url, giving up on anything bigger than a heartbeat binary should be
+func download(url string) ([]byte, error) {
+	client := http.Client{Timeout: 5 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 256<<20))
+}
+
+// releaseVersion parses a version the way git describe writes it from a release tag, eg v1.2.3, or v1.2.3-4-gabcdef0 for 4 commits after v1.2.3
+func releaseVersion(v string) ([]int, bool) {
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "v"), "-dirty")
+	base, after, _ := strings.Cut(v, "-")
+	parts := make([]int, 4)
+	if after != "" {
+		commits, hash, ok := strings.Cut(after, "-g")
+		n, err := strconv.Atoi(commits)
+		if !ok || hash == "" || err != nil {
+			return nil, false
+		}
+		parts[3] = n
+	}
+	fields := strings.Split(base, ".")
+	if len(fields) > 3 {
+		return nil, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// checkNewer reports whether the release tagged tag is newer than current, refusing an older one so a past release, signed or not, can't be passed off as the latest.
+// A build that isn't from a release tag can't be compared, so any release is newer than it.
+func checkNewer(tag, current string) (bool, error) {
+	latest, ok := releaseVersion(tag)
+	if !ok {
+		return false, fmt.Errorf("release %s isn't tagged with a version like v1.2.3", tag)
+	}
+	running, ok := releaseVersion(current)
+	if !ok {
+		return true, nil
+	}
+	c := slices.Compare(latest, running)
+	if c < 0 {
+		return false, fmt.Errorf("the latest release, %s, is older than this build, %s, refusing to downgrade", tag, current)
+	}
+	return c > 0, nil
+}
+
+// fetchUpdate downloads the latest release's binary for this machine, verifying it against the release's checksums and, with updateKey set, their signature
+func fetchUpdate(fetch func(url string) ([]byte, error), repo, key string) (release, []byte, error) {
+	var rel release
+	data, err := fetch(githubAPI + "/repos/" + repo + "/releases/latest")
+	if err != nil {
+		return rel, nil, err
+	}
+	if err := json.Unmarshal(data, &rel); err != nil {
+		return rel, nil, fmt.Errorf("reading the latest release of %s: %w", repo, err)
+	}
+	if newer, err := checkNewer(rel.Tag, buildVersion()); err != nil || !newer {
+		return rel, nil, err
+	}
+
+	url, err := rel.asset(checksumsAsset)
+	if err != nil {
+		return rel, nil, err
+	}
+	sums, err := fetch(url)
+	if err != nil {
+		return rel, nil, err
+	}
+	if key != "" {
+		url, err := rel.asset(checksumsAsset + ".sig")
+		if err != nil {
+			return rel, nil, err
+		}
+		sig, err := fetch(url)
+		if err != nil {
+			return rel, nil, err
+		}
+		if err := verifySignature(key, sums, sig); err != nil {
+			return rel, nil, err
+		}
+	}
+
+	if url, err = rel.asset(updateAsset()); err != nil {
+		return rel, nil, err
+	}
+	binary, err := fetch(url)
+	if err != nil {
+		return rel, nil, err
+	}
+	return rel, binary, verifyChecksum(sums, updateAsset(), binary)
+}
+
+// replaceBinary swaps binary in for the executable at path in one step, after making sure it runs and is the release tagged tag.
+// The binary's checksum is signed, so its version can be trusted where the tag a release is published under can't.
+func replaceBinary(path string, binary []byte, tag string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".heartbeat-update")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	out, err := exec.Command(f.Name(), "--version").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("the new binary doesn't run: %w: %s", err, out)
+	}
+	if first, _, _ := strings.Cut(string(out), "\n"); first != "heartbeat "+tag {
+		return fmt.Errorf("release %s is really %q, refusing to install it", tag, first)
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// selfUpdate is the self-update command: it replaces this binary with the latest release from updateRepo, or with -check only says whether there is one
+func selfUpdate(w io.Writer, args []string) error {
+	flags := flag.NewFlagSet("self-update", flag.ContinueOnError)
+	flags.SetOutput(w)
+	check := flags.Bool("check", false, "only print whether there's a newer release")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if updateRepo == "" {
+		return errors.New("set updateRepo to the GitHub repository your builds are released from")
+	}
+
+	rel, binary, err := fetchUpdate(download, updateRepo, updateKey)
+	if err != nil {
+		return err
+	}
+	if binary == nil {
+		fmt.Fprintf(w, "heartbeat %s is the latest release\n", rel.Tag)
+		return nil
+	}
+	if *check {
+		fmt.Fprintf(w, "heartbeat %s is available, this is %s\n", rel.Tag, buildVersion())
+		return nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self, err = filepath.EvalSymlinks(self); err != nil {
+		return err
+	}
+	if err := replaceBinary(self, binary, rel.Tag); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "updated %s from %s to %s\n", self, buildVersion(), rel.Tag)
+	return nil
+}
+
+// releaseCommand is the release command, for publishing builds self-update will accept: release keygen <file> writes a new signing key, printing the public half for updateKey, and release sign <key file> <file> writes file.sig
+func releaseCommand(w io.Writer, args []string) error {
+	switch {
+	case len(args) == 2 && args[0] == "keygen":
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(args[1], []byte(base64.StdEncoding.EncodeToString(private)+"\n"), 0o600); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "wrote the signing key to %s, keep it secret. Set updateKey to:\n%s\n", args[1], base64.StdEncoding.EncodeToString(public))
+		return nil
+	case len(args) == 3 && args[0] == "sign":
+		encoded, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		private, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(encoded)))
+		if err != nil || len(private) != ed25519.PrivateKeySize {
+			return fmt.Errorf("%s isn't a signing key from heartbeat release keygen", args[1])
+		}
+		data, err := os.ReadFile(args[2])
+		if err != nil {
+			return err
+		}
+		sig := base64.StdEncoding.EncodeToString(ed25519.Sign(private, data))
+		return os.WriteFile(args[2]+".sig", []byte(sig+"\n"), 0o644)
+	default:
+		return errors.New("usage: heartbeat release keygen <key file> | heartbeat release sign <key file> <file>")
+	}
+}
+
+// printVersion is --version: the release, and what it was built from
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "heartbeat %s\n", buildVersion())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := make(map[string]string)
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if rev := settings["vcs.revision"]; rev != "" {
+			if settings["vcs.modified"] == "true" {
+				rev += " (modified)"
+			}
+			fmt.Fprintf(w, "commit %s %s\n", rev, settings["vcs.time"])
+		}
+		fmt.Fprintf(w, "built with %s for %s/%s\n", info.GoVersion, runtime.GOOS, runtime.GOARCH)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifyChecksum(t *testing.T) {
+	t.Parallel()
+
+	binary := []byte("new heartbeat")
+	sum := sha256.Sum256(binary)
+	sums := []byte("0123  heartbeat-linux-arm64\n" + hex.EncodeToString(sum[:]) + " *heartbeat-linux-amd64\n")
+
+	assert.NoError(t, verifyChecksum(sums, "heartbeat-linux-amd64", binary))
+	assert.EqualError(t, verifyChecksum(sums, "heartbeat-linux-amd64", []byte("something else")), "heartbeat-linux-amd64 doesn't match its checksum, the download may be corrupt or tampered with")
+	assert.EqualError(t, verifyChecksum(sums, "heartbeat-freebsd-amd64", binary), "SHA256SUMS has no checksum for heartbeat-freebsd-amd64")
+}
+
+func Test_verifySignature(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	key := base64.StdEncoding.EncodeToString(public)
+	sums := []byte("abcd  heartbeat-linux-amd64\n")
+	sig := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, sums)) + "\n")
+
+	assert.NoError(t, verifySignature(key, sums, sig))
+	assert.EqualError(t, verifySignature(key, []byte("dcba  heartbeat-linux-amd64\n"), sig), "SHA256SUMS isn't signed by updateKey")
+	assert.EqualError(t, verifySignature("not a key", sums, sig), "updateKey isn't a base64 ed25519 public key")
+}
+
+func Test_fetchUpdate(t *testing.T) {
+	t.Parallel()
+
+	public, private, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	binary := []byte("new heartbeat")
+	sum := sha256.Sum256(binary)
+	sums := []byte(hex.EncodeToString(sum[:]) + "  " + updateAsset() + "\n")
+
+	rel := map[string]any{"tag_name": "v2.0.0", "assets": []map[string]string{
+		{"name": updateAsset(), "browser_download_url": "https://example.com/binary"},
+		{"name": "SHA256SUMS", "browser_download_url": "https://example.com/sums"},
+		{"name": "SHA256SUMS.sig", "browser_download_url": "https://example.com/sig"},
+	}}
+	latest, err := json.Marshal(rel)
+	require.NoError(t, err)
+	files := map[string][]byte{
+		"https://api.github.com/repos/me/zfsHeartbeat/releases/latest": latest,
+		"https://example.com/binary":                                   binary,
+		"https://example.com/sums":                                     sums,
+		"https://example.com/sig":                                      []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(private, sums))),
+	}
+	fetch := func(url string) ([]byte, error) {
+		if data, ok := files[url]; ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("%s: 404 Not Found", url)
+	}
+
+	got, gotBinary, err := fetchUpdate(fetch, "me/zfsHeartbeat", base64.StdEncoding.EncodeToString(public))
+	require.NoError(t, err)
+	assert.Equal(t, "v2.0.0", got.Tag)
+	assert.Equal(t, binary, gotBinary)
+
+	other, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, _, err = fetchUpdate(fetch, "me/zfsHeartbeat", base64.StdEncoding.EncodeToString(other))
+	assert.EqualError(t, err, "SHA256SUMS isn't signed by updateKey")
+}
+
+func Test_checkNewer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		tag, current string
+		newer        bool
+		err          string
+	}{
+		{"v2.0.0", "v1.9.3", true, ""},
+		{"v1.10.0", "v1.9.3", true, ""},
+		{"v1.9.3", "v1.9.3", false, ""},
+		{"v1.9.4", "v1.9.3-12-gabcdef0-dirty", true, ""},
+		{"v1.9.3", "v1.9.3-12-gabcdef0", false, "the latest release, v1.9.3, is older than this build, v1.9.3-12-gabcdef0, refusing to downgrade"},
+		{"v1.9", "v1.9.3", false, "the latest release, v1.9, is older than this build, v1.9.3, refusing to downgrade"},
+		{"v1.2.0", "v1.9.3", false, "the latest release, v1.2.0, is older than this build, v1.9.3, refusing to downgrade"},
+		{"v1.2.0", "abcdef012345", true, ""},
+		{"latest", "v1.9.3", false, "release latest isn't tagged with a version like v1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag+" over "+tt.current, func(t *testing.T) {
+			newer, err := checkNewer(tt.tag, tt.current)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.newer, newer)
+		})
+	}
+}
+
+func Test_replaceBinary(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "heartbeat")
+	require.NoError(t, os.WriteFile(path, []byte("old heartbeat"), 0o755))
+	binary := []byte("#!/bin/sh\necho heartbeat v1.2.0\necho commit abcdef\n")
+
+	assert.EqualError(t, replaceBinary(path, binary, "v2.0.0"), `release v2.0.0 is really "heartbeat v1.2.0", refusing to install it`)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "old heartbeat", string(data))
+
+	require.NoError(t, replaceBinary(path, binary, "v1.2.0"))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, binary, data)
+}
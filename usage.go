@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// usageLimit is how full a pool can get, in percent, before it's a warning or critical
+type usageLimit struct {
+	warn     float64
+	critical float64
+}
+
+// percent is how much of the space s could hold is used
+func (s space) percent() float64 {
+	if s.used+s.avail == 0 {
+		return 0
+	}
+	return float64(s.used) / float64(s.used+s.avail) * 100
+}
+
+// poolLimit returns the usage thresholds for the named pool
+func poolLimit(name string) usageLimit {
+	if l, ok := poolUsageLimits[name]; ok {
+		return l
+	}
+	return usageLimit{warn: poolUsageWarn, critical: poolUsageCritical}
+}
+
+// checkPoolUsage returns an error if the pool has crossed one of its usage thresholds
+func checkPoolUsage(name string, s space) error {
+	limit := poolLimit(name)
+	full := s.percent()
+	err := fmt.Errorf("pool %s is %.1f%% full, %s available", name, full, formatBytes(s.avail))
+	switch {
+	case limit.critical > 0 && full >= limit.critical:
+		return severityError{severityCritical, err}
+	case limit.warn > 0 && full >= limit.warn:
+		return severityError{severityWarning, err}
+	}
+	return nil
+}
+
+// recordUsage adds how full each pool is to the disk usage check's span and syslog
+func recordUsage(span *span, usage map[string]space) {
+	for _, name := range diskUsagePools {
+		s, ok := usage[name]
+		if !ok {
+			continue
+		}
+		full := strconv.FormatFloat(s.percent(), 'f', 1, 64)
+		span.attrs["pool."+name+".used_percent"] = full
+		logEvent(severityInfo, fmt.Sprintf("pool %s is %s%% full", name, full), map[string]string{"HEARTBEAT_POOL": name, "HEARTBEAT_USED_PERCENT": full})
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkPoolUsage(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		used     uint64
+		avail    uint64
+		severity severity
+		err      string
+	}{
+		{50, 50, severityInfo, ""},
+		{80, 20, severityWarning, "pool primarySafe is 80.0% full, 20 B available"},
+		{96, 4, severityCritical, "pool primarySafe is 96.0% full, 4 B available"},
+		{0, 0, severityInfo, ""},
+	}
+
+	for _, tt := range tests {
+		err := checkPoolUsage("primarySafe", space{used: tt.used, avail: tt.avail})
+		if tt.err == "" {
+			assert.NoError(t, err)
+			continue
+		}
+		require.EqualError(t, err, tt.err)
+		var se severityError
+		require.ErrorAs(t, err, &se)
+		assert.Equal(t, tt.severity, se.severity)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gregdel/pushover"
+)
+
+// knownChecks is every check disabledChecks can turn off
+var knownChecks = []string{"pool status", "disk replacement", "pool topology", "transient errors", "pool operations", "pool checkpoint", "pool trim", "scrub speed", "dedup table", "compression", "zvols", "snapshot policy", "zrepl", "restore", "services", "peers", "smart selftest", "health score", "sas links", "kernel log", "network", "disk usage", "drive inventory", "disk age", "report share", "run duration", "config"}
+
+// configProblem is a mistake in the settings at the top of main.go
+type configProblem struct {
+	setting string
+	err     error
+	warning bool // the run can go ahead anyway, eg a notifier that can't be reached right now
+}
+
+func (p configProblem) String() string {
+	if p.warning {
+		return fmt.Sprintf("[warning] %s: %s", p.setting, p.err)
+	}
+	return fmt.Sprintf("[error]   %s: %s", p.setting, p.err)
+}
+
+type configValidator struct {
+	problems []configProblem
+}
+
+func (v *configValidator) fail(setting string, err error) {
+	v.problems = append(v.problems, configProblem{setting: setting, err: err})
+}
+
+func (v *configValidator) warn(setting string, err error) {
+	v.problems = append(v.problems, configProblem{setting: setting, err: err, warning: true})
+}
+
+// validateConfig looks for settings that would otherwise only show up as a check quietly doing nothing, or a notification that never arrives.
+// stat is os.Stat, to look for the disks in smartDisks.
+func validateConfig(e executer, stat func(string) (os.FileInfo, error)) []configProblem {
+	var v configValidator
+	v.checkNames("disabledChecks", disabledChecks)
+	v.checkNames("checkIntervals", sortedKeys(checkIntervals))
+	v.checkNames("heavyChecks", heavyChecks)
+	if busyIOWait < 0 || busyIOWait > 100 {
+		v.fail("busyIOWait", fmt.Errorf("%g should be a percentage", busyIOWait))
+	}
+	for _, name := range sortedKeys(checkIntervals) {
+		if checkIntervals[name] <= 0 {
+			v.fail("checkIntervals", fmt.Errorf("%s interval %s should be positive", name, checkIntervals[name]))
+		}
+	}
+	if hostMode != "" && !slices.Contains(hostModes, hostMode) {
+		v.fail("hostMode", fmt.Errorf("unknown host mode %q, expected %s", hostMode, strings.Join(hostModes, " or ")))
+	}
+	if hostMode != "" && sudoHelper {
+		v.fail("sudoHelper", errors.New("the sudo helper can't run through hostMode, give the container the privileges zpool and smartctl need instead"))
+	}
+	if reportShare != "" && reportDir == "" {
+		v.fail("reportShare", errors.New("set reportDir to where the share is mounted"))
+	}
+	if !slices.Contains(pushoverFormats, pushoverFormat) {
+		v.fail("pushoverFormat", fmt.Errorf("unknown format %q, expected html, monospace, or empty for plain text", pushoverFormat))
+	}
+	if readOnly && autoClear {
+		v.fail("autoClear", errors.New("autoClear needs zpool clear, which readOnly refuses to run"))
+	}
+	v.usageLimits(poolUsageWarn, poolUsageCritical, poolUsageLimits)
+	v.quietHours(quietStart, quietEnd)
+	v.sizes("datasetMinFree", datasetMinFree)
+	v.excludeRules(smartExclude)
+	v.notifyURLs("notifyURLs", notifyURLs)
+	for _, group := range sortedKeys(notifyGroups) {
+		v.notifyURLs("notifyGroups["+group+"]", notifyGroups[group])
+	}
+	v.locales(notifyLocales, notifyGroups)
+	v.services(services)
+	v.datasets(e, map[string][]string{
+		"diskUsagePools":  diskUsagePools,
+		"poolUsageLimits": sortedKeys(poolUsageLimits),
+		"datasetMinFree":  sortedKeys(datasetMinFree),
+		"snapshotPolicy":  sortedKeys(snapshotPolicy),
+		"restoreDataset":  slices.DeleteFunc([]string{restoreDataset}, func(s string) bool { return s == "" }),
+	})
+	// the disks of an instance on another host aren't in this machine's /dev
+	if remoteHost == "" {
+		v.devices(stat, smartDisks)
+	}
+	return v.problems
+}
+
+// configError joins the problems that should stop a run from being trusted, logging the warnings
+func configError(problems []configProblem) error {
+	var errs []error
+	for _, p := range problems {
+		if p.warning {
+			log.Println("config " + p.String())
+			continue
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", p.setting, p.err))
+	}
+	return errors.Join(errs...)
+}
+
+func (v *configValidator) checkNames(setting string, names []string) {
+	for _, name := range names {
+		if slices.Contains(knownChecks, name) {
+			continue
+		}
+		err := fmt.Errorf("unknown check %q", name)
+		for _, known := range knownChecks {
+			if strings.Contains(known, strings.ToLower(strings.TrimSpace(name))) {
+				err = fmt.Errorf("unknown check %q, did you mean %q?", name, known)
+				break
+			}
+		}
+		v.fail(setting, err)
+	}
+}
+
+func (v *configValidator) usageLimits(warn, critical float64, limits map[string]usageLimit) {
+	check := func(setting string, l usageLimit) {
+		switch {
+		case l.warn <= 0 || l.warn > 100 || l.critical <= 0 || l.critical > 100:
+			v.fail(setting, fmt.Errorf("limits of %g%% and %g%% aren't percentages", l.warn, l.critical))
+		case l.warn > l.critical:
+			v.fail(setting, fmt.Errorf("warns at %g%%, after it's already critical at %g%%", l.warn, l.critical))
+		}
+	}
+	check("poolUsageWarn", usageLimit{warn: warn, critical: critical})
+	for _, name := range sortedKeys(limits) {
+		check("poolUsageLimits["+name+"]", limits[name])
+	}
+}
+
+func (v *configValidator) quietHours(start, end int) {
+	if start < 0 || start > 23 || end < 0 || end > 23 {
+		v.fail("quietStart", fmt.Errorf("quiet hours %d to %d aren't hours of the day (0-23)", start, end))
+	}
+}
+
+func (v *configValidator) sizes(setting string, sizes map[string]string) {
+	for _, name := range sortedKeys(sizes) {
+		if _, err := parseSize(sizes[name]); err != nil {
+			v.fail(setting+"["+name+"]", fmt.Errorf("%q isn't a size, eg 200G: %w", sizes[name], err))
+		}
+	}
+}
+
+func (v *configValidator) excludeRules(rules []string) {
+	for _, rule := range rules {
+		kind, pattern, _ := strings.Cut(rule, ":")
+		switch {
+		case kind != "serial" && kind != "model" && kind != "path":
+			v.fail("smartExclude", fmt.Errorf("rule %q should start with serial:, model:, or path:", rule))
+		case pattern == "":
+			v.fail("smartExclude", fmt.Errorf("rule %q has nothing to match", rule))
+		default:
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.fail("smartExclude", fmt.Errorf("rule %q: %w", rule, err))
+			}
+		}
+	}
+}
+
+func (v *configValidator) notifyURLs(setting string, urls []string) {
+	for _, raw := range urls {
+		if _, err := parseNotifyURL(raw); err != nil {
+			v.fail(setting, err)
+		}
+	}
+}
+
+func (v *configValidator) locales(locales map[string]string, groups map[string][]string) {
+	for _, group := range sortedKeys(locales) {
+		if _, ok := groups[group]; !ok {
+			v.fail("notifyLocales", fmt.Errorf("%s isn't a group in notifyGroups", group))
+		}
+	}
+}
+
+func (v *configValidator) services(services []service) {
+	for _, s := range services {
+		switch {
+		case s.Address == "":
+			v.fail("services", fmt.Errorf("%s service has no address", s.Kind))
+		case s.Kind == "nfs", s.Kind == "smb", s.Kind == "iscsi":
+		case s.Kind == "tcp":
+			if _, _, err := net.SplitHostPort(s.Address); err != nil {
+				v.fail("services", fmt.Errorf("tcp service %s needs a port, eg %s:80", s.Address, s.Address))
+			}
+		default:
+			v.fail("services", fmt.Errorf("unknown service kind %q for %s, expected nfs, smb, iscsi, or tcp", s.Kind, s.Address))
+		}
+	}
+}
+
+// datasets checks that every pool and dataset named in the settings in refs exists
+func (v *configValidator) datasets(e executer, refs map[string][]string) {
+	var names []string
+	for _, setting := range sortedKeys(refs) {
+		names = append(names, refs[setting]...)
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	out, err := e("zfs", "list", "-H", "-o", "name")
+	if err != nil {
+		v.warn("zfs list", fmt.Errorf("couldn't list datasets to check the pools and datasets in the config exist: %w", err))
+		return
+	}
+	existing := strings.Fields(out)
+	for _, setting := range sortedKeys(refs) {
+		for _, name := range refs[setting] {
+			if !slices.Contains(existing, name) {
+				v.fail(setting, fmt.Errorf("no pool or dataset named %s", name))
+			}
+		}
+	}
+}
+
+func (v *configValidator) devices(stat func(string) (os.FileInfo, error), disks []string) {
+	for _, disk := range disks {
+		device, _, _ := strings.Cut(disk, ":")
+		if _, err := stat(hostPath("/dev/" + device)); err != nil {
+			v.fail("smartDisks", fmt.Errorf("no disk /dev/%s", device))
+		}
+	}
+}
+
+// validate is the validate command: it prints every problem with the config, including notifiers that can't be reached, and returns false if any are errors
+func validate(w io.Writer, e executer, app recipientChecker) bool {
+	problems := validateConfig(e, os.Stat)
+
+	// reaching the notifiers is slow and depends on the network, so it's only done here rather than every run
+	var v configValidator
+	if pushoverEnabled {
+		if _, err := app.GetRecipientDetails(pushover.NewRecipient(user)); err != nil {
+			v.warn("pushover", fmt.Errorf("token and user key weren't accepted: %w", err))
+		}
+	}
+	for _, b := range enabledBackends() {
+		host := backendHost(b)
+		conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+		if err != nil {
+			v.warn(b.name(), fmt.Errorf("%s unreachable: %w", host, err))
+			continue
+		}
+		conn.Close()
+	}
+	problems = append(problems, v.problems...)
+
+	ok := true
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+		ok = ok && p.warning
+	}
+	if len(problems) == 0 {
+		fmt.Fprintln(w, "configuration ok")
+	}
+	return ok
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_validateConfig(t *testing.T) {
+	t.Parallel()
+
+	e := func(cmd string, args ...string) (string, error) {
+		return "boot-pool\nprimarySafe\nprimarySafe/home\n", nil
+	}
+	stat := func(name string) (os.FileInfo, error) {
+		return nil, nil
+	}
+	assert.Empty(t, validateConfig(e, stat), "the config as shipped")
+
+	stat = func(name string) (os.FileInfo, error) {
+		if name == "/dev/sdf" {
+			return nil, os.ErrNotExist
+		}
+		return nil, nil
+	}
+	e = func(cmd string, args ...string) (string, error) {
+		return "primarySafe\n", nil
+	}
+	problems := validateConfig(e, stat)
+	assert.Equal(t, []configProblem{
+		{setting: "diskUsagePools", err: errors.New("no pool or dataset named boot-pool")},
+		{setting: "smartDisks", err: errors.New("no disk /dev/sdf")},
+	}, problems)
+	assert.EqualError(t, configError(problems), "diskUsagePools: no pool or dataset named boot-pool\nsmartDisks: no disk /dev/sdf")
+}
+
+func Test_configValidator(t *testing.T) {
+	t.Parallel()
+
+	var v configValidator
+	v.checkNames("disabledChecks", []string{"smart selftest", "SMART", "bogus"})
+	v.usageLimits(80, 95, map[string]usageLimit{"boot-pool": {warn: 98, critical: 90}, "tank": {warn: 90, critical: 150}})
+	v.quietHours(23, 24)
+	v.sizes("datasetMinFree", map[string]string{"primarySafe/vms": "200G", "primarySafe/home": "lots"})
+	v.excludeRules([]string{"path:sdf", "serial:", "disk:sdg", "model:[ST*"})
+	v.notifyURLs("notifyURLs", []string{"discord://1234/abcd", "pushover://user"})
+	v.locales(map[string]string{"family": "es", "admins": "en"}, map[string][]string{"family": {"pushover://token@user"}})
+	v.services([]service{{Kind: "smb", Address: "localhost"}, {Kind: "tcp", Address: "localhost"}, {Kind: "ftp", Address: "nas"}, {Kind: "nfs"}})
+	v.datasets(func(cmd string, args ...string) (string, error) { return "", errors.New("exit status 1") }, map[string][]string{"diskUsagePools": {"tank"}})
+
+	var lines []string
+	for _, p := range v.problems {
+		lines = append(lines, p.String())
+	}
+	assert.Equal(t, []string{
+		`[error]   disabledChecks: unknown check "SMART", did you mean "smart selftest"?`,
+		`[error]   disabledChecks: unknown check "bogus"`,
+		`[error]   poolUsageLimits[boot-pool]: warns at 98%, after it's already critical at 90%`,
+		`[error]   poolUsageLimits[tank]: limits of 90% and 150% aren't percentages`,
+		`[error]   quietStart: quiet hours 23 to 24 aren't hours of the day (0-23)`,
+		`[error]   datasetMinFree[primarySafe/home]: "lots" isn't a size, eg 200G: unknown unit in size "lots"`,
+		`[error]   smartExclude: rule "serial:" has nothing to match`,
+		`[error]   smartExclude: rule "disk:sdg" should start with serial:, model:, or path:`,
+		`[error]   smartExclude: rule "model:[ST*": syntax error in pattern`,
+		`[error]   notifyURLs: pushover://user: expected pushover://token@user`,
+		`[error]   notifyLocales: admins isn't a group in notifyGroups`,
+		`[error]   services: tcp service localhost needs a port, eg localhost:80`,
+		`[error]   services: unknown service kind "ftp" for nas, expected nfs, smb, iscsi, or tcp`,
+		`[error]   services: nfs service has no address`,
+		`[warning] zfs list: couldn't list datasets to check the pools and datasets in the config exist: exit status 1`,
+	}, lines)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Results are sent as Zabbix trapper items using these keys:
+//
+//	zfsheartbeat.check[<check>]         1 if the check passed, 0 if it failed, eg zfsheartbeat.check[pool status]
+//	zfsheartbeat.check.message[<check>] the failure message, or empty when the check passed
+//	zfsheartbeat.check.duration[<check>] seconds the check took
+//	zfsheartbeat.run.duration            seconds the whole run took
+//	zfsheartbeat.pool.state[<pool>]     the pool's state, eg ONLINE or DEGRADED
+//	zfsheartbeat.pool.healthy[<pool>]   1 if the pool and all its vdevs and disks are healthy, 0 otherwise
+//	zfsheartbeat.pool.used[<pool>]      bytes used
+//	zfsheartbeat.pool.free[<pool>]      bytes available
+//	zfsheartbeat.pool.full[<pool>]      percent of the pool's space used
+//
+// Create matching trapper items (numeric for check, healthy, used, free, full, and the durations, with units B for used and free, % for full, and s for the durations; text for the rest) on the host named zabbixHost.
+const (
+	zabbixKeyCheck        = "zfsheartbeat.check[%s]"
+	zabbixKeyCheckMessage = "zfsheartbeat.check.message[%s]"
+	zabbixKeyCheckTime    = "zfsheartbeat.check.duration[%s]"
+	zabbixKeyRunTime      = "zfsheartbeat.run.duration"
+	zabbixKeyPoolState    = "zfsheartbeat.pool.state[%s]"
+	zabbixKeyPoolHealthy  = "zfsheartbeat.pool.healthy[%s]"
+	zabbixKeyPoolUsed     = "zfsheartbeat.pool.used[%s]"
+	zabbixKeyPoolFree     = "zfsheartbeat.pool.free[%s]"
+	zabbixKeyPoolFull     = "zfsheartbeat.pool.full[%s]"
+)
+
+type zabbixItem struct {
+	Host  string `json:"host"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	Clock int64  `json:"clock"`
+}
+
+type zabbixResponse struct {
+	Response string `json:"response"`
+	Info     string `json:"info"`
+}
+
+// sendZabbix pushes the results of a run to zabbixServer
+func sendZabbix(results []checkResult, pools []pool, free map[string]space, elapsed time.Duration) error {
+	if zabbixServer == "" {
+		return nil
+	}
+
+	host := zabbixHost
+	if host == "" {
+		host = hostname()
+	}
+	items := zabbixItems(host, time.Now(), elapsed, results, pools, free)
+	packet, err := zabbixPacket(map[string]any{"request": "sender data", "data": items})
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", zabbixServer, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+	if _, err := conn.Write(packet); err != nil {
+		return err
+	}
+
+	var resp zabbixResponse
+	if err := readZabbixPacket(conn, &resp); err != nil {
+		return err
+	}
+	if resp.Response != "success" {
+		return fmt.Errorf("zabbix rejected items: %s", resp.Info)
+	}
+	if !strings.Contains(resp.Info, "failed: 0") {
+		return fmt.Errorf("zabbix failed to process some items (check the item keys on host %s): %s", host, resp.Info)
+	}
+
+	return nil
+}
+
+func zabbixItems(host string, now time.Time, elapsed time.Duration, results []checkResult, pools []pool, free map[string]space) []zabbixItem {
+	items := []zabbixItem{{Host: host, Key: zabbixKeyRunTime, Value: seconds(elapsed), Clock: now.Unix()}}
+	add := func(format, name, value string) {
+		items = append(items, zabbixItem{Host: host, Key: fmt.Sprintf(format, name), Value: value, Clock: now.Unix()})
+	}
+
+	for _, r := range results {
+		if r.skipped {
+			continue
+		}
+		if r.err == nil {
+			add(zabbixKeyCheck, r.name, "1")
+			add(zabbixKeyCheckMessage, r.name, "")
+		} else {
+			add(zabbixKeyCheck, r.name, "0")
+			add(zabbixKeyCheckMessage, r.name, r.err.Error())
+		}
+		add(zabbixKeyCheckTime, r.name, seconds(r.duration))
+	}
+	for _, p := range pools {
+		add(zabbixKeyPoolState, p.name, string(p.state))
+		if p.Health() {
+			add(zabbixKeyPoolHealthy, p.name, "1")
+		} else {
+			add(zabbixKeyPoolHealthy, p.name, "0")
+		}
+	}
+	for _, name := range diskUsagePools {
+		if f, ok := free[name]; ok {
+			add(zabbixKeyPoolUsed, name, strconv.FormatUint(f.used, 10))
+			add(zabbixKeyPoolFree, name, strconv.FormatUint(f.avail, 10))
+			add(zabbixKeyPoolFull, name, strconv.FormatFloat(f.percent(), 'f', 1, 64))
+		}
+	}
+
+	return items
+}
+
+// seconds formats d for a numeric zabbix item, to the millisecond
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// zabbixPacket frames a JSON payload with the ZBXD header
+func zabbixPacket(payload any) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("ZBXD\x01")
+	_ = binary.Write(&buf, binary.LittleEndian, uint64(len(data)))
+	buf.Write(data)
+	return buf.Bytes(), nil
+}
+
+func readZabbixPacket(r io.Reader, v any) error {
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if string(header[:4]) != "ZBXD" {
+		return errors.New("invalid zabbix response header")
+	}
+	length := binary.LittleEndian.Uint64(header[5:])
+	if length > 1<<20 {
+		return fmt.Errorf("zabbix response too large: %d bytes", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
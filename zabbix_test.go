@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_zabbixItems(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolSample3.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+
+	now := time.Unix(1711928165, 0)
+	results := []checkResult{
+		{name: "pool status", err: errors.New("pool primarySafe - DEGRADED")},
+		{name: "disk usage", duration: 250 * time.Millisecond},
+	}
+	items := zabbixItems("nas", now, 95*time.Second, results, pools, map[string]space{"primarySafe": {avail: 17716740096}})
+
+	values := make(map[string]string)
+	for _, item := range items {
+		assert.Equal(t, "nas", item.Host)
+		assert.Equal(t, now.Unix(), item.Clock)
+		values[item.Key] = item.Value
+	}
+	assert.Equal(t, map[string]string{
+		"zfsheartbeat.run.duration":                "95.000",
+		"zfsheartbeat.check[pool status]":          "0",
+		"zfsheartbeat.check.message[pool status]":  "pool primarySafe - DEGRADED",
+		"zfsheartbeat.check[disk usage]":           "1",
+		"zfsheartbeat.check.message[disk usage]":   "",
+		"zfsheartbeat.check.duration[pool status]": "0.000",
+		"zfsheartbeat.check.duration[disk usage]":  "0.250",
+		"zfsheartbeat.pool.state[freenas-boot]":    "ONLINE",
+		"zfsheartbeat.pool.healthy[freenas-boot]":  "1",
+		"zfsheartbeat.pool.state[primarySafe]":     "DEGRADED",
+		"zfsheartbeat.pool.healthy[primarySafe]":   "0",
+		"zfsheartbeat.pool.used[primarySafe]":      "0",
+		"zfsheartbeat.pool.free[primarySafe]":      "17716740096",
+		"zfsheartbeat.pool.full[primarySafe]":      "0.0",
+	}, values)
+}
+
+func Test_zabbixPacket(t *testing.T) {
+	t.Parallel()
+
+	packet, err := zabbixPacket(zabbixResponse{Response: "success", Info: "processed: 9; failed: 0; total: 9; seconds spent: 0.000055"})
+	require.NoError(t, err)
+	assert.Equal(t, "ZBXD\x01", string(packet[:5]))
+
+	var resp zabbixResponse
+	require.NoError(t, readZabbixPacket(bytes.NewReader(packet), &resp))
+	assert.Equal(t, "success", resp.Response)
+}
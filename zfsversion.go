@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// zfsVersion is the OpenZFS release zpool reports, which decides a few details of how its output is read
+type zfsVersion struct {
+	major int
+	minor int
+}
+
+// legacyZFS is assumed when zpool version isn't supported, which it wasn't before 0.8
+var legacyZFS = zfsVersion{major: 0, minor: 7}
+
+// parseZFSVersion reads the userland version from zpool version, eg "zfs-2.2.3-1" or "zfs-2.1.4-FreeBSD_g52bad4f23"
+func parseZFSVersion(out string) (zfsVersion, error) {
+	var v zfsVersion
+	line := firstLine(out)
+	if _, err := fmt.Sscanf(strings.TrimPrefix(line, "zfs-"), "%d.%d", &v.major, &v.minor); err != nil {
+		return v, fmt.Errorf("unrecognized zpool version %q: %w", line, err)
+	}
+	return v, nil
+}
+
+// detectZFSVersion asks zpool which OpenZFS it is, falling back to legacyZFS if it doesn't know
+func detectZFSVersion(e executer) zfsVersion {
+	v := legacyZFS
+	if out, err := e("/sbin/zpool", "version"); err == nil {
+		if parsed, err := parseZFSVersion(out); err == nil {
+			v = parsed
+		}
+	}
+	return v
+}
+
+func (v zfsVersion) atLeast(major, minor int) bool {
+	return v.major > major || v.major == major && v.minor >= minor
+}
+
+// statusArgs are the arguments to zpool status: trim status (-t) arrived in 0.8
+func (v zfsVersion) statusArgs() []string {
+	if v.atLeast(0, 8) {
+		return []string{"status", "-t"}
+	}
+	return []string{"status"}
+}
+
+func (v zfsVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
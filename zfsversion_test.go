@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseZFSVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		out     string
+		version zfsVersion
+		err     bool
+	}{
+		{"zfs-2.2.3-1\nzfs-kmod-2.2.3-1\n", zfsVersion{major: 2, minor: 2}, false},
+		{"zfs-2.1.4-FreeBSD_g52bad4f23\nzfs-kmod-2.1.4-FreeBSD_g52bad4f23\n", zfsVersion{major: 2, minor: 1}, false},
+		{"zfs-0.8.6-1\nzfs-kmod-0.8.6-1\n", zfsVersion{major: 0, minor: 8}, false},
+		{"unrecognized command 'version'\n", zfsVersion{}, true},
+	}
+
+	for _, tt := range tests {
+		v, err := parseZFSVersion(tt.out)
+		if tt.err {
+			assert.Error(t, err, tt.out)
+			continue
+		}
+		require.NoError(t, err, tt.out)
+		assert.Equal(t, tt.version, v, tt.out)
+	}
+}
+
+func Test_zfsVersionStatusArgs(t *testing.T) {
+	t.Parallel()
+
+	legacy := func(cmd string, args ...string) (string, error) { return "", errors.New("exit status 2") }
+	assert.Equal(t, []string{"status"}, detectZFSVersion(legacy).statusArgs())
+	assert.Equal(t, []string{"status", "-t"}, zfsVersion{major: 0, minor: 8}.statusArgs())
+	assert.Equal(t, []string{"status", "-t"}, zfsVersion{major: 2, minor: 2}.statusArgs())
+}
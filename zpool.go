@@ -2,29 +2,111 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type pool struct {
 	name       string
-	state      string
+	state      deviceState
 	status     string
 	scanStatus string
+	removal    string // remove: section, for a device evacuation
+	checkpoint string // checkpoint: section, eg "created Tue Apr  2 10:00:01 2024, consumes 1.20G"
+	expansion  string // expand: section, for a raidz expansion
 	read       int
 	write      int
 	checksum   int
 	vdevs      []vdev
 	errors     string
+	features   []string // supported features not yet enabled, from zpool upgrade
+	autotrim   string   // autotrim property, on or off
 }
 
+// Health is true if Evaluate finds nothing wrong with p
 func (p pool) Health() bool {
-	healthy := p.state == "ONLINE" && p.read == 0 && p.write == 0 && p.checksum == 0 && p.errors == "errors: No known data errors"
+	return p.Evaluate().Healthy()
+}
+
+// LastScrub returns when the most recent scrub completed
+func (p pool) LastScrub() (time.Time, bool) {
+	_, on, found := strings.Cut(p.scanStatus, " errors on ")
+	if !found || !strings.HasPrefix(p.scanStatus, "scrub repaired") {
+		return time.Time{}, false
+	}
+	t, err := parseCommandTime(strings.TrimSpace(strings.Split(on, "\n")[0]))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// LastTrim returns when every disk in p that supports trim was last fully trimmed. ssd is false if no disk supports trim, and last is zero if a disk has never been trimmed.
+func (p pool) LastTrim() (last time.Time, running, ssd bool) {
+	first := true
 	for _, v := range p.vdevs {
-		healthy = healthy && v.Healthy()
+		for _, d := range v.disks {
+			if d.trim == nil || !d.trim.supported {
+				continue
+			}
+			ssd = true
+			if d.trim.running {
+				running = true
+				continue
+			}
+			if first || d.trim.at.Before(last) {
+				last = d.trim.at
+				first = false
+			}
+		}
 	}
-	return healthy
+	return last, running, ssd
+}
+
+// Upgradable is true if zpool status says the pool doesn't have every supported feature enabled
+func (p pool) Upgradable() bool {
+	return strings.Contains(p.status, "Some supported") && strings.Contains(p.status, "features are not enabled")
+}
+
+// parseUpgradable reads the features each pool is missing from the output of zpool upgrade
+func parseUpgradable(out string) map[string][]string {
+	features := make(map[string][]string)
+	var inList bool
+	var poolName string
+	for _, line := range strings.Split(out, "\n") {
+		switch {
+		case strings.HasPrefix(line, "---"):
+			inList = true
+		case !inList:
+		case strings.TrimSpace(line) == "":
+			inList = false
+		case line[0] == ' ' || line[0] == '\t':
+			features[poolName] = append(features[poolName], strings.TrimSpace(line))
+		default:
+			poolName = strings.TrimSpace(line)
+		}
+	}
+	return features
+}
+
+// Checkpoint returns when p's checkpoint was created and the bytes it holds, if p has one
+func (p pool) Checkpoint() (created time.Time, size uint64, ok bool) {
+	on, consumes, found := strings.Cut(strings.TrimPrefix(p.checkpoint, "created "), ", consumes ")
+	if !found {
+		return time.Time{}, 0, false
+	}
+	created, err := parseCommandTime(on)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	size, _ = parseSize(consumes)
+	return created, size, true
 }
 
 func (p pool) String() string {
@@ -33,27 +115,19 @@ func (p pool) String() string {
 
 type vdev struct {
 	name     string
-	state    string
+	state    deviceState
 	typev    vdevType
 	disks    []vdevDisk
 	read     int
 	write    int
 	checksum int
+
+	class string // logs, cache, special, or dedup for special purpose vdevs
 }
 
+// Healthy is true if Evaluate finds nothing wrong with v
 func (v vdev) Healthy() bool {
-	var healthy bool
-	switch v.typev {
-	case vdevTypeSpare:
-		healthy = true
-	default:
-		healthy = v.state == "ONLINE" && v.read == 0 && v.write == 0 && v.checksum == 0
-	}
-	for _, d := range v.disks {
-		healthy = healthy && d.Healthy()
-	}
-
-	return healthy
+	return v.Evaluate().Healthy()
 }
 
 func (v vdev) String() string {
@@ -61,22 +135,63 @@ func (v vdev) String() string {
 }
 
 type vdevDisk struct {
-	vdev     *vdev
-	name     string
-	state    string
-	read     int
-	write    int
-	checksum int
-	message  string
+	vdev      *vdev
+	name      string
+	state     deviceState
+	read      int
+	write     int
+	checksum  int
+	message   string
+	trim      *trimStatus // from zpool status -t
+	replacing string      // the replacing-N group the disk is in while zpool replace resilvers it
+	spare     string      // the spare-N group the disk is in while a hot spare stands in for it
 }
 
-func (d vdevDisk) Healthy() bool {
-	switch d.vdev.typev {
-	case vdevTypeSpare:
-		return d.state == "AVAIL"
+// trimStatus is the trim state zpool status -t reports for a disk
+type trimStatus struct {
+	supported bool
+	percent   int
+	running   bool
+	at        time.Time // when the last trim completed, or the current one started
+}
+
+// parseTrim splits the trim status zpool status -t appends to a disk line from the rest of the message,
+// eg "(untrimmed)", "(trim unsupported)", or "(100% trimmed, completed at Sun Mar 10 02:00:00 2024)"
+func parseTrim(message string) (string, *trimStatus) {
+	// the trim status is the last parenthesized part of the line. It's read by hand rather than with a regexp, since every disk line goes through here
+	i := strings.LastIndexByte(message, '(')
+	if i < 0 || !strings.HasSuffix(message, ")") {
+		return message, nil
+	}
+	inner := message[i+1 : len(message)-1]
+
+	t := &trimStatus{supported: true}
+	switch inner {
+	case "untrimmed":
+	case "trim unsupported":
+		t.supported = false
 	default:
-		return d.state == "ONLINE" && d.read == 0 && d.write == 0 && d.checksum == 0 && d.message == ""
+		percent, rest, ok := strings.Cut(inner, "% trimmed, ")
+		if !ok {
+			return message, nil
+		}
+		verb, at, ok := strings.Cut(rest, " at ")
+		if !ok || verb != "completed" && verb != "started" || at == "" {
+			return message, nil
+		}
+		var err error
+		if t.percent, err = strconv.Atoi(percent); err != nil {
+			return message, nil
+		}
+		t.running = verb == "started"
+		t.at, _ = parseCommandTime(at)
 	}
+	return strings.TrimSpace(message[:i]), t
+}
+
+// Healthy is true if Evaluate finds nothing wrong with d
+func (d vdevDisk) Healthy() bool {
+	return d.Evaluate().Healthy()
 }
 
 func (d vdevDisk) String() string {
@@ -92,172 +207,335 @@ type vdevType int
 
 const (
 	vdevTypeNone  = iota
-	vdevTypeRaidz = iota
+	vdevTypeRaidz = iota // mirror, raidz, or draid
 	vdevTypeSpare = iota
+	vdevTypeDisk  = iota // a disk on its own, eg a striped disk or a cache device
 )
 
+// vdevRe matches the names zpool status gives to redundant vdevs
+var vdevRe = regexp.MustCompile(`^(mirror|raidz\d?|draid\d?)[-:]`)
+
+// isState is true if s looks like a device state, eg ONLINE, FAULTED, or AVAIL
+func isState(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// vdevClasses are the headings zpool status lists special purpose vdevs under
+var vdevClasses = []string{"logs", "cache", "spares", "special", "dedup"}
+
 type zpoolParseState int
 
 const (
 	zpoolParseStart zpoolParseState = iota
 	zpoolParseStatus
 	zpoolParseScan
-	zpoolParsePool
-	zpoolParseVdev
-	zpoolParseDisk
+	zpoolParseHeader
+	zpoolParseConfig
 	zpoolParseErrors
+	zpoolParseDedup
 )
 
-var diskRe = regexp.MustCompile(`^\s+(\w{8}-\w{4}-\w{4}-\w{4}-\w{12}\s+|nvme\w+|(\w+\s+){2}(\s+\d+){3}\s+\w+)`)
-var diskMessageRe = regexp.MustCompile(`(?:(?:\d+\s+){3}|^\w+\s+[A-Z]+\s+)(.+)$`)
+// zpoolParser reads zpool status a line at a time
+type zpoolParser struct {
+	state    zpoolParseState
+	pools    []pool
+	warnings []error
+	line     int
+
+	heading    string // status, action, or see, which a paragraph continues onto the following lines
+	nameColumn int    // where the NAME column starts; each level of the device tree is indented 2 more
+	class      string // logs, cache, spares, special, or dedup while their devices are listed
+	group      string // replacing-N or spare-N group the following disks are in
+	groupDepth int
+	errorFiles int // files with permanent errors listed for the current pool
+}
+
+// zpoolErrorFiles is how many of the files with permanent errors are kept for each pool. A badly damaged pool can list thousands
+const zpoolErrorFiles = 50
 
+// parsePools reads the output of zpool status. A line it doesn't understand is skipped with a warning (returned as the error) rather than losing every pool, so check pools even when err isn't nil.
 func parsePools(zpoolStatus string) ([]pool, error) {
-	var pools []pool
+	return parsePoolsReader(strings.NewReader(zpoolStatus))
+}
 
-	scanner := bufio.NewScanner(strings.NewReader(zpoolStatus))
-	var parseState zpoolParseState
+// parsePoolsReader is parsePools for output that's still being read, so it never has to be held in memory all at once
+func parsePoolsReader(r io.Reader) ([]pool, error) {
+	var parser zpoolParser
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
 	for scanner.Scan() {
-		line := scanner.Text()
-
-		newPool, err := parsePoolState(pools, scanner, line, &parseState)
-		if err != nil {
-			return nil, err
-		}
-		if newPool != nil {
-			pools = append(pools, *newPool)
-		}
+		parser.parseLine(scanner.Text())
 	}
-
-	return pools, nil
+	parser.finishPool()
+	if err := scanner.Err(); err != nil {
+		parser.warnings = append(parser.warnings, err)
+	}
+	return parser.pools, errors.Join(parser.warnings...)
 }
 
-func parsePoolState(pools []pool, scanner *bufio.Scanner, line string, parseState *zpoolParseState) (*pool, error) {
-	var p *pool
-	if len(pools) > 0 {
-		p = &pools[len(pools)-1]
+func (z *zpoolParser) parseLine(line string) {
+	z.line++
+	if err := z.parse(line); err != nil {
+		z.warnings = append(z.warnings, fmt.Errorf("zpool status line %d: %w: '%s'", z.line, err, line))
 	}
+}
 
-	switch *parseState {
-	case zpoolParseStart:
-		var p pool
-
-		if _, err := fmt.Sscanf(line, " pool: %s", &p.name); err != nil {
-			return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
+func (z *zpoolParser) parse(line string) error {
+	trimmedLine := strings.TrimSpace(line)
+	if name, ok := strings.CutPrefix(trimmedLine, "pool: "); ok {
+		z.finishPool()
+		z.pools = append(z.pools, pool{name: name})
+		z.state = zpoolParseStatus
+		z.heading, z.class, z.group = "", "", ""
+		z.errorFiles = 0
+		return nil
+	}
+	if len(z.pools) == 0 {
+		if trimmedLine == "" || trimmedLine == "no pools available" {
+			return nil
 		}
+		return errors.New("expected a pool")
+	}
+	p := &z.pools[len(z.pools)-1]
 
-		*parseState++
-		return &p, nil
+	switch z.state {
 	case zpoolParseStatus:
-		trimmedLine := strings.TrimSpace(line)
 		switch {
-		case strings.HasPrefix(trimmedLine, "scan: "):
-			*parseState = zpoolParseScan
-			return parsePoolState(pools, scanner, line, parseState)
-		case strings.HasPrefix(trimmedLine, "action: "):
-			return nil, nil
+		case strings.HasPrefix(trimmedLine, "scan: "), strings.HasPrefix(trimmedLine, "remove: "), strings.HasPrefix(trimmedLine, "checkpoint: "), strings.HasPrefix(trimmedLine, "expand: "), trimmedLine == "config:":
+			z.state = zpoolParseScan
+			return z.parse(line)
 		case strings.HasPrefix(trimmedLine, "status: "):
+			z.heading = "status"
 			p.status = trimmedLine
 		case strings.HasPrefix(trimmedLine, "state: "):
-			if _, err := fmt.Sscanf(trimmedLine, "state: %s", &p.state); err != nil {
-				return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
-			}
-		default:
-			p.status += " " + line
+			p.state = deviceState(strings.TrimPrefix(trimmedLine, "state: "))
+		case strings.HasPrefix(trimmedLine, "action: "), strings.HasPrefix(trimmedLine, "see: "):
+			z.heading, _, _ = strings.Cut(trimmedLine, ":")
+		case z.heading == "status":
+			p.status += " " + trimmedLine
 		}
 	case zpoolParseScan:
-		if strings.HasPrefix(strings.TrimSpace(line), "config:") {
-			*parseState++
-			scanner.Scan() // newline
-			scanner.Scan() // pool headers
-			return nil, nil
+		// scan is followed by optional remove, checkpoint, and expand sections, each of which may continue onto more lines
+		switch {
+		case trimmedLine == "config:":
+			z.state = zpoolParseHeader
+		case strings.HasPrefix(trimmedLine, "scan: "):
+			p.scanStatus = strings.TrimPrefix(trimmedLine, "scan: ")
+		case strings.HasPrefix(trimmedLine, "remove: "):
+			p.removal = strings.TrimPrefix(trimmedLine, "remove: ")
+		case strings.HasPrefix(trimmedLine, "checkpoint: "):
+			p.checkpoint = strings.TrimPrefix(trimmedLine, "checkpoint: ")
+		case strings.HasPrefix(trimmedLine, "expand: "):
+			p.expansion = strings.TrimPrefix(trimmedLine, "expand: ")
+		case p.expansion != "":
+			p.expansion += "\n" + trimmedLine
+		case p.checkpoint != "":
+			p.checkpoint += "\n" + trimmedLine
+		case p.removal != "":
+			p.removal += "\n" + trimmedLine
+		default:
+			p.scanStatus += "\n" + trimmedLine
 		}
-
-		if p.scanStatus == "" {
-			if _, err := fmt.Sscanf(line, " scan: %s", &p.scanStatus); err != nil {
-				return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
-			}
-		} else {
-			p.scanStatus += "\n" + strings.TrimSpace(line)
+	case zpoolParseHeader:
+		name, _ := cutField(trimmedLine)
+		switch name {
+		case "":
+		case "NAME":
+			z.nameColumn = column(line)
+			z.state = zpoolParseConfig
+		case p.name:
+			// no header, but the pool's line tells us where the NAME column is
+			z.nameColumn = column(line)
+			z.state = zpoolParseConfig
+			return z.parse(line)
+		default:
+			return errors.New("expected the NAME STATE READ WRITE CKSUM header")
 		}
-	case zpoolParsePool:
-		var name string
-		var state string
-		if _, err := fmt.Sscanf(line, " %s %s %d %d %d", &name, &state, &p.read, &p.write, &p.checksum); err != nil {
-			return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
+	case zpoolParseConfig:
+		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "errors: ") {
+			z.state = zpoolParseErrors
+			return z.parse(line)
 		}
-		if name != p.name {
-			return nil, fmt.Errorf("expected pool name %s to match name %s", name, p.name)
+		return z.parseDevice(p, line)
+	case zpoolParseErrors:
+		switch {
+		case trimmedLine == "":
+		case strings.HasPrefix(trimmedLine, "errors: "):
+			p.errors = trimmedLine
+		case strings.HasPrefix(trimmedLine, "dedup: "):
+			// zpool status -D follows with the dedup table, which parseDDT reads
+			z.state = zpoolParseDedup
+		case p.errors != "" && line != trimmedLine:
+			// the files with permanent errors are listed indented below the errors line
+			if z.errorFiles++; z.errorFiles <= zpoolErrorFiles {
+				p.errors += "\n" + trimmedLine
+			}
+		default:
+			return errors.New("unexpected line after the device list")
 		}
-		if state != p.state {
-			return nil, fmt.Errorf("expected pool state %s to match state %s", state, p.state)
+	case zpoolParseDedup:
+		if strings.HasPrefix(trimmedLine, "errors: ") {
+			z.state = zpoolParseErrors
+			return z.parse(line)
 		}
+	}
 
-		*parseState++
-	case zpoolParseVdev:
-		p.vdevs = append(p.vdevs, vdev{})
-		v := &p.vdevs[len(p.vdevs)-1]
+	return nil
+}
 
-		switch {
-		case strings.Contains(line, "mirror-"):
-			fallthrough
-		case strings.Contains(line, "raidz"):
-			v.typev = vdevTypeRaidz
-			if _, err := fmt.Sscanf(line, " %s %s %d %d %d", &v.name, &v.state, &v.read, &v.write, &v.checksum); err != nil {
-				return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
-			}
-		case strings.Contains(line, "spares"):
-			v.typev = vdevTypeSpare
-			if _, err := fmt.Sscanf(line, " %s", &v.name); err != nil {
-				return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
-			}
-		}
+// finishPool notes how many errored files were left out of the current pool's errors
+func (z *zpoolParser) finishPool() {
+	if len(z.pools) > 0 && z.errorFiles > zpoolErrorFiles {
+		p := &z.pools[len(z.pools)-1]
+		p.errors += fmt.Sprintf("\n...and %d more files", z.errorFiles-zpoolErrorFiles)
+	}
+}
 
-		*parseState++
-	case zpoolParseDisk:
-		if !diskRe.MatchString(line) {
-			switch {
-			case len(strings.TrimSpace(line)) == 0:
-				*parseState = zpoolParseErrors
-				return nil, nil
-			default:
-				*parseState = zpoolParseVdev
-				return parsePoolState(pools, scanner, line, parseState)
-			}
-		}
+// parseDevice reads one line of the device tree under config:, placing it by how far it's indented
+func (z *zpoolParser) parseDevice(p *pool, line string) error {
+	depth := (column(line) - z.nameColumn) / 2
+	d, err := parseDeviceLine(line)
+	if err != nil {
+		return err
+	}
 
+	switch {
+	case depth <= 0 && d.name == p.name:
+		if d.state != p.state {
+			return fmt.Errorf("expected pool state %s to match state %s", d.state, p.state)
+		}
+		p.read, p.write, p.checksum = d.read, d.write, d.checksum
+	case depth <= 0 && slices.Contains(vdevClasses, d.name):
+		z.class = d.name
+		if d.name == "spares" {
+			p.vdevs = append(p.vdevs, vdev{name: d.name, typev: vdevTypeSpare})
+		}
+	case depth <= 0:
+		return errors.New("expected pool " + p.name)
+	case depth == 1 && z.class == "spares":
 		v := &p.vdevs[len(p.vdevs)-1]
-		var disk vdevDisk
-		disk.vdev = v
-
-		switch v.typev {
-		case vdevTypeRaidz:
-			if _, err := fmt.Sscanf(line, " %s %s %d %d %d", &disk.name, &disk.state, &disk.read, &disk.write, &disk.checksum); err != nil {
-				return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
-			}
-		case vdevTypeSpare:
-			if _, err := fmt.Sscanf(line, " %s %s", &disk.name, &disk.state); err != nil {
-				return nil, fmt.Errorf("parse error (%d) %s: '%s'", parseState, err, line)
+		d.vdev = v
+		v.disks = append(v.disks, d)
+	case depth == 1 && isGroup(d.name):
+		// a striped disk being replaced, or with a hot spare standing in, is a group of its own. It's still one disk's worth of the pool, so it's a disk vdev
+		z.group, z.groupDepth = d.name, depth
+		p.vdevs = append(p.vdevs, vdev{name: d.name, state: d.state, class: z.class, read: d.read, write: d.write, checksum: d.checksum, typev: vdevTypeDisk})
+	case depth == 1:
+		z.group = ""
+		v := vdev{name: d.name, state: d.state, class: z.class, read: d.read, write: d.write, checksum: d.checksum, typev: vdevTypeRaidz}
+		if !vdevRe.MatchString(d.name) {
+			v.typev = vdevTypeDisk
+			v.disks = []vdevDisk{d}
+		}
+		p.vdevs = append(p.vdevs, v)
+		p.vdevs[len(p.vdevs)-1].relink()
+	case len(p.vdevs) == 0 || p.vdevs[len(p.vdevs)-1].typev != vdevTypeRaidz && (z.group == "" || z.groupDepth != 1):
+		return errors.New("expected a vdev")
+	case depth == 2 && isGroup(d.name):
+		// while zpool replace runs, or a hot spare stands in, the old and new disks are nested under a group
+		z.group, z.groupDepth = d.name, depth
+	default:
+		v := &p.vdevs[len(p.vdevs)-1]
+		if z.group != "" && depth > z.groupDepth {
+			if strings.HasPrefix(z.group, "replacing-") {
+				d.replacing = z.group
+			} else {
+				d.spare = z.group
 			}
+		} else {
+			z.group = ""
 		}
+		d.vdev = v
+		v.disks = append(v.disks, d)
+	}
+	return nil
+}
 
-		matches := diskMessageRe.FindStringSubmatch(line)
-		if len(matches) > 0 {
-			disk.message = matches[1]
-		}
+// isGroup is true for the replacing-N and spare-N groups zpool status nests disks under
+func isGroup(name string) bool {
+	return strings.HasPrefix(name, "replacing-") || strings.HasPrefix(name, "spare-")
+}
 
-		v.disks = append(v.disks, disk)
-	case zpoolParseErrors:
-		if len(strings.TrimSpace(line)) == 0 {
-			*parseState = zpoolParseStart
-			return nil, nil
-		}
+// relink points v's disks back at it, after v was copied into its pool
+func (v *vdev) relink() {
+	for i := range v.disks {
+		v.disks[i].vdev = v
+	}
+}
 
-		if p.errors == "" {
-			p.errors = line
-		} else {
-			p.errors = "\n" + line
+// parseDeviceLine reads a device's name, state, error counts, and any message, eg "sdb  FAULTED  23  0  0  too many errors". Spares have no error counts.
+func parseDeviceLine(line string) (vdevDisk, error) {
+	var d vdevDisk
+	var state, rest string
+	d.name, rest = cutField(line)
+	state, rest = cutField(rest)
+	if state == "" {
+		return d, nil
+	}
+	if !isState(state) {
+		return d, fmt.Errorf("unknown device state %q", state)
+	}
+	d.state = deviceState(state)
+
+	counts := rest
+	var fields [3]string
+	for i := range fields {
+		fields[i], counts = cutField(counts)
+	}
+	var err error
+	if d.read, err = parseCount(fields[0]); err == nil {
+		if d.write, err = parseCount(fields[1]); err != nil {
+			return d, err
+		}
+		if d.checksum, err = parseCount(fields[2]); err != nil {
+			return d, err
 		}
+		rest = counts
 	}
+	d.message, d.trim = parseTrim(rest)
+	return d, nil
+}
 
-	return nil, nil
+// parseCount reads an error count, which zpool abbreviates once it's large, eg 1.20K
+func parseCount(s string) (int, error) {
+	// almost every count is a plain number
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return n, nil
+	}
+	n, err := parseSize(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad error count %q", s)
+	}
+	return int(n), nil
+}
+
+// cutField splits the first whitespace separated field from s
+func cutField(s string) (field, rest string) {
+	s = strings.TrimLeft(s, " \t")
+	i := strings.IndexAny(s, " \t")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimLeft(s[i:], " \t")
+}
+
+// column is where the text on line starts, counting a tab as 8 columns
+func column(line string) int {
+	col := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			col++
+		case '\t':
+			col += 8 - col%8
+		default:
+			return col
+		}
+	}
+	return col
 }
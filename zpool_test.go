@@ -0,0 +1,161 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testFiles/golden")
+
+// zpoolCorpus is every zpool status output in testFiles
+func zpoolCorpus(t testing.TB) []string {
+	files, err := filepath.Glob("testFiles/zpool*.txt")
+	require.NoError(t, err)
+	files = append(files, "testFiles/scrubSample.txt")
+	// zpool upgrade output, not zpool status
+	return slices.DeleteFunc(files, func(f string) bool { return f == "testFiles/zpoolUpgrade.txt" })
+}
+
+// dumpPools renders everything parsePools read, to compare against a golden file
+func dumpPools(pools []pool, err error) string {
+	var b strings.Builder
+	for _, p := range pools {
+		fmt.Fprintf(&b, "%s\n", p)
+		fmt.Fprintf(&b, "  status: %q\n  scan: %q\n", p.status, p.scanStatus)
+		for _, v := range p.vdevs {
+			fmt.Fprintf(&b, "  %s type=%d class=%q healthy=%t\n", v, v.typev, v.class, v.Healthy())
+			for _, d := range v.disks {
+				fmt.Fprintf(&b, "    %s replacing=%q healthy=%t\n", d, d.replacing, d.Healthy())
+			}
+		}
+		fmt.Fprintf(&b, "  healthy=%t\n", p.Health())
+	}
+	if err != nil {
+		fmt.Fprintf(&b, "warnings:\n%s\n", err)
+	}
+	return b.String()
+}
+
+func Test_parsePoolsGolden(t *testing.T) {
+	t.Parallel()
+
+	for _, file := range zpoolCorpus(t) {
+		data, err := os.ReadFile(file)
+		require.NoError(t, err)
+		got := dumpPools(parsePools(string(data)))
+
+		golden := filepath.Join("testFiles", "golden", strings.TrimSuffix(filepath.Base(file), ".txt")+".golden")
+		if *updateGolden {
+			require.NoError(t, os.MkdirAll(filepath.Dir(golden), 0o755))
+			require.NoError(t, os.WriteFile(golden, []byte(got), 0o644))
+			continue
+		}
+		want, err := os.ReadFile(golden)
+		require.NoError(t, err, "run go test -run Test_parsePoolsGolden -update to create it")
+		assert.Equal(t, string(want), got, file)
+	}
+}
+
+func Test_parsePoolsWarnings(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zpoolUnknownLine.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	assert.EqualError(t, err, `zpool status line 11: unknown device state "a": '`+"\t"+`    ???     a line from some future zpool'`)
+	require.Len(t, pools, 2)
+	assert.Len(t, pools[0].vdevs, 2)
+	assert.Equal(t, "backup", pools[1].name)
+	assert.True(t, pools[1].Health())
+
+	pools, err = parsePools("garbage\n")
+	assert.Error(t, err)
+	assert.Empty(t, pools)
+}
+
+func Test_parsePoolsStripeGroup(t *testing.T) {
+	t.Parallel()
+
+	// replacing-0 is directly under the pool, since the disk it replaces isn't in a mirror or raidz
+	data, err := os.ReadFile("testFiles/zpoolReplacingStripe.txt")
+	require.NoError(t, err)
+	pools, err := parsePools(string(data))
+	require.NoError(t, err)
+	require.Len(t, pools, 1)
+	require.Len(t, pools[0].vdevs, 3)
+	group := pools[0].vdevs[0]
+	assert.Equal(t, "replacing-0", group.name)
+	assert.Equal(t, "disk", group.kind())
+	require.Len(t, group.disks, 2)
+	for _, d := range group.disks {
+		assert.Equal(t, "replacing-0", d.replacing, d.name)
+		assert.Equal(t, "replacing-0", d.vdev.name, d.name)
+	}
+	assert.Equal(t, "sdc", pools[0].vdevs[1].disks[0].name)
+	assert.Empty(t, pools[0].vdevs[1].disks[0].replacing)
+
+	pools, err = parsePools(strings.Replace(string(data), "replacing-0", "spare-0    ", 1))
+	require.NoError(t, err)
+	assert.Equal(t, "spare-0", pools[0].vdevs[0].disks[1].spare)
+}
+
+func FuzzParsePools(f *testing.F) {
+	for _, file := range zpoolCorpus(f) {
+		data, err := os.ReadFile(file)
+		require.NoError(f, err)
+		f.Add(string(data))
+	}
+
+	f.Fuzz(func(t *testing.T, status string) {
+		pools, _ := parsePools(status)
+		assert.LessOrEqual(t, len(pools), strings.Count(status, "pool: "))
+		for _, p := range pools {
+			_ = p.Health()
+			for _, v := range p.vdevs {
+				for _, d := range v.disks {
+					_ = d.String()
+				}
+			}
+		}
+	})
+}
+
+// largeZpoolStatus is zpool status for a big JBOD: pools of raidz2 vdevs, each with a spare, some disks trimmed and some in error
+func largeZpoolStatus(pools, vdevs, width int) string {
+	var b strings.Builder
+	for p := 0; p < pools; p++ {
+		name := fmt.Sprintf("tank%d", p)
+		fmt.Fprintf(&b, "  pool: %s\n state: ONLINE\n  scan: scrub repaired 0B in 11:12:07 with 0 errors on Sun Mar 10 11:12:09 2024\nconfig:\n\n", name)
+		fmt.Fprintf(&b, "\tNAME                                      STATE     READ WRITE CKSUM\n\t%-40s  ONLINE       0     0     0\n", name)
+		for v := 0; v < vdevs; v++ {
+			fmt.Fprintf(&b, "\t  raidz2-%-32d  ONLINE       0     0     0\n", v)
+			for d := 0; d < width; d++ {
+				fmt.Fprintf(&b, "\t    wwn-0x5000c500%08x%-14s  ONLINE       0     0     %d  (100%% trimmed, completed at Sun Mar 10 02:00:00 2024)\n", p<<16|v<<8|d, "", d%2)
+			}
+		}
+		fmt.Fprintf(&b, "\tspares\n\t  wwn-0x5000c500%08x%-16s  AVAIL\n\nerrors: No known data errors\n\n", p<<16|0xffff, "")
+	}
+	return b.String()
+}
+
+func BenchmarkParsePools(b *testing.B) {
+	status := largeZpoolStatus(4, 8, 12)
+	pools, err := parsePools(status)
+	require.NoError(b, err)
+	require.Len(b, pools, 4)
+	b.SetBytes(int64(len(status)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		parsePools(status)
+	}
+}
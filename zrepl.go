@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// zreplStatus is the part of `zrepl status --mode raw` we look at
+type zreplStatus struct {
+	Jobs map[string]struct {
+		Type        string
+		JobSpecific struct {
+			Replication *struct {
+				Attempts []zreplAttempt
+			}
+		}
+	}
+}
+
+// zreplAttempt is one attempt at a replication run
+type zreplAttempt struct {
+	State       string // planning, planning-error, fan-out-filesystems, filesystem-error, or done
+	StartAt     time.Time
+	FinishAt    time.Time
+	PlanError   *zreplError
+	Filesystems []struct {
+		Info struct {
+			Name string
+		}
+		State     string
+		PlanError *zreplError
+		StepError *zreplError
+	}
+}
+
+type zreplError struct {
+	Err string
+}
+
+// checkZrepl reports replication jobs whose latest attempt failed or has been running longer than zreplStuckAfter
+func checkZrepl(e executer) error {
+	out, err := e("zrepl", "status", "--mode", "raw")
+	if err != nil {
+		return checkError{err}
+	}
+	var status zreplStatus
+	if err := json.Unmarshal([]byte(out), &status); err != nil {
+		return checkError{fmt.Errorf("parsing zrepl status: %w", err)}
+	}
+	return zreplProblems(status, time.Now())
+}
+
+func zreplProblems(status zreplStatus, now time.Time) error {
+	names := make([]string, 0, len(status.Jobs))
+	for name := range status.Jobs {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var errs []error
+	for _, name := range names {
+		replication := status.Jobs[name].JobSpecific.Replication
+		if replication == nil || len(replication.Attempts) == 0 {
+			continue // not a replicating job, or it hasn't run yet
+		}
+		attempt := replication.Attempts[len(replication.Attempts)-1]
+
+		switch attempt.State {
+		case "done":
+		case "planning-error":
+			msg := "unknown error"
+			if attempt.PlanError != nil {
+				msg = attempt.PlanError.Err
+			}
+			errs = append(errs, fmt.Errorf("zrepl job %s failed to plan replication: %s", name, msg))
+		case "filesystem-error":
+			for _, fs := range attempt.Filesystems {
+				switch {
+				case fs.PlanError != nil:
+					errs = append(errs, fmt.Errorf("zrepl job %s failed to replicate %s: %s", name, fs.Info.Name, fs.PlanError.Err))
+				case fs.StepError != nil:
+					errs = append(errs, fmt.Errorf("zrepl job %s failed to replicate %s: %s", name, fs.Info.Name, fs.StepError.Err))
+				}
+			}
+		default:
+			if now.Sub(attempt.StartAt) > zreplStuckAfter {
+				errs = append(errs, fmt.Errorf("zrepl job %s has been %s since %s", name, attempt.State, attempt.StartAt.Local().Format("Jan 2 15:04")))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
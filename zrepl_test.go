@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_checkZrepl(t *testing.T) {
+	t.Parallel()
+
+	data, err := os.ReadFile("testFiles/zreplStatus.json")
+	require.NoError(t, err)
+
+	e := func(cmd string, args ...string) (string, error) {
+		return string(data), nil
+	}
+	assert.Error(t, checkZrepl(e))
+
+	var status zreplStatus
+	e = func(cmd string, args ...string) (string, error) {
+		return "not json", nil
+	}
+	assert.ErrorAs(t, checkZrepl(e), new(checkError))
+
+	require.NoError(t, json.Unmarshal(data, &status))
+	now := time.Date(2024, time.April, 6, 12, 30, 0, 0, time.UTC)
+	assert.EqualError(t, zreplProblems(status, now), "zrepl job backup_local has been fan-out-filesystems since Apr 5 22:00\nzrepl job backup_offsite failed to replicate primarySafe/vms: receive: cannot receive incremental stream: destination has been modified")
+	assert.EqualError(t, zreplProblems(status, now.Add(-10*time.Hour)), "zrepl job backup_offsite failed to replicate primarySafe/vms: receive: cannot receive incremental stream: destination has been modified")
+}
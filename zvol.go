@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// zvol is the space a volume is provisioned with and using, in bytes
+type zvol struct {
+	name           string
+	volsize        uint64
+	refreservation uint64 // 0 for a sparse (thin provisioned) volume
+	used           uint64 // including snapshots and the refreservation
+	logical        uint64 // bytes the guest has written, before compression
+	avail          uint64 // space the volume can still grow into
+}
+
+// sparse is true if nothing is reserved for z, so it can only grow as long as its pool has room
+func (z zvol) sparse() bool {
+	return z.refreservation == 0
+}
+
+// growth is how much more z can grow before it's full
+func (z zvol) growth() uint64 {
+	if z.logical >= z.volsize {
+		return 0
+	}
+	return z.volsize - z.logical
+}
+
+// pool is the name of the pool z is on
+func (z zvol) pool() string {
+	name, _, _ := strings.Cut(z.name, "/")
+	return name
+}
+
+// readZvols lists every volume
+func readZvols(e executer) ([]zvol, error) {
+	out, err := e("zfs", "list", "-H", "-p", "-t", "volume", "-o", "name,volsize,refreservation,used,logicalreferenced,avail")
+	if err != nil {
+		return nil, checkError{err}
+	}
+
+	var zvols []zvol
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 6 {
+			return nil, checkError{fmt.Errorf("unexpected zfs list output: %q", line)}
+		}
+		z := zvol{name: fields[0]}
+		for i, v := range []*uint64{&z.volsize, &z.refreservation, &z.used, &z.logical, &z.avail} {
+			if fields[i+1] == "none" || fields[i+1] == "-" {
+				continue
+			}
+			if *v, err = strconv.ParseUint(fields[i+1], 10, 64); err != nil {
+				return nil, checkError{err}
+			}
+		}
+		zvols = append(zvols, z)
+	}
+	return zvols, nil
+}
+
+// checkZvols warns when a thick volume has less reserved than its size, or sparse volumes could grow past the free space in their pool
+func checkZvols(zvols []zvol) error {
+	var errs []error
+	growth := make(map[string]uint64)
+	avail := make(map[string]uint64)
+	count := make(map[string]int)
+	for _, z := range zvols {
+		if !z.sparse() {
+			if z.refreservation < z.volsize {
+				errs = append(errs, fmt.Errorf("zvol %s has %s reserved, less than its %s volsize", z.name, formatBytes(z.refreservation), formatBytes(z.volsize)))
+			}
+			continue
+		}
+		if z.growth() > z.avail {
+			errs = append(errs, fmt.Errorf("sparse zvol %s could still grow by %s, but only %s is available", z.name, formatBytes(z.growth()), formatBytes(z.avail)))
+		}
+		p := z.pool()
+		growth[p] += z.growth()
+		if a, ok := avail[p]; !ok || z.avail < a {
+			avail[p] = z.avail
+		}
+		count[p]++
+	}
+
+	pools := make([]string, 0, len(growth))
+	for p := range growth {
+		pools = append(pools, p)
+	}
+	sort.Strings(pools)
+	for _, p := range pools {
+		if count[p] > 1 && growth[p] > avail[p] {
+			errs = append(errs, fmt.Errorf("%d sparse zvols in pool %s could still grow by %s together, but only %s is available", count[p], p, formatBytes(growth[p]), formatBytes(avail[p])))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// zvolReports describes each volume for the weekly report
+func zvolReports(zvols []zvol) []zvolReport {
+	var reports []zvolReport
+	for _, z := range zvols {
+		reports = append(reports, zvolReport{Name: z.name, Size: formatBytes(z.volsize), Written: formatBytes(z.logical), Used: formatBytes(z.used), Sparse: z.sparse()})
+	}
+	return reports
+}
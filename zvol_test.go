@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readZvols(t *testing.T) {
+	t.Parallel()
+
+	e := func(cmd string, args ...string) (string, error) {
+		return "primarySafe/vms/win10\t107374182400\t110729625600\t118111600640\t42949672960\t17716740096\nprimarySafe/vms/scratch\t53687091200\tnone\t10737418240\t10737418240\t17716740096\n", nil
+	}
+	zvols, err := readZvols(e)
+	require.NoError(t, err)
+	assert.Equal(t, []zvol{
+		{name: "primarySafe/vms/win10", volsize: 107374182400, refreservation: 110729625600, used: 118111600640, logical: 42949672960, avail: 17716740096},
+		{name: "primarySafe/vms/scratch", volsize: 53687091200, used: 10737418240, logical: 10737418240, avail: 17716740096},
+	}, zvols)
+
+	r := heartbeatReport{Zvols: zvolReports(zvols)}
+	assert.Equal(t, "zvol primarySafe/vms/win10: 40.00 GiB of 100.00 GiB written, 110.00 GiB used\nzvol primarySafe/vms/scratch: 10.00 GiB of 50.00 GiB written, 10.00 GiB used (sparse)\n", r.String())
+
+	e = func(cmd string, args ...string) (string, error) {
+		return "", nil
+	}
+	zvols, err = readZvols(e)
+	require.NoError(t, err)
+	assert.Empty(t, zvols, "a system without volumes")
+}
+
+func Test_checkZvols(t *testing.T) {
+	t.Parallel()
+
+	const gib = 1 << 30
+	tests := []struct {
+		name  string
+		zvols []zvol
+		err   string
+	}{
+		{"thick", []zvol{{name: "tank/vm", volsize: 100 * gib, refreservation: 103 * gib, avail: 10 * gib}}, ""},
+		{"refreservation too small", []zvol{{name: "tank/vm", volsize: 100 * gib, refreservation: 50 * gib}}, "zvol tank/vm has 50.00 GiB reserved, less than its 100.00 GiB volsize"},
+		{"sparse fits", []zvol{{name: "tank/vm", volsize: 100 * gib, logical: 60 * gib, avail: 50 * gib}}, ""},
+		{"sparse overcommitted", []zvol{{name: "tank/vm", volsize: 100 * gib, logical: 10 * gib, avail: 50 * gib}}, "sparse zvol tank/vm could still grow by 90.00 GiB, but only 50.00 GiB is available"},
+		{"sparse overcommitted together", []zvol{
+			{name: "tank/a", volsize: 100 * gib, logical: 70 * gib, avail: 50 * gib},
+			{name: "tank/b", volsize: 100 * gib, logical: 70 * gib, avail: 50 * gib},
+			{name: "other/c", volsize: 100 * gib, logical: 70 * gib, avail: 50 * gib},
+		}, "2 sparse zvols in pool tank could still grow by 60.00 GiB together, but only 50.00 GiB is available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkZvols(tt.zvols)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}